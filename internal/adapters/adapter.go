@@ -13,3 +13,16 @@ type Adapter interface {
 	RemoveServers(context.Context, []string) error
 	ListServers(context.Context) (map[string]model.MCPServerSpec, error)
 }
+
+// EmptyPruner is implemented by adapters that can remove servers and, once
+// none are left, drop the servers key itself along with any parent objects
+// that become empty, rather than writing an empty object.
+type EmptyPruner interface {
+	RemoveServersPruneEmpty(context.Context, []string) error
+}
+
+// CommentedConfig is implemented by adapters whose config may hold comments.
+// They are read past, but a rewrite drops them.
+type CommentedConfig interface {
+	HasComments() bool
+}
@@ -22,6 +22,12 @@ func NewClaudeAdapter() (*ClaudeAdapter, error) {
 	if err != nil {
 		return nil, err
 	}
+	return newClaudeAdapter(backupDir)
+}
+
+// newClaudeAdapter builds the adapter with an explicit backup root; an empty
+// backupDir disables backups.
+func newClaudeAdapter(backupDir string) (*ClaudeAdapter, error) {
 	p, err := detectClaudeSettingsPath()
 	if err != nil {
 		return nil, err
@@ -32,6 +38,9 @@ func NewClaudeAdapter() (*ClaudeAdapter, error) {
 func (a *ClaudeAdapter) Name() string { return model.TargetClaude }
 func (a *ClaudeAdapter) Path() string { return a.path }
 
+// HasComments reports whether the config holds JSONC comments.
+func (a *ClaudeAdapter) HasComments() bool { return configHasComments(a.path) }
+
 func detectClaudeSettingsPath() (string, error) {
 	return paths.ExpandHome("~/.claude.json")
 }
@@ -44,14 +53,21 @@ func (a *ClaudeAdapter) UpsertServers(ctx context.Context, servers map[string]mo
 	}
 	mcp := claudeMCPServers(raw)
 	for name, spec := range servers {
-		mcp[name] = serverSpecToConfig(spec)
+		mcp[name] = serverSpecToConfig(preserveEnv(spec, mcp[name], configToServerSpec))
 	}
-	raw["mcpServers"] = mcp
-	delete(raw, "mcp_servers")
+	storeServers(raw, claudeServerKeys, claudeLegacyServerKeys, mcp)
 	return a.writeRaw(raw)
 }
 
 func (a *ClaudeAdapter) RemoveServers(ctx context.Context, names []string) error {
+	return a.removeServers(ctx, names, false)
+}
+
+func (a *ClaudeAdapter) RemoveServersPruneEmpty(ctx context.Context, names []string) error {
+	return a.removeServers(ctx, names, true)
+}
+
+func (a *ClaudeAdapter) removeServers(ctx context.Context, names []string, pruneEmpty bool) error {
 	_ = ctx
 	raw, err := a.readRaw()
 	if err != nil {
@@ -64,8 +80,11 @@ func (a *ClaudeAdapter) RemoveServers(ctx context.Context, names []string) error
 	for _, name := range names {
 		delete(mcp, name)
 	}
-	raw["mcpServers"] = mcp
-	delete(raw, "mcp_servers")
+	if pruneEmpty && len(mcp) == 0 {
+		dropServers(raw, claudeServerKeys, claudeLegacyServerKeys)
+	} else {
+		storeServers(raw, claudeServerKeys, claudeLegacyServerKeys, mcp)
+	}
 	return a.writeRaw(raw)
 }
 
@@ -93,12 +112,14 @@ func (a *ClaudeAdapter) ListServers(ctx context.Context) (map[string]model.MCPSe
 	return result, nil
 }
 
+var (
+	claudeServerKeys       = []string{"mcpServers"}
+	claudeLegacyServerKeys = [][]string{{"mcp_servers"}}
+)
+
 // claudeMCPServers reads servers from mcpServers (preferred) or mcp_servers (legacy).
 func claudeMCPServers(raw map[string]any) map[string]any {
-	if mcp, ok := toMap(raw["mcpServers"]); ok {
-		return mcp
-	}
-	if mcp, ok := toMap(raw["mcp_servers"]); ok {
+	if mcp := findServers(raw, claudeServerKeys, claudeLegacyServerKeys); mcp != nil {
 		return mcp
 	}
 	return map[string]any{}
@@ -115,13 +136,10 @@ func (a *ClaudeAdapter) readRaw() (map[string]any, error) {
 	if len(data) == 0 {
 		return map[string]any{}, nil
 	}
-	var raw map[string]any
-	if err := json.Unmarshal(data, &raw); err != nil {
+	raw, err := decodeConfigJSON(data)
+	if err != nil {
 		return nil, fmt.Errorf("decode claude settings JSON: %w", err)
 	}
-	if raw == nil {
-		raw = map[string]any{}
-	}
 	return raw, nil
 }
 
@@ -136,8 +154,10 @@ func (a *ClaudeAdapter) writeRaw(raw map[string]any) error {
 	if err := os.MkdirAll(filepath.Dir(a.path), 0o755); err != nil {
 		return fmt.Errorf("create claude settings dir: %w", err)
 	}
-	if _, err := fsutil.BackupFile(a.path, a.backupDir); err != nil {
-		return err
+	if a.backupDir != "" {
+		if _, err := fsutil.BackupFile(a.path, a.backupDir); err != nil {
+			return err
+		}
 	}
 	payload := append(data, '\n')
 	if err := fsutil.AtomicWriteFile(a.path, payload, 0o600); err != nil {
@@ -1,8 +1,12 @@
 package adapters
 
 import (
+	"fmt"
 	"os"
 	"runtime"
+	"slices"
+	"strings"
+	"sync"
 
 	"github.com/sarjann/mcper/internal/model"
 	"github.com/sarjann/mcper/internal/paths"
@@ -11,58 +15,151 @@ import (
 type clientDef struct {
 	target     string
 	label      string
-	detectDirs []string // dirs with ~ prefix to check for detection
-	configPath string   // config file path with ~ prefix
-	serverKeys []string // JSON key path to servers section
+	detectDirs []string   // dirs with ~ prefix to check for detection
+	configPath string     // config file path with ~ prefix
+	serverKeys []string   // JSON key path to servers section
+	legacyKeys [][]string // older server key paths read as fallbacks
 	toConfig   SpecToConfig
 	fromConfig ConfigToSpec
-	customNew  func() (Adapter, error) // for adapters with custom logic (Claude Code, Codex)
+	customNew  func(backupDir string) (Adapter, error) // for adapters with custom logic (Claude Code, Codex)
 }
 
 func (c clientDef) isDetected() bool {
+	_, ok := c.detectedDir()
+	return ok
+}
+
+// detectedDir returns the first detection directory that exists.
+func (c clientDef) detectedDir() (string, bool) {
 	for _, dir := range c.detectDirs {
 		expanded, err := paths.ExpandHome(dir)
 		if err != nil {
 			continue
 		}
 		if fi, err := os.Stat(expanded); err == nil && fi.IsDir() {
-			return true
+			return expanded, true
+		}
+	}
+	return "", false
+}
+
+func (c clientDef) probedDirs() []string {
+	out := make([]string, 0, len(c.detectDirs))
+	for _, dir := range c.detectDirs {
+		if expanded, err := paths.ExpandHome(dir); err == nil {
+			out = append(out, expanded)
+		} else {
+			out = append(out, dir)
 		}
 	}
-	return false
+	return out
 }
 
 func (c clientDef) createAdapter(backupDir string) (Adapter, error) {
 	if c.customNew != nil {
-		return c.customNew()
+		return c.customNew(backupDir)
 	}
 	expanded, err := paths.ExpandHome(c.configPath)
 	if err != nil {
 		return nil, err
 	}
-	return NewGenericJSONAdapter(c.target, expanded, backupDir, c.serverKeys, c.toConfig, c.fromConfig), nil
+	return NewGenericJSONAdapter(c.target, expanded, backupDir, c.serverKeys, c.toConfig, c.fromConfig).WithLegacyServerKeys(c.legacyKeys...), nil
+}
+
+// ClientDef describes a client added at runtime with RegisterClient. Most
+// clients keep servers in a JSON object and need only ConfigPath and
+// ServerKeys; New replaces the generic JSON adapter entirely.
+type ClientDef struct {
+	Target string
+	Label  string
+	// DetectDirs are checked for detection; a leading ~ is the home dir.
+	DetectDirs []string
+	ConfigPath string
+	// ServerKeys is the JSON key path to the servers object.
+	ServerKeys []string
+	// ToConfig and FromConfig convert server entries; nil uses the
+	// mcpServers-style defaults.
+	ToConfig   SpecToConfig
+	FromConfig ConfigToSpec
+	New        func(backupDir string) (Adapter, error)
 }
 
+var (
+	registeredMu      sync.RWMutex
+	registeredClients []clientDef
+)
+
+// RegisterClient adds a client alongside the built-in ones, so detection,
+// labels and --target all include it. Targets must be unique.
+func RegisterClient(def ClientDef) error {
+	if strings.TrimSpace(def.Target) == "" || def.Target == model.TargetAll || strings.ContainsAny(def.Target, ", ") {
+		return fmt.Errorf("invalid client target %q", def.Target)
+	}
+	if def.New == nil && (def.ConfigPath == "" || len(def.ServerKeys) == 0) {
+		return fmt.Errorf("client %q needs a config path and server keys, or its own adapter", def.Target)
+	}
+	label := def.Label
+	if label == "" {
+		label = def.Target
+	}
+	client := clientDef{
+		target:     def.Target,
+		label:      label,
+		detectDirs: def.DetectDirs,
+		configPath: def.ConfigPath,
+		serverKeys: def.ServerKeys,
+		toConfig:   def.ToConfig,
+		fromConfig: def.FromConfig,
+		customNew:  def.New,
+	}
+	// The check and the append share one critical section, so two callers
+	// registering the same target cannot both pass the check.
+	registeredMu.Lock()
+	defer registeredMu.Unlock()
+	taken := func(c clientDef) bool { return c.target == def.Target }
+	if slices.ContainsFunc(builtinClients(), taken) || slices.ContainsFunc(registeredClients, taken) {
+		return fmt.Errorf("client %q is already registered", def.Target)
+	}
+	registeredClients = append(registeredClients, client)
+	return nil
+}
+
+// UnregisterClient removes a client added with RegisterClient. Built-in
+// clients cannot be removed.
+func UnregisterClient(target string) {
+	registeredMu.Lock()
+	defer registeredMu.Unlock()
+	registeredClients = slices.DeleteFunc(registeredClients, func(c clientDef) bool { return c.target == target })
+}
+
+// knownClients returns the built-in clients followed by registered ones.
 func knownClients() []clientDef {
+	registeredMu.RLock()
+	defer registeredMu.RUnlock()
+	return append(builtinClients(), registeredClients...)
+}
+
+func builtinClients() []clientDef {
 	return []clientDef{
 		{
 			target:     model.TargetClaude,
 			label:      "Claude Code",
 			detectDirs: []string{"~/.claude"},
-			customNew:  func() (Adapter, error) { return NewClaudeAdapter() },
+			customNew:  func(backupDir string) (Adapter, error) { return newClaudeAdapter(backupDir) },
 		},
 		{
 			target:     model.TargetCodex,
 			label:      "Codex CLI",
 			detectDirs: []string{"~/.codex"},
-			customNew:  func() (Adapter, error) { return NewCodexAdapter() },
+			customNew:  func(backupDir string) (Adapter, error) { return newCodexAdapter(backupDir) },
 		},
 		{
 			target:     model.TargetClaudeDesktop,
 			label:      "Claude Desktop",
 			detectDirs: claudeDesktopDetectDirs(),
 			configPath: claudeDesktopConfigPath(),
-			serverKeys: []string{"mcpServers"},
+			serverKeys: claudeServerKeys,
+			legacyKeys: claudeLegacyServerKeys,
 		},
 		{
 			target:     model.TargetCursor,
@@ -76,7 +173,8 @@ func knownClients() []clientDef {
 			label:      "VS Code",
 			detectDirs: vscodeDetectDirs(),
 			configPath: vscodeMCPConfigPath(),
-			serverKeys: []string{"servers"},
+			serverKeys: vscodeServerKeys,
+			legacyKeys: vscodeLegacyServerKeys,
 		},
 		{
 			target:     model.TargetGemini,
@@ -109,14 +207,31 @@ func knownClients() []clientDef {
 }
 
 // DetectedAdapters returns adapters for all AI clients found on the system.
-func DetectedAdapters() (map[string]Adapter, error) {
-	backupDir, err := paths.BackupDir()
-	if err != nil {
-		return nil, err
+// With noBackup set the adapters overwrite client configs without taking a
+// backup first.
+func DetectedAdapters(noBackup bool) (map[string]Adapter, error) {
+	return clientAdapters(noBackup, true)
+}
+
+// AllAdapters returns adapters for every known client whether or not it is
+// detected, so configs can be written ahead of installing a client. Writing
+// through one creates its config file.
+func AllAdapters(noBackup bool) (map[string]Adapter, error) {
+	return clientAdapters(noBackup, false)
+}
+
+func clientAdapters(noBackup, detectedOnly bool) (map[string]Adapter, error) {
+	backupDir := ""
+	if !noBackup {
+		var err error
+		backupDir, err = paths.BackupDir()
+		if err != nil {
+			return nil, err
+		}
 	}
 	result := make(map[string]Adapter)
 	for _, client := range knownClients() {
-		if !client.isDetected() {
+		if detectedOnly && !client.isDetected() {
 			continue
 		}
 		adapter, err := client.createAdapter(backupDir)
@@ -128,6 +243,50 @@ func DetectedAdapters() (map[string]Adapter, error) {
 	return result, nil
 }
 
+// ClientStatus describes how a known client was (or was not) detected.
+type ClientStatus struct {
+	Target      string
+	Label       string
+	Detected    bool
+	DetectedDir string
+	ProbedDirs  []string
+	ConfigPath  string
+	AdapterOK   bool
+	Err         error
+}
+
+// DetectClients reports detection results for every known client, including
+// those that are absent or whose adapter could not be constructed.
+func DetectClients() []ClientStatus {
+	backupDir, backupErr := paths.BackupDir()
+	var out []ClientStatus
+	for _, client := range knownClients() {
+		status := ClientStatus{
+			Target:     client.target,
+			Label:      client.label,
+			ProbedDirs: client.probedDirs(),
+		}
+		if client.configPath != "" {
+			if expanded, err := paths.ExpandHome(client.configPath); err == nil {
+				status.ConfigPath = expanded
+			}
+		}
+		status.DetectedDir, status.Detected = client.detectedDir()
+		if status.Detected {
+			if backupErr != nil {
+				status.Err = backupErr
+			} else if adapter, err := client.createAdapter(backupDir); err != nil {
+				status.Err = err
+			} else {
+				status.AdapterOK = true
+				status.ConfigPath = adapter.Path()
+			}
+		}
+		out = append(out, status)
+	}
+	return out
+}
+
 // ClientLabels returns a map of target name to human-readable label for all known clients.
 func ClientLabels() map[string]string {
 	labels := make(map[string]string)
@@ -157,6 +316,14 @@ func claudeDesktopConfigPath() string {
 	}
 }
 
+// VS Code reads servers from "servers" in mcp.json. Earlier releases and
+// copied examples put them under "mcpServers" or a settings-style
+// "mcp.servers"; those are read too and moved to "servers" on write.
+var (
+	vscodeServerKeys       = []string{"servers"}
+	vscodeLegacyServerKeys = [][]string{{"mcpServers"}, {"mcp", "servers"}}
+)
+
 func vscodeDetectDirs() []string {
 	switch runtime.GOOS {
 	case "darwin":
@@ -203,6 +370,9 @@ func zedSpecToConfig(spec model.MCPServerSpec) map[string]any {
 	if len(spec.Args) > 0 {
 		out["args"] = spec.Args
 	}
+	if len(spec.Env) > 0 {
+		out["env"] = spec.Env
+	}
 	return out
 }
 
@@ -211,18 +381,20 @@ func zedConfigToSpec(cfg map[string]any) model.MCPServerSpec {
 		return model.MCPServerSpec{Transport: model.ServerTransportHTTP, URL: url}
 	}
 	s := model.MCPServerSpec{Transport: model.ServerTransportSTDIO}
-	// New flat format: {"command": "npx", "args": [...]}
+	// New flat format: {"command": "npx", "args": [...], "env": {...}}
 	if cmd, ok := cfg["command"].(string); ok {
 		s.Command = cmd
-		s.Args = toStringSlice(cfg["args"])
+		s.Args = toArgs(cfg["args"])
+		s.Env = toStringMap(cfg["env"])
 		return s
 	}
-	// Legacy nested format: {"command": {"path": "npx", "args": [...]}}
+	// Legacy nested format: {"command": {"path": "npx", "args": [...], "env": {...}}}
 	if cmdMap, ok := toMap(cfg["command"]); ok {
 		if path, ok := cmdMap["path"].(string); ok {
 			s.Command = path
 		}
-		s.Args = toStringSlice(cmdMap["args"])
+		s.Args = toArgs(cmdMap["args"])
+		s.Env = toStringMap(cmdMap["env"])
 	}
 	return s
 }
@@ -240,6 +412,9 @@ func opencodeSpecToConfig(spec model.MCPServerSpec) map[string]any {
 		cmd := []string{spec.Command}
 		cmd = append(cmd, spec.Args...)
 		out["command"] = cmd
+		if len(spec.Env) > 0 {
+			out["environment"] = spec.Env
+		}
 	}
 	return out
 }
@@ -254,5 +429,6 @@ func opencodeConfigToSpec(cfg map[string]any) model.MCPServerSpec {
 		s.Command = cmdSlice[0]
 		s.Args = cmdSlice[1:]
 	}
+	s.Env = toStringMap(cfg["environment"])
 	return s
 }
@@ -5,13 +5,16 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"sort"
+	"strconv"
 
 	"github.com/pelletier/go-toml/v2"
 
 	"github.com/sarjann/mcper/internal/fsutil"
 	"github.com/sarjann/mcper/internal/model"
 	"github.com/sarjann/mcper/internal/paths"
+	"github.com/sarjann/mcper/internal/shellargs"
 )
 
 type CodexAdapter struct {
@@ -20,11 +23,17 @@ type CodexAdapter struct {
 }
 
 func NewCodexAdapter() (*CodexAdapter, error) {
-	p, err := paths.ExpandHome("~/.codex/config.toml")
+	backupDir, err := paths.BackupDir()
 	if err != nil {
 		return nil, err
 	}
-	backupDir, err := paths.BackupDir()
+	return newCodexAdapter(backupDir)
+}
+
+// newCodexAdapter builds the adapter with an explicit backup root; an empty
+// backupDir disables backups.
+func newCodexAdapter(backupDir string) (*CodexAdapter, error) {
+	p, err := paths.ExpandHome("~/.codex/config.toml")
 	if err != nil {
 		return nil, err
 	}
@@ -46,13 +55,27 @@ func (a *CodexAdapter) UpsertServers(ctx context.Context, servers map[string]mod
 		mcp = map[string]any{}
 	}
 	for name, spec := range servers {
-		mcp[name] = serverSpecToConfig(spec)
+		fresh := serverSpecToConfig(preserveEnv(spec, mcp[name], configToServerSpec))
+		mcp[name] = mergeUnknownKeys(mcp[name], fresh, codexManagedKeys)
 	}
 	raw["mcp_servers"] = mcp
 	return a.writeRaw(raw)
 }
 
+// codexManagedKeys are the per-server keys serverSpecToConfig owns. Anything
+// else in a Codex server table, such as startup_timeout_ms, belongs to the
+// user and survives an upsert.
+var codexManagedKeys = []string{"url", "command", "args", "env", "env_vars"}
+
 func (a *CodexAdapter) RemoveServers(ctx context.Context, names []string) error {
+	return a.removeServers(ctx, names, false)
+}
+
+func (a *CodexAdapter) RemoveServersPruneEmpty(ctx context.Context, names []string) error {
+	return a.removeServers(ctx, names, true)
+}
+
+func (a *CodexAdapter) removeServers(ctx context.Context, names []string, pruneEmpty bool) error {
 	_ = ctx
 	raw, err := a.readRaw()
 	if err != nil {
@@ -65,7 +88,11 @@ func (a *CodexAdapter) RemoveServers(ctx context.Context, names []string) error
 	for _, name := range names {
 		delete(mcp, name)
 	}
-	raw["mcp_servers"] = mcp
+	if pruneEmpty && len(mcp) == 0 {
+		delete(raw, "mcp_servers")
+	} else {
+		raw["mcp_servers"] = mcp
+	}
 	return a.writeRaw(raw)
 }
 
@@ -126,8 +153,10 @@ func (a *CodexAdapter) writeRaw(raw map[string]any) error {
 	if err := os.MkdirAll(filepath.Dir(a.path), 0o755); err != nil {
 		return fmt.Errorf("create codex config dir: %w", err)
 	}
-	if _, err := fsutil.BackupFile(a.path, a.backupDir); err != nil {
-		return err
+	if a.backupDir != "" {
+		if _, err := fsutil.BackupFile(a.path, a.backupDir); err != nil {
+			return err
+		}
 	}
 	if err := fsutil.AtomicWriteFile(a.path, data, 0o600); err != nil {
 		return fmt.Errorf("write codex config: %w", err)
@@ -145,6 +174,9 @@ func serverSpecToConfig(spec model.MCPServerSpec) map[string]any {
 			out["args"] = spec.Args
 		}
 	}
+	if len(spec.Env) > 0 {
+		out["env"] = spec.Env
+	}
 	if len(spec.EnvRequired) > 0 {
 		env := append([]string{}, spec.EnvRequired...)
 		sort.Strings(env)
@@ -163,8 +195,9 @@ func configToServerSpec(cfg map[string]any) model.MCPServerSpec {
 		if cmd, ok := cfg["command"].(string); ok {
 			s.Command = cmd
 		}
-		s.Args = toStringSlice(cfg["args"])
+		s.Args = toArgs(cfg["args"])
 	}
+	s.Env = toStringMap(cfg["env"])
 	s.EnvRequired = toStringSlice(cfg["env_vars"])
 	return s
 }
@@ -199,10 +232,108 @@ func toStringSlice(v any) []string {
 	}
 	out := make([]string, 0, len(items))
 	for _, item := range items {
-		s, ok := item.(string)
-		if ok {
+		if s, ok := scalarString(item); ok {
 			out = append(out, s)
 		}
 	}
 	return out
 }
+
+// scalarString renders a config scalar as a string. TOML and JSON configs
+// hold unquoted numbers and booleans (args = ["--port", 8080]) that a server
+// receives as text anyway, so they are kept rather than dropped. Tables,
+// arrays and nulls are not scalars.
+func scalarString(v any) (string, bool) {
+	switch val := v.(type) {
+	case string:
+		return val, true
+	case bool:
+		return strconv.FormatBool(val), true
+	case int64:
+		return strconv.FormatInt(val, 10), true
+	case int:
+		return strconv.Itoa(val), true
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64), true
+	case fmt.Stringer:
+		// go-toml's local dates and times.
+		return val.String(), true
+	default:
+		return "", false
+	}
+}
+
+// toArgs reads a server's args, which hand-edited configs sometimes hold as
+// one command-line string instead of an array. A string is split like a
+// shell would; one that cannot be split is kept whole rather than dropped.
+func toArgs(v any) []string {
+	line, ok := v.(string)
+	if !ok {
+		return toStringSlice(v)
+	}
+	args, err := shellargs.Split(line)
+	if err != nil {
+		return []string{line}
+	}
+	return args
+}
+
+// preserveEnv carries the env block of an existing server entry over to a
+// spec that does not set its own, so reinstalling keeps env the user added.
+// A non-nil empty Env is set on purpose and clears the block instead.
+func preserveEnv(spec model.MCPServerSpec, existing any, fromConfig ConfigToSpec) model.MCPServerSpec {
+	if spec.Env != nil {
+		return spec
+	}
+	if cfg, ok := toMap(existing); ok {
+		spec.Env = fromConfig(cfg).Env
+	}
+	return spec
+}
+
+// mergeUnknownKeys returns fresh plus every key of the existing server entry
+// that is not in managed. Managed keys come only from fresh, so a key the new
+// spec drops (args after a switch to http, say) is dropped from the config.
+func mergeUnknownKeys(existing any, fresh map[string]any, managed []string) map[string]any {
+	cfg, ok := toMap(existing)
+	if !ok {
+		return fresh
+	}
+	out := make(map[string]any, len(cfg)+len(fresh))
+	for k, v := range cfg {
+		if !slices.Contains(managed, k) {
+			out[k] = v
+		}
+	}
+	for k, v := range fresh {
+		out[k] = v
+	}
+	return out
+}
+
+// toStringMap reads a config object of string values, such as an env block.
+// Numbers and booleans are stringified, other values are skipped and an empty
+// object yields nil.
+func toStringMap(v any) map[string]string {
+	if sm, ok := v.(map[string]string); ok {
+		if len(sm) == 0 {
+			return nil
+		}
+		out := make(map[string]string, len(sm))
+		for k, val := range sm {
+			out[k] = val
+		}
+		return out
+	}
+	m, ok := toMap(v)
+	if !ok || len(m) == 0 {
+		return nil
+	}
+	out := make(map[string]string, len(m))
+	for k, val := range m {
+		if s, ok := scalarString(val); ok {
+			out[k] = s
+		}
+	}
+	return out
+}
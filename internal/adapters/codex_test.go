@@ -2,6 +2,9 @@ package adapters
 
 import (
 	"context"
+	"os"
+	"path/filepath"
+	"slices"
 	"testing"
 
 	"github.com/sarjann/mcper/internal/model"
@@ -49,3 +52,127 @@ func TestCodexAdapterUpsertAndRemove(t *testing.T) {
 		t.Fatalf("expected demo server to be removed")
 	}
 }
+
+func TestCodexAdapterRemoveServersPruneEmpty(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+	t.Setenv("XDG_CONFIG_HOME", tmp)
+
+	a, err := NewCodexAdapter()
+	if err != nil {
+		t.Fatalf("NewCodexAdapter failed: %v", err)
+	}
+	ctx := context.Background()
+	servers := map[string]model.MCPServerSpec{
+		"demo": {Transport: model.ServerTransportSTDIO, Command: "npx"},
+	}
+	if err := a.UpsertServers(ctx, servers); err != nil {
+		t.Fatalf("UpsertServers failed: %v", err)
+	}
+	if err := a.RemoveServersPruneEmpty(ctx, []string{"demo"}); err != nil {
+		t.Fatalf("RemoveServersPruneEmpty failed: %v", err)
+	}
+	raw, err := a.readRaw()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := raw["mcp_servers"]; ok {
+		t.Errorf("expected the empty mcp_servers table removed, got %v", raw)
+	}
+}
+
+func TestCodexAdapterUpsertKeepsUnknownServerKeys(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+	t.Setenv("XDG_CONFIG_HOME", tmp)
+
+	a, err := NewCodexAdapter()
+	if err != nil {
+		t.Fatalf("NewCodexAdapter failed: %v", err)
+	}
+	seed := `[mcp_servers.demo]
+command = "npx"
+args = ["-y", "demo-mcp@1"]
+startup_timeout_ms = 20000
+`
+	if err := os.MkdirAll(filepath.Dir(a.Path()), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(a.Path(), []byte(seed), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	err = a.UpsertServers(context.Background(), map[string]model.MCPServerSpec{
+		"demo": {Transport: model.ServerTransportHTTP, URL: "https://example.com/mcp"},
+	})
+	if err != nil {
+		t.Fatalf("UpsertServers failed: %v", err)
+	}
+
+	raw, err := a.readRaw()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mcp, _ := toMap(raw["mcp_servers"])
+	demo, _ := toMap(mcp["demo"])
+	if demo["startup_timeout_ms"] != int64(20000) {
+		t.Errorf("expected startup_timeout_ms to survive the upsert, got %v", demo)
+	}
+	if demo["url"] != "https://example.com/mcp" {
+		t.Errorf("expected url to be written, got %v", demo)
+	}
+	if _, ok := demo["args"]; ok {
+		t.Errorf("expected stale args to be dropped after switching to http, got %v", demo)
+	}
+}
+
+func TestCodexAdapterReadsNumericArgs(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+	t.Setenv("XDG_CONFIG_HOME", tmp)
+
+	a, err := NewCodexAdapter()
+	if err != nil {
+		t.Fatalf("NewCodexAdapter failed: %v", err)
+	}
+	seed := `[mcp_servers.demo]
+command = "demo-mcp"
+args = ["--port", 8080, "--ratio", 0.5, "--verbose", true]
+
+[mcp_servers.demo.env]
+PORT = 8080
+DEBUG = false
+NAME = "demo"
+`
+	if err := os.MkdirAll(filepath.Dir(a.Path()), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(a.Path(), []byte(seed), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	listed, err := a.ListServers(context.Background())
+	if err != nil {
+		t.Fatalf("ListServers failed: %v", err)
+	}
+	demo := listed["demo"]
+	want := []string{"--port", "8080", "--ratio", "0.5", "--verbose", "true"}
+	if !slices.Equal(demo.Args, want) {
+		t.Errorf("expected args %v, got %v", want, demo.Args)
+	}
+	if demo.Env["PORT"] != "8080" || demo.Env["DEBUG"] != "false" || demo.Env["NAME"] != "demo" {
+		t.Errorf("expected numeric and boolean env kept as strings, got %v", demo.Env)
+	}
+
+	// Reinstalling the same spec must not lose the numeric arg.
+	if err := a.UpsertServers(context.Background(), map[string]model.MCPServerSpec{"demo": demo}); err != nil {
+		t.Fatalf("UpsertServers failed: %v", err)
+	}
+	listed, err = a.ListServers(context.Background())
+	if err != nil {
+		t.Fatalf("ListServers failed: %v", err)
+	}
+	if got := listed["demo"].Args; !slices.Equal(got, want) {
+		t.Errorf("expected args to round-trip, got %v", got)
+	}
+}
@@ -1,6 +1,7 @@
 package adapters
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -19,12 +20,13 @@ type ConfigToSpec func(map[string]any) model.MCPServerSpec
 
 // GenericJSONAdapter handles MCP server configuration for JSON-based AI clients.
 type GenericJSONAdapter struct {
-	name       string
-	path       string
-	backupDir  string
-	serverKeys []string     // JSON key path to servers section (e.g., ["mcpServers"])
-	toConfig   SpecToConfig // converts spec → client config format
-	fromConfig ConfigToSpec // converts client config → spec
+	name             string
+	path             string
+	backupDir        string       // empty disables backups
+	serverKeys       []string     // JSON key path to servers section (e.g., ["mcpServers"])
+	legacyServerKeys [][]string   // older key paths read when serverKeys is absent
+	toConfig         SpecToConfig // converts spec → client config format
+	fromConfig       ConfigToSpec // converts client config → spec
 }
 
 func NewGenericJSONAdapter(name, path, backupDir string, serverKeys []string, toConfig SpecToConfig, fromConfig ConfigToSpec) *GenericJSONAdapter {
@@ -44,6 +46,17 @@ func NewGenericJSONAdapter(name, path, backupDir string, serverKeys []string, to
 	}
 }
 
+// WithLegacyServerKeys sets fallback key paths, in order of preference, that
+// are read when the canonical servers key is missing. Writes always go to the
+// canonical key and drop the legacy ones.
+func (a *GenericJSONAdapter) WithLegacyServerKeys(keys ...[]string) *GenericJSONAdapter {
+	a.legacyServerKeys = keys
+	return a
+}
+
+// HasComments reports whether the config holds JSONC comments.
+func (a *GenericJSONAdapter) HasComments() bool { return configHasComments(a.path) }
+
 func (a *GenericJSONAdapter) Name() string { return a.name }
 func (a *GenericJSONAdapter) Path() string { return a.path }
 
@@ -53,31 +66,43 @@ func (a *GenericJSONAdapter) UpsertServers(ctx context.Context, servers map[stri
 	if err != nil {
 		return err
 	}
-	mcp := getNestedMap(raw, a.serverKeys)
+	mcp := findServers(raw, a.serverKeys, a.legacyServerKeys)
 	if mcp == nil {
 		mcp = map[string]any{}
 	}
 	for name, spec := range servers {
-		mcp[name] = a.toConfig(spec)
+		mcp[name] = a.toConfig(preserveEnv(spec, mcp[name], a.fromConfig))
 	}
-	setNestedMap(raw, a.serverKeys, mcp)
+	storeServers(raw, a.serverKeys, a.legacyServerKeys, mcp)
 	return a.writeRaw(raw)
 }
 
 func (a *GenericJSONAdapter) RemoveServers(ctx context.Context, names []string) error {
+	return a.removeServers(ctx, names, false)
+}
+
+func (a *GenericJSONAdapter) RemoveServersPruneEmpty(ctx context.Context, names []string) error {
+	return a.removeServers(ctx, names, true)
+}
+
+func (a *GenericJSONAdapter) removeServers(ctx context.Context, names []string, pruneEmpty bool) error {
 	_ = ctx
 	raw, err := a.readRaw()
 	if err != nil {
 		return err
 	}
-	mcp := getNestedMap(raw, a.serverKeys)
+	mcp := findServers(raw, a.serverKeys, a.legacyServerKeys)
 	if mcp == nil {
 		return nil
 	}
 	for _, name := range names {
 		delete(mcp, name)
 	}
-	setNestedMap(raw, a.serverKeys, mcp)
+	if pruneEmpty && len(mcp) == 0 {
+		dropServers(raw, a.serverKeys, a.legacyServerKeys)
+	} else {
+		storeServers(raw, a.serverKeys, a.legacyServerKeys, mcp)
+	}
 	return a.writeRaw(raw)
 }
 
@@ -90,7 +115,7 @@ func (a *GenericJSONAdapter) ListServers(ctx context.Context) (map[string]model.
 		}
 		return nil, err
 	}
-	mcp := getNestedMap(raw, a.serverKeys)
+	mcp := findServers(raw, a.serverKeys, a.legacyServerKeys)
 	if mcp == nil {
 		return map[string]model.MCPServerSpec{}, nil
 	}
@@ -116,9 +141,27 @@ func (a *GenericJSONAdapter) readRaw() (map[string]any, error) {
 	if len(data) == 0 {
 		return map[string]any{}, nil
 	}
+	raw, err := decodeConfigJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("decode %s config JSON: %w", a.name, err)
+	}
+	return raw, nil
+}
+
+// decodeConfigJSON decodes a client config object, tolerating the UTF-8
+// byte order mark and trailing commas that hand edits leave behind. Both are
+// dropped when the config is next written. Anything else that is not valid
+// JSON fails with the error for the file as read.
+func decodeConfigJSON(data []byte) (map[string]any, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if len(bytes.TrimSpace(data)) == 0 {
+		return map[string]any{}, nil
+	}
 	var raw map[string]any
 	if err := json.Unmarshal(data, &raw); err != nil {
-		return nil, fmt.Errorf("decode %s config JSON: %w", a.name, err)
+		if json.Unmarshal(stripTrailingCommas(stripJSONComments(data)), &raw) != nil {
+			return nil, err
+		}
 	}
 	if raw == nil {
 		raw = map[string]any{}
@@ -126,6 +169,94 @@ func (a *GenericJSONAdapter) readRaw() (map[string]any, error) {
 	return raw, nil
 }
 
+// stripJSONComments removes // line and /* block */ comments, as allowed in
+// JSONC files such as VS Code's, leaving string contents alone. A line
+// comment keeps its newline.
+func stripJSONComments(data []byte) []byte {
+	out := make([]byte, 0, len(data))
+	inString, escaped := false, false
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+			out = append(out, c)
+			continue
+		}
+		if c == '/' && i+1 < len(data) {
+			switch data[i+1] {
+			case '/':
+				end := bytes.IndexByte(data[i:], '\n')
+				if end < 0 {
+					return out
+				}
+				i += end - 1
+				continue
+			case '*':
+				end := bytes.Index(data[i+2:], []byte("*/"))
+				if end < 0 {
+					return out
+				}
+				i += end + 3
+				continue
+			}
+		}
+		if c == '"' {
+			inString = true
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// configHasComments reports whether the JSON config at path holds comments,
+// which a rewrite cannot keep. Unreadable files report false.
+func configHasComments(path string) bool {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	return !bytes.Equal(stripJSONComments(data), data)
+}
+
+// stripTrailingCommas removes commas that directly precede a closing brace
+// or bracket, leaving string contents alone.
+func stripTrailingCommas(data []byte) []byte {
+	out := make([]byte, 0, len(data))
+	inString, escaped := false, false
+	for i, c := range data {
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+			out = append(out, c)
+			continue
+		}
+		if c == '"' {
+			inString = true
+		}
+		if c == ',' {
+			rest := bytes.TrimLeft(data[i+1:], " \t\r\n")
+			if len(rest) > 0 && (rest[0] == '}' || rest[0] == ']') {
+				continue
+			}
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
 func (a *GenericJSONAdapter) writeRaw(raw map[string]any) error {
 	data, err := json.MarshalIndent(raw, "", "  ")
 	if err != nil {
@@ -134,7 +265,7 @@ func (a *GenericJSONAdapter) writeRaw(raw map[string]any) error {
 	if err := os.MkdirAll(filepath.Dir(a.path), 0o755); err != nil {
 		return fmt.Errorf("create %s config dir: %w", a.name, err)
 	}
-	if _, statErr := os.Stat(a.path); statErr == nil {
+	if _, statErr := os.Stat(a.path); statErr == nil && a.backupDir != "" {
 		if _, err := fsutil.BackupFile(a.path, a.backupDir); err != nil {
 			return err
 		}
@@ -158,6 +289,9 @@ func standardSpecToConfig(spec model.MCPServerSpec) map[string]any {
 			out["args"] = spec.Args
 		}
 	}
+	if len(spec.Env) > 0 {
+		out["env"] = spec.Env
+	}
 	return out
 }
 
@@ -172,8 +306,9 @@ func standardConfigToSpec(cfg map[string]any) model.MCPServerSpec {
 		if cmd, ok := cfg["command"].(string); ok {
 			s.Command = cmd
 		}
-		s.Args = toStringSlice(cfg["args"])
+		s.Args = toArgs(cfg["args"])
 	}
+	s.Env = toStringMap(cfg["env"])
 	return s
 }
 
@@ -197,6 +332,69 @@ func getNestedMap(raw map[string]any, keys []string) map[string]any {
 	return nil
 }
 
+// findServers returns the servers map at the canonical key path merged with
+// those at every legacy path, so a file caught halfway through a client's
+// key change loses none. On a name clash the canonical entry wins, then the
+// earlier legacy path.
+func findServers(raw map[string]any, canonical []string, legacy [][]string) map[string]any {
+	mcp := getNestedMap(raw, canonical)
+	for _, keys := range legacy {
+		old := getNestedMap(raw, keys)
+		if old == nil {
+			continue
+		}
+		merged := make(map[string]any, len(mcp)+len(old))
+		for name, cfg := range old {
+			merged[name] = cfg
+		}
+		for name, cfg := range mcp {
+			merged[name] = cfg
+		}
+		mcp = merged
+	}
+	return mcp
+}
+
+// storeServers writes servers to the canonical key path and removes any
+// legacy copies so the file converges on one location.
+func storeServers(raw map[string]any, canonical []string, legacy [][]string, mcp map[string]any) {
+	for _, keys := range legacy {
+		deleteNestedKey(raw, keys)
+	}
+	setNestedMap(raw, canonical, mcp)
+}
+
+// dropServers removes the servers key at the canonical and every legacy
+// path, and any parent objects left empty.
+func dropServers(raw map[string]any, canonical []string, legacy [][]string) {
+	deleteNestedKey(raw, canonical)
+	for _, keys := range legacy {
+		deleteNestedKey(raw, keys)
+	}
+}
+
+// deleteNestedKey removes the last key of a nested key path, if present,
+// and the parent object too when that leaves it empty.
+func deleteNestedKey(raw map[string]any, keys []string) {
+	if len(keys) == 0 {
+		return
+	}
+	parent := raw
+	if len(keys) > 1 {
+		parent = getNestedMap(raw, keys[:len(keys)-1])
+		if parent == nil {
+			return
+		}
+	}
+	if _, ok := parent[keys[len(keys)-1]]; !ok {
+		return
+	}
+	delete(parent, keys[len(keys)-1])
+	if len(keys) > 1 && len(parent) == 0 {
+		deleteNestedKey(raw, keys[:len(keys)-1])
+	}
+}
+
 // setNestedMap sets a value at a nested key path, creating intermediate maps as needed.
 func setNestedMap(raw map[string]any, keys []string, value map[string]any) {
 	current := raw
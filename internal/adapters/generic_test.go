@@ -5,6 +5,9 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"reflect"
+	"sync"
+	"sync/atomic"
 	"testing"
 
 	"github.com/sarjann/mcper/internal/model"
@@ -141,6 +144,54 @@ func TestGenericJSONAdapter_RemoveServers(t *testing.T) {
 	}
 }
 
+func TestGenericJSONAdapter_RemoveServersPruneEmpty(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.json")
+	existing := `{"theme": "dark", "mcp": {"servers": {"a": {"command": "a"}, "b": {"command": "b"}}}}`
+	if err := os.WriteFile(configPath, []byte(existing), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	adapter := NewGenericJSONAdapter("test", configPath, dir, []string{"mcp", "servers"}, nil, nil)
+	ctx := context.Background()
+	read := func() map[string]any {
+		t.Helper()
+		data, err := os.ReadFile(configPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var raw map[string]any
+		if err := json.Unmarshal(data, &raw); err != nil {
+			t.Fatal(err)
+		}
+		return raw
+	}
+
+	if err := adapter.RemoveServersPruneEmpty(ctx, []string{"a"}); err != nil {
+		t.Fatalf("RemoveServersPruneEmpty: %v", err)
+	}
+	if servers := getNestedMap(read(), []string{"mcp", "servers"}); len(servers) != 1 {
+		t.Fatalf("expected b kept while servers remain, got %v", servers)
+	}
+
+	if err := adapter.RemoveServers(ctx, []string{"b"}); err != nil {
+		t.Fatalf("RemoveServers: %v", err)
+	}
+	if servers := getNestedMap(read(), []string{"mcp", "servers"}); servers == nil || len(servers) != 0 {
+		t.Fatalf("expected RemoveServers to keep writing an empty object, got %v", read())
+	}
+
+	if err := adapter.RemoveServersPruneEmpty(ctx, nil); err != nil {
+		t.Fatalf("RemoveServersPruneEmpty: %v", err)
+	}
+	raw := read()
+	if _, ok := raw["mcp"]; ok {
+		t.Errorf("expected the empty servers key and its empty parent removed, got %v", raw)
+	}
+	if raw["theme"] != "dark" {
+		t.Errorf("expected unrelated keys kept, got %v", raw)
+	}
+}
+
 func TestGenericJSONAdapter_PreservesExistingConfig(t *testing.T) {
 	dir := t.TempDir()
 	configPath := filepath.Join(dir, "config.json")
@@ -189,6 +240,55 @@ func TestGenericJSONAdapter_EmptyFile(t *testing.T) {
 	}
 }
 
+func TestGenericJSONAdapter_LegacyServerKeys(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.json")
+
+	existing := map[string]any{
+		"mcp_servers": map[string]any{
+			"legacy": map[string]any{"command": "old-server"},
+		},
+	}
+	data, _ := json.MarshalIndent(existing, "", "  ")
+	os.WriteFile(configPath, data, 0o600)
+
+	adapter := NewGenericJSONAdapter("test", configPath, dir, []string{"mcpServers"}, nil, nil).
+		WithLegacyServerKeys([]string{"mcp_servers"})
+	ctx := context.Background()
+
+	listed, err := adapter.ListServers(ctx)
+	if err != nil {
+		t.Fatalf("ListServers: %v", err)
+	}
+	if listed["legacy"].Command != "old-server" {
+		t.Fatalf("expected server read from legacy key, got %v", listed)
+	}
+
+	servers := map[string]model.MCPServerSpec{
+		"vercel": {Transport: model.ServerTransportSTDIO, Command: "npx"},
+	}
+	if err := adapter.UpsertServers(ctx, servers); err != nil {
+		t.Fatalf("UpsertServers: %v", err)
+	}
+
+	data, _ = os.ReadFile(configPath)
+	var raw map[string]any
+	json.Unmarshal(data, &raw)
+	if _, ok := raw["mcp_servers"]; ok {
+		t.Error("expected legacy key to be removed after write")
+	}
+	mcp, ok := raw["mcpServers"].(map[string]any)
+	if !ok {
+		t.Fatalf("expected canonical mcpServers key, got %v", raw)
+	}
+	if _, ok := mcp["legacy"]; !ok {
+		t.Error("expected legacy server to be carried over to canonical key")
+	}
+	if _, ok := mcp["vercel"]; !ok {
+		t.Error("expected new server under canonical key")
+	}
+}
+
 func TestZedSpecToConfig(t *testing.T) {
 	spec := model.MCPServerSpec{
 		Transport: model.ServerTransportSTDIO,
@@ -239,6 +339,28 @@ func TestZedConfigToSpec(t *testing.T) {
 	}
 }
 
+func TestConfigToSpecSplitsStringArgs(t *testing.T) {
+	array := map[string]any{"command": "npx", "args": []any{"-y", "@vercel/mcp", "--name", "my server"}}
+	line := map[string]any{"command": "npx", "args": `-y @vercel/mcp --name "my server"`}
+
+	for name, fromConfig := range map[string]ConfigToSpec{
+		"standard": standardConfigToSpec,
+		"codex":    configToServerSpec,
+		"zed":      zedConfigToSpec,
+	} {
+		want, got := fromConfig(array), fromConfig(line)
+		if !reflect.DeepEqual(want, got) {
+			t.Errorf("%s: expected string args to match array args:\n%+v\n%+v", name, want, got)
+		}
+	}
+
+	// An unsplittable string is kept whole rather than dropped.
+	spec := standardConfigToSpec(map[string]any{"command": "npx", "args": `-y "open`})
+	if !reflect.DeepEqual(spec.Args, []string{`-y "open`}) {
+		t.Errorf("expected unterminated args kept as one argument, got %q", spec.Args)
+	}
+}
+
 func TestZedConfigToSpec_Legacy(t *testing.T) {
 	cfg := map[string]any{
 		"command": map[string]any{
@@ -268,6 +390,40 @@ func TestClientLabels(t *testing.T) {
 	}
 }
 
+func TestDetectClients_ReportsAbsentClientWithProbePath(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	if err := os.MkdirAll(filepath.Join(home, ".codex"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	byTarget := make(map[string]ClientStatus)
+	for _, st := range DetectClients() {
+		byTarget[st.Target] = st
+	}
+	if len(byTarget) != len(knownClients()) {
+		t.Fatalf("expected %d clients, got %d", len(knownClients()), len(byTarget))
+	}
+
+	cursor := byTarget[model.TargetCursor]
+	if cursor.Detected || cursor.AdapterOK {
+		t.Fatalf("expected cursor to be undetected, got %+v", cursor)
+	}
+	want := filepath.Join(home, ".cursor")
+	if len(cursor.ProbedDirs) != 1 || cursor.ProbedDirs[0] != want {
+		t.Fatalf("expected probe path %q, got %v", want, cursor.ProbedDirs)
+	}
+
+	codex := byTarget[model.TargetCodex]
+	if !codex.Detected || !codex.AdapterOK || codex.Err != nil {
+		t.Fatalf("expected codex detected with adapter, got %+v", codex)
+	}
+	if codex.DetectedDir != filepath.Join(home, ".codex") {
+		t.Fatalf("unexpected detected dir %q", codex.DetectedDir)
+	}
+}
+
 func TestGetNestedMap(t *testing.T) {
 	raw := map[string]any{
 		"mcp": map[string]any{
@@ -356,3 +512,353 @@ func TestOpencodeConfigToSpec(t *testing.T) {
 		t.Errorf("expected args [-y @vercel/mcp], got %v", spec.Args)
 	}
 }
+
+func TestGenericJSONAdapter_EnvRoundTripAndPreserve(t *testing.T) {
+	dir := t.TempDir()
+	adapter := NewGenericJSONAdapter("test", filepath.Join(dir, "config.json"), dir, []string{"mcpServers"}, nil, nil)
+	ctx := context.Background()
+
+	spec := model.MCPServerSpec{
+		Transport: model.ServerTransportSTDIO,
+		Command:   "npx",
+		Args:      []string{"-y", "demo"},
+		Env:       map[string]string{"LOG_LEVEL": "debug"},
+	}
+	if err := adapter.UpsertServers(ctx, map[string]model.MCPServerSpec{"demo": spec}); err != nil {
+		t.Fatalf("UpsertServers: %v", err)
+	}
+	listed, err := adapter.ListServers(ctx)
+	if err != nil {
+		t.Fatalf("ListServers: %v", err)
+	}
+	if got := listed["demo"].Env["LOG_LEVEL"]; got != "debug" {
+		t.Fatalf("expected env to round-trip, got %v", listed["demo"].Env)
+	}
+
+	spec.Env = nil
+	if err := adapter.UpsertServers(ctx, map[string]model.MCPServerSpec{"demo": spec}); err != nil {
+		t.Fatalf("UpsertServers: %v", err)
+	}
+	listed, err = adapter.ListServers(ctx)
+	if err != nil {
+		t.Fatalf("ListServers: %v", err)
+	}
+	if got := listed["demo"].Env["LOG_LEVEL"]; got != "debug" {
+		t.Errorf("expected existing env to be preserved, got %v", listed["demo"].Env)
+	}
+}
+
+func TestDetectedAdapters_NoBackup(t *testing.T) {
+	home := t.TempDir()
+	configHome := filepath.Join(home, "config")
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", configHome)
+	if err := os.MkdirAll(filepath.Join(home, ".cursor"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(home, ".cursor", "mcp.json"), []byte(`{"mcpServers":{}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	backupRoot := filepath.Join(configHome, "mcper", "backups")
+	servers := map[string]model.MCPServerSpec{
+		"demo": {Transport: model.ServerTransportSTDIO, Command: "npx", Args: []string{"-y", "demo"}},
+	}
+
+	detected, err := DetectedAdapters(true)
+	if err != nil {
+		t.Fatalf("DetectedAdapters failed: %v", err)
+	}
+	cursor, ok := detected[model.TargetCursor]
+	if !ok {
+		t.Fatalf("expected cursor to be detected, got %v", detected)
+	}
+	if err := cursor.UpsertServers(context.Background(), servers); err != nil {
+		t.Fatalf("UpsertServers failed: %v", err)
+	}
+	if _, err := os.Stat(backupRoot); !os.IsNotExist(err) {
+		t.Fatalf("expected no backup dir with noBackup, stat err: %v", err)
+	}
+
+	detected, err = DetectedAdapters(false)
+	if err != nil {
+		t.Fatalf("DetectedAdapters failed: %v", err)
+	}
+	if err := detected[model.TargetCursor].UpsertServers(context.Background(), servers); err != nil {
+		t.Fatalf("UpsertServers failed: %v", err)
+	}
+	if _, err := os.Stat(backupRoot); err != nil {
+		t.Fatalf("expected backups by default: %v", err)
+	}
+}
+
+func TestAllAdaptersCoversUndetectedClients(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	t.Setenv("APPDATA", filepath.Join(home, "AppData"))
+
+	detected, err := DetectedAdapters(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(detected) != 0 {
+		t.Fatalf("expected no detected clients in an empty home, got %v", detected)
+	}
+	all, err := AllAdapters(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != len(knownClients()) {
+		t.Fatalf("expected an adapter per known client, got %d", len(all))
+	}
+
+	cursor := all[model.TargetCursor]
+	err = cursor.UpsertServers(context.Background(), map[string]model.MCPServerSpec{
+		"demo": {Transport: model.ServerTransportSTDIO, Command: "npx"},
+	})
+	if err != nil {
+		t.Fatalf("UpsertServers failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(home, ".cursor", "mcp.json")); err != nil {
+		t.Fatalf("expected the cursor config to be created: %v", err)
+	}
+}
+
+func TestRegisterClient(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	t.Setenv("XDG_DATA_HOME", filepath.Join(home, ".local", "share"))
+	if err := os.MkdirAll(filepath.Join(home, ".niche"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	def := ClientDef{
+		Target:     "niche",
+		Label:      "Niche Editor",
+		DetectDirs: []string{"~/.niche"},
+		ConfigPath: "~/.niche/tools.json",
+		ServerKeys: []string{"tools", "mcp"},
+	}
+	if err := RegisterClient(def); err != nil {
+		t.Fatalf("RegisterClient failed: %v", err)
+	}
+	t.Cleanup(func() { UnregisterClient("niche") })
+
+	if err := RegisterClient(def); err == nil {
+		t.Error("expected registering the same target twice to fail")
+	}
+	if err := RegisterClient(ClientDef{Target: model.TargetCursor, ConfigPath: "~/x.json", ServerKeys: []string{"s"}}); err == nil {
+		t.Error("expected a built-in target to be refused")
+	}
+	if ClientLabels()["niche"] != "Niche Editor" {
+		t.Errorf("expected the label registered, got %v", ClientLabels())
+	}
+
+	detected, err := DetectedAdapters(true)
+	if err != nil {
+		t.Fatalf("DetectedAdapters failed: %v", err)
+	}
+	adapter, ok := detected["niche"]
+	if !ok {
+		t.Fatalf("expected niche detected, got %v", detected)
+	}
+	if err := adapter.UpsertServers(context.Background(), map[string]model.MCPServerSpec{
+		"demo": {Transport: model.ServerTransportHTTP, URL: "https://example.com/mcp"},
+	}); err != nil {
+		t.Fatalf("UpsertServers failed: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(home, ".niche", "tools.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var raw map[string]map[string]map[string]any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := raw["tools"]["mcp"]["demo"]; !ok {
+		t.Errorf("expected demo under tools.mcp, got %s", data)
+	}
+
+	UnregisterClient("niche")
+	if _, ok := ClientLabels()["niche"]; ok {
+		t.Error("expected niche gone after UnregisterClient")
+	}
+}
+
+func TestRegisterClient_ConcurrentSameTargetRegistersOnce(t *testing.T) {
+	def := ClientDef{Target: "racer", ConfigPath: "~/.racer.json", ServerKeys: []string{"mcpServers"}}
+	t.Cleanup(func() { UnregisterClient("racer") })
+
+	var wg sync.WaitGroup
+	var registered atomic.Int32
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if RegisterClient(def) == nil {
+				registered.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := registered.Load(); n != 1 {
+		t.Fatalf("expected exactly one registration to succeed, got %d", n)
+	}
+}
+
+func TestGenericJSONAdapter_ToleratesBOMAndTrailingCommas(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.json")
+	content := "\xef\xbb\xbf{\n  \"theme\": \"a,}\",\n  \"mcpServers\": {\n    \"old\": {\"command\": \"npx\", \"args\": [\"-y\", \"old\",],},\n  },\n}\n"
+	if err := os.WriteFile(configPath, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	adapter := NewGenericJSONAdapter("test", configPath, dir, []string{"mcpServers"}, nil, nil)
+	ctx := context.Background()
+
+	listed, err := adapter.ListServers(ctx)
+	if err != nil {
+		t.Fatalf("ListServers: %v", err)
+	}
+	if got := listed["old"].Args; len(got) != 2 || got[1] != "old" {
+		t.Fatalf("expected old server read, got %+v", listed)
+	}
+	if err := adapter.UpsertServers(ctx, map[string]model.MCPServerSpec{"new": {Transport: model.ServerTransportSTDIO, Command: "go"}}); err != nil {
+		t.Fatalf("UpsertServers: %v", err)
+	}
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var raw map[string]any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		t.Fatalf("expected strict JSON after rewrite: %v\n%s", err, data)
+	}
+	if raw["theme"] != "a,}" {
+		t.Errorf("expected string contents untouched, got %v", raw["theme"])
+	}
+
+	if err := os.WriteFile(configPath, []byte("\xef\xbb\xbf{\"mcpServers\": {"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := adapter.ListServers(ctx); err == nil {
+		t.Error("expected truncated JSON to still fail")
+	}
+}
+
+func TestVSCodeAdapter_MergesLegacyServerKeys(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	t.Setenv("APPDATA", filepath.Join(home, "AppData"))
+
+	all, err := AllAdapters(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vscode := all[model.TargetVSCode]
+	if err := os.MkdirAll(filepath.Dir(vscode.Path()), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	existing := `{
+  "inputs": [],
+  "servers": {"shared": {"command": "current"}},
+  "mcpServers": {"older": {"command": "older"}},
+  "mcp": {"servers": {"shared": {"command": "stale"}, "settings": {"command": "settings"}}}
+}`
+	if err := os.WriteFile(vscode.Path(), []byte(existing), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	listed, err := vscode.ListServers(ctx)
+	if err != nil {
+		t.Fatalf("ListServers: %v", err)
+	}
+	if len(listed) != 3 || listed["shared"].Command != "current" || listed["older"].Command != "older" || listed["settings"].Command != "settings" {
+		t.Fatalf("expected servers merged from every location with servers winning, got %+v", listed)
+	}
+
+	if err := vscode.UpsertServers(ctx, map[string]model.MCPServerSpec{
+		"demo": {Transport: model.ServerTransportSTDIO, Command: "npx"},
+	}); err != nil {
+		t.Fatalf("UpsertServers: %v", err)
+	}
+	data, err := os.ReadFile(vscode.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var raw map[string]any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := raw["mcpServers"]; ok {
+		t.Error("expected mcpServers moved to servers")
+	}
+	if _, ok := raw["mcp"]; ok {
+		t.Error("expected the emptied mcp object removed")
+	}
+	if _, ok := raw["inputs"]; !ok {
+		t.Error("expected unrelated keys kept")
+	}
+	servers, _ := raw["servers"].(map[string]any)
+	for _, name := range []string{"shared", "older", "settings", "demo"} {
+		if _, ok := servers[name]; !ok {
+			t.Errorf("expected %s under servers, got %v", name, servers)
+		}
+	}
+}
+
+func TestVSCodeAdapter_ReadsCommentedConfig(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	t.Setenv("APPDATA", filepath.Join(home, "AppData"))
+
+	all, err := AllAdapters(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vscode := all[model.TargetVSCode]
+	if err := os.MkdirAll(filepath.Dir(vscode.Path()), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	existing := `// Servers for this machine.
+{
+  "servers": {
+    /* hosted */
+    "remote": {"type": "http", "url": "https://example.com/mcp"}, // not a comment: "//"
+    "local": {"command": "npx", "args": ["-y", "a/*b*/c"]},
+  }
+}
+`
+	if err := os.WriteFile(vscode.Path(), []byte(existing), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	commented, ok := vscode.(CommentedConfig)
+	if !ok || !commented.HasComments() {
+		t.Fatal("expected the VS Code adapter to report the comments")
+	}
+	listed, err := vscode.ListServers(ctx)
+	if err != nil {
+		t.Fatalf("ListServers: %v", err)
+	}
+	if listed["remote"].URL != "https://example.com/mcp" || listed["local"].Args[1] != "a/*b*/c" {
+		t.Fatalf("expected string contents left alone, got %+v", listed)
+	}
+
+	if err := vscode.UpsertServers(ctx, map[string]model.MCPServerSpec{
+		"demo": {Transport: model.ServerTransportSTDIO, Command: "npx"},
+	}); err != nil {
+		t.Fatalf("UpsertServers: %v", err)
+	}
+	if commented.HasComments() {
+		t.Error("expected the rewritten config to be plain JSON")
+	}
+	if listed, err = vscode.ListServers(ctx); err != nil || len(listed) != 3 {
+		t.Fatalf("expected all servers kept on rewrite, got %+v, %v", listed, err)
+	}
+}
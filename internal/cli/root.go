@@ -6,12 +6,23 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"maps"
+	"net/http"
 	"os"
+	"os/signal"
+	"runtime"
+	"slices"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
 
+	"github.com/sarjann/mcper/internal/adapters"
 	"github.com/sarjann/mcper/internal/model"
+	"github.com/sarjann/mcper/internal/registry"
+	"github.com/sarjann/mcper/internal/schema"
 	"github.com/sarjann/mcper/internal/service"
 )
 
@@ -25,7 +36,7 @@ func NewRootCmd() *cobra.Command {
 			if !isInteractiveSession(in, out) {
 				return cmd.Help()
 			}
-			mgr, err := service.NewManager(in, out)
+			mgr, err := service.NewManager(in, out, managerOptions())
 			if err != nil {
 				return err
 			}
@@ -33,26 +44,83 @@ func NewRootCmd() *cobra.Command {
 		},
 	}
 	cmd.CompletionOptions.DisableDefaultCmd = true
+	cmd.PersistentFlags().BoolVar(&noBackup, "no-backup", envBool("MCPER_NO_BACKUP"), "Skip backing up client configs before writing them (env MCPER_NO_BACKUP)")
+	cmd.PersistentFlags().IntVar(&concurrency, "concurrency", runtime.NumCPU(), "Maximum taps, packages or client configs worked on at once")
+	cmd.PersistentFlags().DurationVar(&timeout, "timeout", 0, "Abort the command after this long, e.g. 2m (0 means no limit)")
+	cmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		if concurrency < 1 {
+			return fmt.Errorf("--concurrency must be at least 1, got %d", concurrency)
+		}
+		if timeout < 0 {
+			return fmt.Errorf("--timeout must not be negative, got %s", timeout)
+		}
+		if timeout > 0 {
+			ctx, cancel := context.WithTimeout(cmd.Context(), timeout)
+			cancelTimeout = cancel
+			cmd.SetContext(ctx)
+		}
+		return nil
+	}
 
 	cmd.AddCommand(
 		newSearchCmd(),
 		newInstallCmd(),
 		newInstallURLCmd(),
+		newWatchCmd(),
 		newListCmd(),
 		newInfoCmd(),
 		newRemoveCmd(),
 		newUpgradeCmd(),
+		newReinstallCmd(),
 		newDoctorCmd(),
+		newRepairCmd(),
+		newClientsCmd(),
+		newStatusCmd(),
+		newWhereisCmd(),
+		newEditCmd(),
+		newHistoryCmd(),
 		newExportCmd(),
 		newTapCmd(),
+		newBackupCmd(),
+		newTrustCmd(),
 		newSecretCmd(),
+		newConfigCmd(),
+		newSchemaCmd(),
+		newValidateCmd(),
 	)
 
 	return cmd
 }
 
+// stdout and stderr are where commands write. Execute routes them through
+// the redact-patterns setting.
+var (
+	stdout io.Writer = os.Stdout
+	stderr io.Writer = os.Stderr
+)
+
+// noBackup, concurrency and timeout are bound to persistent root flags.
+var (
+	noBackup    bool
+	concurrency int
+	timeout     time.Duration
+	// cancelTimeout releases the --timeout context once the command is done.
+	cancelTimeout context.CancelFunc = func() {}
+)
+
+func managerOptions() service.ManagerOptions {
+	return service.ManagerOptions{NoBackup: noBackup, Concurrency: concurrency}
+}
+
+// envBool reports whether the named environment variable is set to a true
+// value as understood by strconv.ParseBool.
+func envBool(name string) bool {
+	v, err := strconv.ParseBool(os.Getenv(name))
+	return err == nil && v
+}
+
 func managerOrDie() (*service.Manager, error) {
-	return service.NewManager(os.Stdin, os.Stdout)
+	return service.NewManager(os.Stdin, stdout, managerOptions())
 }
 
 func isInteractiveSession(in io.Reader, out io.Writer) bool {
@@ -76,6 +144,9 @@ func isInteractiveSession(in io.Reader, out io.Writer) bool {
 }
 
 func newSearchCmd() *cobra.Command {
+	var dedup bool
+	var showInstalled bool
+	var notInstalled bool
 	cmd := &cobra.Command{
 		Use:   "search <query>",
 		Short: "Search packages across taps",
@@ -85,93 +156,556 @@ func newSearchCmd() *cobra.Command {
 			if err != nil {
 				return err
 			}
-			results, err := mgr.Search(cmd.Context(), args[0])
+			results, err := mgr.Search(cmd.Context(), args[0], dedup)
 			if err != nil {
 				return err
 			}
-			if len(results) == 0 {
-				fmt.Println("No results")
-				return nil
-			}
-			for _, r := range results {
-				fmt.Printf("%s/%s %s - %s\n", r.Tap, r.Name, r.Latest, r.Description)
+			var installed []model.InstalledPackage
+			if showInstalled || notInstalled {
+				if installed, err = mgr.ListInstalled(); err != nil {
+					return err
+				}
 			}
+			printSearchResults(stdout, results, installed, showInstalled, notInstalled)
 			return nil
 		},
 	}
+	cmd.Flags().BoolVar(&dedup, "dedup", false, "Collapse packages provided by several taps into one row")
+	cmd.Flags().BoolVar(&showInstalled, "installed", false, "Mark results that are installed, with the installed version")
+	cmd.Flags().BoolVar(&notInstalled, "not-installed", false, "Only show packages that are not installed")
 	return cmd
 }
 
+// printSearchResults writes one row per result. Packages are matched to
+// installed ones by name; markInstalled tags those rows with the installed
+// version and notInstalled drops them.
+func printSearchResults(w io.Writer, results []registry.SearchResult, installed []model.InstalledPackage, markInstalled, notInstalled bool) {
+	versions := make(map[string]string, len(installed))
+	for _, pkg := range installed {
+		versions[pkg.Name] = pkg.Version
+	}
+	printed := 0
+	for _, r := range results {
+		version, ok := versions[r.Name]
+		if ok && notInstalled {
+			continue
+		}
+		mark := ""
+		if ok && markInstalled {
+			mark = fmt.Sprintf(" [installed %s]", version)
+		}
+		fmt.Fprintf(w, "%s/%s %s%s - %s\n", r.Tap, r.Name, r.Latest, mark, r.Description)
+		printed++
+	}
+	if printed == 0 {
+		fmt.Fprintln(w, "No results")
+	}
+}
+
 func newInstallCmd() *cobra.Command {
 	var tap string
 	var target string
 	var force bool
+	var fromFile string
+	var fromBundle string
+	var sha256 string
+	var asJSON bool
+	var serverMap []string
+	var envPairs []string
+	var inlineSecrets bool
+	var noPrompt bool
+	var onlyDetected bool
+	var createMissing bool
+	var dryRun bool
+	var serverPrefix string
+	var strict bool
+	var noVerify bool
+	var manifestPath string
+	var filter targetFilterFlags
+	var backups backupFlags
 
 	cmd := &cobra.Command{
 		Use:   "install <name[@version]>",
 		Short: "Install a package from a configured tap",
-		Args:  cobra.ExactArgs(1),
+		Args: func(cmd *cobra.Command, args []string) error {
+			if fromFile != "" || fromBundle != "" {
+				return cobra.NoArgs(cmd, args)
+			}
+			return cobra.ExactArgs(1)(cmd, args)
+		},
 		RunE: func(cmd *cobra.Command, args []string) error {
-			mgr, err := managerOrDie()
+			serverTargets, err := parseServerMap(serverMap)
+			if err != nil {
+				return err
+			}
+			envOverrides, err := parseEnvOverrides(envPairs)
+			if err != nil {
+				return err
+			}
+			if noVerify && (fromFile != "" || fromBundle != "") {
+				return errors.New("--no-verify only applies to tap installs")
+			}
+			if manifestPath != "" && (fromFile != "" || fromBundle != "") {
+				return errors.New("--manifest-path only applies to tap installs; use --from-file for a manifest outside a tap")
+			}
+			if dryRun && fromBundle != "" {
+				return errors.New("--dry-run cannot be combined with --from-bundle")
+			}
+			if fromBundle != "" && (fromFile != "" || sha256 != "" || len(serverTargets) > 0 || serverPrefix != "" || len(envOverrides) > 0) {
+				return errors.New("--from-bundle cannot be combined with --from-file, --sha256, --map, --env or --server-name-prefix")
+			}
+			mgr, err := installTargetManager(asJSON, onlyDetected, createMissing)
 			if err != nil {
 				return err
 			}
+			if dryRun {
+				var preview service.InstallPreview
+				if fromFile != "" {
+					preview, err = mgr.PlanInstallFile(cmd.Context(), service.InstallFileRequest{
+						Path:           fromFile,
+						SHA256:         sha256,
+						Target:         target,
+						ServerTargets:  serverTargets,
+						IncludeTargets: filter.include,
+						ExcludeTargets: filter.exclude,
+						ServerPrefix:   serverPrefix,
+						EnvOverrides:   envOverrides,
+					})
+				} else {
+					name, ver := splitNameVersion(args[0])
+					preview, err = mgr.PlanInstall(cmd.Context(), service.InstallRequest{
+						Name:           name,
+						Version:        ver,
+						Tap:            tap,
+						Target:         target,
+						ServerTargets:  serverTargets,
+						IncludeTargets: filter.include,
+						ExcludeTargets: filter.exclude,
+						ServerPrefix:   serverPrefix,
+						NoVerify:       noVerify,
+						ManifestPath:   manifestPath,
+						EnvOverrides:   envOverrides,
+					})
+				}
+				if err != nil {
+					return err
+				}
+				return printInstallPreview(stdout, preview, asJSON)
+			}
+			if fromBundle != "" {
+				installed, err := mgr.InstallFromBundle(cmd.Context(), service.InstallBundleRequest{
+					Path:           fromBundle,
+					Target:         target,
+					Force:          force,
+					KeepBackups:    backups.keep(),
+					InlineSecrets:  inlineSecrets,
+					IncludeTargets: filter.include,
+					ExcludeTargets: filter.exclude,
+				})
+				if err != nil && asJSON {
+					return err
+				}
+				if printErr := printBundleInstallResult(stdout, installed, asJSON); printErr != nil {
+					return printErr
+				}
+				return err
+			}
+			// Only a real file or tap install asks which clients to write;
+			// a dry run or bundle keeps the target it was given.
+			if target == "" && !noPrompt && onlyDetected && filter.empty() && !asJSON && isInteractiveSession(os.Stdin, os.Stdout) {
+				if target, err = promptInstallTargets(mgr); err != nil {
+					return err
+				}
+			}
+			if fromFile != "" {
+				installed, err := mgr.InstallFromFile(cmd.Context(), service.InstallFileRequest{
+					Path:           fromFile,
+					SHA256:         sha256,
+					Target:         target,
+					ServerTargets:  serverTargets,
+					Force:          force,
+					KeepBackups:    backups.keep(),
+					InlineSecrets:  inlineSecrets,
+					IncludeTargets: filter.include,
+					ExcludeTargets: filter.exclude,
+					ServerPrefix:   serverPrefix,
+					Strict:         strict,
+					EnvOverrides:   envOverrides,
+				})
+				if err != nil {
+					return err
+				}
+				return printInstallResult(stdout, installed, asJSON)
+			}
+			if sha256 != "" {
+				return errors.New("--sha256 requires --from-file")
+			}
 			name, ver := splitNameVersion(args[0])
 			installed, err := mgr.InstallFromTap(cmd.Context(), service.InstallRequest{
-				Name:    name,
-				Version: ver,
-				Tap:     tap,
-				Target:  target,
-				Force:   force,
+				Name:           name,
+				Version:        ver,
+				Tap:            tap,
+				Target:         target,
+				ServerTargets:  serverTargets,
+				Force:          force,
+				KeepBackups:    backups.keep(),
+				InlineSecrets:  inlineSecrets,
+				IncludeTargets: filter.include,
+				ExcludeTargets: filter.exclude,
+				ServerPrefix:   serverPrefix,
+				Strict:         strict,
+				NoVerify:       noVerify,
+				ManifestPath:   manifestPath,
+				EnvOverrides:   envOverrides,
 			})
 			if err != nil {
 				return err
 			}
-			fmt.Printf("Installed %s@%s targets=%s\n", installed.Name, installed.Version, strings.Join(installed.Targets, ","))
-			return nil
+			return printInstallResult(stdout, installed, asJSON)
 		},
 	}
 	cmd.Flags().StringVar(&tap, "tap", "", "Tap name (default: official)")
-	cmd.Flags().StringVar(&target, "target", model.TargetAll, "Target config(s): all (detected clients), or comma-separated (claude, codex, claude-desktop, cursor, vscode, gemini, zed, opencode)")
+	cmd.Flags().StringVar(&target, "target", "", "Target config(s): all (detected clients), or comma-separated (claude, codex, claude-desktop, cursor, vscode, gemini, zed, opencode) or aliases such as desktop; defaults to the default-target setting, else all")
 	cmd.Flags().BoolVar(&force, "force", false, "Skip conflict detection and overwrite existing servers")
+	cmd.Flags().StringVar(&fromFile, "from-file", "", "Install a local manifest file instead of a tap package")
+	cmd.Flags().StringVar(&sha256, "sha256", "", "Expected SHA-256 of the --from-file manifest")
+	cmd.Flags().StringVar(&fromBundle, "from-bundle", "", "Install every package in a bundle from export --format bundle, without contacting a tap")
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Output the installed package as JSON")
+	cmd.Flags().StringArrayVar(&serverMap, "map", nil, "Send one server to its own target(s) as server=target (repeatable); unmapped servers use --target")
+	cmd.Flags().BoolVar(&inlineSecrets, "inline-secrets", false, "Write the package's stored secrets into the env of every server that requires them")
+	cmd.Flags().StringArrayVar(&envPairs, "env", nil, "Set an env value on one server as server:KEY=VALUE (repeatable); kept in state so reinstall and upgrade write it again")
+	cmd.Flags().BoolVar(&noPrompt, "no-prompt", false, "Install to every detected client without asking when --target is omitted")
+	cmd.Flags().BoolVar(&onlyDetected, "only-detected", true, onlyDetectedUsage)
+	cmd.Flags().BoolVar(&createMissing, "create-missing-clients", false, createMissingUsage)
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show the changes and conflicts the install would cause without applying them; with --json, print the plan as JSON")
+	cmd.Flags().BoolVar(&strict, "strict", false, "Fail instead of warning when a tool the manifest requires (required_tools) is not on PATH")
+	cmd.Flags().StringVar(&serverPrefix, "server-name-prefix", "", "Write servers as <prefix>-<server> to avoid name clashes across packages; \"auto\" uses the package name")
+	cmd.Flags().StringVar(&manifestPath, "manifest-path", "", "Read the package's manifest from this local file instead of the tap, unverified; reinstalls read it again until the next upgrade (for manifest authors)")
+	cmd.Flags().BoolVar(&noVerify, "no-verify", false, "Skip the tap's trust checks on the index and manifest (unsafe; only for taps trusted by other means). The install is recorded as unverified")
+	filter.register(cmd)
+	backups.register(cmd)
+	return cmd
+}
+
+// printInstallPreview writes the plan of an install --dry-run. The JSON form
+// lists every conflict and diff so automation can gate on them.
+func printInstallPreview(w io.Writer, preview service.InstallPreview, asJSON bool) error {
+	if asJSON {
+		data, err := json.MarshalIndent(preview, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w, string(data))
+		return nil
+	}
+	fmt.Fprintf(w, "%s@%s (dry run)\n", preview.Name, preview.Version)
+	service.FormatInstallPlan(w, preview.Plan)
+	return nil
+}
+
+func newWatchCmd() *cobra.Command {
+	var target string
+	var serverMap []string
+	var inlineSecrets bool
+	var onlyDetected bool
+	var createMissing bool
+	var force bool
+	var interval time.Duration
+	var debounce time.Duration
+	var filter targetFilterFlags
+	var backups backupFlags
+
+	cmd := &cobra.Command{
+		Use:   "watch <manifest-path>",
+		Short: "Re-install a local manifest every time it changes",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			serverTargets, err := parseServerMap(serverMap)
+			if err != nil {
+				return err
+			}
+			mgr, err := installTargetManager(false, onlyDetected, createMissing)
+			if err != nil {
+				return err
+			}
+			// Ctrl+C cancels the command context, which ends the watch.
+			return mgr.Watch(cmd.Context(), service.WatchRequest{
+				Path:           args[0],
+				Target:         target,
+				ServerTargets:  serverTargets,
+				KeepBackups:    backups.keep(),
+				InlineSecrets:  inlineSecrets,
+				IncludeTargets: filter.include,
+				ExcludeTargets: filter.exclude,
+				Force:          force,
+				Interval:       interval,
+				Debounce:       debounce,
+			})
+		},
+	}
+	cmd.Flags().StringVar(&target, "target", "", "Target config(s) to keep in sync, as for install; defaults to the default-target setting, else all")
+	cmd.Flags().StringArrayVar(&serverMap, "map", nil, "Send one server to its own target(s) as server=target (repeatable); unmapped servers use --target")
+	cmd.Flags().BoolVar(&inlineSecrets, "inline-secrets", false, "Write the package's stored secrets into the env of every server that requires them")
+	cmd.Flags().BoolVar(&force, "force", false, "Overwrite servers of the same name that the package did not write without asking")
+	cmd.Flags().BoolVar(&onlyDetected, "only-detected", true, onlyDetectedUsage)
+	cmd.Flags().BoolVar(&createMissing, "create-missing-clients", false, createMissingUsage)
+	cmd.Flags().DurationVar(&interval, "interval", 500*time.Millisecond, "How often to check the manifest for changes")
+	cmd.Flags().DurationVar(&debounce, "debounce", 300*time.Millisecond, "How long the manifest must stay unchanged before it is re-installed")
+	filter.register(cmd)
+	backups.register(cmd)
 	return cmd
 }
 
+// targetPicker is what promptInstallTargets needs from the manager.
+type targetPicker interface {
+	ConfigGet(key string) (string, error)
+	Detect() []adapters.ClientStatus
+}
+
+// promptInstallTargets asks which detected clients to install to when no
+// --target was given and the default would write to all of them. An empty
+// result leaves target resolution to the manager.
+func promptInstallTargets(mgr targetPicker) (string, error) {
+	def, err := mgr.ConfigGet("default-target")
+	if err != nil {
+		return "", err
+	}
+	if def != model.TargetAll {
+		return "", nil
+	}
+	var detected []string
+	for _, c := range mgr.Detect() {
+		if c.Detected && c.AdapterOK {
+			detected = append(detected, c.Target)
+		}
+	}
+	if len(detected) < 2 {
+		return "", nil
+	}
+	chosen, err := selectMany("Install to which clients?", detected)
+	if err != nil {
+		return "", err
+	}
+	if len(chosen) == 0 {
+		return "", errors.New("no clients selected")
+	}
+	return strings.Join(chosen, ","), nil
+}
+
+// parseServerMap turns repeated server=target flags into install mappings.
+// Mapping the same server twice adds to its targets.
+func parseServerMap(pairs []string) (map[string]string, error) {
+	if len(pairs) == 0 {
+		return nil, nil
+	}
+	out := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		server, target, ok := strings.Cut(pair, "=")
+		server, target = strings.TrimSpace(server), strings.TrimSpace(target)
+		if !ok || server == "" || target == "" {
+			return nil, fmt.Errorf("invalid --map %q: expected server=target", pair)
+		}
+		if prev, ok := out[server]; ok {
+			target = prev + "," + target
+		}
+		out[server] = target
+	}
+	return out, nil
+}
+
+// parseEnvOverrides turns repeated --env server:KEY=VALUE flags into env
+// values per server.
+func parseEnvOverrides(pairs []string) (map[string]map[string]string, error) {
+	if len(pairs) == 0 {
+		return nil, nil
+	}
+	out := make(map[string]map[string]string)
+	for _, pair := range pairs {
+		server, assignment, ok := strings.Cut(pair, ":")
+		key, value, hasValue := strings.Cut(assignment, "=")
+		server, key = strings.TrimSpace(server), strings.TrimSpace(key)
+		if !ok || !hasValue || server == "" || key == "" {
+			return nil, fmt.Errorf("invalid --env %q: expected server:KEY=VALUE", pair)
+		}
+		if out[server] == nil {
+			out[server] = make(map[string]string)
+		}
+		out[server][key] = value
+	}
+	return out, nil
+}
+
 func newInstallURLCmd() *cobra.Command {
 	var target string
 	var yes bool
 	var force bool
+	var asJSON bool
+	var inlineSecrets bool
+	var rawHeaders []string
+	var sigURL, certURL, oidcIssuer string
+	var identities []string
+	var onlyDetected bool
+	var createMissing bool
+	var filter targetFilterFlags
+	var backups backupFlags
 
 	cmd := &cobra.Command{
 		Use:   "install-url <url-or-path>",
 		Short: "Install package from direct manifest URL/path",
 		Args:  cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			mgr, err := managerOrDie()
+			headers, err := parseHeaders(rawHeaders)
+			if err != nil {
+				return err
+			}
+			if (sigURL == "") != (certURL == "") {
+				return errors.New("--sig and --cert must be given together")
+			}
+			if sigURL != "" && len(identities) == 0 {
+				return errors.New("--sig requires at least one --identity")
+			}
+			mgr, err := installTargetManager(asJSON, onlyDetected, createMissing)
 			if err != nil {
 				return err
 			}
 			installed, err := mgr.InstallFromURL(cmd.Context(), service.InstallURLRequest{
-				URL:    args[0],
-				Target: target,
-				Yes:    yes,
-				Force:  force,
+				URL:           args[0],
+				Target:        target,
+				Yes:           yes,
+				Force:         force,
+				KeepBackups:   backups.keep(),
+				InlineSecrets: inlineSecrets,
+				Headers:       headers,
+				Signature: registry.DetachedSignature{
+					SigURL:     sigURL,
+					CertURL:    certURL,
+					Identities: identities,
+					OIDCIssuer: oidcIssuer,
+				},
+				IncludeTargets: filter.include,
+				ExcludeTargets: filter.exclude,
 			})
 			if err != nil {
 				return err
 			}
-			fmt.Printf("Installed %s@%s from %s\n", installed.Name, installed.Version, installed.Source.URL)
-			return nil
+			return printInstallResult(stdout, installed, asJSON)
 		},
 	}
-	cmd.Flags().StringVar(&target, "target", model.TargetAll, "Target config(s): all (detected clients), or comma-separated (claude, codex, claude-desktop, cursor, vscode, gemini, zed, opencode)")
+	cmd.Flags().StringVar(&target, "target", "", "Target config(s): all (detected clients), or comma-separated (claude, codex, claude-desktop, cursor, vscode, gemini, zed, opencode) or aliases such as desktop; defaults to the default-target setting, else all")
 	cmd.Flags().BoolVar(&yes, "yes", false, "Trust direct source without interactive prompt")
 	cmd.Flags().BoolVar(&force, "force", false, "Skip conflict detection and overwrite existing servers")
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Output the installed package as JSON")
+	cmd.Flags().BoolVar(&inlineSecrets, "inline-secrets", false, "Write the package's stored secrets into the env of every server that requires them")
+	cmd.Flags().StringArrayVar(&rawHeaders, "header", nil, "Extra HTTP header for the manifest request as 'Name: value' (repeatable); never stored")
+	cmd.Flags().StringVar(&sigURL, "sig", "", "URL or path of a detached cosign signature the manifest must verify against (replaces the trust prompt)")
+	cmd.Flags().StringVar(&certURL, "cert", "", "URL or path of the signing certificate for --sig")
+	cmd.Flags().StringArrayVar(&identities, "identity", nil, "Signer identity accepted for --sig, such as a workflow URL or email (repeatable)")
+	cmd.Flags().StringVar(&oidcIssuer, "oidc-issuer", "https://token.actions.githubusercontent.com", "OIDC issuer the --sig certificate must come from")
+	cmd.Flags().BoolVar(&onlyDetected, "only-detected", true, onlyDetectedUsage)
+	cmd.Flags().BoolVar(&createMissing, "create-missing-clients", false, createMissingUsage)
+	filter.register(cmd)
+	backups.register(cmd)
 	return cmd
 }
 
+// targetFilterFlags are the --include and --exclude flags that narrow
+// --target all.
+type targetFilterFlags struct {
+	include []string
+	exclude []string
+}
+
+func (f *targetFilterFlags) register(cmd *cobra.Command) {
+	cmd.Flags().StringSliceVar(&f.include, "include", nil, "With --target all (or no --target), only write to these detected clients (comma-separated or repeatable)")
+	cmd.Flags().StringSliceVar(&f.exclude, "exclude", nil, "With --target all (or no --target), skip these clients (comma-separated or repeatable)")
+}
+
+func (f targetFilterFlags) empty() bool {
+	return len(f.include) == 0 && len(f.exclude) == 0
+}
+
+// parseHeaders turns repeated 'Name: value' flags into request headers.
+// Errors identify a bad header by position and never echo it, since the
+// value is usually a credential.
+func parseHeaders(raw []string) (http.Header, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	headers := make(http.Header, len(raw))
+	for i, h := range raw {
+		name, value, ok := strings.Cut(h, ":")
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+		if !ok || name == "" || value == "" || strings.ContainsAny(name, " \t") {
+			return nil, fmt.Errorf("invalid --header #%d: expected 'Name: value'", i+1)
+		}
+		headers.Add(name, value)
+	}
+	return headers, nil
+}
+
+// installManager keeps stdout clean for --json by sending the manager's
+// progress output (plans, warnings, setup prompts) to stderr.
+func installManager(asJSON bool) (*service.Manager, error) {
+	return installTargetManager(asJSON, true, false)
+}
+
+// installTargetManager is installManager for commands with --only-detected
+// and --create-missing-clients; they let the manager also write to clients
+// that are not detected, for every target or only for named ones.
+func installTargetManager(asJSON, onlyDetected, createMissing bool) (*service.Manager, error) {
+	opts := managerOptions()
+	opts.IncludeUndetected = !onlyDetected
+	opts.CreateMissingClients = createMissing
+	if asJSON {
+		return service.NewManager(os.Stdin, stderr, opts)
+	}
+	return service.NewManager(os.Stdin, stdout, opts)
+}
+
+const onlyDetectedUsage = "Limit targets, including all, to detected clients; false also writes configs for known clients that are not installed yet"
+
+const createMissingUsage = "Create the config of a client named in --target even when it is not detected, for pre-provisioning; all still means detected clients"
+
+func printInstallResult(w io.Writer, installed model.InstalledPackage, asJSON bool) error {
+	if asJSON {
+		data, err := json.MarshalIndent(installed, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w, string(data))
+		return nil
+	}
+	if installed.Source.Type == model.SourceTypeDirect {
+		fmt.Fprintf(w, "Installed %s@%s from %s\n", installed.Name, installed.Version, installed.Source.URL)
+		return nil
+	}
+	fmt.Fprintf(w, "Installed %s@%s targets=%s\n", installed.Name, installed.Version, strings.Join(installed.Targets, ","))
+	return nil
+}
+
+// printBundleInstallResult reports the packages a bundle install applied,
+// which on failure are the ones before the failing entry.
+func printBundleInstallResult(w io.Writer, installed []model.InstalledPackage, asJSON bool) error {
+	if asJSON {
+		if installed == nil {
+			installed = []model.InstalledPackage{}
+		}
+		data, err := json.MarshalIndent(installed, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w, string(data))
+		return nil
+	}
+	for _, pkg := range installed {
+		fmt.Fprintf(w, "Installed %s@%s targets=%s\n", pkg.Name, pkg.Version, strings.Join(pkg.Targets, ","))
+	}
+	return nil
+}
+
 func newListCmd() *cobra.Command {
 	var asJSON bool
+	var withServers bool
 
 	cmd := &cobra.Command{
 		Use:   "list",
@@ -185,34 +719,71 @@ func newListCmd() *cobra.Command {
 			if err != nil {
 				return err
 			}
-			if asJSON {
-				data, _ := json.MarshalIndent(pkgs, "", "  ")
-				fmt.Println(string(data))
-				return nil
-			}
-			if len(pkgs) == 0 {
-				fmt.Println("No packages installed")
-				return nil
-			}
-			for _, p := range pkgs {
-				source := p.Source.Type
-				if p.Source.Tap != "" {
-					source += ":" + p.Source.Tap
+			var servers map[string][]service.InstalledServer
+			if withServers {
+				servers = make(map[string][]service.InstalledServer, len(pkgs))
+				for _, p := range pkgs {
+					servers[p.Name] = mgr.InstalledServers(cmd.Context(), p)
 				}
-				if p.Source.URL != "" {
-					source += ":" + p.Source.URL
-				}
-				fmt.Printf("%s@%s source=%s targets=%s\n", p.Name, p.Version, source, strings.Join(p.Targets, ","))
 			}
-			return nil
+			return printInstalledList(stdout, pkgs, servers, asJSON)
 		},
 	}
 	cmd.Flags().BoolVar(&asJSON, "json", false, "Output JSON")
+	cmd.Flags().BoolVar(&withServers, "servers", false, "Show each package's servers as currently configured in every client")
 	return cmd
 }
 
+// printInstalledList prints installed packages, followed by their servers
+// when servers is non-nil.
+func printInstalledList(w io.Writer, pkgs []model.InstalledPackage, servers map[string][]service.InstalledServer, asJSON bool) error {
+	if asJSON {
+		var payload any = pkgs
+		if servers != nil {
+			type packageWithServers struct {
+				model.InstalledPackage
+				ConfiguredServers []service.InstalledServer `json:"configured_servers"`
+			}
+			withServers := make([]packageWithServers, 0, len(pkgs))
+			for _, p := range pkgs {
+				withServers = append(withServers, packageWithServers{InstalledPackage: p, ConfiguredServers: servers[p.Name]})
+			}
+			payload = withServers
+		}
+		data, _ := json.MarshalIndent(payload, "", "  ")
+		fmt.Fprintln(w, string(data))
+		return nil
+	}
+	if len(pkgs) == 0 {
+		fmt.Fprintln(w, "No packages installed")
+		return nil
+	}
+	for _, p := range pkgs {
+		source := p.Source.Type
+		if p.Source.Tap != "" {
+			source += ":" + p.Source.Tap
+		}
+		if p.Source.URL != "" {
+			source += ":" + p.Source.URL
+		}
+		fmt.Fprintf(w, "%s@%s source=%s targets=%s\n", p.Name, p.Version, source, strings.Join(p.Targets, ","))
+		for _, srv := range servers[p.Name] {
+			switch {
+			case srv.Error != "":
+				fmt.Fprintf(w, "  [%s] %s (%s)\n", srv.Target, srv.Name, srv.Error)
+			case srv.Missing:
+				fmt.Fprintf(w, "  [%s] %s (missing from config)\n", srv.Target, srv.Name)
+			default:
+				fmt.Fprintf(w, "  [%s] %s %s\n", srv.Target, srv.Name, srv.Summary)
+			}
+		}
+	}
+	return nil
+}
+
 func newInfoCmd() *cobra.Command {
 	var tap string
+	var versions bool
 	cmd := &cobra.Command{
 		Use:   "info <name>",
 		Short: "Show package manifest details",
@@ -222,47 +793,96 @@ func newInfoCmd() *cobra.Command {
 			if err != nil {
 				return err
 			}
+			if versions {
+				items, err := mgr.ListVersions(cmd.Context(), args[0], tap)
+				if err != nil {
+					return err
+				}
+				for _, v := range items {
+					switch {
+					case v.Yanked && v.YankReason != "":
+						fmt.Fprintf(stdout, "%s (yanked: %s)\n", v.Version, v.YankReason)
+					case v.Yanked:
+						fmt.Fprintf(stdout, "%s (yanked)\n", v.Version)
+					default:
+						fmt.Fprintln(stdout, v.Version)
+					}
+				}
+				return nil
+			}
 			info, err := mgr.Info(cmd.Context(), args[0], tap)
 			if err != nil {
 				return err
 			}
 			data, _ := json.MarshalIndent(info, "", "  ")
-			fmt.Println(string(data))
+			fmt.Fprintln(stdout, string(data))
 			return nil
 		},
 	}
 	cmd.Flags().StringVar(&tap, "tap", "", "Tap name override")
+	cmd.Flags().BoolVar(&versions, "versions", false, "List all available versions instead of the latest manifest")
 	return cmd
 }
 
 func newRemoveCmd() *cobra.Command {
+	var keepSecrets bool
+	var idempotent bool
+	var pruneEmpty bool
+	var asJSON bool
 	cmd := &cobra.Command{
 		Use:   "remove <name>",
 		Short: "Remove an installed package",
 		Args:  cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			mgr, err := managerOrDie()
+			mgr, err := installManager(asJSON)
 			if err != nil {
 				return err
 			}
-			if err := mgr.Remove(cmd.Context(), args[0]); err != nil {
+			result, err := mgr.Remove(cmd.Context(), service.RemoveRequest{Name: args[0], KeepSecrets: keepSecrets, Idempotent: idempotent, PruneEmpty: pruneEmpty})
+			if err != nil {
 				return err
 			}
-			fmt.Printf("Removed %s\n", args[0])
-			return nil
+			return printRemoveResult(stdout, result, asJSON)
 		},
 	}
+	cmd.Flags().BoolVar(&keepSecrets, "keep-secrets", false, "Keep the package's keychain secrets")
+	cmd.Flags().BoolVar(&idempotent, "idempotent", false, "Succeed when the package is not installed, reporting removed: false")
+	cmd.Flags().BoolVar(&pruneEmpty, "prune-empty", false, "Delete a client's servers key when the removal leaves it empty instead of writing an empty object")
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Output the result as JSON; a failure prints an error object with a code such as not_installed")
 	return cmd
 }
 
+func printRemoveResult(w io.Writer, result service.RemoveResult, asJSON bool) error {
+	if asJSON {
+		data, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w, string(data))
+		return nil
+	}
+	if !result.Removed {
+		fmt.Fprintf(w, "%s is not installed; nothing to remove\n", result.Name)
+		return nil
+	}
+	fmt.Fprintf(w, "Removed %s\n", result.Name)
+	return nil
+}
+
 func newUpgradeCmd() *cobra.Command {
 	var major bool
+	var asJSON bool
+	var dryRun bool
+	var sinceVersion string
+	var target string
+	var serversOnly bool
+	var backups backupFlags
 	cmd := &cobra.Command{
 		Use:   "upgrade [name]",
 		Short: "Upgrade installed package(s)",
 		Args:  cobra.MaximumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			mgr, err := managerOrDie()
+			mgr, err := installManager(asJSON)
 			if err != nil {
 				return err
 			}
@@ -270,27 +890,151 @@ func newUpgradeCmd() *cobra.Command {
 			if len(args) == 1 {
 				name = args[0]
 			}
-			res, err := mgr.Upgrade(cmd.Context(), name, major)
+			res, err := mgr.Upgrade(cmd.Context(), service.UpgradeRequest{
+				Name:         name,
+				AllowMajor:   major,
+				KeepBackups:  backups.keep(),
+				DryRun:       dryRun,
+				SinceVersion: sinceVersion,
+				Target:       target,
+				ServersOnly:  serversOnly,
+			})
+			if err != nil {
+				return err
+			}
+			if asJSON {
+				data, _ := json.MarshalIndent(res, "", "  ")
+				fmt.Fprintln(stdout, string(data))
+				return nil
+			}
+			printUpgradeResults(stdout, res)
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&major, "major", false, "Allow major version upgrades")
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Output JSON")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show the changes each upgrade would make without applying them")
+	cmd.Flags().StringVar(&sinceVersion, "since-version", "", "Show release notes for every version after this one instead of after the installed version")
+	cmd.Flags().StringVar(&target, "target", "", "Upgrade only in these clients (comma-separated); the package's other clients stay on their current version until upgraded")
+	cmd.Flags().BoolVar(&serversOnly, "servers-only", false, "Re-apply the installed version's servers without checking the tap for a newer version")
+	backups.register(cmd)
+	return cmd
+}
+
+func newReinstallCmd() *cobra.Command {
+	var all bool
+	var asJSON bool
+	var dryRun bool
+	var backups backupFlags
+	cmd := &cobra.Command{
+		Use:   "reinstall [name...]",
+		Short: "Rewrite installed packages into their client configs",
+		Long:  "Re-resolve installed packages at their installed version and write their servers to the recorded targets again, for example after a client upgrade changed its config format. A package that fails is reported and the others still run.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			mgr, err := installManager(asJSON)
 			if err != nil {
 				return err
 			}
-			for _, r := range res {
-				if r.WasUpgraded {
-					fmt.Printf("Upgraded %s %s -> %s\n", r.Name, r.OldVersion, r.NewVersion)
-				} else {
-					fmt.Printf("No change %s (%s)\n", r.Name, r.OldVersion)
+			results, err := mgr.Reinstall(cmd.Context(), service.ReinstallRequest{
+				Names:       args,
+				All:         all,
+				DryRun:      dryRun,
+				KeepBackups: backups.keep(),
+			})
+			if err != nil && len(results) == 0 {
+				return err
+			}
+			if printErr := printReinstallResults(stdout, results, asJSON); printErr != nil {
+				return printErr
+			}
+			if err != nil {
+				return reported(err)
+			}
+			failed := 0
+			for _, r := range results {
+				if r.Error != "" {
+					failed++
 				}
 			}
+			if failed > 0 {
+				return reported(fmt.Errorf("%d of %d package(s) failed to reinstall", failed, len(results)))
+			}
 			return nil
 		},
 	}
-	cmd.Flags().BoolVar(&major, "major", false, "Allow major version upgrades")
+	cmd.Flags().BoolVar(&all, "all", false, "Reinstall every installed package")
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Output the per-package results as JSON")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show the changes each reinstall would make without applying them")
+	backups.register(cmd)
 	return cmd
 }
 
+func printReinstallResults(w io.Writer, results []service.ReinstallResult, asJSON bool) error {
+	if asJSON {
+		data, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w, string(data))
+		return nil
+	}
+	for _, r := range results {
+		switch {
+		case r.Error != "":
+			fmt.Fprintf(w, "Failed %s@%s: %s\n", r.Name, r.Version, r.Error)
+		case r.Plan != nil:
+			fmt.Fprintf(w, "%s@%s (dry run)\n", r.Name, r.Version)
+			service.FormatInstallPlan(w, *r.Plan)
+		default:
+			fmt.Fprintf(w, "Reinstalled %s@%s targets=%s\n", r.Name, r.Version, strings.Join(r.Targets, ","))
+		}
+	}
+	return nil
+}
+
+func printUpgradeResults(w io.Writer, res []service.UpgradeResult) {
+	for _, r := range res {
+		switch {
+		case r.DryRun && r.ServersOnly:
+			fmt.Fprintf(w, "Would re-apply servers of %s@%s\n", r.Name, r.NewVersion)
+		case r.DryRun:
+			fmt.Fprintf(w, "Would upgrade %s %s -> %s\n", r.Name, r.OldVersion, r.NewVersion)
+		case !r.WasUpgraded:
+			fmt.Fprintf(w, "No change %s (%s)\n", r.Name, r.OldVersion)
+			continue
+		case r.ServersOnly:
+			fmt.Fprintf(w, "Re-applied servers of %s@%s\n", r.Name, r.NewVersion)
+		default:
+			fmt.Fprintf(w, "Upgraded %s %s -> %s\n", r.Name, r.OldVersion, r.NewVersion)
+		}
+		for _, target := range slices.Sorted(maps.Keys(r.HeldTargets)) {
+			fmt.Fprintf(w, "  %s stays on %s\n", target, r.HeldTargets[target])
+		}
+		notes := append(slices.Clip(r.EarlierNotes), service.VersionNotes{Version: r.NewVersion, Notes: r.ReleaseNotes})
+		for _, n := range notes {
+			if n.Notes == "" {
+				continue
+			}
+			fmt.Fprintf(w, "  Release notes for %s:\n", n.Version)
+			for _, line := range strings.Split(strings.TrimSpace(n.Notes), "\n") {
+				fmt.Fprintf(w, "    %s\n", line)
+			}
+		}
+		if r.Changelog != "" {
+			fmt.Fprintf(w, "  Changelog: %s\n", r.Changelog)
+		}
+	}
+}
+
 func newDoctorCmd() *cobra.Command {
 	var fix bool
 	var asJSON bool
+	var checks []string
+	var pkg string
+	var manifestPath string
+	var keyringOnly bool
+	var legacyJSON bool
+	var probe bool
 	cmd := &cobra.Command{
 		Use:   "doctor",
 		Short: "Validate installed MCP packages and config health",
@@ -299,100 +1043,529 @@ func newDoctorCmd() *cobra.Command {
 			if err != nil {
 				return err
 			}
-			issues, err := mgr.Doctor(cmd.Context(), fix)
+			req := service.DoctorRequest{Fix: fix, KeyringOnly: keyringOnly, Package: pkg, ManifestPath: manifestPath, Probe: probe}
+			for _, check := range checks {
+				switch check {
+				case "command-versions":
+					req.CheckCommandVersions = true
+				default:
+					return fmt.Errorf("unknown doctor check %q", check)
+				}
+			}
+			result, err := mgr.RunDoctor(cmd.Context(), req)
 			if err != nil {
 				return err
 			}
-			if asJSON {
-				data, _ := json.MarshalIndent(issues, "", "  ")
-				fmt.Println(string(data))
-			} else if len(issues) == 0 {
-				fmt.Println("doctor: no issues found")
-			} else {
-				for _, issue := range issues {
-					fmt.Printf("[%s] package=%s target=%s detail=%s\n", issue.Kind, issue.Package, issue.Target, issue.Detail)
-				}
+			if err := printDoctorIssues(stdout, result.Issues, result.Fixed, asJSON, legacyJSON); err != nil {
+				return err
 			}
-			if len(issues) > 0 {
-				return errors.New("doctor found issues")
+			if len(result.Issues) > 0 {
+				return reported(errors.New("doctor found issues"))
 			}
 			return nil
 		},
 	}
 	cmd.Flags().BoolVar(&fix, "fix", false, "Attempt auto-fixes for missing config entries")
-	cmd.Flags().BoolVar(&asJSON, "json", false, "Output JSON")
+	cmd.Flags().StringSliceVar(&checks, "check", nil, "Additional checks to run: command-versions")
+	cmd.Flags().BoolVar(&keyringOnly, "keyring-only", false, "Report required env vars that are set in the host environment but not the keychain")
+	cmd.Flags().StringVar(&pkg, "package", "", "Only check this installed package")
+	cmd.Flags().StringVar(&manifestPath, "manifest", "", "Check --package against this local manifest instead of its source")
+	cmd.Flags().BoolVar(&probe, "probe", false, "Send a HEAD request to each http server and report those that do not respond (makes network calls)")
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Output JSON as {ok, issue_count, issues}")
+	cmd.Flags().BoolVar(&legacyJSON, "legacy-json", false, "Output JSON as a bare array of issues")
 	return cmd
 }
 
+// printDoctorIssues prints doctor findings followed by the fixes --fix
+// applied. The legacy bare-array JSON has no room for fixes and omits them.
+func printDoctorIssues(w io.Writer, issues []service.DoctorIssue, fixed []service.FixAction, asJSON, legacyJSON bool) error {
+	var payload any
+	switch {
+	case legacyJSON:
+		if issues == nil {
+			issues = []service.DoctorIssue{}
+		}
+		payload = issues
+	case asJSON:
+		report := service.NewDoctorReport(issues)
+		report.Fixed = fixed
+		payload = report
+	default:
+		if len(issues) == 0 {
+			fmt.Fprintln(w, "doctor: no issues found")
+		}
+		for _, issue := range issues {
+			fmt.Fprintf(w, "[%s] package=%s target=%s detail=%s\n", issue.Kind, issue.Package, issue.Target, issue.Detail)
+		}
+		for _, fix := range fixed {
+			fmt.Fprintf(w, "[fixed:%s] package=%s target=%s detail=%s\n", fix.Action, fix.Package, fix.Target, fix.Detail)
+		}
+		return nil
+	}
+	data, err := json.MarshalIndent(payload, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(w, string(data))
+	return nil
+}
+
 func newExportCmd() *cobra.Command {
 	var format string
+	var out string
+	var diffBaseline string
+	var asJSON bool
+	var ignoreAge bool
 	cmd := &cobra.Command{
 		Use:   "export",
-		Short: "Export lockfile or SBOM from current installed state",
+		Short: "Export lockfile, SBOM, manifest bundle or env template from current installed state",
 		RunE: func(cmd *cobra.Command, args []string) error {
 			mgr, err := managerOrDie()
 			if err != nil {
 				return err
 			}
-			payload, err := mgr.Export(format)
+			if diffBaseline != "" {
+				if format != "lock" {
+					return errors.New("--diff requires --format lock")
+				}
+				if out != "" {
+					return errors.New("--diff cannot be combined with --out")
+				}
+				diff, err := mgr.DiffLockfile(diffBaseline, ignoreAge)
+				if err != nil {
+					return err
+				}
+				return printLockDiff(stdout, diffBaseline, diff, asJSON)
+			}
+			if out != "" {
+				written, err := mgr.ExportToFile(cmd.Context(), format, out)
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(stdout, "Wrote %s\n", written)
+				return nil
+			}
+			payload, err := mgr.Export(cmd.Context(), format)
 			if err != nil {
 				return err
 			}
-			fmt.Println(string(payload))
+			fmt.Fprintln(stdout, string(payload))
 			return nil
 		},
 	}
-	cmd.Flags().StringVar(&format, "format", "lock", "Export format: lock or sbom")
+	cmd.Flags().StringVar(&format, "format", "lock", "Export format: lock, sbom, bundle (installed manifests for offline reinstall) or env (empty assignments for every required secret)")
+	cmd.Flags().StringVar(&out, "out", "", "Write to this file (or default file name inside this directory) instead of stdout")
+	cmd.Flags().StringVar(&diffBaseline, "diff", "", "Compare installed packages against this baseline lockfile instead of exporting")
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Output the --diff result as JSON")
+	cmd.Flags().BoolVar(&ignoreAge, "ignore-age", false, "Do not warn when the --diff baseline was generated in the future or longer ago than the lock-max-age setting")
 	return cmd
 }
 
-func newTapCmd() *cobra.Command {
-	cmd := &cobra.Command{Use: "tap", Short: "Manage package taps"}
-	cmd.AddCommand(newTapAddCmd(), newTapRemoveCmd(), newTapListCmd())
-	return cmd
+func printLockDiff(w io.Writer, baseline string, diff service.LockDiff, asJSON bool) error {
+	if asJSON {
+		data, err := json.MarshalIndent(diff, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w, string(data))
+		return nil
+	}
+	for _, warning := range diff.Warnings {
+		fmt.Fprintf(w, "Warning: %s\n", warning)
+	}
+	if diff.Empty() {
+		fmt.Fprintf(w, "No differences from %s\n", baseline)
+		return nil
+	}
+	for _, c := range diff.Added {
+		fmt.Fprintf(w, "+ %s %s\n", c.Name, c.To)
+	}
+	for _, c := range diff.Removed {
+		fmt.Fprintf(w, "- %s %s\n", c.Name, c.From)
+	}
+	for _, c := range diff.Changed {
+		fmt.Fprintf(w, "~ %s %s -> %s\n", c.Name, c.From, c.To)
+	}
+	return nil
 }
 
-func newTapAddCmd() *cobra.Command {
-	var description string
+func newRepairCmd() *cobra.Command {
+	var yes bool
+	var dryRun bool
+	var asJSON bool
 	cmd := &cobra.Command{
-		Use:   "add <name> <url>",
-		Short: "Add or update a package tap",
-		Args:  cobra.ExactArgs(2),
+		Use:   "repair",
+		Short: "Rebuild install records from the servers in client configs",
+		Long:  "Rebuild install records from the servers in detected client configs, for when mcper state was lost. Each server no installed package owns is recorded as a package of the same name with an unknown source, so list, remove and doctor work on it again.",
+		Args:  cobra.NoArgs,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			mgr, err := managerOrDie()
 			if err != nil {
 				return err
 			}
-			return mgr.TapAdd(service.TapAddRequest{
-				Name:        args[0],
-				URL:         args[1],
-				Description: description,
-			})
+			result, err := mgr.Repair(cmd.Context(), service.RepairRequest{Yes: yes, DryRun: dryRun})
+			if err != nil {
+				return err
+			}
+			return printRepairResult(stdout, result, asJSON)
 		},
 	}
-	cmd.Flags().StringVar(&description, "description", "", "Tap description")
+	cmd.Flags().BoolVar(&yes, "yes", false, "Rewrite state without asking for confirmation")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "List the packages that would be recorded without writing state")
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Output the recovered packages as JSON")
 	return cmd
 }
 
-func newTapRemoveCmd() *cobra.Command {
+func printRepairResult(w io.Writer, result service.RepairResult, asJSON bool) error {
+	if asJSON {
+		data, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w, string(data))
+		return nil
+	}
+	if len(result.Recovered) == 0 {
+		fmt.Fprintln(w, "Nothing to repair: every configured server belongs to an installed package")
+		return nil
+	}
+	verb := "Recorded"
+	if !result.Applied {
+		verb = "Would record"
+	}
+	for _, pkg := range result.Recovered {
+		fmt.Fprintf(w, "%s %s targets=%s\n", verb, pkg.Name, strings.Join(pkg.Targets, ","))
+	}
+	return nil
+}
+
+func newClientsCmd() *cobra.Command {
+	var verbose bool
 	cmd := &cobra.Command{
-		Use:   "remove <name>",
-		Short: "Remove a configured tap",
-		Args:  cobra.ExactArgs(1),
+		Use:   "clients",
+		Short: "List detected AI clients",
 		RunE: func(cmd *cobra.Command, args []string) error {
 			mgr, err := managerOrDie()
 			if err != nil {
 				return err
 			}
-			return mgr.TapRemove(args[0])
+			printClientStatuses(stdout, mgr.Detect(), verbose)
+			return nil
 		},
 	}
+	cmd.Flags().BoolVar(&verbose, "verbose", false, "Show every known client with detection details")
 	return cmd
 }
 
-func newTapListCmd() *cobra.Command {
+func newStatusCmd() *cobra.Command {
+	var asJSON bool
 	cmd := &cobra.Command{
-		Use:   "list",
+		Use:   "status",
+		Short: "Summarize installed packages, clients, taps and health",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			mgr, err := installManager(asJSON)
+			if err != nil {
+				return err
+			}
+			status, err := mgr.Status(cmd.Context())
+			if err != nil {
+				return err
+			}
+			return printStatus(stdout, status, asJSON, time.Now())
+		},
+	}
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Output JSON")
+	return cmd
+}
+
+func newHistoryCmd() *cobra.Command {
+	var asJSON bool
+	cmd := &cobra.Command{
+		Use:   "history",
+		Short: "Show past installs, upgrades and removals",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			mgr, err := managerOrDie()
+			if err != nil {
+				return err
+			}
+			entries, err := mgr.History()
+			if err != nil {
+				return err
+			}
+			return printHistory(stdout, entries, asJSON)
+		},
+	}
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Output JSON")
+	return cmd
+}
+
+func printHistory(w io.Writer, entries []service.HistoryEntry, asJSON bool) error {
+	if asJSON {
+		data, err := json.MarshalIndent(entries, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w, string(data))
+		return nil
+	}
+	if len(entries) == 0 {
+		fmt.Fprintln(w, "No history recorded")
+		return nil
+	}
+	for _, e := range entries {
+		version := e.ToVersion
+		switch {
+		case e.FromVersion != "" && e.ToVersion != "":
+			version = e.FromVersion + " -> " + e.ToVersion
+		case e.ToVersion == "":
+			version = e.FromVersion
+		}
+		if e.Unverified {
+			version += " (unverified)"
+		}
+		fmt.Fprintf(w, "%s  %-7s %s %s targets=%s\n", e.Time.Local().Format("2006-01-02 15:04:05"), e.Action, e.Package, version, strings.Join(e.Targets, ","))
+	}
+	return nil
+}
+
+func newWhereisCmd() *cobra.Command {
+	var asJSON bool
+	cmd := &cobra.Command{
+		Use:   "whereis",
+		Short: "Print where mcper keeps its state, caches, backups and client configs",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			mgr, err := managerOrDie()
+			if err != nil {
+				return err
+			}
+			loc, err := mgr.Locations()
+			if err != nil {
+				return err
+			}
+			return printLocations(stdout, loc, asJSON)
+		},
+	}
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Output JSON")
+	return cmd
+}
+
+func newEditCmd() *cobra.Command {
+	var editor string
+	var asJSON bool
+	cmd := &cobra.Command{
+		Use:   "edit <client>",
+		Short: "Open a client's MCP config in $EDITOR, creating it if missing",
+		Long: `Open a client's MCP config in an editor and wait for it to close.
+
+The editor is --editor, else $VISUAL, else $EDITOR, else the platform default
+(open -W -t on macOS, notepad on Windows, vi elsewhere). A missing config is
+created as an empty skeleton first, even for a client that is not detected.
+Once the editor exits, mcper reads the file back and warns if it no longer
+parses.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			mgr, err := installTargetManager(asJSON, true, true)
+			if err != nil {
+				return err
+			}
+			result, err := mgr.Edit(cmd.Context(), service.EditRequest{Target: args[0], Editor: editor})
+			if err != nil {
+				return err
+			}
+			return printEditResult(stdout, result, asJSON)
+		},
+	}
+	cmd.Flags().StringVar(&editor, "editor", "", "Editor command to run instead of $VISUAL or $EDITOR")
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Output JSON")
+	return cmd
+}
+
+func printEditResult(w io.Writer, result service.EditResult, asJSON bool) error {
+	if asJSON {
+		data, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w, string(data))
+		return nil
+	}
+	if result.Created {
+		fmt.Fprintf(w, "Created %s config at %s\n", result.Target, result.Path)
+	}
+	return nil
+}
+
+func printLocations(w io.Writer, loc service.Locations, asJSON bool) error {
+	if asJSON {
+		data, err := json.MarshalIndent(loc, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w, string(data))
+		return nil
+	}
+	fmt.Fprintf(w, "state:   %s\n", loc.StateFile)
+	fmt.Fprintf(w, "config:  %s\n", loc.ConfigDir)
+	fmt.Fprintf(w, "cache:   %s\n", loc.CacheDir)
+	fmt.Fprintf(w, "backups: %s\n", loc.BackupDir)
+	if len(loc.Clients) == 0 {
+		fmt.Fprintln(w, "clients: none detected")
+		return nil
+	}
+	fmt.Fprintln(w, "clients:")
+	for _, c := range loc.Clients {
+		fmt.Fprintf(w, "  %-15s %s\n", c.Target, c.Path)
+	}
+	return nil
+}
+
+func printStatus(w io.Writer, status service.Status, asJSON bool, now time.Time) error {
+	if asJSON {
+		data, err := json.MarshalIndent(status, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w, string(data))
+		return nil
+	}
+	fmt.Fprintf(w, "Packages: %d installed\n", status.Installed)
+	if len(status.DetectedClients) == 0 {
+		fmt.Fprintln(w, "Clients:  none detected")
+	} else {
+		fmt.Fprintf(w, "Clients:  %s\n", strings.Join(status.DetectedClients, ", "))
+	}
+	taps := make([]string, 0, len(status.Taps))
+	for _, tap := range status.Taps {
+		switch {
+		case tap.LastSynced == nil:
+			taps = append(taps, tap.Name)
+		case tap.Stale:
+			taps = append(taps, fmt.Sprintf("%s (stale, synced %s ago)", tap.Name, now.Sub(*tap.LastSynced).Round(time.Hour)))
+		default:
+			taps = append(taps, fmt.Sprintf("%s (synced %s ago)", tap.Name, now.Sub(*tap.LastSynced).Round(time.Minute)))
+		}
+	}
+	fmt.Fprintf(w, "Taps:     %s\n", strings.Join(taps, ", "))
+	switch {
+	case status.DoctorError != "":
+		fmt.Fprintf(w, "Doctor:   failed: %s\n", status.DoctorError)
+	case status.DoctorIssues > 0:
+		fmt.Fprintf(w, "Doctor:   %d issue(s); run mcper doctor for details\n", status.DoctorIssues)
+	default:
+		fmt.Fprintln(w, "Doctor:   no issues")
+	}
+	return nil
+}
+
+func printClientStatuses(w io.Writer, statuses []adapters.ClientStatus, verbose bool) {
+	for _, st := range statuses {
+		if !verbose {
+			if st.Detected && st.AdapterOK {
+				fmt.Fprintf(w, "%s\t%s\t%s\n", st.Target, st.Label, st.ConfigPath)
+			}
+			continue
+		}
+		switch {
+		case st.Detected && st.AdapterOK:
+			fmt.Fprintf(w, "%s\t%s\tdetected\t%s\n", st.Target, st.Label, st.ConfigPath)
+			fmt.Fprintf(w, "  found: %s\n", st.DetectedDir)
+		case st.Detected:
+			fmt.Fprintf(w, "%s\t%s\tunavailable\n", st.Target, st.Label)
+			fmt.Fprintf(w, "  found: %s\n", st.DetectedDir)
+			fmt.Fprintf(w, "  error: %v\n", st.Err)
+		default:
+			fmt.Fprintf(w, "%s\t%s\tnot detected\n", st.Target, st.Label)
+			fmt.Fprintf(w, "  probed: %s\n", strings.Join(st.ProbedDirs, ", "))
+		}
+	}
+}
+
+func newTapCmd() *cobra.Command {
+	cmd := &cobra.Command{Use: "tap", Short: "Manage package taps"}
+	cmd.AddCommand(newTapAddCmd(), newTapRemoveCmd(), newTapListCmd(), newTapVerifyCmd())
+	return cmd
+}
+
+func newTapAddCmd() *cobra.Command {
+	var description string
+	var depth int
+	var gitArgs []string
+	var subdir string
+	var indexFile string
+	var submodules bool
+	cmd := &cobra.Command{
+		Use:   "add <name> <url>",
+		Short: "Add or update a package tap",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			mgr, err := managerOrDie()
+			if err != nil {
+				return err
+			}
+			req := service.TapAddRequest{
+				Name:        args[0],
+				URL:         args[1],
+				Description: description,
+				GitArgs:     gitArgs,
+				Subdir:      subdir,
+				IndexFile:   indexFile,
+				Submodules:  submodules,
+			}
+			if cmd.Flags().Changed("depth") {
+				req.CloneDepth = &depth
+			}
+			return mgr.TapAdd(req)
+		},
+	}
+	cmd.Flags().StringVar(&description, "description", "", "Tap description")
+	cmd.Flags().IntVar(&depth, "depth", 1, "Git clone depth; 0 clones full history")
+	cmd.Flags().StringArrayVar(&gitArgs, "git-args", nil, "Extra argument passed to git clone (repeatable)")
+	cmd.Flags().StringVar(&subdir, "subdir", "", "Directory within the repository that holds the index")
+	cmd.Flags().StringVar(&indexFile, "index-file", model.DefaultIndexFile, "Name of the index file within the tap, e.g. registry.json")
+	cmd.Flags().BoolVar(&submodules, "submodules", false, "Check out the repository's git submodules after each clone and pull, at the same depth")
+	return cmd
+}
+
+func newTapRemoveCmd() *cobra.Command {
+	var force bool
+	var dryRun bool
+	cmd := &cobra.Command{
+		Use:   "remove <name>",
+		Short: "Remove a configured tap",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			mgr, err := managerOrDie()
+			if err != nil {
+				return err
+			}
+			if dryRun {
+				dependents, err := mgr.TapDependents(args[0])
+				if err != nil {
+					return err
+				}
+				if len(dependents) == 0 {
+					fmt.Fprintf(stdout, "No installed packages use tap %s\n", args[0])
+					return nil
+				}
+				fmt.Fprintf(stdout, "Removing tap %s would affect:\n", args[0])
+				for _, name := range dependents {
+					fmt.Fprintf(stdout, "  %s\n", name)
+				}
+				return nil
+			}
+			return mgr.TapRemove(args[0], force)
+		},
+	}
+	cmd.Flags().BoolVar(&force, "force", false, "Remove even if installed packages are sourced from the tap")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "List installed packages sourced from the tap without removing it")
+	return cmd
+}
+
+func newTapListCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list",
 		Short: "List configured taps",
 		RunE: func(cmd *cobra.Command, args []string) error {
 			mgr, err := managerOrDie()
@@ -404,7 +1577,7 @@ func newTapListCmd() *cobra.Command {
 				return err
 			}
 			for _, tap := range taps {
-				fmt.Printf("%s\t%s\tmode=%s\n", tap.Name, tap.URL, tap.Trust.Mode)
+				fmt.Fprintf(stdout, "%s\t%s\tmode=%s\n", tap.Name, tap.URL, tap.Trust.Mode)
 			}
 			return nil
 		},
@@ -412,9 +1585,142 @@ func newTapListCmd() *cobra.Command {
 	return cmd
 }
 
+func newTapVerifyCmd() *cobra.Command {
+	var asJSON bool
+	cmd := &cobra.Command{
+		Use:   "verify <name>",
+		Short: "Verify a tap's index and the latest version of each package",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			mgr, err := managerOrDie()
+			if err != nil {
+				return err
+			}
+			checks, err := mgr.TapVerify(cmd.Context(), args[0])
+			if err != nil {
+				return err
+			}
+			if err := printTapChecks(stdout, checks, asJSON); err != nil {
+				return err
+			}
+			failed := 0
+			for _, check := range checks {
+				if !check.OK {
+					failed++
+				}
+			}
+			if failed > 0 {
+				return reported(fmt.Errorf("tap %s failed verification: %d of %d check(s) failed", args[0], failed, len(checks)))
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Output the checks as JSON")
+	return cmd
+}
+
+func printTapChecks(w io.Writer, checks []registry.TapCheck, asJSON bool) error {
+	if asJSON {
+		data, err := json.MarshalIndent(checks, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w, string(data))
+		return nil
+	}
+	for _, check := range checks {
+		if check.OK {
+			if check.Detail != "" {
+				fmt.Fprintf(w, "ok\t%s\t%s\n", check.Item, check.Detail)
+				continue
+			}
+			fmt.Fprintf(w, "ok\t%s\n", check.Item)
+			continue
+		}
+		fmt.Fprintf(w, "FAIL\t%s\t%s\n", check.Item, check.Detail)
+	}
+	return nil
+}
+
+func newTrustCmd() *cobra.Command {
+	cmd := &cobra.Command{Use: "trust", Short: "Manage trusted direct sources"}
+	cmd.AddCommand(newTrustAddCmd(), newTrustListCmd(), newTrustRevokeCmd())
+	return cmd
+}
+
+func newTrustListCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List trusted direct sources",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			mgr, err := managerOrDie()
+			if err != nil {
+				return err
+			}
+			items, err := mgr.TrustList()
+			if err != nil {
+				return err
+			}
+			if len(items) == 0 {
+				fmt.Fprintln(stdout, "No trusted direct sources")
+				return nil
+			}
+			for _, item := range items {
+				if item.Identity != "" {
+					fmt.Fprintf(stdout, "%s\tapproved=%s\tsigned-by=%s\n", item.URL, item.CreatedAt.Format(time.RFC3339), item.Identity)
+					continue
+				}
+				fmt.Fprintf(stdout, "%s\tapproved=%s\n", item.URL, item.CreatedAt.Format(time.RFC3339))
+			}
+			return nil
+		},
+	}
+	return cmd
+}
+
+func newTrustAddCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "add <url>",
+		Short: "Pre-approve a direct source for install-url",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			mgr, err := managerOrDie()
+			if err != nil {
+				return err
+			}
+			if err := mgr.TrustAdd(args[0]); err != nil {
+				return err
+			}
+			fmt.Fprintf(stdout, "Trusted %s\n", args[0])
+			return nil
+		},
+	}
+	return cmd
+}
+
+func newTrustRevokeCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "revoke <url>",
+		Short: "Revoke trust for a direct source",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			mgr, err := managerOrDie()
+			if err != nil {
+				return err
+			}
+			if err := mgr.TrustRevoke(args[0]); err != nil {
+				return err
+			}
+			fmt.Fprintf(stdout, "Revoked trust for %s\n", args[0])
+			return nil
+		},
+	}
+	return cmd
+}
+
 func newSecretCmd() *cobra.Command {
 	cmd := &cobra.Command{Use: "secret", Short: "Manage package secrets in OS keychain"}
-	cmd.AddCommand(newSecretSetCmd(), newSecretUnsetCmd())
+	cmd.AddCommand(newSecretSetCmd(), newSecretUnsetCmd(), newSecretPruneCmd())
 	return cmd
 }
 
@@ -430,7 +1736,7 @@ func newSecretSetCmd() *cobra.Command {
 				return err
 			}
 			if value == "" {
-				fmt.Fprint(os.Stdout, "Enter secret value: ")
+				fmt.Fprint(stdout, "Enter secret value: ")
 				var input string
 				if _, err := fmt.Fscanln(os.Stdin, &input); err != nil {
 					return err
@@ -460,6 +1766,442 @@ func newSecretUnsetCmd() *cobra.Command {
 	return cmd
 }
 
+func newSecretPruneCmd() *cobra.Command {
+	var yes bool
+	var asJSON bool
+	cmd := &cobra.Command{
+		Use:   "prune",
+		Short: "Delete stored secrets of packages that are no longer installed",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			mgr, err := managerOrDie()
+			if err != nil {
+				return err
+			}
+			orphans, err := mgr.SecretPrune(!yes)
+			if err != nil && (asJSON || len(orphans) == 0) {
+				return err
+			}
+			if printErr := printSecretPrune(stdout, orphans, !yes, asJSON); printErr != nil {
+				return printErr
+			}
+			if err != nil {
+				return reported(err)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&yes, "yes", false, "Delete the listed secrets; without it they are only reported")
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Output the secrets as JSON")
+	return cmd
+}
+
+func printSecretPrune(w io.Writer, orphans []service.OrphanedSecret, dryRun, asJSON bool) error {
+	if asJSON {
+		if orphans == nil {
+			orphans = []service.OrphanedSecret{}
+		}
+		data, err := json.MarshalIndent(orphans, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w, string(data))
+		return nil
+	}
+	verb := "Deleted"
+	if dryRun {
+		verb = "Would delete"
+	}
+	for _, o := range orphans {
+		fmt.Fprintf(w, "%s %s/%s\n", verb, o.Package, o.Key)
+	}
+	fmt.Fprintf(w, "%s %d secret(s)\n", verb, len(orphans))
+	if dryRun && len(orphans) > 0 {
+		fmt.Fprintln(w, "Run with --yes to delete them.")
+	}
+	return nil
+}
+
+func newConfigCmd() *cobra.Command {
+	cmd := &cobra.Command{Use: "config", Short: "View and set mcper preferences"}
+	cmd.AddCommand(newConfigGetCmd(), newConfigSetCmd(), newConfigListCmd())
+	return cmd
+}
+
+func newConfigGetCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "get <key>",
+		Short: "Print a preference value",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			mgr, err := managerOrDie()
+			if err != nil {
+				return err
+			}
+			value, err := mgr.ConfigGet(args[0])
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(stdout, value)
+			return nil
+		},
+	}
+	return cmd
+}
+
+func newConfigSetCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "set <key> <value>",
+		Short: "Set a preference",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			mgr, err := managerOrDie()
+			if err != nil {
+				return err
+			}
+			if err := mgr.ConfigSet(args[0], args[1]); err != nil {
+				return err
+			}
+			value, err := mgr.ConfigGet(args[0])
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(stdout, "Set %s=%s\n", args[0], value)
+			return nil
+		},
+	}
+	return cmd
+}
+
+func newConfigListCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List all preferences",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			mgr, err := managerOrDie()
+			if err != nil {
+				return err
+			}
+			entries, err := mgr.ConfigList()
+			if err != nil {
+				return err
+			}
+			for _, e := range entries {
+				fmt.Fprintf(stdout, "%s\t%s\t%s\n", e.Key, e.Value, e.Description)
+			}
+			return nil
+		},
+	}
+	return cmd
+}
+
+func newSchemaCmd() *cobra.Command {
+	cmd := &cobra.Command{Use: "schema", Short: "Print JSON Schemas for registry files"}
+	cmd.AddCommand(
+		newSchemaPrintCmd("manifest", "Print the package manifest JSON Schema", schema.Manifest),
+		newSchemaPrintCmd("index", "Print the tap index.json JSON Schema", schema.Index),
+	)
+	return cmd
+}
+
+// errInvalidManifest is returned by validate once it has printed its report.
+var errInvalidManifest = errors.New("manifest is invalid")
+
+// reportedError marks a failure whose command has already printed its
+// result, so --json output is not followed by a second error object.
+type reportedError struct{ error }
+
+func (e reportedError) Unwrap() error { return e.error }
+
+// reported wraps err as already reported.
+func reported(err error) error { return reportedError{err} }
+
+func newValidateCmd() *cobra.Command {
+	var asJSON bool
+	cmd := &cobra.Command{
+		Use:   "validate <manifest.json|->",
+		Short: "Check a package manifest without installing it; - reads it from stdin",
+		Args:  cobra.ExactArgs(1),
+		// An invalid manifest is a result, not a usage mistake.
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			origin := args[0]
+			var data []byte
+			var err error
+			if origin == "-" {
+				origin = "stdin"
+				data, err = io.ReadAll(cmd.InOrStdin())
+			} else {
+				data, err = os.ReadFile(origin)
+			}
+			if err != nil {
+				return fmt.Errorf("read manifest: %w", err)
+			}
+			result := service.ValidateManifest(data, origin)
+			if err := printManifestValidation(cmd.OutOrStdout(), origin, result, asJSON); err != nil {
+				return err
+			}
+			if !result.Valid {
+				return reported(errInvalidManifest)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Output JSON as {valid, errors, warnings}")
+	return cmd
+}
+
+func printManifestValidation(w io.Writer, origin string, result service.ManifestValidation, asJSON bool) error {
+	if asJSON {
+		data, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w, string(data))
+		return nil
+	}
+	if result.Valid {
+		fmt.Fprintf(w, "%s: valid (%s@%s)\n", origin, result.Name, result.Version)
+	} else {
+		fmt.Fprintf(w, "%s: invalid\n", origin)
+	}
+	for _, e := range result.Errors {
+		fmt.Fprintf(w, "  error: %s\n", e)
+	}
+	for _, warning := range result.Warnings {
+		fmt.Fprintf(w, "  warning: %s\n", warning)
+	}
+	return nil
+}
+
+func newSchemaPrintCmd(use, short string, build func() map[string]any) *cobra.Command {
+	return &cobra.Command{
+		Use:   use,
+		Short: short,
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			data, err := json.MarshalIndent(build(), "", "  ")
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), string(data))
+			return nil
+		},
+	}
+}
+
+// backupFlags holds the --prune-backups/--keep-backups pair shared by
+// commands that write client configs.
+type backupFlags struct {
+	prune  bool
+	retain int
+}
+
+func (b *backupFlags) register(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&b.prune, "prune-backups", false, "Prune old config backups after a successful write")
+	cmd.Flags().IntVar(&b.retain, "keep-backups", 10, "Number of backup sets to keep with --prune-backups")
+}
+
+func (b backupFlags) keep() int {
+	if !b.prune {
+		return 0
+	}
+	if b.retain < 1 {
+		return 1
+	}
+	return b.retain
+}
+
+// backupWindowFlags holds the --since/--until pair used by backup commands.
+type backupWindowFlags struct {
+	since string
+	until string
+}
+
+func (b *backupWindowFlags) register(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&b.since, "since", "", "Only backups taken at or after this time (duration like 72h or 7d, or RFC3339)")
+	cmd.Flags().StringVar(&b.until, "until", "", "Only backups taken at or before this time (duration like 72h or 7d, or RFC3339)")
+}
+
+func (b backupWindowFlags) window(now time.Time) (service.BackupWindow, error) {
+	var w service.BackupWindow
+	var err error
+	if w.Since, err = parseTimeBound(b.since, now); err != nil {
+		return w, fmt.Errorf("--since: %w", err)
+	}
+	if w.Until, err = parseTimeBound(b.until, now); err != nil {
+		return w, fmt.Errorf("--until: %w", err)
+	}
+	return w, nil
+}
+
+// parseTimeBound reads an RFC3339 timestamp or a duration before now. Besides
+// Go durations it accepts whole days such as "7d". Empty means unbounded.
+func parseTimeBound(raw string, now time.Time) (time.Time, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t, nil
+	}
+	if days, ok := strings.CutSuffix(raw, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return time.Time{}, fmt.Errorf("invalid time %q", raw)
+		}
+		return now.AddDate(0, 0, -n), nil
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil || d < 0 {
+		return time.Time{}, fmt.Errorf("invalid time %q: expected a duration or RFC3339 timestamp", raw)
+	}
+	return now.Add(-d), nil
+}
+
+func newBackupCmd() *cobra.Command {
+	cmd := &cobra.Command{Use: "backup", Short: "Inspect and prune client config backups"}
+	cmd.AddCommand(newBackupListCmd(), newBackupPruneCmd(), newBackupVerifyCmd())
+	return cmd
+}
+
+func newBackupListCmd() *cobra.Command {
+	var window backupWindowFlags
+	var asJSON bool
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List backup sets, newest first",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			w, err := window.window(time.Now())
+			if err != nil {
+				return err
+			}
+			mgr, err := managerOrDie()
+			if err != nil {
+				return err
+			}
+			sets, err := mgr.BackupList(w)
+			if err != nil {
+				return err
+			}
+			if asJSON {
+				data, _ := json.MarshalIndent(sets, "", "  ")
+				fmt.Fprintln(stdout, string(data))
+				return nil
+			}
+			if len(sets) == 0 {
+				fmt.Fprintln(stdout, "No backups")
+				return nil
+			}
+			for _, set := range sets {
+				fmt.Fprintf(stdout, "%s\t%s\n", set.Time.Format(time.RFC3339), set.Path)
+			}
+			return nil
+		},
+	}
+	window.register(cmd)
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Output JSON")
+	return cmd
+}
+
+func newBackupPruneCmd() *cobra.Command {
+	var window backupWindowFlags
+	var keep int
+	var dryRun bool
+	cmd := &cobra.Command{
+		Use:   "prune",
+		Short: "Delete backup sets, keeping the newest ones",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			w, err := window.window(time.Now())
+			if err != nil {
+				return err
+			}
+			mgr, err := managerOrDie()
+			if err != nil {
+				return err
+			}
+			removed, err := mgr.BackupPrune(service.BackupPruneRequest{Window: w, Keep: keep, DryRun: dryRun})
+			if err != nil {
+				return err
+			}
+			verb := "Removed"
+			if dryRun {
+				verb = "Would remove"
+			}
+			for _, set := range removed {
+				fmt.Fprintf(stdout, "%s %s\n", verb, set.Path)
+			}
+			fmt.Fprintf(stdout, "%s %d backup set(s)\n", verb, len(removed))
+			return nil
+		},
+	}
+	window.register(cmd)
+	cmd.Flags().IntVar(&keep, "keep", 10, "Number of the newest matching backup sets to keep")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "List what would be removed without deleting anything")
+	return cmd
+}
+
+func newBackupVerifyCmd() *cobra.Command {
+	var fix bool
+	var asJSON bool
+	cmd := &cobra.Command{
+		Use:   "verify",
+		Short: "Report empty or unreadable backup files",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			mgr, err := managerOrDie()
+			if err != nil {
+				return err
+			}
+			corrupt, err := mgr.BackupVerify(service.BackupVerifyRequest{Fix: fix})
+			if err != nil {
+				return err
+			}
+			if err := printCorruptBackups(stdout, corrupt, asJSON); err != nil {
+				return err
+			}
+			for _, c := range corrupt {
+				if !c.Removed && !c.Suspect {
+					return reported(errors.New("backup verify found corrupt backups; rerun with --fix to delete them"))
+				}
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&fix, "fix", false, "Delete unreadable backup files; empty ones are reported but kept")
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Output JSON")
+	return cmd
+}
+
+func printCorruptBackups(w io.Writer, corrupt []service.CorruptBackup, asJSON bool) error {
+	if asJSON {
+		if corrupt == nil {
+			corrupt = []service.CorruptBackup{}
+		}
+		data, err := json.MarshalIndent(corrupt, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w, string(data))
+		return nil
+	}
+	if len(corrupt) == 0 {
+		fmt.Fprintln(w, "backup verify: all backups readable")
+		return nil
+	}
+	for _, c := range corrupt {
+		verb := "corrupt"
+		switch {
+		case c.Removed:
+			verb = "removed"
+		case c.Suspect:
+			verb = "suspect"
+		}
+		fmt.Fprintf(w, "%s %s: %s\n", verb, c.Path, c.Reason)
+	}
+	return nil
+}
+
 func splitNameVersion(raw string) (string, string) {
 	parts := strings.SplitN(raw, "@", 2)
 	if len(parts) == 1 {
@@ -469,8 +2211,104 @@ func splitNameVersion(raw string) (string, string) {
 }
 
 func Execute() error {
-	ctx := context.Background()
+	// Ctrl+C cancels the command's context so git, HTTP fetches and
+	// installs stop cleanly instead of the process dying mid-write.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	// Prompts block on stdin without watching ctx, so restore the default
+	// handler after the first signal: a second Ctrl+C then kills the process.
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	defer func() { cancelTimeout() }()
 	root := NewRootCmd()
 	root.SetContext(ctx)
-	return root.Execute()
+	return execute(root, service.LoadRedactor(), os.Stdout, os.Stderr)
+}
+
+// execute runs root with everything it writes, through the stdout and
+// stderr vars or cobra's own writers, passed through redactor.
+func execute(root *cobra.Command, redactor *service.Redactor, out, errOut io.Writer) error {
+	stdout = redactor.Writer(out)
+	stderr = redactor.Writer(errOut)
+	root.SetOut(stdout)
+	root.SetErr(stderr)
+	// Cobra prints usage on error to its Out, which is stdout here, so it
+	// is silenced and printed to stderr instead, keeping --json output
+	// clean; help asked for with --help still goes to stdout.
+	root.SilenceUsage = true
+	cmd, err := root.ExecuteC()
+	if err == nil {
+		return nil
+	}
+	if cmd != nil && !cmd.SilenceUsage {
+		fmt.Fprintln(stderr, cmd.UsageString())
+	}
+	if cmd != nil {
+		if f := cmd.Flags().Lookup("json"); f != nil && f.Value.String() == "true" && !errors.As(err, new(reportedError)) {
+			printJSONError(stdout, err)
+		}
+	}
+	return redactedError{err: err, msg: redactor.Redact(err.Error())}
+}
+
+// redactedError is err with the redact patterns applied to its message. It
+// unwraps to err so ExitCode still sees the cause.
+type redactedError struct {
+	err error
+	msg string
+}
+
+func (e redactedError) Error() string { return e.msg }
+func (e redactedError) Unwrap() error { return e.err }
+
+// Exit codes for failures callers may want to tell apart. Anything else
+// exits with 1.
+const (
+	ExitNotFound      = 3
+	ExitConflict      = 4
+	ExitTrustRequired = 5
+)
+
+// ErrorCode names the kind of err for --json output.
+func ErrorCode(err error) string {
+	switch {
+	case errors.Is(err, service.ErrPackageNotFound):
+		return "package_not_found"
+	case errors.Is(err, service.ErrNotInstalled):
+		return "not_installed"
+	case errors.Is(err, service.ErrTapNotFound):
+		return "tap_not_found"
+	case errors.Is(err, service.ErrConflict):
+		return "conflict"
+	case errors.Is(err, service.ErrTrustRequired):
+		return "trust_required"
+	case errors.Is(err, service.ErrTrustNotFound):
+		return "trust_not_found"
+	default:
+		return "error"
+	}
+}
+
+// ExitCode maps err to the process exit status.
+func ExitCode(err error) int {
+	switch ErrorCode(err) {
+	case "package_not_found", "not_installed", "tap_not_found", "trust_not_found":
+		return ExitNotFound
+	case "conflict":
+		return ExitConflict
+	case "trust_required":
+		return ExitTrustRequired
+	default:
+		return 1
+	}
+}
+
+func printJSONError(w io.Writer, err error) {
+	data, _ := json.MarshalIndent(struct {
+		Error string `json:"error"`
+		Code  string `json:"code"`
+	}{Error: err.Error(), Code: ErrorCode(err)}, "", "  ")
+	fmt.Fprintln(w, string(data))
 }
@@ -10,6 +10,8 @@ import (
 
 	"github.com/manifoldco/promptui"
 
+	"github.com/sarjann/mcper/internal/model"
+	"github.com/sarjann/mcper/internal/registry"
 	"github.com/sarjann/mcper/internal/service"
 )
 
@@ -19,7 +21,7 @@ func runTUI(ctx context.Context, in io.Reader, out io.Writer, mgr *service.Manag
 	fmt.Fprintln(out, "Use arrow keys + Enter. Press Ctrl+C to exit.")
 
 	items := []string{
-		"Search packages",
+		"Search and install packages",
 		"List installed packages",
 		"Install package from tap",
 		"Install package from URL/path",
@@ -43,7 +45,7 @@ func runTUI(ctx context.Context, in io.Reader, out io.Writer, mgr *service.Manag
 
 		var actionErr error
 		switch choice {
-		case "Search packages":
+		case "Search and install packages":
 			actionErr = tuiSearch(ctx, out, mgr)
 		case "List installed packages":
 			actionErr = tuiList(out, mgr)
@@ -58,7 +60,7 @@ func runTUI(ctx context.Context, in io.Reader, out io.Writer, mgr *service.Manag
 		case "Run doctor":
 			actionErr = tuiDoctor(ctx, out, mgr)
 		case "Export lockfile (JSON)":
-			actionErr = tuiExport(out, mgr)
+			actionErr = tuiExport(ctx, out, mgr)
 		case "Quit":
 			fmt.Fprintln(out, "Goodbye.")
 			return nil
@@ -69,12 +71,18 @@ func runTUI(ctx context.Context, in io.Reader, out io.Writer, mgr *service.Manag
 	}
 }
 
-func tuiSearch(ctx context.Context, out io.Writer, mgr *service.Manager) error {
+// searchInstaller is the part of *service.Manager used by the search flow.
+type searchInstaller interface {
+	Search(ctx context.Context, query string, dedup bool) ([]registry.SearchResult, error)
+	InstallFromTap(ctx context.Context, req service.InstallRequest) (model.InstalledPackage, error)
+}
+
+func tuiSearch(ctx context.Context, out io.Writer, mgr searchInstaller) error {
 	query, err := promptText("Search query", "", false)
 	if err != nil {
 		return err
 	}
-	results, err := mgr.Search(ctx, query)
+	results, err := mgr.Search(ctx, query, false)
 	if err != nil {
 		return err
 	}
@@ -82,12 +90,50 @@ func tuiSearch(ctx context.Context, out io.Writer, mgr *service.Manager) error {
 		fmt.Fprintln(out, "No results.")
 		return nil
 	}
-	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
-	fmt.Fprintln(w, "TAP\tPACKAGE\tLATEST\tDESCRIPTION")
+
+	const cancel = "Cancel"
+	byLabel := make(map[string]registry.SearchResult, len(results))
+	items := make([]string, 0, len(results)+1)
 	for _, r := range results {
-		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", r.Tap, r.Name, r.Latest, r.Description)
+		label := fmt.Sprintf("%s@%s (%s)", r.Name, r.Latest, r.Tap)
+		if r.Description != "" {
+			label += " - " + r.Description
+		}
+		byLabel[label] = r
+		items = append(items, label)
 	}
-	return w.Flush()
+	items = append(items, cancel)
+	choice, err := selectOne("Select a package to install", items)
+	if err != nil {
+		return err
+	}
+	if choice == cancel {
+		return nil
+	}
+	selected := byLabel[choice]
+
+	target, err := selectTarget()
+	if err != nil {
+		return err
+	}
+	approved, err := promptYesNo(fmt.Sprintf("Install %s@%s from %s to %s", selected.Name, selected.Latest, selected.Tap, target))
+	if err != nil {
+		return err
+	}
+	if !approved {
+		fmt.Fprintln(out, "Install canceled.")
+		return nil
+	}
+	installed, err := mgr.InstallFromTap(ctx, service.InstallRequest{
+		Name:   selected.Name,
+		Tap:    selected.Tap,
+		Target: target,
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Installed %s@%s targets=%s\n", installed.Name, installed.Version, strings.Join(installed.Targets, ","))
+	return nil
 }
 
 func tuiList(out io.Writer, mgr *service.Manager) error {
@@ -123,12 +169,7 @@ func tuiInstallFromTap(ctx context.Context, out io.Writer, mgr *service.Manager)
 	if err != nil {
 		return err
 	}
-	target, err := selectOne("Target configs", []string{
-		"all",
-		"codex",
-		"claude",
-		"codex,claude",
-	})
+	target, err := selectTarget()
 	if err != nil {
 		return err
 	}
@@ -152,12 +193,7 @@ func tuiInstallFromURL(ctx context.Context, out io.Writer, mgr *service.Manager)
 	if err != nil {
 		return err
 	}
-	target, err := selectOne("Target configs", []string{
-		"all",
-		"codex",
-		"claude",
-		"codex,claude",
-	})
+	target, err := selectTarget()
 	if err != nil {
 		return err
 	}
@@ -195,7 +231,7 @@ func tuiRemove(ctx context.Context, out io.Writer, mgr *service.Manager) error {
 		fmt.Fprintln(out, "Remove canceled.")
 		return nil
 	}
-	if err := mgr.Remove(ctx, name); err != nil {
+	if _, err := mgr.Remove(ctx, service.RemoveRequest{Name: name}); err != nil {
 		return err
 	}
 	fmt.Fprintf(out, "Removed %s\n", name)
@@ -211,7 +247,7 @@ func tuiUpgrade(ctx context.Context, out io.Writer, mgr *service.Manager) error
 	if err != nil {
 		return err
 	}
-	results, err := mgr.Upgrade(ctx, name, allowMajor)
+	results, err := mgr.Upgrade(ctx, service.UpgradeRequest{Name: name, AllowMajor: allowMajor})
 	if err != nil {
 		return err
 	}
@@ -236,24 +272,27 @@ func tuiDoctor(ctx context.Context, out io.Writer, mgr *service.Manager) error {
 	if err != nil {
 		return err
 	}
-	issues, err := mgr.Doctor(ctx, fix)
+	result, err := mgr.RunDoctor(ctx, service.DoctorRequest{Fix: fix})
 	if err != nil {
 		return err
 	}
-	if len(issues) == 0 {
+	if len(result.Issues) == 0 {
 		fmt.Fprintln(out, "doctor: no issues found")
 		return nil
 	}
 	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
 	fmt.Fprintln(w, "KIND\tPACKAGE\tTARGET\tDETAIL")
-	for _, issue := range issues {
+	for _, issue := range result.Issues {
 		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", issue.Kind, issue.Package, issue.Target, issue.Detail)
 	}
+	for _, fix := range result.Fixed {
+		fmt.Fprintf(w, "fixed:%s\t%s\t%s\t%s\n", fix.Action, fix.Package, fix.Target, fix.Detail)
+	}
 	return w.Flush()
 }
 
-func tuiExport(out io.Writer, mgr *service.Manager) error {
-	payload, err := mgr.Export("lock")
+func tuiExport(ctx context.Context, out io.Writer, mgr *service.Manager) error {
+	payload, err := mgr.Export(ctx, "lock")
 	if err != nil {
 		return err
 	}
@@ -261,7 +300,62 @@ func tuiExport(out io.Writer, mgr *service.Manager) error {
 	return nil
 }
 
-func promptText(label, defaultValue string, required bool) (string, error) {
+func selectTarget() (string, error) {
+	return selectOne("Target configs", []string{
+		"all",
+		"codex",
+		"claude",
+		"codex,claude",
+	})
+}
+
+// selectMany lets the user toggle items on and off through selectOne until
+// they pick Done. Every item starts selected; the result keeps item order.
+func selectMany(label string, items []string) ([]string, error) {
+	const done = "Done"
+	selected := make(map[string]bool, len(items))
+	for _, item := range items {
+		selected[item] = true
+	}
+	byOption := make(map[string]string, len(items))
+	for {
+		options := make([]string, 0, len(items)+1)
+		for _, item := range items {
+			mark := "[ ]"
+			if selected[item] {
+				mark = "[x]"
+			}
+			option := mark + " " + item
+			byOption[option] = item
+			options = append(options, option)
+		}
+		options = append(options, done)
+		choice, err := selectOne(label, options)
+		if err != nil {
+			return nil, err
+		}
+		if choice == done {
+			break
+		}
+		item := byOption[choice]
+		selected[item] = !selected[item]
+	}
+	out := make([]string, 0, len(items))
+	for _, item := range items {
+		if selected[item] {
+			out = append(out, item)
+		}
+	}
+	return out, nil
+}
+
+// Prompt hooks, replaced in tests to script input.
+var (
+	promptText = promptuiText
+	selectOne  = promptuiSelect
+)
+
+func promptuiText(label, defaultValue string, required bool) (string, error) {
 	prompt := promptui.Prompt{
 		Label:   label,
 		Default: defaultValue,
@@ -289,7 +383,7 @@ func promptYesNo(label string) (bool, error) {
 	return choice == "yes", nil
 }
 
-func selectOne(label string, items []string) (string, error) {
+func promptuiSelect(label string, items []string) (string, error) {
 	prompt := promptui.Select{
 		Label: label,
 		Items: items,
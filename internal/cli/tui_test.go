@@ -0,0 +1,135 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/sarjann/mcper/internal/adapters"
+	"github.com/sarjann/mcper/internal/model"
+	"github.com/sarjann/mcper/internal/registry"
+	"github.com/sarjann/mcper/internal/service"
+)
+
+type fakeSearchInstaller struct {
+	results   []registry.SearchResult
+	installed []service.InstallRequest
+}
+
+func (f *fakeSearchInstaller) Search(_ context.Context, _ string, _ bool) ([]registry.SearchResult, error) {
+	return f.results, nil
+}
+
+func (f *fakeSearchInstaller) InstallFromTap(_ context.Context, req service.InstallRequest) (model.InstalledPackage, error) {
+	f.installed = append(f.installed, req)
+	return model.InstalledPackage{Name: req.Name, Version: "2.0.0", Targets: strings.Split(req.Target, ",")}, nil
+}
+
+// scriptPrompts replaces the prompt hooks with canned answers, matched by
+// prefix against each select item so tests need not repeat full labels.
+func scriptPrompts(t *testing.T, answers ...string) {
+	t.Helper()
+	origText, origSelect := promptText, selectOne
+	t.Cleanup(func() { promptText, selectOne = origText, origSelect })
+
+	next := func() string {
+		if len(answers) == 0 {
+			t.Fatal("unexpected prompt: script exhausted")
+		}
+		a := answers[0]
+		answers = answers[1:]
+		return a
+	}
+	promptText = func(string, string, bool) (string, error) { return next(), nil }
+	selectOne = func(label string, items []string) (string, error) {
+		want := next()
+		for _, item := range items {
+			if strings.HasPrefix(item, want) {
+				return item, nil
+			}
+		}
+		return "", fmt.Errorf("%s: no item matching %q in %v", label, want, items)
+	}
+}
+
+func TestTUISearchSelectInstall(t *testing.T) {
+	mgr := &fakeSearchInstaller{results: []registry.SearchResult{
+		{Tap: "official", Name: "vercel-mcp", Latest: "1.0.0", Description: "Vercel"},
+		{Tap: "team", Name: "github-mcp", Latest: "2.0.0", Description: "GitHub"},
+	}}
+	scriptPrompts(t, "git", "github-mcp@2.0.0 (team)", "codex,claude", "yes")
+
+	var out bytes.Buffer
+	if err := tuiSearch(context.Background(), &out, mgr); err != nil {
+		t.Fatalf("tuiSearch: %v", err)
+	}
+	if len(mgr.installed) != 1 {
+		t.Fatalf("expected one install, got %+v", mgr.installed)
+	}
+	got := mgr.installed[0]
+	if got.Name != "github-mcp" || got.Tap != "team" || got.Target != "codex,claude" {
+		t.Fatalf("unexpected install request %+v", got)
+	}
+	if !strings.Contains(out.String(), "Installed github-mcp@2.0.0 targets=codex,claude") {
+		t.Fatalf("unexpected output %q", out.String())
+	}
+}
+
+func TestTUISearchCancel(t *testing.T) {
+	mgr := &fakeSearchInstaller{results: []registry.SearchResult{
+		{Tap: "official", Name: "vercel-mcp", Latest: "1.0.0"},
+	}}
+	scriptPrompts(t, "vercel", "Cancel")
+
+	if err := tuiSearch(context.Background(), &bytes.Buffer{}, mgr); err != nil {
+		t.Fatalf("tuiSearch: %v", err)
+	}
+	if len(mgr.installed) != 0 {
+		t.Fatalf("expected no install, got %+v", mgr.installed)
+	}
+}
+
+type fakeTargetPicker struct {
+	defaultTarget string
+	clients       []adapters.ClientStatus
+}
+
+func (f fakeTargetPicker) ConfigGet(string) (string, error) { return f.defaultTarget, nil }
+func (f fakeTargetPicker) Detect() []adapters.ClientStatus  { return f.clients }
+
+func TestPromptInstallTargetsSubset(t *testing.T) {
+	picker := fakeTargetPicker{defaultTarget: model.TargetAll, clients: []adapters.ClientStatus{
+		{Target: "claude", Detected: true, AdapterOK: true},
+		{Target: "codex", Detected: true, AdapterOK: true},
+		{Target: "cursor", Detected: true, AdapterOK: true},
+		{Target: "zed", Detected: false},
+	}}
+	// Untick claude, then accept.
+	scriptPrompts(t, "[x] claude", "Done")
+	target, err := promptInstallTargets(picker)
+	if err != nil {
+		t.Fatalf("promptInstallTargets: %v", err)
+	}
+	if target != "codex,cursor" {
+		t.Fatalf("expected codex,cursor, got %q", target)
+	}
+
+	scriptPrompts(t, "[x] claude", "[x] codex", "[x] cursor", "Done")
+	if _, err := promptInstallTargets(picker); err == nil {
+		t.Fatal("expected an empty selection to be rejected")
+	}
+}
+
+func TestPromptInstallTargetsSkipsWhenDefaultIsSet(t *testing.T) {
+	scriptPrompts(t) // any prompt fails the test
+	picker := fakeTargetPicker{defaultTarget: "codex", clients: []adapters.ClientStatus{
+		{Target: "claude", Detected: true, AdapterOK: true},
+		{Target: "codex", Detected: true, AdapterOK: true},
+	}}
+	target, err := promptInstallTargets(picker)
+	if err != nil || target != "" {
+		t.Fatalf("expected no prompt with a default target, got %q, %v", target, err)
+	}
+}
@@ -7,10 +7,14 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 )
 
+// BackupTimestampLayout names the per-run directories created by BackupFile.
+const BackupTimestampLayout = "20060102T150405Z"
+
 func AtomicWriteFile(path string, data []byte, perm os.FileMode) error {
 	dir := filepath.Dir(path)
 	if err := os.MkdirAll(dir, 0o755); err != nil {
@@ -31,6 +35,10 @@ func AtomicWriteFile(path string, data []byte, perm os.FileMode) error {
 		tmp.Close()
 		return fmt.Errorf("chmod temp file: %w", err)
 	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("sync temp file: %w", err)
+	}
 	if err := tmp.Close(); err != nil {
 		return fmt.Errorf("close temp file: %w", err)
 	}
@@ -38,6 +46,11 @@ func AtomicWriteFile(path string, data []byte, perm os.FileMode) error {
 	if err := os.Rename(tmpName, path); err != nil {
 		return fmt.Errorf("rename temp file: %w", err)
 	}
+	// Persist the rename itself; without this a crash can leave the old
+	// file (or none) in place on some filesystems.
+	if err := syncDir(dir); err != nil {
+		return fmt.Errorf("sync dir %s: %w", dir, err)
+	}
 	return nil
 }
 
@@ -54,7 +67,7 @@ func BackupFile(path, backupRoot string) (string, error) {
 	}
 
 	relPath := sanitizePath(path)
-	timestamp := time.Now().UTC().Format("20060102T150405Z")
+	timestamp := time.Now().UTC().Format(BackupTimestampLayout)
 	backupPath := filepath.Join(backupRoot, timestamp, relPath)
 	if err := os.MkdirAll(filepath.Dir(backupPath), 0o755); err != nil {
 		return "", fmt.Errorf("create backup dir: %w", err)
@@ -81,6 +94,95 @@ func BackupFile(path, backupRoot string) (string, error) {
 	return backupPath, nil
 }
 
+// PruneBackups keeps the newest keep timestamped backup sets under
+// backupRoot and deletes the rest, returning the removed directories.
+// Entries that are not backup sets are ignored.
+func PruneBackups(backupRoot string, keep int) ([]string, error) {
+	if keep < 0 {
+		keep = 0
+	}
+	sets, err := backupSets(backupRoot)
+	if err != nil {
+		return nil, err
+	}
+	if len(sets) <= keep {
+		return nil, nil
+	}
+
+	removed := make([]string, 0, len(sets)-keep)
+	for _, name := range sets[keep:] {
+		dir := filepath.Join(backupRoot, name)
+		if err := os.RemoveAll(dir); err != nil {
+			return removed, fmt.Errorf("remove backup %s: %w", dir, err)
+		}
+		removed = append(removed, dir)
+	}
+	return removed, nil
+}
+
+// LatestBackup returns the newest backup of path under backupRoot, or ""
+// if none exists.
+func LatestBackup(path, backupRoot string) (string, error) {
+	sets, err := backupSets(backupRoot)
+	if err != nil {
+		return "", err
+	}
+	rel := sanitizePath(path)
+	for _, name := range sets {
+		candidate := filepath.Join(backupRoot, name, rel)
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate, nil
+		}
+	}
+	return "", nil
+}
+
+// BackupSet is one timestamped directory created by BackupFile.
+type BackupSet struct {
+	Name string    `json:"name"`
+	Path string    `json:"path"`
+	Time time.Time `json:"time"`
+}
+
+// ListBackupSets returns the backup sets under backupRoot, newest first.
+func ListBackupSets(backupRoot string) ([]BackupSet, error) {
+	names, err := backupSets(backupRoot)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]BackupSet, 0, len(names))
+	for _, name := range names {
+		ts, _ := time.Parse(BackupTimestampLayout, name)
+		out = append(out, BackupSet{Name: name, Path: filepath.Join(backupRoot, name), Time: ts})
+	}
+	return out, nil
+}
+
+// backupSets lists the timestamped backup set names under backupRoot,
+// newest first.
+func backupSets(backupRoot string) ([]string, error) {
+	entries, err := os.ReadDir(backupRoot)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read backup dir: %w", err)
+	}
+	sets := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		if _, err := time.Parse(BackupTimestampLayout, e.Name()); err != nil {
+			continue
+		}
+		sets = append(sets, e.Name())
+	}
+	// The layout sorts lexically in chronological order.
+	sort.Sort(sort.Reverse(sort.StringSlice(sets)))
+	return sets, nil
+}
+
 func SHA256Hex(data []byte) string {
 	sum := sha256.Sum256(data)
 	return hex.EncodeToString(sum[:])
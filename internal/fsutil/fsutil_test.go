@@ -0,0 +1,118 @@
+package fsutil
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAtomicWriteFileReplacesContents(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "nested", "state.json")
+
+	for _, content := range []string{`{"v":1}`, `{"v":2}`} {
+		if err := AtomicWriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("AtomicWriteFile failed: %v", err)
+		}
+		got, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("read back: %v", err)
+		}
+		if string(got) != content {
+			t.Fatalf("expected %s, got %s", content, got)
+		}
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("expected mode 0600, got %o", perm)
+	}
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("expected only the target file, got %v", entries)
+	}
+}
+
+func TestPruneBackupsKeepsNewest(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"20250101T000000Z", "20250301T000000Z", "20250201T000000Z", "notes"} {
+		if err := os.MkdirAll(filepath.Join(root, name), 0o755); err != nil {
+			t.Fatalf("seed backup dir: %v", err)
+		}
+	}
+
+	removed, err := PruneBackups(root, 2)
+	if err != nil {
+		t.Fatalf("PruneBackups failed: %v", err)
+	}
+	if len(removed) != 1 || filepath.Base(removed[0]) != "20250101T000000Z" {
+		t.Fatalf("expected oldest set removed, got %v", removed)
+	}
+	for _, name := range []string{"20250201T000000Z", "20250301T000000Z", "notes"} {
+		if _, err := os.Stat(filepath.Join(root, name)); err != nil {
+			t.Errorf("expected %s to be kept: %v", name, err)
+		}
+	}
+}
+
+func TestPruneBackupsMissingRoot(t *testing.T) {
+	removed, err := PruneBackups(filepath.Join(t.TempDir(), "missing"), 1)
+	if err != nil || len(removed) != 0 {
+		t.Fatalf("expected no-op for missing root, got %v %v", removed, err)
+	}
+}
+
+func TestLatestBackupPicksNewestSet(t *testing.T) {
+	root := t.TempDir()
+	cfg := "/home/u/.cursor/mcp.json"
+	for _, set := range []string{"20250101T000000Z", "20250201T000000Z"} {
+		p := filepath.Join(root, set, sanitizePath(cfg))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte("{}"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A newer set that does not contain this file must be skipped.
+	if err := os.MkdirAll(filepath.Join(root, "20250301T000000Z"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := LatestBackup(cfg, root)
+	if err != nil {
+		t.Fatalf("LatestBackup failed: %v", err)
+	}
+	want := filepath.Join(root, "20250201T000000Z", sanitizePath(cfg))
+	if got != want {
+		t.Fatalf("expected %s, got %s", want, got)
+	}
+}
+
+func TestLockWaitsForRelease(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tap.lock")
+	unlock, err := Lock(context.Background(), path)
+	if err != nil {
+		t.Fatalf("Lock failed: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*lockPollInterval)
+	defer cancel()
+	if _, err := Lock(ctx, path); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected a held lock to time out, got %v", err)
+	}
+
+	unlock()
+	again, err := Lock(context.Background(), path)
+	if err != nil {
+		t.Fatalf("Lock after release failed: %v", err)
+	}
+	again()
+}
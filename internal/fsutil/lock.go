@@ -0,0 +1,34 @@
+package fsutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// lockPollInterval is how often Lock retries a lock held by someone else.
+const lockPollInterval = 50 * time.Millisecond
+
+// errLocked is returned by tryLock when another process holds the lock.
+var errLocked = errors.New("lock held")
+
+// Lock takes an exclusive advisory lock on path, creating the file if
+// needed, and waits until the lock is free or ctx is done. The returned
+// func releases the lock.
+func Lock(ctx context.Context, path string) (func(), error) {
+	for {
+		unlock, err := tryLock(path)
+		if err == nil {
+			return unlock, nil
+		}
+		if !errors.Is(err, errLocked) {
+			return nil, fmt.Errorf("lock %s: %w", path, err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("wait for lock %s: %w", path, ctx.Err())
+		case <-time.After(lockPollInterval):
+		}
+	}
+}
@@ -0,0 +1,31 @@
+//go:build windows
+
+package fsutil
+
+import (
+	"os"
+	"time"
+)
+
+// staleLockAge is how old a lock file must be before it is assumed to have
+// been left behind by a process that died holding it.
+const staleLockAge = 10 * time.Minute
+
+// tryLock creates path exclusively; the lock is held for as long as the file
+// exists.
+func tryLock(path string) (func(), error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0o644)
+	if os.IsExist(err) {
+		if fi, statErr := os.Stat(path); statErr == nil && time.Since(fi.ModTime()) > staleLockAge {
+			os.Remove(path)
+		}
+		return nil, errLocked
+	}
+	if err != nil {
+		return nil, err
+	}
+	return func() {
+		f.Close()
+		os.Remove(path)
+	}, nil
+}
@@ -0,0 +1,7 @@
+//go:build windows
+
+package fsutil
+
+// syncDir is a no-op on Windows, where directories cannot be opened for
+// syncing and renames are made durable by the filesystem.
+func syncDir(string) error { return nil }
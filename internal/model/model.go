@@ -4,9 +4,13 @@ import "time"
 
 const (
 	StateVersion          = 1
+	ManifestSchemaVersion = 1
 	TrustModeHash         = "hash"
 	SourceTypeTap         = "tap"
 	SourceTypeDirect      = "direct"
+	// SourceTypeUnknown marks a package rebuilt by repair from client
+	// configs, whose origin was lost with the state file.
+	SourceTypeUnknown     = "unknown"
 	TargetCodex         = "codex"
 	TargetClaude        = "claude"
 	TargetClaudeDesktop = "claude-desktop"
@@ -19,6 +23,7 @@ const (
 	DefaultTapName        = "official"
 	DefaultTapURL         = "https://github.com/sarjann/mcp-registry.git"
 	DefaultTapDescription = "Official mcper registry"
+	DefaultIndexFile      = "index.json"
 	ServerTransportSTDIO  = "stdio"
 	ServerTransportHTTP   = "http"
 )
@@ -28,6 +33,21 @@ type State struct {
 	Taps                 map[string]TapConfig        `json:"taps"`
 	Installed            map[string]InstalledPackage `json:"installed"`
 	TrustedDirectSources map[string]TrustDecision    `json:"trusted_direct_sources"`
+	Settings             Settings                    `json:"settings"`
+	// RetainedSecrets lists, by package, the keychain keys mcper stored for
+	// packages that are no longer installed, kept by remove --keep-secrets.
+	RetainedSecrets map[string][]string `json:"retained_secrets,omitempty"`
+}
+
+type Settings struct {
+	DefaultTarget string            `json:"default_target,omitempty"`
+	TargetAliases map[string]string `json:"target_aliases,omitempty"`
+	// LockMaxAge is how old a lockfile may be before reading it warns, as
+	// days ("90d") or a Go duration; "0" never warns. Empty is the default.
+	LockMaxAge string `json:"lock_max_age,omitempty"`
+	// RedactPatterns holds the space-separated regular expressions masked
+	// in output; empty means the defaults and "none" turns redaction off.
+	RedactPatterns string `json:"redact_patterns,omitempty"`
 }
 
 type TapConfig struct {
@@ -35,8 +55,16 @@ type TapConfig struct {
 	URL         string         `json:"url"`
 	Description string         `json:"description,omitempty"`
 	Trust       TapTrustConfig `json:"trust"`
-	CreatedAt   time.Time      `json:"created_at"`
-	UpdatedAt   time.Time      `json:"updated_at"`
+	CloneDepth  *int           `json:"clone_depth,omitempty"`
+	GitArgs     []string       `json:"git_args,omitempty"`
+	Subdir      string         `json:"subdir,omitempty"`
+	// IndexFile names the tap's index within Subdir; empty means index.json.
+	IndexFile string `json:"index_file,omitempty"`
+	// Submodules checks out the repository's git submodules after every
+	// clone and pull, for taps that vendor manifests through them.
+	Submodules bool      `json:"submodules,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
 }
 
 type TapTrustConfig struct {
@@ -47,24 +75,49 @@ type TrustDecision struct {
 	URL       string    `json:"url"`
 	Approved  bool      `json:"approved"`
 	CreatedAt time.Time `json:"created_at"`
+	// Identity is the signer whose cosign signature last verified the
+	// source, if one was checked.
+	Identity string `json:"identity,omitempty"`
 }
 
 type InstalledPackage struct {
-	Name           string    `json:"name"`
-	Version        string    `json:"version"`
-	Description    string    `json:"description,omitempty"`
-	Source         SourceRef `json:"source"`
-	ManifestDigest string    `json:"manifest_digest,omitempty"`
-	Servers        []string  `json:"servers"`
-	Targets        []string  `json:"targets"`
-	InstalledAt    time.Time `json:"installed_at"`
-	UpdatedAt      time.Time `json:"updated_at"`
+	Name           string              `json:"name"`
+	Version        string              `json:"version"`
+	Description    string              `json:"description,omitempty"`
+	Source         SourceRef           `json:"source"`
+	ManifestDigest string              `json:"manifest_digest,omitempty"`
+	Servers        []string            `json:"servers"`
+	Targets        []string            `json:"targets"`
+	TargetPaths    map[string]string   `json:"target_paths,omitempty"`
+	ServerTargets  map[string][]string `json:"server_targets,omitempty"`
+	InlinedEnv     map[string][]string `json:"inlined_env,omitempty"`
+	SecretKeys     []string            `json:"secret_keys,omitempty"`
+	// ServerPrefix is prepended to every manifest server name when written
+	// to client configs; Servers holds the prefixed names.
+	ServerPrefix string `json:"server_prefix,omitempty"`
+	// DefaultTargets, for installs with --map, are the targets the unmapped
+	// servers went to. Servers a later version adds are written there.
+	DefaultTargets []string `json:"default_targets,omitempty"`
+	// Unverified records that the tap's trust checks were skipped with
+	// install --no-verify.
+	Unverified bool `json:"unverified,omitempty"`
+	// TargetVersions lists targets that upgrade --target left on an older
+	// version, with that version; every other target is at Version.
+	TargetVersions map[string]string `json:"target_versions,omitempty"`
+	// EnvOverrides holds the env values set with install --env, by written
+	// server name, so reinstalls and upgrades write them again.
+	EnvOverrides map[string]map[string]string `json:"env_overrides,omitempty"`
+	InstalledAt  time.Time                    `json:"installed_at"`
+	UpdatedAt    time.Time                    `json:"updated_at"`
 }
 
 type SourceRef struct {
 	Type string `json:"type"`
 	Tap  string `json:"tap,omitempty"`
 	URL  string `json:"url,omitempty"`
+	// ManifestPath is the local manifest install --manifest-path read in
+	// place of the tap's; reinstalls and doctor read it again.
+	ManifestPath string `json:"manifest_path,omitempty"`
 }
 
 type RegistryIndex struct {
@@ -75,12 +128,15 @@ type RegistryIndex struct {
 
 type IndexPackage struct {
 	Description string                  `json:"description,omitempty"`
+	Homepage    string                  `json:"homepage,omitempty"`
 	Versions    map[string]IndexVersion `json:"versions"`
 }
 
 type IndexVersion struct {
 	ManifestPath string `json:"manifest"`
 	SHA256       string `json:"sha256,omitempty"`
+	Yanked       bool   `json:"yanked,omitempty"`
+	YankReason   string `json:"yank_reason,omitempty"`
 }
 
 type SetupCommand struct {
@@ -94,9 +150,16 @@ type PackageManifest struct {
 	Name          string                     `json:"name"`
 	Version       string                     `json:"version"`
 	Description   string                     `json:"description,omitempty"`
+	Homepage      string                     `json:"homepage,omitempty"`
+	Repository    string                     `json:"repository,omitempty"`
 	MCPServers    map[string]MCPServerSpec   `json:"mcp_servers"`
 	SetupCommands map[string]SetupCommand    `json:"setup_commands,omitempty"`
 	Compatibility Compatibility              `json:"compatibility,omitempty"`
+	Changelog     string                     `json:"changelog,omitempty"`
+	ReleaseNotes  map[string]string          `json:"release_notes,omitempty"`
+	// RequiredTools names executables the servers need on PATH, such as
+	// node or uvx, checked at install and by doctor.
+	RequiredTools []string `json:"required_tools,omitempty"`
 }
 
 type Compatibility struct {
@@ -107,11 +170,15 @@ type Compatibility struct {
 }
 
 type MCPServerSpec struct {
-	Transport   string   `json:"transport"`
-	Command     string   `json:"command,omitempty"`
-	Args        []string `json:"args,omitempty"`
-	URL         string   `json:"url,omitempty"`
-	EnvRequired []string `json:"env_required,omitempty"`
+	Transport         string            `json:"transport"`
+	Command           string            `json:"command,omitempty"`
+	Args              []string          `json:"args,omitempty"`
+	URL               string            `json:"url,omitempty"`
+	Env               map[string]string `json:"env,omitempty"`
+	EnvRequired       []string          `json:"env_required,omitempty"`
+	ExpandHostEnv     bool              `json:"expand_host_env,omitempty"`
+	MinCommandVersion string            `json:"min_command_version,omitempty"`
+	Description       string            `json:"description,omitempty"`
 }
 
 type Lockfile struct {
@@ -132,6 +199,25 @@ type SBOMItem struct {
 	Source  SourceRef `json:"source"`
 }
 
+// Bundle carries the exact manifests behind installed packages, keyed by
+// name@version, so they can be reinstalled without tap or network access.
+type Bundle struct {
+	SchemaVersion int                    `json:"schema_version"`
+	GeneratedAt   time.Time              `json:"generated_at"`
+	Packages      map[string]BundleEntry `json:"packages"`
+}
+
+// BundleEntry is one bundled manifest. Manifest holds the original bytes as
+// a string rather than nested JSON, since re-encoding would change them and
+// ManifestDigest is their SHA-256.
+type BundleEntry struct {
+	Name           string    `json:"name"`
+	Version        string    `json:"version"`
+	Source         SourceRef `json:"source"`
+	ManifestDigest string    `json:"manifest_digest"`
+	Manifest       string    `json:"manifest"`
+}
+
 func NewDefaultState() State {
 	now := time.Now().UTC()
 	return State{
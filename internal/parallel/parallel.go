@@ -0,0 +1,52 @@
+// Package parallel runs indexed jobs with a cap on how many run at once.
+package parallel
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrSkipped marks jobs that never started because an earlier job failed.
+var ErrSkipped = errors.New("skipped after an earlier failure")
+
+// Run calls fn for every index in [0, n) with at most limit calls in flight
+// and returns their errors by index. Jobs start in index order; a limit
+// below 1 runs them one at a time. With stopOnError no job starts after one
+// has failed, and those report ErrSkipped, so a limit of 1 behaves exactly
+// like a sequential loop that returns on the first error.
+func Run(n, limit int, stopOnError bool, fn func(i int) error) []error {
+	if limit < 1 {
+		limit = 1
+	}
+	errs := make([]error, n)
+	sem := make(chan struct{}, limit)
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		failed bool
+	)
+	for i := 0; i < n; i++ {
+		sem <- struct{}{}
+		mu.Lock()
+		stop := stopOnError && failed
+		mu.Unlock()
+		if stop {
+			<-sem
+			errs[i] = ErrSkipped
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err := fn(i); err != nil {
+				errs[i] = err
+				mu.Lock()
+				failed = true
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return errs
+}
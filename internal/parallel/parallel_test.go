@@ -0,0 +1,68 @@
+package parallel
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// maxInFlight runs n jobs under limit and reports the most that overlapped.
+func maxInFlight(n, limit int) int {
+	var mu sync.Mutex
+	cur, peak := 0, 0
+	Run(n, limit, false, func(int) error {
+		mu.Lock()
+		cur++
+		if cur > peak {
+			peak = cur
+		}
+		mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+		mu.Lock()
+		cur--
+		mu.Unlock()
+		return nil
+	})
+	return peak
+}
+
+func TestRunRespectsLimit(t *testing.T) {
+	if got := maxInFlight(6, 1); got != 1 {
+		t.Errorf("expected limit 1 to serialize, saw %d in flight", got)
+	}
+	if got := maxInFlight(6, 0); got != 1 {
+		t.Errorf("expected limit 0 to be treated as 1, saw %d in flight", got)
+	}
+	if got := maxInFlight(6, 2); got > 2 {
+		t.Errorf("expected at most 2 in flight, saw %d", got)
+	}
+}
+
+func TestRunStopOnError(t *testing.T) {
+	boom := errors.New("boom")
+	var ran []int
+	errs := Run(4, 1, true, func(i int) error {
+		ran = append(ran, i)
+		if i == 1 {
+			return boom
+		}
+		return nil
+	})
+	if len(ran) != 2 {
+		t.Fatalf("expected jobs after the failure to be skipped, ran %v", ran)
+	}
+	if errs[0] != nil || !errors.Is(errs[1], boom) || !errors.Is(errs[2], ErrSkipped) || !errors.Is(errs[3], ErrSkipped) {
+		t.Fatalf("unexpected errors %v", errs)
+	}
+
+	errs = Run(3, 1, false, func(i int) error {
+		if i == 0 {
+			return boom
+		}
+		return nil
+	})
+	if errs[1] != nil || errs[2] != nil {
+		t.Fatalf("expected later jobs to run without stopOnError, got %v", errs)
+	}
+}
@@ -34,6 +34,15 @@ func StatePath() (string, error) {
 	return filepath.Join(d, "state.json"), nil
 }
 
+// HistoryPath is the append-only log of installs, upgrades and removals.
+func HistoryPath() (string, error) {
+	d, err := ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(d, "history.jsonl"), nil
+}
+
 func BackupDir() (string, error) {
 	d, err := ConfigDir()
 	if err != nil {
@@ -50,6 +59,16 @@ func TapCacheDir(tap string) (string, error) {
 	return filepath.Join(d, "taps", tap), nil
 }
 
+// TapLockPath is the lock file guarding a tap's cache. It sits beside the
+// cache directory because the cache itself is replaced on re-clone.
+func TapLockPath(tap string) (string, error) {
+	d, err := CacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(d, "taps", "."+tap+".lock"), nil
+}
+
 func EnsureDir(path string) error {
 	return os.MkdirAll(path, 0o755)
 }
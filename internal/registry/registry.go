@@ -7,22 +7,42 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
-	"regexp"
 	"os/exec"
 	"path/filepath"
+	"reflect"
+	"regexp"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	semver "github.com/Masterminds/semver/v3"
 
 	"github.com/sarjann/mcper/internal/fsutil"
 	"github.com/sarjann/mcper/internal/model"
+	"github.com/sarjann/mcper/internal/parallel"
 	"github.com/sarjann/mcper/internal/paths"
+	"github.com/sarjann/mcper/internal/shellargs"
 )
 
-type Client struct{}
+type Client struct {
+	// Concurrency caps how many taps Search syncs at once; below 1 means
+	// one at a time.
+	Concurrency int
+
+	mu      sync.Mutex
+	indexes map[string]cachedIndex
+}
+
+// cachedIndex is a decoded tap index and the digest of the bytes it was
+// decoded from, so a changed index is never served stale.
+type cachedIndex struct {
+	digest string
+	index  model.RegistryIndex
+}
 
 func NewClient() *Client {
 	return &Client{}
@@ -36,43 +56,112 @@ type TapSnapshot struct {
 }
 
 func (c *Client) SyncTap(ctx context.Context, tap model.TapConfig) (TapSnapshot, error) {
-	localPath, err := c.materializeTap(ctx, tap)
+	return c.syncTap(ctx, tap, true)
+}
+
+// syncTap is SyncTap, checking the index against the tap's trust mode only
+// when verify is set.
+func (c *Client) syncTap(ctx context.Context, tap model.TapConfig, verify bool) (TapSnapshot, error) {
+	localPath, indexRaw, err := c.fetchTapIndex(ctx, tap)
 	if err != nil {
 		return TapSnapshot{}, err
 	}
+	if verify {
+		if err := verifyTapIndex(ctx, tap, localPath, indexRaw); err != nil {
+			return TapSnapshot{}, err
+		}
+	}
 
-	indexPath := filepath.Join(localPath, "index.json")
-	indexRaw, err := os.ReadFile(indexPath)
+	idx, err := c.decodeIndex(tap.Name, indexRaw)
 	if err != nil {
-		return TapSnapshot{}, fmt.Errorf("read index for tap %q: %w", tap.Name, err)
+		return TapSnapshot{}, err
 	}
 
-	if err := VerifyTapIndex(ctx, tap, localPath, indexRaw); err != nil {
-		return TapSnapshot{}, err
+	return TapSnapshot{Tap: tap, LocalPath: localPath, Index: idx, IndexRaw: indexRaw}, nil
+}
+
+// fetchTapIndex brings the tap's local copy up to date and reads its
+// index, without verifying or decoding it.
+func (c *Client) fetchTapIndex(ctx context.Context, tap model.TapConfig) (string, []byte, error) {
+	repoPath, err := c.materializeTap(ctx, tap)
+	if err != nil {
+		return "", nil, err
+	}
+	localPath, err := tapRoot(tap, repoPath)
+	if err != nil {
+		return "", nil, err
+	}
+	indexRaw, err := os.ReadFile(filepath.Join(localPath, indexFile(tap)))
+	if err != nil {
+		return "", nil, fmt.Errorf("read index for tap %q: %w", tap.Name, err)
+	}
+	return localPath, indexRaw, nil
+}
+
+// indexFile returns the name of the tap's index file.
+func indexFile(tap model.TapConfig) string {
+	if tap.IndexFile == "" {
+		return model.DefaultIndexFile
+	}
+	return tap.IndexFile
+}
+
+// tapRoot returns the directory holding the tap's index file: the repository
+// itself, or tap.Subdir within it.
+func tapRoot(tap model.TapConfig, repoPath string) (string, error) {
+	if tap.Subdir == "" {
+		return repoPath, nil
+	}
+	if !filepath.IsLocal(tap.Subdir) {
+		return "", fmt.Errorf("tap %q subdir %q must be a relative path inside the repository", tap.Name, tap.Subdir)
+	}
+	root := filepath.Join(repoPath, tap.Subdir)
+	if fi, err := os.Stat(root); err != nil || !fi.IsDir() {
+		return "", fmt.Errorf("tap %q subdir %q not found in %s", tap.Name, tap.Subdir, repoPath)
+	}
+	return root, nil
+}
+
+// decodeIndex parses indexRaw, reusing the previous result for the tap when
+// the bytes are unchanged. The returned index is shared and must not be
+// modified.
+func (c *Client) decodeIndex(tapName string, indexRaw []byte) (model.RegistryIndex, error) {
+	digest := fsutil.SHA256Hex(indexRaw)
+	c.mu.Lock()
+	cached, ok := c.indexes[tapName]
+	c.mu.Unlock()
+	if ok && cached.digest == digest {
+		return cached.index, nil
 	}
 
 	var idx model.RegistryIndex
 	if err := json.Unmarshal(indexRaw, &idx); err != nil {
-		return TapSnapshot{}, fmt.Errorf("decode tap index %q: %w", tap.Name, err)
+		return model.RegistryIndex{}, fmt.Errorf("decode tap index %q: %w", tapName, err)
 	}
 	if idx.Packages == nil {
 		idx.Packages = map[string]model.IndexPackage{}
 	}
 
-	return TapSnapshot{Tap: tap, LocalPath: localPath, Index: idx, IndexRaw: indexRaw}, nil
+	c.mu.Lock()
+	if c.indexes == nil {
+		c.indexes = make(map[string]cachedIndex)
+	}
+	c.indexes[tapName] = cachedIndex{digest: digest, index: idx}
+	c.mu.Unlock()
+	return idx, nil
 }
 
 func (c *Client) materializeTap(ctx context.Context, tap model.TapConfig) (string, error) {
 	if tap.URL == "" {
 		return "", fmt.Errorf("tap %q has empty URL", tap.Name)
 	}
-
-	if strings.HasPrefix(tap.URL, "file://") {
-		p := strings.TrimPrefix(tap.URL, "file://")
-		return p, nil
+	source, err := expandTapURL(tap)
+	if err != nil {
+		return "", err
 	}
-	if fi, err := os.Stat(tap.URL); err == nil && fi.IsDir() {
-		return tap.URL, nil
+
+	if dir, ok := isLocalTap(source); ok {
+		return dir, nil
 	}
 
 	cacheDir, err := paths.TapCacheDir(tap.Name)
@@ -83,39 +172,234 @@ func (c *Client) materializeTap(ctx context.Context, tap model.TapConfig) (strin
 		return "", fmt.Errorf("create tap cache parent: %w", err)
 	}
 
-	if _, err := os.Stat(cacheDir); err == nil {
-		cmd := exec.CommandContext(ctx, "git", "-C", cacheDir, "pull", "--ff-only")
-		out, runErr := cmd.CombinedOutput()
-		if runErr == nil {
-			return cacheDir, nil
+	// Another mcper process may be syncing the same tap; git operations on
+	// one cache are serialized so neither sees the other's half-done work.
+	lockPath, err := paths.TapLockPath(tap.Name)
+	if err != nil {
+		return "", err
+	}
+	unlock, err := fsutil.Lock(ctx, lockPath)
+	if err != nil {
+		return "", fmt.Errorf("lock tap %q cache: %w", tap.Name, err)
+	}
+	defer unlock()
+
+	// A cache without its index is left over from an interrupted clone and
+	// cannot be trusted to pull cleanly, so it is discarded and re-cloned.
+	// A complete cache is kept when a pull fails, as being offline or
+	// canceled says nothing about the cache itself.
+	if fi, err := os.Stat(filepath.Join(cacheDir, tap.Subdir, indexFile(tap))); err == nil && !fi.IsDir() {
+		if err := c.pullTap(ctx, tap, source, cacheDir); err != nil {
+			if ctx.Err() != nil {
+				return "", fmt.Errorf("pull tap %q: %w", tap.Name, ctx.Err())
+			}
+			return "", fmt.Errorf("pull tap %q: %w", tap.Name, err)
 		}
-		_ = os.RemoveAll(cacheDir)
-		_ = out
+		return cacheDir, nil
+	}
+	if err := os.RemoveAll(cacheDir); err != nil {
+		return "", fmt.Errorf("remove stale tap cache %s: %w", cacheDir, err)
 	}
 
-	cmd := exec.CommandContext(ctx, "git", "clone", "--depth=1", tap.URL, cacheDir)
+	// Clone next to the final location and swap it in only once complete so
+	// a killed process never leaves a half-populated cache behind.
+	tmpDir, err := os.MkdirTemp(filepath.Dir(cacheDir), ".clone-"+tap.Name+"-*")
+	if err != nil {
+		return "", fmt.Errorf("create temp clone dir: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	args := []string{"clone"}
+	if depth := cloneDepth(tap); depth > 0 {
+		args = append(args, fmt.Sprintf("--depth=%d", depth))
+	}
+	args = append(args, tap.GitArgs...)
+	args = append(args, source, tmpDir)
+	cmd := exec.CommandContext(ctx, "git", args...)
+	// git hands the transfer to helper processes that outlive a killed
+	// parent; stop waiting on their output shortly after a cancel.
+	cmd.WaitDelay = gitWaitDelay
 	out, err := cmd.CombinedOutput()
+	if err != nil && ctx.Err() != nil {
+		return "", fmt.Errorf("clone tap %q from %q: %w", tap.Name, tap.URL, ctx.Err())
+	}
 	if err != nil {
-		return "", fmt.Errorf("clone tap %q from %q: %w (%s)", tap.Name, tap.URL, err, strings.TrimSpace(string(out)))
+		return "", fmt.Errorf("clone tap %q from %q: %w (%s)", tap.Name, tap.URL, err, redactTapURL(tap, strings.TrimSpace(string(out))))
+	}
+	if source != tap.URL {
+		// Keep the expanded URL, which may carry a token, out of
+		// .git/config; pullTap passes it to git on every sync instead.
+		if out, err := exec.CommandContext(ctx, "git", "-C", tmpDir, "remote", "set-url", "origin", tap.URL).CombinedOutput(); err != nil {
+			return "", fmt.Errorf("set tap %q remote: %w (%s)", tap.Name, err, redactTapURL(tap, strings.TrimSpace(string(out))))
+		}
+	}
+	if err := updateSubmodules(ctx, tap, tmpDir); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmpDir, cacheDir); err != nil {
+		return "", fmt.Errorf("move tap %q clone into cache: %w", tap.Name, err)
 	}
 	return cacheDir, nil
 }
 
+var tapURLVar = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// redactTapURL replaces the values expanded into tap's URL template with
+// their ${VAR} references, so git output quoting the URL leaks no token.
+func redactTapURL(tap model.TapConfig, text string) string {
+	for _, ref := range tapURLVar.FindAllStringSubmatch(tap.URL, -1) {
+		if val := os.Getenv(ref[1]); val != "" {
+			text = strings.ReplaceAll(text, val, ref[0])
+		}
+	}
+	return text
+}
+
+// expandTapURL substitutes ${VAR} references in the tap URL from the
+// environment, so stored state can stay generic while hosts and tokens vary
+// per machine. Errors name the template, never the expanded URL.
+func expandTapURL(tap model.TapConfig) (string, error) {
+	var missing []string
+	source := tapURLVar.ReplaceAllStringFunc(tap.URL, func(ref string) string {
+		key := tapURLVar.FindStringSubmatch(ref)[1]
+		val, ok := os.LookupEnv(key)
+		if !ok {
+			missing = append(missing, key)
+		}
+		return val
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("tap %q URL %q references unset environment variable(s) %s", tap.Name, tap.URL, strings.Join(missing, ", "))
+	}
+	return source, nil
+}
+
 type SearchResult struct {
-	Tap         string `json:"tap"`
-	Name        string `json:"name"`
-	Description string `json:"description"`
-	Latest      string `json:"latest"`
+	Tap         string   `json:"tap"`
+	Taps        []string `json:"taps,omitempty"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Homepage    string   `json:"homepage,omitempty"`
+	Latest      string   `json:"latest"`
+}
+
+// LastSynced reports when a git tap's local cache was last cloned or pulled.
+// Local taps are read in place and report false.
+func LastSynced(tap model.TapConfig) (time.Time, bool) {
+	source, err := expandTapURL(tap)
+	if err != nil {
+		source = tap.URL
+	}
+	if _, ok := isLocalTap(source); ok {
+		return time.Time{}, false
+	}
+	cacheDir, err := paths.TapCacheDir(tap.Name)
+	if err != nil {
+		return time.Time{}, false
+	}
+	// FETCH_HEAD is rewritten by every pull; a fresh clone only has the index.
+	for _, p := range []string{filepath.Join(cacheDir, ".git", "FETCH_HEAD"), filepath.Join(cacheDir, tap.Subdir, indexFile(tap))} {
+		if fi, err := os.Stat(p); err == nil {
+			return fi.ModTime(), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// isLocalTap reports whether the expanded tap source is a file:// URL or an
+// existing directory, which are read in place rather than cloned, and
+// returns that directory.
+func isLocalTap(source string) (string, bool) {
+	if strings.HasPrefix(source, "file://") {
+		return strings.TrimPrefix(source, "file://"), true
+	}
+	if fi, err := os.Stat(source); err == nil && fi.IsDir() {
+		return source, true
+	}
+	return "", false
+}
+
+// pullTap fast-forwards an existing tap cache. A shallow cache is deepened
+// first when the tap has since been switched to full history.
+func (c *Client) pullTap(ctx context.Context, tap model.TapConfig, source, cacheDir string) error {
+	// A templated URL is not stored as the remote, so it is expanded and
+	// passed on each sync; that also follows a changed host or token.
+	var remote []string
+	if source != tap.URL {
+		remote = []string{source}
+	}
+	if cloneDepth(tap) == 0 {
+		if _, err := os.Stat(filepath.Join(cacheDir, ".git", "shallow")); err == nil {
+			args := append([]string{"-C", cacheDir, "fetch", "--unshallow", "--tags"}, remote...)
+			cmd := exec.CommandContext(ctx, "git", args...)
+			cmd.WaitDelay = gitWaitDelay
+			if err := cmd.Run(); err != nil {
+				return err
+			}
+		}
+	}
+	args := append([]string{"-C", cacheDir, "pull", "--ff-only"}, remote...)
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.WaitDelay = gitWaitDelay
+	if err := cmd.Run(); err != nil {
+		return err
+	}
+	return updateSubmodules(ctx, tap, cacheDir)
+}
+
+// updateSubmodules checks out the submodules of a tap that asks for them,
+// as shallow as the tap itself. Clones and pulls leave them empty.
+func updateSubmodules(ctx context.Context, tap model.TapConfig, dir string) error {
+	if !tap.Submodules {
+		return nil
+	}
+	args := []string{"-C", dir, "submodule", "update", "--init", "--recursive"}
+	if depth := cloneDepth(tap); depth > 0 {
+		args = append(args, fmt.Sprintf("--depth=%d", depth))
+	}
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.WaitDelay = gitWaitDelay
+	out, err := cmd.CombinedOutput()
+	if err != nil && ctx.Err() != nil {
+		return fmt.Errorf("update tap %q submodules: %w", tap.Name, ctx.Err())
+	}
+	if err != nil {
+		return fmt.Errorf("update tap %q submodules: %w (%s)", tap.Name, err, redactTapURL(tap, strings.TrimSpace(string(out))))
+	}
+	return nil
+}
+
+// gitWaitDelay bounds how long a canceled git command may keep its output
+// open.
+const gitWaitDelay = time.Second
+
+// cloneDepth returns the history depth to clone for tap; 0 means full
+// history. Taps without an explicit depth are cloned shallow.
+func cloneDepth(tap model.TapConfig) int {
+	if tap.CloneDepth == nil {
+		return 1
+	}
+	return *tap.CloneDepth
 }
 
 func (c *Client) Search(ctx context.Context, taps map[string]model.TapConfig, query string) ([]SearchResult, error) {
 	query = strings.ToLower(strings.TrimSpace(query))
 	results := make([]SearchResult, 0)
+	ordered := make([]model.TapConfig, 0, len(taps))
 	for _, tap := range taps {
-		snap, err := c.SyncTap(ctx, tap)
-		if err != nil {
+		ordered = append(ordered, tap)
+	}
+	snaps := make([]TapSnapshot, len(ordered))
+	errs := parallel.Run(len(ordered), c.Concurrency, false, func(i int) error {
+		var err error
+		snaps[i], err = c.SyncTap(ctx, ordered[i])
+		return err
+	})
+	for i, snap := range snaps {
+		if errs[i] != nil {
 			continue
 		}
+		tap := snap.Tap
 		for name, pkg := range snap.Index.Packages {
 			if query != "" {
 				hay := strings.ToLower(name + " " + pkg.Description)
@@ -128,6 +412,7 @@ func (c *Client) Search(ctx context.Context, taps map[string]model.TapConfig, qu
 				Tap:         tap.Name,
 				Name:        name,
 				Description: pkg.Description,
+				Homepage:    pkg.Homepage,
 				Latest:      latest,
 			})
 		}
@@ -141,12 +426,60 @@ func (c *Client) Search(ctx context.Context, taps map[string]model.TapConfig, qu
 	return results, nil
 }
 
+// DedupResults collapses results sharing a package name into a single row
+// listing every tap that provides it, keeping the highest latest version.
+// Input is expected in the order returned by Search.
+func DedupResults(results []SearchResult) []SearchResult {
+	out := make([]SearchResult, 0, len(results))
+	index := map[string]int{}
+	for _, r := range results {
+		i, ok := index[r.Name]
+		if !ok {
+			r.Taps = []string{r.Tap}
+			index[r.Name] = len(out)
+			out = append(out, r)
+			continue
+		}
+		merged := out[i]
+		merged.Taps = append(merged.Taps, r.Tap)
+		if versionGreater(r.Latest, merged.Latest) {
+			merged.Latest = r.Latest
+			if r.Description != "" {
+				merged.Description = r.Description
+			}
+			if r.Homepage != "" {
+				merged.Homepage = r.Homepage
+			}
+		}
+		out[i] = merged
+	}
+	for i := range out {
+		out[i].Tap = strings.Join(out[i].Taps, ",")
+	}
+	return out
+}
+
+func versionGreater(a, b string) bool {
+	va, errA := semver.NewVersion(a)
+	vb, errB := semver.NewVersion(b)
+	if errA != nil || errB != nil {
+		return errB != nil && errA == nil
+	}
+	return va.GreaterThan(vb)
+}
+
+// ErrPackageNotFound is returned when a tap index has no entry for a package.
+var ErrPackageNotFound = errors.New("package not found")
+
 type ResolvedPackage struct {
 	Manifest       model.PackageManifest
 	ManifestRaw    []byte
 	ManifestDigest string
 	Tap            model.TapConfig
 	Version        string
+	Warnings       []string
+	// Unverified is set when the tap's trust mode checks were skipped.
+	Unverified bool
 }
 
 func (c *Client) ResolveFromTap(ctx context.Context, tap model.TapConfig, name, versionExpr string) (ResolvedPackage, error) {
@@ -154,9 +487,42 @@ func (c *Client) ResolveFromTap(ctx context.Context, tap model.TapConfig, name,
 	if err != nil {
 		return ResolvedPackage{}, err
 	}
+	return resolveInSnapshot(ctx, snap, name, versionExpr, true)
+}
+
+// ResolveInSnapshot is ResolveFromTap against a tap already synced with
+// SyncTap. Callers resolving many packages of one tap at once sync it once
+// and resolve from the snapshot, so none of them pulls, or discards, the
+// cache while another reads it.
+func (c *Client) ResolveInSnapshot(ctx context.Context, snap TapSnapshot, name, versionExpr string) (ResolvedPackage, error) {
+	return resolveInSnapshot(ctx, snap, name, versionExpr, true)
+}
+
+// ResolveFromTapUnverified is ResolveFromTap without the tap's trust mode
+// checks on the index and manifest, for users who trust the tap by other
+// means. The manifest is still checked against the index hash. The result
+// is marked Unverified.
+func (c *Client) ResolveFromTapUnverified(ctx context.Context, tap model.TapConfig, name, versionExpr string) (ResolvedPackage, error) {
+	snap, err := c.syncTap(ctx, tap, false)
+	if err != nil {
+		return ResolvedPackage{}, err
+	}
+	resolved, err := resolveInSnapshot(ctx, snap, name, versionExpr, false)
+	if err != nil {
+		return ResolvedPackage{}, err
+	}
+	resolved.Unverified = true
+	return resolved, nil
+}
+
+// resolveInSnapshot resolves a package from an already synced tap, checking
+// the manifest against the index hash and, when verify is set, the tap's
+// trust mode.
+func resolveInSnapshot(ctx context.Context, snap TapSnapshot, name, versionExpr string, verify bool) (ResolvedPackage, error) {
+	tap := snap.Tap
 	pkg, ok := snap.Index.Packages[name]
 	if !ok {
-		return ResolvedPackage{}, fmt.Errorf("package %q not found in tap %q", name, tap.Name)
+		return ResolvedPackage{}, fmt.Errorf("%w: %q in tap %q", ErrPackageNotFound, name, tap.Name)
 	}
 
 	resolvedVersion, meta, err := resolveVersion(pkg, versionExpr)
@@ -175,16 +541,27 @@ func (c *Client) ResolveFromTap(ctx context.Context, tap model.TapConfig, name,
 			return ResolvedPackage{}, fmt.Errorf("manifest hash mismatch for %s@%s: expected %s got %s", name, resolvedVersion, meta.SHA256, actual)
 		}
 	}
-	if err := VerifyManifest(ctx, tap, snap.LocalPath, manifestPath, meta); err != nil {
-		return ResolvedPackage{}, err
+	if verify {
+		if err := verifyManifest(ctx, tap, snap.LocalPath, manifestPath, meta); err != nil {
+			return ResolvedPackage{}, err
+		}
 	}
 
-	var mf model.PackageManifest
-	if err := json.Unmarshal(manifestRaw, &mf); err != nil {
+	mf, unknown, err := decodeManifest(manifestRaw)
+	if err != nil {
 		return ResolvedPackage{}, fmt.Errorf("decode manifest %s: %w", manifestPath, err)
 	}
 	if err := validateManifest(mf); err != nil {
-		return ResolvedPackage{}, err
+		return ResolvedPackage{}, withUnknownFields(err, unknown)
+	}
+
+	warnings := unknownFieldWarnings(unknown)
+	if meta.Yanked {
+		msg := fmt.Sprintf("%s@%s has been yanked", name, resolvedVersion)
+		if meta.YankReason != "" {
+			msg += ": " + meta.YankReason
+		}
+		warnings = append(warnings, msg)
 	}
 
 	return ResolvedPackage{
@@ -193,9 +570,56 @@ func (c *Client) ResolveFromTap(ctx context.Context, tap model.TapConfig, name,
 		ManifestDigest: fsutil.SHA256Hex(manifestRaw),
 		Tap:            tap,
 		Version:        resolvedVersion,
+		Warnings:       warnings,
 	}, nil
 }
 
+type VersionInfo struct {
+	Version    string `json:"version"`
+	Yanked     bool   `json:"yanked,omitempty"`
+	YankReason string `json:"yank_reason,omitempty"`
+}
+
+// ListVersions returns every version of a package in the tap index, newest
+// first. Keys that are not valid semver sort after the rest.
+func (c *Client) ListVersions(ctx context.Context, tap model.TapConfig, name string) ([]VersionInfo, error) {
+	snap, err := c.SyncTap(ctx, tap)
+	if err != nil {
+		return nil, err
+	}
+	pkg, ok := snap.Index.Packages[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q in tap %q", ErrPackageNotFound, name, tap.Name)
+	}
+	return sortedVersions(pkg), nil
+}
+
+func sortedVersions(pkg model.IndexPackage) []VersionInfo {
+	parsed := make([]*semver.Version, 0, len(pkg.Versions))
+	invalid := make([]string, 0)
+	for raw := range pkg.Versions {
+		v, err := semver.NewVersion(raw)
+		if err != nil {
+			invalid = append(invalid, raw)
+			continue
+		}
+		parsed = append(parsed, v)
+	}
+	sort.Sort(sort.Reverse(semver.Collection(parsed)))
+	sort.Strings(invalid)
+
+	out := make([]VersionInfo, 0, len(pkg.Versions))
+	for _, v := range parsed {
+		meta := pkg.Versions[v.Original()]
+		out = append(out, VersionInfo{Version: v.Original(), Yanked: meta.Yanked, YankReason: meta.YankReason})
+	}
+	for _, raw := range invalid {
+		meta := pkg.Versions[raw]
+		out = append(out, VersionInfo{Version: raw, Yanked: meta.Yanked, YankReason: meta.YankReason})
+	}
+	return out
+}
+
 func (c *Client) ResolveUpgrade(ctx context.Context, tap model.TapConfig, name, currentVersion string, allowMajor bool) (ResolvedPackage, bool, error) {
 	snap, err := c.SyncTap(ctx, tap)
 	if err != nil {
@@ -203,7 +627,7 @@ func (c *Client) ResolveUpgrade(ctx context.Context, tap model.TapConfig, name,
 	}
 	_, ok := snap.Index.Packages[name]
 	if !ok {
-		return ResolvedPackage{}, false, fmt.Errorf("package %q not found in tap %q", name, tap.Name)
+		return ResolvedPackage{}, false, fmt.Errorf("%w: %q in tap %q", ErrPackageNotFound, name, tap.Name)
 	}
 
 	targetExpr := ""
@@ -237,17 +661,30 @@ func (c *Client) ResolveUpgrade(ctx context.Context, tap model.TapConfig, name,
 }
 
 func (c *Client) ResolveFromURL(ctx context.Context, url string) (ResolvedPackage, error) {
-	_ = ctx
-	data, err := c.readURLOrFile(url)
+	return c.ResolveFromURLWithHeaders(ctx, url, nil)
+}
+
+// ResolveFromURLWithHeaders is ResolveFromURL with extra request headers,
+// such as Authorization, for manifests behind an authenticated endpoint.
+// Headers are ignored for local paths.
+func (c *Client) ResolveFromURLWithHeaders(ctx context.Context, url string, headers http.Header) (ResolvedPackage, error) {
+	data, err := c.readURLOrFile(ctx, url, headers)
 	if err != nil {
 		return ResolvedPackage{}, err
 	}
-	var mf model.PackageManifest
-	if err := json.Unmarshal(data, &mf); err != nil {
-		return ResolvedPackage{}, fmt.Errorf("decode manifest from %q: %w", url, err)
+	return ResolveManifest(data, url)
+}
+
+// ResolveManifest decodes and validates manifest bytes that were obtained
+// some other way, such as from an export bundle. origin names where the bytes
+// came from in errors.
+func ResolveManifest(data []byte, origin string) (ResolvedPackage, error) {
+	mf, unknown, err := decodeManifest(data)
+	if err != nil {
+		return ResolvedPackage{}, fmt.Errorf("decode manifest from %q: %w", origin, err)
 	}
 	if err := validateManifest(mf); err != nil {
-		return ResolvedPackage{}, err
+		return ResolvedPackage{}, withUnknownFields(err, unknown)
 	}
 
 	return ResolvedPackage{
@@ -255,17 +692,23 @@ func (c *Client) ResolveFromURL(ctx context.Context, url string) (ResolvedPackag
 		ManifestRaw:    data,
 		ManifestDigest: fsutil.SHA256Hex(data),
 		Version:        mf.Version,
+		Warnings:       unknownFieldWarnings(unknown),
 	}, nil
 }
 
-func (c *Client) readURLOrFile(raw string) ([]byte, error) {
+func (c *Client) readURLOrFile(ctx context.Context, raw string, headers http.Header) ([]byte, error) {
 	if strings.HasPrefix(raw, "http://") || strings.HasPrefix(raw, "https://") {
-		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
 		defer cancel()
 		req, err := http.NewRequestWithContext(ctx, http.MethodGet, raw, nil)
 		if err != nil {
 			return nil, fmt.Errorf("create request: %w", err)
 		}
+		for name, values := range headers {
+			for _, v := range values {
+				req.Header.Add(name, v)
+			}
+		}
 		resp, err := http.DefaultClient.Do(req)
 		if err != nil {
 			return nil, fmt.Errorf("fetch %q: %w", raw, err)
@@ -291,18 +734,24 @@ func resolveVersion(pkg model.IndexPackage, versionExpr string) (string, model.I
 		return "", model.IndexVersion{}, errors.New("package has no versions")
 	}
 
+	constraintExpr := ">=0.0.0"
+	if versionExpr != "" {
+		constraintExpr = versionExpr
+	}
 	if versionExpr != "" && !strings.ContainsAny(versionExpr, "<>=~^,") {
 		meta, ok := pkg.Versions[versionExpr]
+		if ok {
+			return versionExpr, meta, nil
+		}
+		// A partial version such as "1" or "1.2" means the latest release
+		// in that series; anything else must be an exact key.
+		rng, ok := partialVersionRange(versionExpr)
 		if !ok {
 			return "", model.IndexVersion{}, fmt.Errorf("version %q not found", versionExpr)
 		}
-		return versionExpr, meta, nil
+		constraintExpr = rng
 	}
 
-	constraintExpr := ">=0.0.0"
-	if versionExpr != "" {
-		constraintExpr = versionExpr
-	}
 	constraint, err := semver.NewConstraint(constraintExpr)
 	if err != nil {
 		return "", model.IndexVersion{}, fmt.Errorf("parse version constraint %q: %w", versionExpr, err)
@@ -320,6 +769,10 @@ func resolveVersion(pkg model.IndexPackage, versionExpr string) (string, model.I
 	}
 	sort.Sort(sort.Reverse(semver.Collection(versions)))
 	for _, v := range versions {
+		// Yanked versions are only reachable through an exact pin.
+		if lookup[v.Original()].Yanked {
+			continue
+		}
 		if constraint.Check(v) {
 			return v.Original(), lookup[v.Original()], nil
 		}
@@ -327,18 +780,195 @@ func resolveVersion(pkg model.IndexPackage, versionExpr string) (string, model.I
 	return "", model.IndexVersion{}, fmt.Errorf("no version satisfies constraint %q", constraintExpr)
 }
 
+// partialVersionRange turns a version missing its patch or minor part into
+// the range it stands for: "1" is >=1.0.0, <2.0.0 and "1.2" is >=1.2.0,
+// <1.3.0. A leading "v" is allowed. Full versions and anything that is not
+// numeric report false.
+func partialVersionRange(expr string) (string, bool) {
+	parts := strings.Split(strings.TrimPrefix(expr, "v"), ".")
+	if len(parts) > 2 {
+		return "", false
+	}
+	nums := make([]uint64, len(parts))
+	for i, p := range parts {
+		n, err := strconv.ParseUint(p, 10, 64)
+		if err != nil {
+			return "", false
+		}
+		nums[i] = n
+	}
+	if len(nums) == 1 {
+		return fmt.Sprintf(">=%d.0.0, <%d.0.0", nums[0], nums[0]+1), true
+	}
+	return fmt.Sprintf(">=%d.%d.0, <%d.%d.0", nums[0], nums[1], nums[0], nums[1]+1), true
+}
+
 func latestVersion(pkg model.IndexPackage) (string, error) {
 	v, _, err := resolveVersion(pkg, ">=0.0.0")
 	return v, err
 }
 
+// decodeManifest parses a manifest and also returns any top-level keys that
+// do not map to a known field, since json.Unmarshal silently drops them.
+func decodeManifest(data []byte) (model.PackageManifest, []string, error) {
+	data, err := normalizeStringArgs(data)
+	if err != nil {
+		return model.PackageManifest{}, nil, err
+	}
+	var mf model.PackageManifest
+	if err := json.Unmarshal(data, &mf); err != nil {
+		return model.PackageManifest{}, nil, err
+	}
+	normalizeTransports(mf.MCPServers)
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return model.PackageManifest{}, nil, err
+	}
+	known := jsonFieldNames(reflect.TypeOf(mf))
+	unknown := make([]string, 0)
+	for key := range raw {
+		// "$schema" lets editors validate against `mcper schema manifest`.
+		if !known[key] && key != "$schema" {
+			unknown = append(unknown, key)
+		}
+	}
+	sort.Strings(unknown)
+	return mf, unknown, nil
+}
+
+// transportAliases maps transport names used by other clients' configs to
+// the canonical ones validateManifest accepts.
+var transportAliases = map[string]string{
+	"streamable-http": model.ServerTransportHTTP,
+	"command":         model.ServerTransportSTDIO,
+}
+
+// normalizeTransports rewrites aliased transports in place, so manifests
+// written for other tools install without edits.
+func normalizeTransports(servers map[string]model.MCPServerSpec) {
+	for name, server := range servers {
+		if canonical, ok := transportAliases[server.Transport]; ok {
+			server.Transport = canonical
+			servers[name] = server
+		}
+	}
+}
+
+// normalizeStringArgs rewrites any server args given as one command-line
+// string into the array form the manifest schema expects, splitting it the
+// way a shell would. Manifests without string args are returned unchanged.
+func normalizeStringArgs(data []byte) ([]byte, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	var servers map[string]map[string]json.RawMessage
+	if err := json.Unmarshal(raw["mcp_servers"], &servers); err != nil || len(servers) == 0 {
+		// A malformed mcp_servers is reported by the typed decode.
+		return data, nil
+	}
+	changed := false
+	for name, server := range servers {
+		var line string
+		if args := server["args"]; len(args) == 0 || args[0] != '"' || json.Unmarshal(args, &line) != nil {
+			continue
+		}
+		args, err := shellargs.Split(line)
+		if err != nil {
+			return nil, fmt.Errorf("server %q args: %w", name, err)
+		}
+		if server["args"], err = json.Marshal(args); err != nil {
+			return nil, err
+		}
+		changed = true
+	}
+	if !changed {
+		return data, nil
+	}
+	var err error
+	if raw["mcp_servers"], err = json.Marshal(servers); err != nil {
+		return nil, err
+	}
+	return json.Marshal(raw)
+}
+
+func jsonFieldNames(t reflect.Type) map[string]bool {
+	names := make(map[string]bool, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		names[name] = true
+	}
+	return names
+}
+
+func unknownFieldWarnings(unknown []string) []string {
+	out := make([]string, 0, len(unknown))
+	for _, key := range unknown {
+		out = append(out, fmt.Sprintf("manifest has unrecognized field %q", key))
+	}
+	return out
+}
+
+// withUnknownFields points at unrecognized keys when validation fails, as a
+// misspelled key is the most common cause of an empty-looking manifest.
+func withUnknownFields(err error, unknown []string) error {
+	if len(unknown) == 0 {
+		return err
+	}
+	return fmt.Errorf("%w (unrecognized fields: %s)", err, strings.Join(unknown, ", "))
+}
+
+func isWebURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// checkServerNameCollisions rejects server names that differ only by case or
+// surrounding whitespace. JSON keeps them apart, but some clients match
+// server names case-insensitively or trim them, so one would clobber the other.
+func checkServerNameCollisions(servers map[string]model.MCPServerSpec) error {
+	names := make([]string, 0, len(servers))
+	for name := range servers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	seen := make(map[string]string, len(names))
+	for _, name := range names {
+		key := strings.ToLower(strings.TrimSpace(name))
+		if prev, ok := seen[key]; ok {
+			return fmt.Errorf("servers %q and %q differ only by case or whitespace", prev, name)
+		}
+		seen[key] = name
+	}
+	return nil
+}
+
 func validateManifest(m model.PackageManifest) error {
+	// Manifests predating schema_version decode as 0 and are treated as v1.
+	if m.SchemaVersion < 0 {
+		return fmt.Errorf("manifest has invalid schema_version %d", m.SchemaVersion)
+	}
+	if m.SchemaVersion > model.ManifestSchemaVersion {
+		return fmt.Errorf("manifest schema_version %d is newer than supported version %d; upgrade mcper to install it", m.SchemaVersion, model.ManifestSchemaVersion)
+	}
 	if strings.TrimSpace(m.Name) == "" {
 		return errors.New("manifest missing name")
 	}
 	if strings.TrimSpace(m.Version) == "" {
 		return errors.New("manifest missing version")
 	}
+	for _, link := range []struct{ field, value string }{{"homepage", m.Homepage}, {"repository", m.Repository}} {
+		if link.value != "" && !isWebURL(link.value) {
+			return fmt.Errorf("manifest %s %q is not an http(s) URL", link.field, link.value)
+		}
+	}
 	if len(m.MCPServers) == 0 {
 		return errors.New("manifest has no mcp_servers")
 	}
@@ -359,6 +989,14 @@ func validateManifest(m model.PackageManifest) error {
 			return fmt.Errorf("server %q has unsupported transport %q", name, server.Transport)
 		}
 	}
+	if err := checkServerNameCollisions(m.MCPServers); err != nil {
+		return err
+	}
+	for _, tool := range m.RequiredTools {
+		if strings.TrimSpace(tool) == "" || strings.ContainsAny(tool, `/\`) {
+			return fmt.Errorf("required_tools entry %q must be a bare executable name", tool)
+		}
+	}
 	for envVar, sc := range m.SetupCommands {
 		if len(sc.Run) == 0 {
 			return fmt.Errorf("setup_command for %q has empty run", envVar)
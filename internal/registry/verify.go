@@ -2,10 +2,24 @@ package registry
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
 
 	"github.com/sarjann/mcper/internal/model"
 )
 
+// verifyTapIndex and verifyManifest are the checks applied while resolving,
+// swapped out in tests.
+var (
+	verifyTapIndex = VerifyTapIndex
+	verifyManifest = VerifyManifest
+)
+
 func VerifyTapIndex(ctx context.Context, tap model.TapConfig, localPath string, indexRaw []byte) error {
 	_ = ctx
 	_ = tap
@@ -22,3 +36,135 @@ func VerifyManifest(ctx context.Context, tap model.TapConfig, localPath, manifes
 	_ = meta
 	return nil
 }
+
+// DetachedSignature locates a keyless cosign signature and certificate for
+// a manifest and lists the signer identities accepted for it.
+type DetachedSignature struct {
+	SigURL     string
+	CertURL    string
+	Identities []string
+	OIDCIssuer string
+}
+
+// VerifyDetached checks data against a detached cosign signature and returns
+// the certificate identity that verified it. The signature and certificate
+// are fetched without any of the manifest's request headers.
+func (c *Client) VerifyDetached(ctx context.Context, data []byte, sig DetachedSignature) (string, error) {
+	if sig.SigURL == "" || sig.CertURL == "" {
+		return "", errors.New("signature verification needs both a signature and a certificate")
+	}
+	if len(sig.Identities) == 0 {
+		return "", errors.New("signature verification needs at least one signer identity")
+	}
+	if sig.OIDCIssuer == "" {
+		return "", errors.New("signature verification needs an OIDC issuer")
+	}
+
+	dir, err := os.MkdirTemp("", "mcper-verify-*")
+	if err != nil {
+		return "", fmt.Errorf("create verify dir: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	blob := filepath.Join(dir, "manifest.json")
+	sigPath := filepath.Join(dir, "manifest.sig")
+	certPath := filepath.Join(dir, "manifest.pem")
+	if err := os.WriteFile(blob, data, 0o600); err != nil {
+		return "", fmt.Errorf("write manifest for verification: %w", err)
+	}
+	for path, url := range map[string]string{sigPath: sig.SigURL, certPath: sig.CertURL} {
+		raw, err := c.readURLOrFile(ctx, url, nil)
+		if err != nil {
+			return "", err
+		}
+		if err := os.WriteFile(path, raw, 0o600); err != nil {
+			return "", fmt.Errorf("write %s: %w", filepath.Base(path), err)
+		}
+	}
+	return verifyWithAnyIdentity(ctx, blob, sigPath, certPath, sig.Identities, sig.OIDCIssuer)
+}
+
+// verifyWithAnyIdentity runs cosign verify-blob once per identity and
+// returns the first identity the certificate matches. When none match, the
+// error carries cosign's output for the last attempt.
+func verifyWithAnyIdentity(ctx context.Context, blob, sigPath, certPath string, identities []string, issuer string) (string, error) {
+	cosign, err := exec.LookPath("cosign")
+	if err != nil {
+		return "", errors.New("cosign not found on PATH; install it to verify signatures")
+	}
+	var lastErr error
+	for _, identity := range identities {
+		cmd := exec.CommandContext(ctx, cosign, "verify-blob",
+			"--signature", sigPath,
+			"--certificate", certPath,
+			"--certificate-identity", identity,
+			"--certificate-oidc-issuer", issuer,
+			blob)
+		out, err := cmd.CombinedOutput()
+		if err == nil {
+			return identity, nil
+		}
+		lastErr = fmt.Errorf("%w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return "", fmt.Errorf("signature does not verify for any of %s: %w", strings.Join(identities, ", "), lastErr)
+}
+
+// TapCheck is the outcome of verifying one part of a tap: its index, or the
+// latest version of one package.
+type TapCheck struct {
+	Item   string `json:"item"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// VerifyTap checks a tap end to end without installing anything: the index
+// against the tap's trust mode, then the latest version of every package,
+// whose manifest must match its index hash, pass VerifyManifest and
+// validate. Each check is reported; an error means the tap could not be
+// read at all. Taps in hash mode carry no signature, so the index check
+// says so rather than vouching for who published it.
+func (c *Client) VerifyTap(ctx context.Context, tap model.TapConfig) ([]TapCheck, error) {
+	localPath, indexRaw, err := c.fetchTapIndex(ctx, tap)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyTapIndex(ctx, tap, localPath, indexRaw); err != nil {
+		return []TapCheck{{Item: "index", Detail: err.Error()}}, nil
+	}
+	idx, err := c.decodeIndex(tap.Name, indexRaw)
+	if err != nil {
+		return []TapCheck{{Item: "index", Detail: err.Error()}}, nil
+	}
+	checks := []TapCheck{{Item: "index", OK: true, Detail: indexTrustDetail(tap)}}
+
+	snap := TapSnapshot{Tap: tap, LocalPath: localPath, Index: idx, IndexRaw: indexRaw}
+	names := make([]string, 0, len(idx.Packages))
+	for name := range idx.Packages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		version, err := latestVersion(idx.Packages[name])
+		if err != nil {
+			checks = append(checks, TapCheck{Item: name, Detail: err.Error()})
+			continue
+		}
+		check := TapCheck{Item: name + "@" + version, OK: true}
+		if _, err := resolveInSnapshot(ctx, snap, name, version, true); err != nil {
+			check.OK = false
+			check.Detail = err.Error()
+		}
+		checks = append(checks, check)
+	}
+	return checks, nil
+}
+
+// indexTrustDetail describes what a passing index check vouches for under
+// the tap's trust mode.
+func indexTrustDetail(tap model.TapConfig) string {
+	switch tap.Trust.Mode {
+	case model.TrustModeHash, "":
+		return "unsigned (hash mode): manifests are pinned to the index's SHA-256 sums, but the index itself is not signed"
+	default:
+		return "trust mode " + tap.Trust.Mode
+	}
+}
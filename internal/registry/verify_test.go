@@ -0,0 +1,177 @@
+package registry
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sarjann/mcper/internal/model"
+	"github.com/sarjann/mcper/internal/testutil"
+)
+
+func writeSignatureFiles(t *testing.T) DetachedSignature {
+	t.Helper()
+	sigPath, certPath := testutil.SignatureFiles(t)
+	return DetachedSignature{
+		SigURL:     sigPath,
+		CertURL:    certPath,
+		OIDCIssuer: "https://token.actions.githubusercontent.com",
+	}
+}
+
+func TestVerifyDetached(t *testing.T) {
+	testutil.FakeCosign(t, "good@example.com")
+	c := NewClient()
+	sig := writeSignatureFiles(t)
+
+	sig.Identities = []string{"bad@example.com", "good@example.com"}
+	identity, err := c.VerifyDetached(context.Background(), []byte(`{}`), sig)
+	if err != nil {
+		t.Fatalf("VerifyDetached failed: %v", err)
+	}
+	if identity != "good@example.com" {
+		t.Errorf("expected the matching identity, got %q", identity)
+	}
+
+	sig.Identities = []string{"bad@example.com"}
+	_, err = c.VerifyDetached(context.Background(), []byte(`{}`), sig)
+	if err == nil || !strings.Contains(err.Error(), "none of the expected identities matched") {
+		t.Fatalf("expected cosign's failure in the error, got %v", err)
+	}
+}
+
+func TestVerifyDetachedNeedsCosign(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	sig := writeSignatureFiles(t)
+	sig.Identities = []string{"good@example.com"}
+	_, err := NewClient().VerifyDetached(context.Background(), []byte(`{}`), sig)
+	if err == nil || !strings.Contains(err.Error(), "cosign not found") {
+		t.Fatalf("expected missing cosign error, got %v", err)
+	}
+}
+
+func TestVerifyTapReportsEachPackage(t *testing.T) {
+	dir := t.TempDir()
+	manifests := map[string]string{
+		"good":     `{"schema_version":1,"name":"good","version":"1.1.0","mcp_servers":{"good":{"transport":"http","url":"https://example.com/mcp"}}}`,
+		"tampered": `{"schema_version":1,"name":"tampered","version":"1.0.0","mcp_servers":{"tampered":{"transport":"http","url":"https://example.com/mcp"}}}`,
+	}
+	idx := model.RegistryIndex{SchemaVersion: 1, Packages: map[string]model.IndexPackage{}}
+	for name, raw := range manifests {
+		rel := filepath.Join("packages", name, "manifest.json")
+		if err := os.MkdirAll(filepath.Join(dir, "packages", name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, rel), []byte(raw), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		sum := sha256.Sum256([]byte(raw))
+		idx.Packages[name] = model.IndexPackage{Versions: map[string]model.IndexVersion{}}
+		var version string
+		if name == "good" {
+			version = "1.1.0"
+			// Older versions are not checked.
+			idx.Packages[name].Versions["1.0.0"] = model.IndexVersion{ManifestPath: "packages/good/missing.json"}
+		} else {
+			version = "1.0.0"
+			sum = sha256.Sum256([]byte("something else"))
+		}
+		idx.Packages[name].Versions[version] = model.IndexVersion{ManifestPath: filepath.ToSlash(rel), SHA256: hex.EncodeToString(sum[:])}
+	}
+	writeIndexTo(t, dir, idx)
+
+	checks, err := NewClient().VerifyTap(context.Background(), model.TapConfig{Name: "local", URL: dir, Trust: model.TapTrustConfig{Mode: model.TrustModeHash}})
+	if err != nil {
+		t.Fatalf("VerifyTap: %v", err)
+	}
+	if len(checks) != 3 {
+		t.Fatalf("expected index plus two packages checked, got %+v", checks)
+	}
+	if checks[0].Item != "index" || !checks[0].OK || !strings.Contains(checks[0].Detail, "not signed") {
+		t.Errorf("expected the index to pass and be reported unsigned, got %+v", checks[0])
+	}
+	if checks[1] != (TapCheck{Item: "good@1.1.0", OK: true}) {
+		t.Errorf("expected good@1.1.0 to pass, got %+v", checks[1])
+	}
+	if checks[2].Item != "tampered@1.0.0" || checks[2].OK || !strings.Contains(checks[2].Detail, "hash mismatch") {
+		t.Errorf("expected tampered@1.0.0 to fail its hash check, got %+v", checks[2])
+	}
+}
+
+func TestVerifyTapReportsFailedIndexCheck(t *testing.T) {
+	dir := t.TempDir()
+	writeIndexTo(t, dir, model.RegistryIndex{SchemaVersion: 1, Packages: map[string]model.IndexPackage{}})
+	verifyTapIndex = func(context.Context, model.TapConfig, string, []byte) error {
+		return errors.New("index signature does not verify")
+	}
+	t.Cleanup(func() { verifyTapIndex = VerifyTapIndex })
+
+	checks, err := NewClient().VerifyTap(context.Background(), model.TapConfig{Name: "local", URL: dir, Trust: model.TapTrustConfig{Mode: model.TrustModeHash}})
+	if err != nil {
+		t.Fatalf("VerifyTap: %v", err)
+	}
+	if len(checks) != 1 || checks[0].OK || !strings.Contains(checks[0].Detail, "does not verify") {
+		t.Fatalf("expected the index check to fail with the verifier's error, got %+v", checks)
+	}
+}
+
+func TestVerifyTapBadIndex(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "index.json"), []byte("{not json"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	checks, err := NewClient().VerifyTap(context.Background(), model.TapConfig{Name: "local", URL: dir})
+	if err != nil {
+		t.Fatalf("VerifyTap: %v", err)
+	}
+	if len(checks) != 1 || checks[0].Item != "index" || checks[0].OK {
+		t.Fatalf("expected a single failed index check, got %+v", checks)
+	}
+}
+
+func TestResolveFromTapUnverifiedSkipsTrustChecks(t *testing.T) {
+	raw := `{"schema_version":1,"name":"demo","version":"1.0.0","mcp_servers":{"demo":{"transport":"http","url":"https://example.com/mcp"}}}`
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "manifest.json"), []byte(raw), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	writeIndexTo(t, dir, model.RegistryIndex{SchemaVersion: 1, Packages: map[string]model.IndexPackage{
+		"demo": {Versions: map[string]model.IndexVersion{"1.0.0": {ManifestPath: "manifest.json"}}},
+	}})
+	tap := model.TapConfig{Name: "local", URL: dir}
+
+	calls := 0
+	verifyTapIndex = func(context.Context, model.TapConfig, string, []byte) error {
+		calls++
+		return errors.New("signature check failed")
+	}
+	verifyManifest = func(context.Context, model.TapConfig, string, string, model.IndexVersion) error {
+		calls++
+		return errors.New("signature check failed")
+	}
+	t.Cleanup(func() {
+		verifyTapIndex = VerifyTapIndex
+		verifyManifest = VerifyManifest
+	})
+
+	c := NewClient()
+	if _, err := c.ResolveFromTap(context.Background(), tap, "demo", ""); err == nil || !strings.Contains(err.Error(), "signature check failed") {
+		t.Fatalf("expected verification to run by default, got %v", err)
+	}
+	calls = 0
+	resolved, err := c.ResolveFromTapUnverified(context.Background(), tap, "demo", "")
+	if err != nil {
+		t.Fatalf("ResolveFromTapUnverified: %v", err)
+	}
+	if calls != 0 {
+		t.Errorf("expected no verification calls, got %d", calls)
+	}
+	if !resolved.Unverified || resolved.Version != "1.0.0" {
+		t.Errorf("expected an unverified demo@1.0.0, got %+v", resolved)
+	}
+}
@@ -0,0 +1,97 @@
+package schema
+
+import (
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/sarjann/mcper/internal/model"
+)
+
+const draft = "https://json-schema.org/draft/2020-12/schema"
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// Manifest returns a JSON Schema describing model.PackageManifest.
+func Manifest() map[string]any {
+	return Generate("mcper package manifest", model.PackageManifest{})
+}
+
+// Index returns a JSON Schema describing model.RegistryIndex.
+func Index() map[string]any {
+	return Generate("mcper registry index", model.RegistryIndex{})
+}
+
+// Generate derives a JSON Schema from v's type using its json struct tags.
+// Fields without omitempty are treated as required, except a top-level
+// schema_version, which mcper does not require.
+func Generate(title string, v any) map[string]any {
+	out := typeSchema(reflect.TypeOf(v))
+	if required, ok := out["required"].([]string); ok {
+		required = slices.DeleteFunc(required, func(name string) bool { return name == "schema_version" })
+		if len(required) > 0 {
+			out["required"] = required
+		} else {
+			delete(out, "required")
+		}
+	}
+	out["$schema"] = draft
+	out["title"] = title
+	return out
+}
+
+func typeSchema(t reflect.Type) map[string]any {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return map[string]any{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": typeSchema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": typeSchema(t.Elem())}
+	case reflect.Struct:
+		return structSchema(t)
+	default:
+		return map[string]any{}
+	}
+}
+
+func structSchema(t reflect.Type) map[string]any {
+	props := map[string]any{}
+	required := make([]string, 0)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		props[name] = typeSchema(f.Type)
+		if !strings.Contains(opts, "omitempty") {
+			required = append(required, name)
+		}
+	}
+	out := map[string]any{"type": "object", "properties": props}
+	if len(required) > 0 {
+		out["required"] = required
+	}
+	return out
+}
@@ -0,0 +1,60 @@
+package schema
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestManifestSchema(t *testing.T) {
+	data, err := json.Marshal(Manifest())
+	if err != nil {
+		t.Fatalf("encode schema: %v", err)
+	}
+	var decoded struct {
+		Schema     string                     `json:"$schema"`
+		Type       string                     `json:"type"`
+		Properties map[string]json.RawMessage `json:"properties"`
+		Required   []string                   `json:"required"`
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("schema is not valid JSON: %v", err)
+	}
+	if decoded.Schema == "" || decoded.Type != "object" {
+		t.Fatalf("expected object schema with $schema, got %s", data)
+	}
+	if _, ok := decoded.Properties["mcp_servers"]; !ok {
+		t.Fatalf("expected mcp_servers property, got %v", decoded.Properties)
+	}
+
+	required := map[string]bool{}
+	for _, name := range decoded.Required {
+		required[name] = true
+	}
+	for _, name := range []string{"name", "version", "mcp_servers"} {
+		if !required[name] {
+			t.Errorf("expected %s to be required", name)
+		}
+	}
+	if required["description"] {
+		t.Error("expected description to be optional")
+	}
+	if required["schema_version"] {
+		t.Error("expected schema_version to be optional")
+	}
+}
+
+func TestIndexSchema(t *testing.T) {
+	data, err := json.Marshal(Index())
+	if err != nil {
+		t.Fatalf("encode schema: %v", err)
+	}
+	var decoded struct {
+		Properties map[string]json.RawMessage `json:"properties"`
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("schema is not valid JSON: %v", err)
+	}
+	if _, ok := decoded.Properties["packages"]; !ok {
+		t.Fatalf("expected packages property, got %v", decoded.Properties)
+	}
+}
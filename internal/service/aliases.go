@@ -0,0 +1,110 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/sarjann/mcper/internal/adapters"
+	"github.com/sarjann/mcper/internal/model"
+)
+
+// DefaultTargetAliases are the friendly target names that work without any
+// configuration. Each maps to a comma-separated list of real targets; a user
+// alias of the same name takes precedence.
+var DefaultTargetAliases = map[string]string{
+	"desktop":     model.TargetClaudeDesktop,
+	"claude-code": model.TargetClaude,
+	"code":        model.TargetVSCode,
+	"vs-code":     model.TargetVSCode,
+	"gemini-cli":  model.TargetGemini,
+	"editors":     strings.Join([]string{model.TargetCursor, model.TargetVSCode, model.TargetZed}, ","),
+}
+
+// targetAliases layers the user's aliases over the built-in ones.
+func targetAliases(s model.Settings) map[string]string {
+	out := make(map[string]string, len(DefaultTargetAliases)+len(s.TargetAliases))
+	for name, targets := range DefaultTargetAliases {
+		out[name] = targets
+	}
+	for name, targets := range s.TargetAliases {
+		out[name] = targets
+	}
+	return out
+}
+
+// targetScope is what resolveTargets needs beyond the target list: aliases
+// to expand and, for "all", the clients to keep or drop.
+type targetScope struct {
+	aliases map[string]string
+	include []string
+	exclude []string
+}
+
+// clientSet expands aliases in names and checks each is a known client,
+// which need not be detected. No names gives a nil set.
+func (s targetScope) clientSet(names []string) (map[string]bool, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	known := adapters.ClientLabels()
+	set := make(map[string]bool)
+	for _, name := range expandTargetAliases(strings.Join(names, ","), s.aliases) {
+		if _, ok := known[name]; !ok {
+			return nil, unknownTargetError(name, s.aliases)
+		}
+		set[name] = true
+	}
+	return set, nil
+}
+
+// expandTargetAliases splits a comma-separated target list, lowercasing each
+// entry and replacing any alias with the targets it stands for. Names that
+// are not aliases pass through for the caller to validate.
+func expandTargetAliases(target string, aliases map[string]string) []string {
+	var out []string
+	for _, part := range strings.Split(target, ",") {
+		p := strings.ToLower(strings.TrimSpace(part))
+		if p == "" {
+			continue
+		}
+		if expanded, ok := aliases[p]; ok {
+			for _, t := range strings.Split(expanded, ",") {
+				if t = strings.ToLower(strings.TrimSpace(t)); t != "" {
+					out = append(out, t)
+				}
+			}
+			continue
+		}
+		out = append(out, p)
+	}
+	return out
+}
+
+// unknownTargetError reports a name that is neither a known client nor an
+// alias, listing the aliases so a misremembered name is easy to correct.
+func unknownTargetError(name string, aliases map[string]string) error {
+	if len(aliases) == 0 {
+		return fmt.Errorf("unknown target %q", name)
+	}
+	names := make([]string, 0, len(aliases))
+	for alias := range aliases {
+		names = append(names, alias)
+	}
+	sort.Strings(names)
+	return fmt.Errorf("unknown target or alias %q (aliases: %s)", name, strings.Join(names, ", "))
+}
+
+// validateAliasName rejects alias names that would shadow a real target.
+func validateAliasName(name string) error {
+	if name == "" || strings.ContainsAny(name, ", \t") {
+		return fmt.Errorf("invalid alias name %q", name)
+	}
+	if name == model.TargetAll {
+		return fmt.Errorf("alias %q would shadow the all target", name)
+	}
+	if _, ok := adapters.ClientLabels()[name]; ok {
+		return fmt.Errorf("alias %q would shadow the %s target", name, name)
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sarjann/mcper/internal/fsutil"
+	"github.com/sarjann/mcper/internal/paths"
+)
+
+// BackupWindow limits backup commands to sets taken within [Since, Until].
+// A zero bound is open.
+type BackupWindow struct {
+	Since time.Time
+	Until time.Time
+}
+
+func (w BackupWindow) contains(t time.Time) bool {
+	if !w.Since.IsZero() && t.Before(w.Since) {
+		return false
+	}
+	if !w.Until.IsZero() && t.After(w.Until) {
+		return false
+	}
+	return true
+}
+
+// BackupList returns the backup sets inside the window, newest first.
+func (m *Manager) BackupList(window BackupWindow) ([]fsutil.BackupSet, error) {
+	backupDir, err := paths.BackupDir()
+	if err != nil {
+		return nil, err
+	}
+	sets, err := fsutil.ListBackupSets(backupDir)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]fsutil.BackupSet, 0, len(sets))
+	for _, set := range sets {
+		if window.contains(set.Time) {
+			out = append(out, set)
+		}
+	}
+	return out, nil
+}
+
+type BackupPruneRequest struct {
+	Window BackupWindow
+	// Keep is how many of the newest sets inside the window survive.
+	Keep   int
+	DryRun bool
+}
+
+// BackupPrune deletes the backup sets inside the window beyond the newest
+// Keep and returns them. With DryRun nothing is deleted.
+func (m *Manager) BackupPrune(req BackupPruneRequest) ([]fsutil.BackupSet, error) {
+	if req.Keep < 0 {
+		return nil, errors.New("keep must not be negative")
+	}
+	sets, err := m.BackupList(req.Window)
+	if err != nil {
+		return nil, err
+	}
+	if len(sets) <= req.Keep {
+		return nil, nil
+	}
+	doomed := sets[req.Keep:]
+	if req.DryRun {
+		return doomed, nil
+	}
+	removed := make([]fsutil.BackupSet, 0, len(doomed))
+	for _, set := range doomed {
+		if err := os.RemoveAll(set.Path); err != nil {
+			return removed, fmt.Errorf("remove backup %s: %w", set.Path, err)
+		}
+		removed = append(removed, set)
+	}
+	return removed, nil
+}
+
+// CorruptBackup is a backup file that cannot serve as a restore point.
+type CorruptBackup struct {
+	Path    string `json:"path"`
+	Reason  string `json:"reason"`
+	Removed bool   `json:"removed,omitempty"`
+	// Suspect marks an empty file. A crash in the middle of a copy leaves
+	// one, but so does backing up a config that was genuinely empty, so
+	// Fix keeps it.
+	Suspect bool `json:"suspect,omitempty"`
+}
+
+type BackupVerifyRequest struct {
+	// Fix deletes the corrupt files that are not Suspect, and any backup
+	// directories left empty.
+	Fix bool
+}
+
+// BackupVerify walks every backup set and reports files that are empty or
+// cannot be read back, as left by a crash in the middle of a copy.
+func (m *Manager) BackupVerify(req BackupVerifyRequest) ([]CorruptBackup, error) {
+	backupDir, err := paths.BackupDir()
+	if err != nil {
+		return nil, err
+	}
+	var corrupt []CorruptBackup
+	err = filepath.WalkDir(backupDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == backupDir && errors.Is(err, fs.ErrNotExist) {
+				return fs.SkipAll
+			}
+			if path != backupDir {
+				corrupt = append(corrupt, CorruptBackup{Path: path, Reason: fmt.Sprintf("unreadable: %v", err)})
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if reason, suspect := backupFileProblem(path); reason != "" {
+			corrupt = append(corrupt, CorruptBackup{Path: path, Reason: reason, Suspect: suspect})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("walk backups: %w", err)
+	}
+	if !req.Fix {
+		return corrupt, nil
+	}
+	for i := range corrupt {
+		if corrupt[i].Suspect {
+			continue
+		}
+		if err := os.RemoveAll(corrupt[i].Path); err != nil {
+			return corrupt, fmt.Errorf("remove backup %s: %w", corrupt[i].Path, err)
+		}
+		corrupt[i].Removed = true
+		removeEmptyParents(filepath.Dir(corrupt[i].Path), backupDir)
+	}
+	return corrupt, nil
+}
+
+// backupFileProblem returns why the backup at path is unusable, or "" when
+// it is a non-empty file that reads back in full. suspect is set for an
+// empty file, which may be a genuine backup of an empty config.
+func backupFileProblem(path string) (reason string, suspect bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Sprintf("unreadable: %v", err), false
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Sprintf("unreadable: %v", err), false
+	}
+	if !info.Mode().IsRegular() {
+		return "not a regular file", false
+	}
+	n, err := io.Copy(io.Discard, f)
+	if err != nil {
+		return fmt.Sprintf("unreadable: %v", err), false
+	}
+	if n == 0 {
+		return "empty (0 bytes); this may be a genuine backup of an empty config", true
+	}
+	return "", false
+}
+
+// removeEmptyParents deletes dir and its ancestors below root for as long as
+// they are empty, so a backup set emptied by a fix disappears from the list.
+func removeEmptyParents(dir, root string) {
+	for dir != root && strings.HasPrefix(dir, root+string(filepath.Separator)) {
+		if err := os.Remove(dir); err != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
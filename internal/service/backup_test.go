@@ -0,0 +1,129 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sarjann/mcper/internal/fsutil"
+)
+
+func backupNames(sets []fsutil.BackupSet) []string {
+	out := make([]string, 0, len(sets))
+	for _, s := range sets {
+		out = append(out, s.Name)
+	}
+	return out
+}
+
+func TestBackupList_Window(t *testing.T) {
+	m, _ := newInstallTestManager(t, t.TempDir(), nil)
+	seedBackupSets(t, "20250101T000000Z", "20250201T000000Z", "20250301T000000Z", "20250401T000000Z")
+
+	window := BackupWindow{
+		Since: time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC),
+		Until: time.Date(2025, 3, 15, 0, 0, 0, 0, time.UTC),
+	}
+	sets, err := m.BackupList(window)
+	if err != nil {
+		t.Fatalf("BackupList failed: %v", err)
+	}
+	got := backupNames(sets)
+	if len(got) != 2 || got[0] != "20250301T000000Z" || got[1] != "20250201T000000Z" {
+		t.Fatalf("expected Feb and Mar sets newest first, got %v", got)
+	}
+
+	all, err := m.BackupList(BackupWindow{})
+	if err != nil {
+		t.Fatalf("BackupList failed: %v", err)
+	}
+	if len(all) != 4 {
+		t.Fatalf("expected all 4 sets without a window, got %v", backupNames(all))
+	}
+}
+
+func TestBackupPrune_WindowAndKeep(t *testing.T) {
+	m, _ := newInstallTestManager(t, t.TempDir(), nil)
+	root := seedBackupSets(t, "20250101T000000Z", "20250201T000000Z", "20250301T000000Z", "20250401T000000Z")
+
+	req := BackupPruneRequest{
+		Window: BackupWindow{Until: time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)},
+		Keep:   1,
+		DryRun: true,
+	}
+	planned, err := m.BackupPrune(req)
+	if err != nil {
+		t.Fatalf("BackupPrune failed: %v", err)
+	}
+	if got := backupNames(planned); len(got) != 2 || got[0] != "20250201T000000Z" || got[1] != "20250101T000000Z" {
+		t.Fatalf("expected Jan and Feb to be pruned, got %v", got)
+	}
+	if _, err := os.Stat(filepath.Join(root, "20250101T000000Z")); err != nil {
+		t.Fatalf("expected dry run to keep sets: %v", err)
+	}
+
+	req.DryRun = false
+	if _, err := m.BackupPrune(req); err != nil {
+		t.Fatalf("BackupPrune failed: %v", err)
+	}
+	left, err := m.BackupList(BackupWindow{})
+	if err != nil {
+		t.Fatalf("BackupList failed: %v", err)
+	}
+	if got := backupNames(left); len(got) != 2 || got[0] != "20250401T000000Z" || got[1] != "20250301T000000Z" {
+		t.Fatalf("expected Mar and Apr to remain, got %v", got)
+	}
+}
+
+func TestBackupVerify_FlagsAndFixesEmptyBackups(t *testing.T) {
+	m, _ := newInstallTestManager(t, t.TempDir(), nil)
+	root := seedBackupSets(t, "20250101T000000Z", "20250201T000000Z", "20250301T000000Z")
+	good := filepath.Join(root, "20250101T000000Z", "home", "mcp.json")
+	empty := filepath.Join(root, "20250201T000000Z", "home", "mcp.json")
+	dangling := filepath.Join(root, "20250301T000000Z", "home", "mcp.json")
+	for path, body := range map[string]string{good: `{"mcpServers":{}}`, empty: ""} {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(dangling), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(root, "missing"), dangling); err != nil {
+		t.Skipf("symlinks unavailable: %v", err)
+	}
+
+	corrupt, err := m.BackupVerify(BackupVerifyRequest{})
+	if err != nil {
+		t.Fatalf("BackupVerify failed: %v", err)
+	}
+	if len(corrupt) != 2 || corrupt[0].Path != empty || !corrupt[0].Suspect || corrupt[1].Path != dangling || corrupt[1].Suspect {
+		t.Fatalf("expected the empty backup flagged as suspect and the dangling one as corrupt, got %+v", corrupt)
+	}
+	if !strings.Contains(corrupt[0].Reason, "may be a genuine backup") {
+		t.Errorf("expected the reason to say an empty backup may be genuine, got %q", corrupt[0].Reason)
+	}
+	if _, err := os.Stat(empty); err != nil {
+		t.Fatalf("expected verify without fix to keep the file: %v", err)
+	}
+
+	corrupt, err = m.BackupVerify(BackupVerifyRequest{Fix: true})
+	if err != nil {
+		t.Fatalf("BackupVerify(fix) failed: %v", err)
+	}
+	if corrupt[0].Removed || !corrupt[1].Removed {
+		t.Fatalf("expected fix to delete only the unreadable backup, got %+v", corrupt)
+	}
+	left, err := m.BackupList(BackupWindow{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := backupNames(left); len(got) != 2 || got[0] != "20250201T000000Z" || got[1] != "20250101T000000Z" {
+		t.Fatalf("expected the emptied set removed and the others kept, got %v", got)
+	}
+}
@@ -0,0 +1,191 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sarjann/mcper/internal/fsutil"
+	"github.com/sarjann/mcper/internal/model"
+	"github.com/sarjann/mcper/internal/registry"
+)
+
+// bundleSchemaVersion is the only bundle layout ReadBundle accepts.
+const bundleSchemaVersion = 1
+
+// BundledPackage is one verified bundle entry, ready to install.
+type BundledPackage struct {
+	Key string
+	// Source is where the package was originally installed from.
+	Source   model.SourceRef
+	Resolved registry.ResolvedPackage
+}
+
+// exportBundle re-resolves each installed package from its source and embeds
+// the manifest bytes. A manifest that no longer matches the digest recorded
+// at install time is an error rather than a silent substitute.
+func (m *Manager) exportBundle(ctx context.Context, st model.State, pkgs []model.InstalledPackage) (model.Bundle, error) {
+	bundle := model.Bundle{
+		SchemaVersion: bundleSchemaVersion,
+		GeneratedAt:   time.Now().UTC(),
+		Packages:      make(map[string]model.BundleEntry, len(pkgs)),
+	}
+	for _, pkg := range pkgs {
+		resolved, err := m.resolveInstalled(ctx, st, pkg)
+		if err != nil {
+			return model.Bundle{}, fmt.Errorf("bundle %s: %w", pkg.Name, err)
+		}
+		if pkg.ManifestDigest != "" && !strings.EqualFold(resolved.ManifestDigest, pkg.ManifestDigest) {
+			return model.Bundle{}, fmt.Errorf("bundle %s: manifest changed since install: expected %s got %s", pkg.Name, pkg.ManifestDigest, resolved.ManifestDigest)
+		}
+		bundle.Packages[bundleKey(pkg.Name, pkg.Version)] = model.BundleEntry{
+			Name:           pkg.Name,
+			Version:        pkg.Version,
+			Source:         pkg.Source,
+			ManifestDigest: resolved.ManifestDigest,
+			Manifest:       string(resolved.ManifestRaw),
+		}
+	}
+	return bundle, nil
+}
+
+func bundleKey(name, version string) string {
+	return name + "@" + version
+}
+
+// ReadBundle loads a bundle written by `export --format bundle` and checks
+// every entry: the manifest must hash to its recorded digest and describe
+// the package it is keyed by. Entries come back sorted by key.
+func ReadBundle(path string) ([]BundledPackage, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read bundle: %w", err)
+	}
+	var bundle model.Bundle
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		return nil, fmt.Errorf("decode bundle %s: %w", path, err)
+	}
+	if bundle.SchemaVersion != bundleSchemaVersion {
+		return nil, fmt.Errorf("unsupported bundle schema version %d", bundle.SchemaVersion)
+	}
+
+	keys := make([]string, 0, len(bundle.Packages))
+	for key := range bundle.Packages {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	out := make([]BundledPackage, 0, len(keys))
+	for _, key := range keys {
+		entry := bundle.Packages[key]
+		if key != bundleKey(entry.Name, entry.Version) {
+			return nil, fmt.Errorf("bundle entry %q is for %s", key, bundleKey(entry.Name, entry.Version))
+		}
+		raw := []byte(entry.Manifest)
+		if actual := fsutil.SHA256Hex(raw); !strings.EqualFold(actual, entry.ManifestDigest) {
+			return nil, fmt.Errorf("manifest hash mismatch for bundle entry %s: expected %s got %s", key, entry.ManifestDigest, actual)
+		}
+		resolved, err := registry.ResolveManifest(raw, path+"#"+key)
+		if err != nil {
+			return nil, err
+		}
+		if resolved.Manifest.Name != entry.Name {
+			return nil, fmt.Errorf("bundle entry %s holds a manifest for %q", key, resolved.Manifest.Name)
+		}
+		resolved.Version = entry.Version
+		out = append(out, BundledPackage{Key: key, Source: entry.Source, Resolved: resolved})
+	}
+	return out, nil
+}
+
+// InstallBundleRequest installs every package in a bundle written by
+// `export --format bundle`.
+type InstallBundleRequest struct {
+	Path           string
+	Target         string
+	Force          bool
+	KeepBackups    int
+	InlineSecrets  bool
+	IncludeTargets []string
+	ExcludeTargets []string
+}
+
+// InstallFromBundle installs each bundled manifest without contacting a tap.
+// Every entry is verified before the first is applied. Packages are recorded
+// as direct sources pinned to their bundle entry, so upgrade leaves them
+// alone. On failure the packages installed so far are returned with the
+// error.
+func (m *Manager) InstallFromBundle(ctx context.Context, req InstallBundleRequest) ([]model.InstalledPackage, error) {
+	abs, err := filepath.Abs(req.Path)
+	if err != nil {
+		return nil, fmt.Errorf("resolve bundle path: %w", err)
+	}
+	pkgs, err := ReadBundle(abs)
+	if err != nil {
+		return nil, err
+	}
+	if len(pkgs) == 0 {
+		return nil, fmt.Errorf("bundle %s has no packages", abs)
+	}
+
+	opts := installOptions{
+		target:         req.Target,
+		force:          req.Force,
+		keepBackups:    req.KeepBackups,
+		inlineSecrets:  req.InlineSecrets,
+		includeTargets: req.IncludeTargets,
+		excludeTargets: req.ExcludeTargets,
+	}
+	out := make([]model.InstalledPackage, 0, len(pkgs))
+	for _, pkg := range pkgs {
+		st, err := m.store.Load()
+		if err != nil {
+			return out, err
+		}
+		source := model.SourceRef{Type: model.SourceTypeDirect, URL: bundleSourceURL(abs, pkg.Key)}
+		installed, err := m.installResolved(ctx, st, pkg.Resolved, source, opts)
+		if err != nil {
+			return out, fmt.Errorf("install %s from bundle: %w", pkg.Key, err)
+		}
+		out = append(out, installed)
+	}
+	return out, nil
+}
+
+// bundleSourceURL is the source recorded for a package installed from a
+// bundle: the bundle file with the entry key as fragment.
+func bundleSourceURL(path, key string) string {
+	return "file://" + path + "#" + key
+}
+
+// splitBundleSource reports whether a direct source URL points into a bundle
+// and, if so, returns the bundle path and entry key.
+func splitBundleSource(url string) (path, key string, ok bool) {
+	rest, ok := strings.CutPrefix(url, "file://")
+	if !ok {
+		return "", "", false
+	}
+	i := strings.LastIndex(rest, "#")
+	if i < 0 || !strings.Contains(rest[i+1:], "@") {
+		return "", "", false
+	}
+	return rest[:i], rest[i+1:], true
+}
+
+// resolveFromBundle re-reads one verified entry from a bundle file.
+func resolveFromBundle(path, key string) (registry.ResolvedPackage, error) {
+	pkgs, err := ReadBundle(path)
+	if err != nil {
+		return registry.ResolvedPackage{}, err
+	}
+	for _, pkg := range pkgs {
+		if pkg.Key == key {
+			return pkg.Resolved, nil
+		}
+	}
+	return registry.ResolvedPackage{}, fmt.Errorf("bundle %s has no entry %s", path, key)
+}
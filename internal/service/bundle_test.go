@@ -0,0 +1,164 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sarjann/mcper/internal/adapters"
+	"github.com/sarjann/mcper/internal/model"
+)
+
+func TestExportBundleRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	tapDir := writeTestTap(t, testManifest("alpha", "1.0.0"), testManifest("beta", "2.1.0"))
+	m, _ := newInstallTestManager(t, tapDir, map[string]adapters.Adapter{
+		model.TargetCodex: newStub("codex", nil),
+	})
+	for _, name := range []string{"alpha", "beta"} {
+		if _, err := m.InstallFromTap(ctx, InstallRequest{Name: name, Force: true}); err != nil {
+			t.Fatalf("InstallFromTap(%s) failed: %v", name, err)
+		}
+	}
+
+	written, err := m.ExportToFile(ctx, "bundle", t.TempDir())
+	if err != nil {
+		t.Fatalf("ExportToFile failed: %v", err)
+	}
+	if filepath.Base(written) != "mcper-bundle.json" {
+		t.Fatalf("expected default bundle file name, got %s", written)
+	}
+	data, err := os.ReadFile(written)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var bundle model.Bundle
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		t.Fatalf("decode bundle: %v", err)
+	}
+	for key, rel := range map[string]string{
+		"alpha@1.0.0": "packages/alpha/1.0.0/manifest.json",
+		"beta@2.1.0":  "packages/beta/2.1.0/manifest.json",
+	} {
+		want, err := os.ReadFile(filepath.Join(tapDir, rel))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := bundle.Packages[key].Manifest; got != string(want) {
+			t.Errorf("expected %s to embed the tap manifest verbatim, got %q", key, got)
+		}
+	}
+
+	pkgs, err := ReadBundle(written)
+	if err != nil {
+		t.Fatalf("ReadBundle failed: %v", err)
+	}
+	if len(pkgs) != 2 || pkgs[0].Key != "alpha@1.0.0" || pkgs[1].Key != "beta@2.1.0" {
+		t.Fatalf("unexpected bundle entries %+v", pkgs)
+	}
+	installed, err := m.ListInstalled()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, pkg := range pkgs {
+		if pkg.Resolved.Manifest.Name != installed[i].Name || pkg.Resolved.Version != installed[i].Version {
+			t.Errorf("entry %s decoded to %s@%s", pkg.Key, pkg.Resolved.Manifest.Name, pkg.Resolved.Version)
+		}
+		if pkg.Resolved.ManifestDigest != installed[i].ManifestDigest {
+			t.Errorf("entry %s digest %s differs from installed %s", pkg.Key, pkg.Resolved.ManifestDigest, installed[i].ManifestDigest)
+		}
+		if pkg.Source.Type != model.SourceTypeTap {
+			t.Errorf("entry %s lost its original source: %+v", pkg.Key, pkg.Source)
+		}
+	}
+}
+
+// writeTestBundle installs manifests from a throwaway tap and exports them as
+// a bundle, returning the bundle path.
+func writeTestBundle(t *testing.T, manifests ...model.PackageManifest) string {
+	t.Helper()
+	ctx := context.Background()
+	m, _ := newInstallTestManager(t, writeTestTap(t, manifests...), map[string]adapters.Adapter{
+		model.TargetCodex: newStub("codex", nil),
+	})
+	for _, mf := range manifests {
+		if _, err := m.InstallFromTap(ctx, InstallRequest{Name: mf.Name, Force: true}); err != nil {
+			t.Fatalf("InstallFromTap(%s) failed: %v", mf.Name, err)
+		}
+	}
+	path, err := m.ExportToFile(ctx, "bundle", filepath.Join(t.TempDir(), "bundle.json"))
+	if err != nil {
+		t.Fatalf("ExportToFile failed: %v", err)
+	}
+	return path
+}
+
+func TestInstallFromBundle(t *testing.T) {
+	bundlePath := writeTestBundle(t, testManifest("alpha", "1.0.0"), testManifest("beta", "2.1.0"))
+
+	// The tap of the installing manager does not exist, so any tap access fails.
+	codex := newStub("codex", nil)
+	m, _ := newInstallTestManager(t, filepath.Join(t.TempDir(), "missing-tap"), map[string]adapters.Adapter{
+		model.TargetCodex: codex,
+	})
+	installed, err := m.InstallFromBundle(context.Background(), InstallBundleRequest{Path: bundlePath, Force: true})
+	if err != nil {
+		t.Fatalf("InstallFromBundle failed: %v", err)
+	}
+	if len(installed) != 2 || installed[0].Name != "alpha" || installed[1].Version != "2.1.0" {
+		t.Fatalf("unexpected installed packages %+v", installed)
+	}
+	for _, name := range []string{"alpha", "beta"} {
+		if _, ok := codex.servers[name]; !ok {
+			t.Errorf("expected %s server written to codex", name)
+		}
+	}
+	if installed[0].Source.Type != model.SourceTypeDirect || installed[0].Source.URL != bundleSourceURL(bundlePath, "alpha@1.0.0") {
+		t.Errorf("expected a pinned bundle source, got %+v", installed[0].Source)
+	}
+
+	st, err := m.store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := m.resolveManifestForInstalled(context.Background(), st, st.Installed["beta"])
+	if err != nil || manifest.Name != "beta" {
+		t.Fatalf("expected the bundle source to resolve again, got %+v, %v", manifest, err)
+	}
+}
+
+func TestInstallFromBundleRejectsTamperedEntry(t *testing.T) {
+	bundlePath := writeTestBundle(t, testManifest("alpha", "1.0.0"), testManifest("beta", "2.1.0"))
+	data, err := os.ReadFile(bundlePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var bundle model.Bundle
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		t.Fatal(err)
+	}
+	entry := bundle.Packages["beta@2.1.0"]
+	entry.Manifest = strings.Replace(entry.Manifest, `"npx"`, `"evil"`, 1)
+	bundle.Packages["beta@2.1.0"] = entry
+	if data, err = json.Marshal(bundle); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(bundlePath, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	codex := newStub("codex", nil)
+	m, _ := newInstallTestManager(t, writeTestTap(t), map[string]adapters.Adapter{
+		model.TargetCodex: codex,
+	})
+	_, err = m.InstallFromBundle(context.Background(), InstallBundleRequest{Path: bundlePath, Force: true})
+	if err == nil || !strings.Contains(err.Error(), "manifest hash mismatch for bundle entry beta@2.1.0") {
+		t.Fatalf("expected hash mismatch error, got %v", err)
+	}
+	if len(codex.servers) != 0 {
+		t.Errorf("expected nothing applied from a tampered bundle, got %v", codex.servers)
+	}
+}
@@ -0,0 +1,227 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/sarjann/mcper/internal/adapters"
+	"github.com/sarjann/mcper/internal/model"
+)
+
+// ConfigEntry is one user-facing setting and its current value.
+type ConfigEntry struct {
+	Key         string `json:"key"`
+	Value       string `json:"value"`
+	Description string `json:"description"`
+}
+
+type configKey struct {
+	name        string
+	description string
+	get         func(model.Settings) string
+	set         func(*model.Settings, string) error
+}
+
+var configKeys = []configKey{
+	{
+		name:        "default-target",
+		description: "Targets used when --target is omitted (comma-separated, or all)",
+		get: func(s model.Settings) string {
+			if s.DefaultTarget == "" {
+				return model.TargetAll
+			}
+			return s.DefaultTarget
+		},
+		set: func(s *model.Settings, value string) error {
+			target, err := normalizeTargetSetting(value, targetAliases(*s))
+			if err != nil {
+				return err
+			}
+			s.DefaultTarget = target
+			return nil
+		},
+	},
+	{
+		name:        "lock-max-age",
+		description: "How old a lockfile may be before export --diff warns (days such as 90d, or a duration; 0 never warns)",
+		get: func(s model.Settings) string {
+			if s.LockMaxAge == "" {
+				return defaultLockMaxAge
+			}
+			return s.LockMaxAge
+		},
+		set: func(s *model.Settings, value string) error {
+			value = strings.TrimSpace(value)
+			if _, err := parseAge(value); err != nil {
+				return err
+			}
+			if value == defaultLockMaxAge {
+				value = ""
+			}
+			s.LockMaxAge = value
+			return nil
+		},
+	},
+	{
+		name:        "redact-patterns",
+		description: "Space-separated regular expressions masked in all output; \"default\" restores the built-in token patterns, \"none\" turns masking off",
+		get: func(s model.Settings) string {
+			if s.RedactPatterns == "" {
+				return strings.Join(DefaultRedactPatterns, " ")
+			}
+			return s.RedactPatterns
+		},
+		set: func(s *model.Settings, value string) error {
+			value = strings.Join(strings.Fields(value), " ")
+			switch value {
+			case "", "default":
+				s.RedactPatterns = ""
+				return nil
+			case redactNone:
+				s.RedactPatterns = redactNone
+				return nil
+			}
+			if _, err := NewRedactor(strings.Fields(value)); err != nil {
+				return err
+			}
+			s.RedactPatterns = value
+			return nil
+		},
+	},
+}
+
+// aliasKeyPrefix marks the config keys that define target aliases, such as
+// alias.desktop.
+const aliasKeyPrefix = "alias."
+
+func lookupConfigKey(name string) (configKey, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if alias, ok := strings.CutPrefix(name, aliasKeyPrefix); ok {
+		if err := validateAliasName(alias); err != nil {
+			return configKey{}, err
+		}
+		return aliasConfigKey(alias), nil
+	}
+	for _, k := range configKeys {
+		if k.name == name {
+			return k, nil
+		}
+	}
+	names := make([]string, 0, len(configKeys))
+	for _, k := range configKeys {
+		names = append(names, k.name)
+	}
+	names = append(names, aliasKeyPrefix+"<name>")
+	return configKey{}, fmt.Errorf("unknown config key %q (known: %s)", name, strings.Join(names, ", "))
+}
+
+// aliasConfigKey reads and writes one target alias. Setting an empty value
+// drops the user's alias, which restores the built-in one if there is one.
+func aliasConfigKey(alias string) configKey {
+	return configKey{
+		name:        aliasKeyPrefix + alias,
+		description: "Targets the " + alias + " alias expands to",
+		get: func(s model.Settings) string {
+			return targetAliases(s)[alias]
+		},
+		set: func(s *model.Settings, value string) error {
+			if strings.TrimSpace(value) == "" {
+				delete(s.TargetAliases, alias)
+				return nil
+			}
+			// Aliases expand to real targets only, so one alias never
+			// depends on another.
+			target, err := normalizeTargetSetting(value, nil)
+			if err != nil {
+				return err
+			}
+			if target == "" {
+				return fmt.Errorf("alias %q cannot expand to all", alias)
+			}
+			if s.TargetAliases == nil {
+				s.TargetAliases = make(map[string]string)
+			}
+			s.TargetAliases[alias] = target
+			return nil
+		},
+	}
+}
+
+func (m *Manager) ConfigGet(key string) (string, error) {
+	k, err := lookupConfigKey(key)
+	if err != nil {
+		return "", err
+	}
+	st, err := m.store.Load()
+	if err != nil {
+		return "", err
+	}
+	return k.get(st.Settings), nil
+}
+
+func (m *Manager) ConfigSet(key, value string) error {
+	k, err := lookupConfigKey(key)
+	if err != nil {
+		return err
+	}
+	st, err := m.store.Load()
+	if err != nil {
+		return err
+	}
+	if err := k.set(&st.Settings, value); err != nil {
+		return fmt.Errorf("invalid value for %s: %w", k.name, err)
+	}
+	return m.store.Save(st)
+}
+
+func (m *Manager) ConfigList() ([]ConfigEntry, error) {
+	st, err := m.store.Load()
+	if err != nil {
+		return nil, err
+	}
+	aliases := targetAliases(st.Settings)
+	out := make([]ConfigEntry, 0, len(configKeys)+len(aliases))
+	for _, k := range configKeys {
+		out = append(out, ConfigEntry{Key: k.name, Value: k.get(st.Settings), Description: k.description})
+	}
+	names := make([]string, 0, len(aliases))
+	for alias := range aliases {
+		names = append(names, alias)
+	}
+	sort.Strings(names)
+	for _, alias := range names {
+		k := aliasConfigKey(alias)
+		out = append(out, ConfigEntry{Key: k.name, Value: k.get(st.Settings), Description: k.description})
+	}
+	return out, nil
+}
+
+// normalizeTargetSetting validates a comma-separated target list against the
+// known clients, which need not be detected on this machine. Aliases are
+// expanded first. "all" or an empty value restores the detect-everything
+// default.
+func normalizeTargetSetting(value string, aliases map[string]string) (string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" || strings.EqualFold(value, model.TargetAll) {
+		return "", nil
+	}
+	known := adapters.ClientLabels()
+	seen := map[string]bool{}
+	var out []string
+	for _, p := range expandTargetAliases(value, aliases) {
+		if seen[p] {
+			continue
+		}
+		if _, ok := known[p]; !ok {
+			return "", unknownTargetError(p, aliases)
+		}
+		seen[p] = true
+		out = append(out, p)
+	}
+	if len(out) == 0 {
+		return "", errors.New("no valid targets specified")
+	}
+	return strings.Join(out, ","), nil
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/sarjann/mcper/internal/adapters"
+)
+
+func TestConfigSetAndGet(t *testing.T) {
+	m, _ := newInstallTestManager(t, writeTestTap(t), map[string]adapters.Adapter{})
+
+	got, err := m.ConfigGet("default-target")
+	if err != nil {
+		t.Fatalf("ConfigGet: %v", err)
+	}
+	if got != "all" {
+		t.Fatalf("expected unset default-target to read as all, got %q", got)
+	}
+
+	if err := m.ConfigSet("default-target", "Claude, codex,claude"); err != nil {
+		t.Fatalf("ConfigSet: %v", err)
+	}
+	got, err = m.ConfigGet("default-target")
+	if err != nil {
+		t.Fatalf("ConfigGet: %v", err)
+	}
+	if got != "claude,codex" {
+		t.Fatalf("expected normalized claude,codex, got %q", got)
+	}
+
+	entries, err := m.ConfigList()
+	if err != nil {
+		t.Fatalf("ConfigList: %v", err)
+	}
+	if len(entries) != len(configKeys)+len(DefaultTargetAliases) || entries[0].Value != "claude,codex" {
+		t.Fatalf("unexpected config list %+v", entries)
+	}
+
+	if err := m.ConfigSet("default-target", "all"); err != nil {
+		t.Fatalf("ConfigSet(all): %v", err)
+	}
+	st, err := m.store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Settings.DefaultTarget != "" {
+		t.Fatalf("expected all to clear the stored default, got %q", st.Settings.DefaultTarget)
+	}
+}
+
+func TestConfigRejectsUnknownKeyAndInvalidValue(t *testing.T) {
+	m, _ := newInstallTestManager(t, writeTestTap(t), map[string]adapters.Adapter{})
+
+	if err := m.ConfigSet("colour", "blue"); err == nil {
+		t.Fatal("expected error for unknown key")
+	}
+	if _, err := m.ConfigGet("colour"); err == nil {
+		t.Fatal("expected error for unknown key")
+	}
+	if err := m.ConfigSet("default-target", "codex,notaclient"); err == nil {
+		t.Fatal("expected error for unknown target")
+	}
+}
+
+func TestConfigTargetAliases(t *testing.T) {
+	m, _ := newInstallTestManager(t, writeTestTap(t), map[string]adapters.Adapter{})
+
+	if err := m.ConfigSet("alias.work", "Codex, cursor"); err != nil {
+		t.Fatalf("ConfigSet(alias.work): %v", err)
+	}
+	if got, _ := m.ConfigGet("alias.work"); got != "codex,cursor" {
+		t.Fatalf("expected normalized codex,cursor, got %q", got)
+	}
+	if err := m.ConfigSet("default-target", "work,desktop"); err != nil {
+		t.Fatalf("ConfigSet(default-target): %v", err)
+	}
+	if got, _ := m.ConfigGet("default-target"); got != "codex,cursor,claude-desktop" {
+		t.Fatalf("expected aliases expanded in default-target, got %q", got)
+	}
+
+	if err := m.ConfigSet("alias.desktop", "claude"); err != nil {
+		t.Fatalf("ConfigSet(alias.desktop): %v", err)
+	}
+	if err := m.ConfigSet("alias.desktop", ""); err != nil {
+		t.Fatalf("ConfigSet(alias.desktop, empty): %v", err)
+	}
+	if got, _ := m.ConfigGet("alias.desktop"); got != "claude-desktop" {
+		t.Fatalf("expected clearing the override to restore the built-in alias, got %q", got)
+	}
+
+	if err := m.ConfigSet("alias.codex", "claude"); err == nil {
+		t.Fatal("expected error for an alias shadowing a real target")
+	}
+	if err := m.ConfigSet("alias.both", "work"); err == nil {
+		t.Fatal("expected error for an alias expanding to another alias")
+	}
+}
@@ -14,15 +14,20 @@ import (
 type ConflictKind string
 
 const (
-	ConflictNameExists   ConflictKind = "name_exists"
+	ConflictNameExists    ConflictKind = "name_exists"
 	ConflictDuplicateSpec ConflictKind = "duplicate_spec"
+	// ConflictTransportChanged is a name collision where the incoming spec
+	// switches the server between stdio and http.
+	ConflictTransportChanged ConflictKind = "transport_changed"
 )
 
 type ServerConflict struct {
-	Target       string
-	ServerName   string
-	Kind         ConflictKind
-	ExistingName string // for duplicate_spec, the existing name that shares the same canonical key
+	Target       string       `json:"target"`
+	ServerName   string       `json:"server"`
+	Kind         ConflictKind `json:"kind"`
+	ExistingName string       `json:"existing_name,omitempty"` // for duplicate_spec, the existing name that shares the same canonical key
+	From         string       `json:"from,omitempty"`          // for transport_changed, the existing transport
+	To           string       `json:"to,omitempty"`            // for transport_changed, the incoming transport
 }
 
 type DiffOp string
@@ -34,16 +39,16 @@ const (
 )
 
 type ServerDiff struct {
-	Target     string
-	ServerName string
-	Op         DiffOp
-	Before     *model.MCPServerSpec
-	After      model.MCPServerSpec
+	Target     string               `json:"target"`
+	ServerName string               `json:"server"`
+	Op         DiffOp               `json:"op"`
+	Before     *model.MCPServerSpec `json:"before,omitempty"`
+	After      model.MCPServerSpec  `json:"after"`
 }
 
 type InstallPlan struct {
-	Conflicts []ServerConflict
-	Diffs     []ServerDiff
+	Conflicts []ServerConflict `json:"conflicts"`
+	Diffs     []ServerDiff     `json:"diffs"`
 }
 
 func (p InstallPlan) HasConflicts() bool {
@@ -63,6 +68,17 @@ func (p InstallPlan) NeedsPrompt() bool {
 	return p.HasConflicts() || p.HasMeaningfulChanges()
 }
 
+// TransportChanges returns the conflicts that switch a server's transport.
+func (p InstallPlan) TransportChanges() []ServerConflict {
+	var out []ServerConflict
+	for _, c := range p.Conflicts {
+		if c.Kind == ConflictTransportChanged {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
 func buildInstallPlan(ctx context.Context, targets []string, adapterMap map[string]adapters.Adapter, incoming map[string]model.MCPServerSpec) (InstallPlan, error) {
 	var plan InstallPlan
 
@@ -82,6 +98,11 @@ func buildInstallPlan(ctx context.Context, targets []string, adapterMap map[stri
 		for serverName, incomingSpec := range incoming {
 			existingSpec, nameExists := existing[serverName]
 			incomingKey := canonicalKey(incomingSpec)
+			if len(incomingSpec.Env) == 0 {
+				// Adapters keep an existing env block when the incoming
+				// spec has none, so it is not a change.
+				existingSpec.Env = nil
+			}
 
 			if nameExists {
 				// Same name already exists
@@ -93,6 +114,21 @@ func buildInstallPlan(ctx context.Context, targets []string, adapterMap map[stri
 						Before:     &existingSpec,
 						After:      incomingSpec,
 					})
+				} else if existingSpec.Transport != incomingSpec.Transport {
+					plan.Conflicts = append(plan.Conflicts, ServerConflict{
+						Target:     target,
+						ServerName: serverName,
+						Kind:       ConflictTransportChanged,
+						From:       existingSpec.Transport,
+						To:         incomingSpec.Transport,
+					})
+					plan.Diffs = append(plan.Diffs, ServerDiff{
+						Target:     target,
+						ServerName: serverName,
+						Op:         DiffModify,
+						Before:     &existingSpec,
+						After:      incomingSpec,
+					})
 				} else {
 					plan.Conflicts = append(plan.Conflicts, ServerConflict{
 						Target:     target,
@@ -157,8 +193,22 @@ func canonicalKey(spec model.MCPServerSpec) string {
 	return "stdio:" + strings.Join(parts, " ")
 }
 
+// envKey renders env in a stable order so map iteration never shows up as a
+// difference.
+func envKey(env map[string]string) string {
+	pairs := make([]string, 0, len(env))
+	for k, v := range env {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "\x00")
+}
+
+// specsEqual compares what a server runs and the env it runs with. Env is
+// left out of canonicalKey so duplicate detection still matches the same
+// server configured with different env.
 func specsEqual(a, b model.MCPServerSpec) bool {
-	return canonicalKey(a) == canonicalKey(b)
+	return canonicalKey(a) == canonicalKey(b) && envKey(a.Env) == envKey(b.Env)
 }
 
 func specSummary(spec model.MCPServerSpec) string {
@@ -170,7 +220,9 @@ func specSummary(spec model.MCPServerSpec) string {
 	return "command: " + strings.Join(parts, " ")
 }
 
-func formatInstallPlan(w io.Writer, plan InstallPlan) {
+// FormatInstallPlan writes plan as the per-target diff and conflict warnings
+// shown before an install.
+func FormatInstallPlan(w io.Writer, plan InstallPlan) {
 	fmt.Fprintln(w, "The following changes will be applied:")
 
 	// Group diffs by target
@@ -205,13 +257,20 @@ func formatInstallPlan(w io.Writer, plan InstallPlan) {
 	// Print warnings
 	for _, c := range plan.Conflicts {
 		fmt.Fprintln(w)
-		switch c.Kind {
-		case ConflictNameExists:
-			fmt.Fprintf(w, "Warning: server %q already exists in %s config and will be overwritten.\n", c.ServerName, c.Target)
-		case ConflictDuplicateSpec:
-			fmt.Fprintf(w, "Warning: server %q appears to duplicate existing server %q in %s config.\n", c.ServerName, c.ExistingName, c.Target)
-		}
+		writeConflictWarning(w, c)
 	}
 
 	fmt.Fprintln(w)
 }
+
+func writeConflictWarning(w io.Writer, c ServerConflict) {
+	switch c.Kind {
+	case ConflictNameExists:
+		fmt.Fprintf(w, "Warning: server %q already exists in %s config and will be overwritten.\n", c.ServerName, c.Target)
+	case ConflictDuplicateSpec:
+		fmt.Fprintf(w, "Warning: server %q appears to duplicate existing server %q in %s config.\n", c.ServerName, c.ExistingName, c.Target)
+	case ConflictTransportChanged:
+		fmt.Fprintf(w, "WARNING: server %q in %s config changes transport from %s to %s.\n", c.ServerName, c.Target, c.From, c.To)
+		fmt.Fprintln(w, "  This is usually a breaking reconfiguration; clients using the old endpoint will stop working.")
+	}
+}
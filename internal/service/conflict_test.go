@@ -3,6 +3,7 @@ package service
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"strings"
 	"testing"
 
@@ -162,6 +163,36 @@ func TestBuildInstallPlan_IdenticalReinstall(t *testing.T) {
 	}
 }
 
+func TestBuildInstallPlan_EnvReinstall(t *testing.T) {
+	ctx := context.Background()
+	base := model.MCPServerSpec{Transport: model.ServerTransportSTDIO, Command: "npx", Args: []string{"-y", "@vercel/mcp"}}
+	withEnv := base
+	withEnv.Env = map[string]string{"LOG_LEVEL": "debug", "REGION": "eu"}
+
+	tests := []struct {
+		name     string
+		existing model.MCPServerSpec
+		incoming model.MCPServerSpec
+		want     DiffOp
+	}{
+		{name: "identical env", existing: withEnv, incoming: model.MCPServerSpec{Transport: base.Transport, Command: base.Command, Args: base.Args, Env: map[string]string{"REGION": "eu", "LOG_LEVEL": "debug"}}, want: DiffNoop},
+		{name: "existing env kept", existing: withEnv, incoming: base, want: DiffNoop},
+		{name: "env changed", existing: withEnv, incoming: model.MCPServerSpec{Transport: base.Transport, Command: base.Command, Args: base.Args, Env: map[string]string{"LOG_LEVEL": "info"}}, want: DiffModify},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claude := newStub("claude", map[string]model.MCPServerSpec{"vercel": tt.existing})
+			plan, err := buildInstallPlan(ctx, []string{"claude"}, map[string]adapters.Adapter{"claude": claude}, map[string]model.MCPServerSpec{"vercel": tt.incoming})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(plan.Diffs) != 1 || plan.Diffs[0].Op != tt.want {
+				t.Fatalf("expected %s, got %+v", tt.want, plan.Diffs)
+			}
+		})
+	}
+}
+
 func TestBuildInstallPlan_DuplicateSpec(t *testing.T) {
 	ctx := context.Background()
 	claude := newStub("claude", map[string]model.MCPServerSpec{
@@ -247,7 +278,7 @@ func TestFormatInstallPlan_Output(t *testing.T) {
 	}
 
 	var buf bytes.Buffer
-	formatInstallPlan(&buf, plan)
+	FormatInstallPlan(&buf, plan)
 	output := buf.String()
 
 	if !strings.Contains(output, "The following changes will be applied:") {
@@ -282,7 +313,7 @@ func TestFormatInstallPlan_DuplicateSpecWarning(t *testing.T) {
 	}
 
 	var buf bytes.Buffer
-	formatInstallPlan(&buf, plan)
+	FormatInstallPlan(&buf, plan)
 	output := buf.String()
 
 	if !strings.Contains(output, "duplicate existing server") {
@@ -293,6 +324,67 @@ func TestFormatInstallPlan_DuplicateSpecWarning(t *testing.T) {
 	}
 }
 
+func TestBuildInstallPlan_TransportChanged(t *testing.T) {
+	ctx := context.Background()
+	claude := newStub("claude", map[string]model.MCPServerSpec{
+		"vercel": {Transport: model.ServerTransportSTDIO, Command: "npx", Args: []string{"-y", "@vercel/mcp"}},
+	})
+	adapterMap := map[string]adapters.Adapter{"claude": claude}
+
+	incoming := map[string]model.MCPServerSpec{
+		"vercel": {Transport: model.ServerTransportHTTP, URL: "https://mcp.vercel.com"},
+	}
+
+	plan, err := buildInstallPlan(ctx, []string{"claude"}, adapterMap, incoming)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(plan.Conflicts) != 1 {
+		t.Fatalf("expected 1 conflict, got %d", len(plan.Conflicts))
+	}
+	c := plan.Conflicts[0]
+	if c.Kind != ConflictTransportChanged || c.From != model.ServerTransportSTDIO || c.To != model.ServerTransportHTTP {
+		t.Errorf("expected stdio->http transport change, got %+v", c)
+	}
+	if len(plan.TransportChanges()) != 1 {
+		t.Errorf("expected TransportChanges to report the conflict")
+	}
+	if len(plan.Diffs) != 1 || plan.Diffs[0].Op != DiffModify {
+		t.Fatalf("expected one DiffModify, got %+v", plan.Diffs)
+	}
+
+	var buf bytes.Buffer
+	FormatInstallPlan(&buf, plan)
+	output := buf.String()
+	if !strings.Contains(output, `WARNING: server "vercel" in claude config changes transport from stdio to http`) {
+		t.Errorf("expected transport warning, got:\n%s", output)
+	}
+	if strings.Contains(output, "will be overwritten") {
+		t.Errorf("expected transport change instead of plain overwrite warning, got:\n%s", output)
+	}
+}
+
+func TestInstallFromTap_ForceWarnsOnTransportChange(t *testing.T) {
+	mf := testManifest("demo", "1.0.0")
+	mf.MCPServers["demo"] = model.MCPServerSpec{Transport: model.ServerTransportHTTP, URL: "https://example.com/mcp"}
+	stub := newStub("codex", map[string]model.MCPServerSpec{
+		"demo": {Transport: model.ServerTransportSTDIO, Command: "npx", Args: []string{"-y", "demo"}},
+	})
+	m, out := newInstallTestManager(t, writeTestTap(t, mf), map[string]adapters.Adapter{
+		model.TargetCodex: stub,
+	})
+
+	if _, err := m.InstallFromTap(context.Background(), InstallRequest{Name: "demo", Force: true}); err != nil {
+		t.Fatalf("InstallFromTap failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "changes transport from stdio to http") {
+		t.Errorf("expected transport warning on forced install, got:\n%s", out.String())
+	}
+	if stub.servers["demo"].Transport != model.ServerTransportHTTP {
+		t.Errorf("expected forced install to apply, got %+v", stub.servers["demo"])
+	}
+}
+
 func TestSpecSummary(t *testing.T) {
 	tests := []struct {
 		name string
@@ -319,3 +411,148 @@ func TestSpecSummary(t *testing.T) {
 		})
 	}
 }
+
+func TestPlanInstallJSON(t *testing.T) {
+	codex := newStub("codex", map[string]model.MCPServerSpec{
+		"demo": {Transport: model.ServerTransportHTTP, URL: "https://example.com/mcp"},
+	})
+	claude := newStub("claude", map[string]model.MCPServerSpec{
+		"demo": {Transport: model.ServerTransportSTDIO, Command: "uvx", Args: []string{"demo"}},
+	})
+	cursor := newStub("cursor", nil)
+	m, _ := newInstallTestManager(t, writeTestTap(t, testManifest("demo", "1.0.0")), map[string]adapters.Adapter{
+		model.TargetCodex:  codex,
+		model.TargetClaude: claude,
+		model.TargetCursor: cursor,
+	})
+	preview, err := m.PlanInstall(context.Background(), InstallRequest{Name: "demo"})
+	if err != nil {
+		t.Fatalf("PlanInstall failed: %v", err)
+	}
+	if len(cursor.servers) != 0 || codex.servers["demo"].URL == "" {
+		t.Fatal("expected a plan to leave client configs alone")
+	}
+	if pkgs, _ := m.ListInstalled(); len(pkgs) != 0 {
+		t.Fatalf("expected a plan to record nothing, got %+v", pkgs)
+	}
+
+	data, err := json.Marshal(preview)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded struct {
+		Name string `json:"name"`
+		Plan struct {
+			Conflicts []struct {
+				Target string `json:"target"`
+				Server string `json:"server"`
+				Kind   string `json:"kind"`
+			} `json:"conflicts"`
+			Diffs []struct {
+				Target string               `json:"target"`
+				Op     string               `json:"op"`
+				Before *model.MCPServerSpec `json:"before"`
+				After  model.MCPServerSpec  `json:"after"`
+			} `json:"diffs"`
+		} `json:"plan"`
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("decode plan JSON: %v\n%s", err, data)
+	}
+	kinds := map[string]string{}
+	for _, c := range decoded.Plan.Conflicts {
+		if c.Server == "demo" {
+			kinds[c.Target] = c.Kind
+		}
+	}
+	if kinds[model.TargetClaude] != string(ConflictNameExists) || kinds[model.TargetCodex] != string(ConflictTransportChanged) {
+		t.Errorf("expected name_exists on claude and transport_changed on codex, got %s", data)
+	}
+	ops := map[string]string{}
+	for _, d := range decoded.Plan.Diffs {
+		ops[d.Target] = d.Op
+		if d.Target == model.TargetCodex && (d.Before == nil || d.Before.URL != "https://example.com/mcp" || d.After.Command != "npx") {
+			t.Errorf("expected before and after specs on the codex diff, got %s", data)
+		}
+	}
+	if ops[model.TargetClaude] != string(DiffModify) || ops[model.TargetCodex] != string(DiffModify) || ops[model.TargetCursor] != string(DiffAdd) {
+		t.Errorf("expected modify on claude and codex and add on cursor, got %v", ops)
+	}
+}
+
+func TestInstallServerNamePrefixAvoidsCollision(t *testing.T) {
+	ctx := context.Background()
+	genericServer := func(name string) model.PackageManifest {
+		mf := testManifest(name, "1.0.0")
+		mf.MCPServers = map[string]model.MCPServerSpec{
+			"server": {Transport: model.ServerTransportSTDIO, Command: "sh", Args: []string{"-c", name}},
+		}
+		return mf
+	}
+	codex := newStub("codex", nil)
+	m, _ := newInstallTestManager(t, writeTestTap(t, genericServer("alpha"), genericServer("beta")), map[string]adapters.Adapter{
+		model.TargetCodex: codex,
+	})
+	if _, err := m.InstallFromTap(ctx, InstallRequest{Name: "alpha", Force: true}); err != nil {
+		t.Fatalf("InstallFromTap(alpha): %v", err)
+	}
+
+	preview, err := m.PlanInstall(ctx, InstallRequest{Name: "beta"})
+	if err != nil {
+		t.Fatalf("PlanInstall: %v", err)
+	}
+	if len(preview.Plan.Conflicts) != 1 || preview.Plan.Conflicts[0].Kind != ConflictNameExists {
+		t.Fatalf("expected beta's server to collide with alpha's, got %+v", preview.Plan.Conflicts)
+	}
+	preview, err = m.PlanInstall(ctx, InstallRequest{Name: "beta", ServerPrefix: ServerPrefixAuto})
+	if err != nil {
+		t.Fatalf("PlanInstall with prefix: %v", err)
+	}
+	if len(preview.Plan.Conflicts) != 0 {
+		t.Fatalf("expected no conflict with a prefix, got %+v", preview.Plan.Conflicts)
+	}
+
+	installed, err := m.InstallFromTap(ctx, InstallRequest{Name: "beta", Force: true, ServerPrefix: ServerPrefixAuto, ServerTargets: map[string]string{"server": model.TargetCodex}})
+	if err != nil {
+		t.Fatalf("InstallFromTap(beta): %v", err)
+	}
+	if installed.ServerPrefix != "beta" || len(installed.Servers) != 1 || installed.Servers[0] != "beta-server" {
+		t.Fatalf("expected beta-server recorded, got %+v", installed)
+	}
+	if got := codex.servers["server"].Args; len(got) != 2 || got[1] != "alpha" {
+		t.Errorf("expected alpha's server untouched, got %v", got)
+	}
+	if got := codex.servers["beta-server"].Args; len(got) != 2 || got[1] != "beta" {
+		t.Errorf("expected beta-server written, got %v", got)
+	}
+
+	// A later install without the flag keeps the recorded prefix.
+	if _, err := m.InstallFromTap(ctx, InstallRequest{Name: "beta", Force: true}); err != nil {
+		t.Fatalf("reinstall beta: %v", err)
+	}
+	if got := codex.servers["server"].Args; got[1] != "alpha" {
+		t.Errorf("expected reinstall to keep the prefix, got server args %v", got)
+	}
+
+	delete(codex.servers, "beta-server")
+	result, err := m.RunDoctor(ctx, DoctorRequest{Package: "beta", Fix: true})
+	if err != nil {
+		t.Fatalf("RunDoctor: %v", err)
+	}
+	if len(result.Issues) != 1 || !strings.Contains(result.Issues[0].Detail, "beta-server") {
+		t.Fatalf("expected doctor to report beta-server missing, got %+v", result.Issues)
+	}
+	if _, ok := codex.servers["beta-server"]; !ok {
+		t.Error("expected doctor --fix to restore beta-server")
+	}
+
+	if _, err := m.Remove(ctx, RemoveRequest{Name: "beta"}); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if _, ok := codex.servers["beta-server"]; ok {
+		t.Error("expected beta-server removed")
+	}
+	if _, ok := codex.servers["server"]; !ok {
+		t.Error("expected alpha's server kept on removing beta")
+	}
+}
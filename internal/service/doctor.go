@@ -0,0 +1,158 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	semver "github.com/Masterminds/semver/v3"
+
+	"github.com/sarjann/mcper/internal/adapters"
+	"github.com/sarjann/mcper/internal/model"
+)
+
+const commandVersionTimeout = 5 * time.Second
+
+var versionPattern = regexp.MustCompile(`\d+\.\d+(?:\.\d+)?`)
+
+// checkCommandVersion runs `command --version` and reports whether the first
+// version found in its output is below minVersion. Commands that fail to run
+// or print nothing parseable are not reported.
+func checkCommandVersion(ctx context.Context, command, minVersion string) (string, bool) {
+	min, err := semver.NewVersion(minVersion)
+	if err != nil {
+		return "", false
+	}
+	ctx, cancel := context.WithTimeout(ctx, commandVersionTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, command, "--version").Output()
+	if err != nil {
+		return "", false
+	}
+	raw := versionPattern.FindString(string(out))
+	if raw == "" {
+		return "", false
+	}
+	installed, err := semver.NewVersion(raw)
+	if err != nil {
+		return "", false
+	}
+	if !installed.LessThan(min) {
+		return "", false
+	}
+	return fmt.Sprintf("%s %s < %s", command, installed.Original(), minVersion), true
+}
+
+// probeTimeout bounds each doctor --probe request.
+const probeTimeout = 5 * time.Second
+
+// probeServer sends a HEAD request to url and fails only when no response
+// arrives. Any status counts as reachable: servers commonly answer HEAD, or
+// a request without credentials, with 401 or 405. No headers are sent, so
+// configured tokens never leave the config.
+func probeServer(ctx context.Context, url string) error {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// secureConfigMode is the mode doctor --fix gives a client config that holds
+// secrets.
+const secureConfigMode = 0o600
+
+// doctorConfigPermissions flags client configs that other users can read
+// while they hold secrets: env a package inlined, or env set for one of its
+// recorded secret keys. With req.Fix the file is narrowed to 0600. Windows
+// has no such mode bits and is skipped.
+func (m *Manager) doctorConfigPermissions(ctx context.Context, pkgs []model.InstalledPackage, req DoctorRequest) DoctorResult {
+	var result DoctorResult
+	if runtime.GOOS == "windows" {
+		return result
+	}
+	byTarget := make(map[string][]model.InstalledPackage)
+	for _, pkg := range pkgs {
+		for _, target := range pkg.Targets {
+			byTarget[target] = append(byTarget[target], pkg)
+		}
+	}
+	targets := make([]string, 0, len(byTarget))
+	for target := range byTarget {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+
+	for _, target := range targets {
+		adapter, ok := m.adapters[target]
+		if !ok {
+			continue
+		}
+		info, err := os.Stat(adapter.Path())
+		if err != nil || info.Mode().Perm()&0o077 == 0 {
+			continue
+		}
+		owners := m.secretBearingPackages(ctx, adapter, target, byTarget[target])
+		if len(owners) == 0 {
+			continue
+		}
+		pkgList := strings.Join(owners, ",")
+		result.Issues = append(result.Issues, DoctorIssue{Package: pkgList, Target: target, Kind: "insecure_permissions", Detail: fmt.Sprintf("%s is mode %04o but holds secrets; it should be %04o", adapter.Path(), info.Mode().Perm(), secureConfigMode)})
+		if !req.Fix {
+			continue
+		}
+		if err := os.Chmod(adapter.Path(), secureConfigMode); err != nil {
+			result.Issues = append(result.Issues, DoctorIssue{Package: pkgList, Target: target, Kind: "fix_failed", Detail: err.Error()})
+			continue
+		}
+		result.Fixed = append(result.Fixed, FixAction{Package: pkgList, Target: target, Action: "tightened_permissions", Detail: adapter.Path()})
+	}
+	return result
+}
+
+// secretBearingPackages returns the packages whose servers in target's
+// config carry secret values.
+func (m *Manager) secretBearingPackages(ctx context.Context, adapter adapters.Adapter, target string, pkgs []model.InstalledPackage) []string {
+	var live map[string]model.MCPServerSpec
+	var owners []string
+	for _, pkg := range pkgs {
+		if len(pkg.InlinedEnv) > 0 {
+			owners = append(owners, pkg.Name)
+			continue
+		}
+		if len(pkg.SecretKeys) == 0 {
+			continue
+		}
+		if live == nil {
+			servers, err := adapter.ListServers(ctx)
+			if err != nil {
+				return owners
+			}
+			live = servers
+		}
+	servers:
+		for _, name := range serversForTarget(pkg, target) {
+			for _, key := range pkg.SecretKeys {
+				if live[name].Env[key] != "" {
+					owners = append(owners, pkg.Name)
+					break servers
+				}
+			}
+		}
+	}
+	return owners
+}
@@ -0,0 +1,418 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/sarjann/mcper/internal/adapters"
+	"github.com/sarjann/mcper/internal/model"
+	"github.com/sarjann/mcper/internal/registry"
+)
+
+// fakeCommand writes an executable script that prints output and returns
+// its path.
+func fakeCommand(t *testing.T, name, output string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake commands require a POSIX shell")
+	}
+	path := filepath.Join(t.TempDir(), name)
+	script := "#!/bin/sh\necho '" + output + "'\n"
+	if err := os.WriteFile(path, []byte(script), 0o755); err != nil {
+		t.Fatalf("write fake command: %v", err)
+	}
+	return path
+}
+
+func TestCheckCommandVersion(t *testing.T) {
+	ctx := context.Background()
+	old := fakeCommand(t, "tool", "tool version 1.4.2")
+
+	detail, outdated := checkCommandVersion(ctx, old, "2.0.0")
+	if !outdated {
+		t.Fatal("expected 1.4.2 to be reported below 2.0.0")
+	}
+	if !strings.Contains(detail, "1.4.2 < 2.0.0") {
+		t.Errorf("unexpected detail %q", detail)
+	}
+
+	if _, outdated := checkCommandVersion(ctx, old, "1.4.0"); outdated {
+		t.Error("expected 1.4.2 to satisfy 1.4.0")
+	}
+
+	garbled := fakeCommand(t, "garbled", "no version here")
+	if _, outdated := checkCommandVersion(ctx, garbled, "2.0.0"); outdated {
+		t.Error("expected unparseable version output to be skipped")
+	}
+}
+
+func TestDoctor_CommandVersions(t *testing.T) {
+	tool := fakeCommand(t, "tool", "v8.1.0")
+	mf := testManifest("demo", "1.0.0")
+	spec := mf.MCPServers["demo"]
+	spec.Command = tool
+	spec.MinCommandVersion = "9.0.0"
+	mf.MCPServers["demo"] = spec
+
+	m, _ := newInstallTestManager(t, writeTestTap(t, mf), map[string]adapters.Adapter{
+		model.TargetCodex: newStub("codex", nil),
+	})
+	ctx := context.Background()
+	if _, err := m.InstallFromTap(ctx, InstallRequest{Name: "demo", Force: true}); err != nil {
+		t.Fatalf("InstallFromTap failed: %v", err)
+	}
+
+	issues, err := m.Doctor(ctx, DoctorRequest{})
+	if err != nil {
+		t.Fatalf("Doctor failed: %v", err)
+	}
+	if len(issues) != 0 {
+		t.Fatalf("expected no issues without the check, got %+v", issues)
+	}
+
+	issues, err = m.Doctor(ctx, DoctorRequest{CheckCommandVersions: true})
+	if err != nil {
+		t.Fatalf("Doctor failed: %v", err)
+	}
+	if len(issues) != 1 || issues[0].Kind != "outdated_command" {
+		t.Fatalf("expected one outdated_command issue, got %+v", issues)
+	}
+}
+
+func TestDoctor_ManifestOverride(t *testing.T) {
+	m, _ := newInstallTestManager(t, writeTestTap(t, testManifest("demo", "1.0.0")), map[string]adapters.Adapter{
+		model.TargetCodex: newStub("codex", nil),
+	})
+	ctx := context.Background()
+	if _, err := m.InstallFromTap(ctx, InstallRequest{Name: "demo", Force: true}); err != nil {
+		t.Fatalf("InstallFromTap failed: %v", err)
+	}
+
+	issues, err := m.Doctor(ctx, DoctorRequest{Package: "demo"})
+	if err != nil {
+		t.Fatalf("Doctor failed: %v", err)
+	}
+	if len(issues) != 0 {
+		t.Fatalf("expected no issues against the tap manifest, got %+v", issues)
+	}
+
+	// The local draft adds a server that is not in the client config yet.
+	draft := testManifest("demo", "1.1.0")
+	draft.MCPServers["demo-extra"] = model.MCPServerSpec{Transport: model.ServerTransportHTTP, URL: "https://example.com/mcp"}
+	path, _ := writeTestManifest(t, draft)
+
+	issues, err = m.Doctor(ctx, DoctorRequest{Package: "demo", ManifestPath: path})
+	if err != nil {
+		t.Fatalf("Doctor failed: %v", err)
+	}
+	if len(issues) != 1 || issues[0].Kind != "missing_server" || issues[0].Detail != "demo-extra" {
+		t.Fatalf("expected missing demo-extra from override, got %+v", issues)
+	}
+
+	if _, err := m.Doctor(ctx, DoctorRequest{ManifestPath: path}); err == nil {
+		t.Fatal("expected --manifest without --package to fail")
+	}
+	other, _ := writeTestManifest(t, testManifest("other", "1.0.0"))
+	issues, err = m.Doctor(ctx, DoctorRequest{Package: "demo", ManifestPath: other})
+	if err != nil {
+		t.Fatalf("Doctor failed: %v", err)
+	}
+	if len(issues) != 1 || issues[0].Kind != "manifest" {
+		t.Fatalf("expected manifest issue for mismatched name, got %+v", issues)
+	}
+}
+
+func TestDoctor_EnvRequiredSatisfiedByHostEnv(t *testing.T) {
+	mf := testManifest("demo", "1.0.0")
+	spec := mf.MCPServers["demo"]
+	spec.Command = fakeCommand(t, "demo", "ok")
+	spec.EnvRequired = []string{"MCPER_TEST_TOKEN"}
+	mf.MCPServers["demo"] = spec
+
+	m, _ := newInstallTestManager(t, writeTestTap(t, mf), map[string]adapters.Adapter{
+		model.TargetCodex: newStub("codex", nil),
+	})
+	ctx := context.Background()
+	if _, err := m.InstallFromTap(ctx, InstallRequest{Name: "demo", Force: true}); err != nil {
+		t.Fatalf("InstallFromTap failed: %v", err)
+	}
+
+	t.Setenv("MCPER_TEST_TOKEN", "")
+	issues, err := m.Doctor(ctx, DoctorRequest{})
+	if err != nil {
+		t.Fatalf("Doctor failed: %v", err)
+	}
+	if len(issues) != 1 || issues[0].Kind != "missing_secret" {
+		t.Fatalf("expected missing_secret when unset everywhere, got %+v", issues)
+	}
+
+	t.Setenv("MCPER_TEST_TOKEN", "from-env")
+	issues, err = m.Doctor(ctx, DoctorRequest{})
+	if err != nil {
+		t.Fatalf("Doctor failed: %v", err)
+	}
+	if len(issues) != 0 {
+		t.Fatalf("expected host env to satisfy env_required, got %+v", issues)
+	}
+
+	issues, err = m.Doctor(ctx, DoctorRequest{KeyringOnly: true})
+	if err != nil {
+		t.Fatalf("Doctor failed: %v", err)
+	}
+	if len(issues) != 1 || issues[0].Kind != "secret_in_env_only" {
+		t.Fatalf("expected secret_in_env_only with keyring-only, got %+v", issues)
+	}
+
+	if err := m.SecretSet("demo", "MCPER_TEST_TOKEN", "stored"); err != nil {
+		t.Fatalf("SecretSet failed: %v", err)
+	}
+	issues, err = m.Doctor(ctx, DoctorRequest{KeyringOnly: true})
+	if err != nil {
+		t.Fatalf("Doctor failed: %v", err)
+	}
+	if len(issues) != 0 {
+		t.Fatalf("expected stored secret to satisfy keyring-only, got %+v", issues)
+	}
+}
+
+func TestDoctor_ServerDescriptionInDetail(t *testing.T) {
+	m, _ := newInstallTestManager(t, writeTestTap(t, testManifest("demo", "1.0.0")), map[string]adapters.Adapter{
+		model.TargetCodex: newStub("codex", nil),
+	})
+	ctx := context.Background()
+	if _, err := m.InstallFromTap(ctx, InstallRequest{Name: "demo", Force: true}); err != nil {
+		t.Fatalf("InstallFromTap failed: %v", err)
+	}
+
+	draft := testManifest("demo", "1.1.0")
+	draft.MCPServers["demo-search"] = model.MCPServerSpec{
+		Transport:   model.ServerTransportHTTP,
+		URL:         "https://example.com/mcp",
+		Description: "web search",
+	}
+	path, _ := writeTestManifest(t, draft)
+
+	issues, err := m.Doctor(ctx, DoctorRequest{Package: "demo", ManifestPath: path})
+	if err != nil {
+		t.Fatalf("Doctor failed: %v", err)
+	}
+	if len(issues) != 1 || issues[0].Detail != "demo-search [web search]" {
+		t.Fatalf("expected described missing server, got %+v", issues)
+	}
+}
+
+func TestRunDoctor_ReportsFixActions(t *testing.T) {
+	codex := newStub("codex", nil)
+	m, _ := newInstallTestManager(t, writeTestTap(t, testManifest("demo", "1.0.0")), map[string]adapters.Adapter{
+		model.TargetCodex: codex,
+	})
+	ctx := context.Background()
+	if _, err := m.InstallFromTap(ctx, InstallRequest{Name: "demo", Force: true}); err != nil {
+		t.Fatalf("InstallFromTap failed: %v", err)
+	}
+	delete(codex.servers, "demo")
+
+	result, err := m.RunDoctor(ctx, DoctorRequest{Fix: true})
+	if err != nil {
+		t.Fatalf("RunDoctor failed: %v", err)
+	}
+	want := FixAction{Package: "demo", Target: model.TargetCodex, Action: "added_server", Detail: "demo"}
+	if len(result.Fixed) != 1 || result.Fixed[0] != want {
+		t.Fatalf("expected fix action %+v, got %+v", want, result.Fixed)
+	}
+	if _, ok := codex.servers["demo"]; !ok {
+		t.Error("expected the fix to restore the demo server")
+	}
+
+	result, err = m.RunDoctor(ctx, DoctorRequest{Fix: true})
+	if err != nil {
+		t.Fatalf("RunDoctor failed: %v", err)
+	}
+	if len(result.Fixed) != 0 {
+		t.Errorf("expected nothing to fix on a healthy install, got %+v", result.Fixed)
+	}
+}
+
+func TestRunDoctor_FixReappliesDriftedServer(t *testing.T) {
+	codex := newStub("codex", nil)
+	m, _ := newInstallTestManager(t, writeTestTap(t, testManifest("demo", "1.0.0")), map[string]adapters.Adapter{
+		model.TargetCodex: codex,
+	})
+	ctx := context.Background()
+	if _, err := m.InstallFromTap(ctx, InstallRequest{Name: "demo", Force: true}); err != nil {
+		t.Fatalf("InstallFromTap failed: %v", err)
+	}
+	codex.servers["demo"] = model.MCPServerSpec{
+		Transport: model.ServerTransportHTTP,
+		URL:       "https://example.com/mcp",
+		Env:       map[string]string{"API_TOKEN": "inlined"},
+	}
+
+	issues, err := m.Doctor(ctx, DoctorRequest{})
+	if err != nil {
+		t.Fatalf("Doctor failed: %v", err)
+	}
+	if len(issues) != 1 || issues[0].Kind != "drifted_server" || issues[0].Detail != "demo (url: https://example.com/mcp, expected command: npx -y demo)" {
+		t.Fatalf("expected a drifted server issue, got %+v", issues)
+	}
+
+	result, err := m.RunDoctor(ctx, DoctorRequest{Fix: true})
+	if err != nil {
+		t.Fatalf("RunDoctor failed: %v", err)
+	}
+	want := FixAction{Package: "demo", Target: model.TargetCodex, Action: "reapplied_server", Detail: "demo"}
+	if len(result.Fixed) != 1 || result.Fixed[0] != want {
+		t.Fatalf("expected fix action %+v, got %+v", want, result.Fixed)
+	}
+	servers, err := codex.ListServers(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := servers["demo"]
+	if got.Transport != model.ServerTransportSTDIO || got.Command != "npx" || len(got.Args) != 2 || got.Args[1] != "demo" {
+		t.Errorf("expected the manifest spec re-applied, got %+v", got)
+	}
+	if got.Env["API_TOKEN"] != "inlined" {
+		t.Errorf("expected the live env kept, got %v", got.Env)
+	}
+	if issues, err := m.Doctor(ctx, DoctorRequest{}); err != nil || len(issues) != 0 {
+		t.Errorf("expected no issues after the fix, got %+v, %v", issues, err)
+	}
+}
+
+func TestDoctor_InsecureConfigPermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("permission bits are not enforced on windows")
+	}
+	ctx := context.Background()
+	mf := testManifest("demo", "1.0.0")
+	spec := mf.MCPServers["demo"]
+	spec.EnvRequired = []string{"API_TOKEN"}
+	mf.MCPServers["demo"] = spec
+	dir := t.TempDir()
+	path := filepath.Join(dir, "mcp.json")
+	m, _ := newInstallTestManager(t, writeTestTap(t, mf), map[string]adapters.Adapter{
+		model.TargetCodex: adapters.NewGenericJSONAdapter(model.TargetCodex, path, dir, []string{"mcpServers"}, nil, nil),
+	})
+	if err := m.secret.Set("demo", "API_TOKEN", "s3cret"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.InstallFromTap(ctx, InstallRequest{Name: "demo", Force: true, InlineSecrets: true}); err != nil {
+		t.Fatalf("InstallFromTap: %v", err)
+	}
+	if err := os.Chmod(path, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := m.RunDoctor(ctx, DoctorRequest{})
+	if err != nil {
+		t.Fatalf("RunDoctor: %v", err)
+	}
+	if len(result.Issues) != 1 || result.Issues[0].Kind != "insecure_permissions" || !strings.Contains(result.Issues[0].Detail, "0644") {
+		t.Fatalf("expected one insecure_permissions issue, got %+v", result.Issues)
+	}
+
+	result, err = m.RunDoctor(ctx, DoctorRequest{Fix: true})
+	if err != nil {
+		t.Fatalf("RunDoctor(fix): %v", err)
+	}
+	if len(result.Fixed) != 1 || result.Fixed[0].Action != "tightened_permissions" {
+		t.Fatalf("expected the permissions tightened, got %+v", result.Fixed)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := info.Mode().Perm(); got != 0o600 {
+		t.Errorf("expected mode 0600 after fix, got %04o", got)
+	}
+	if result, err := m.RunDoctor(ctx, DoctorRequest{}); err != nil || len(result.Issues) != 0 {
+		t.Errorf("expected a clean doctor after fix, got %+v, %v", result.Issues, err)
+	}
+}
+
+func TestDoctor_ProbeReportsUnreachableServers(t *testing.T) {
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}))
+	defer up.Close()
+	down := httptest.NewServer(http.NotFoundHandler())
+	downURL := down.URL
+	down.Close()
+
+	mf := testManifest("demo", "1.0.0")
+	mf.MCPServers = map[string]model.MCPServerSpec{
+		"up":   {Transport: model.ServerTransportHTTP, URL: up.URL},
+		"down": {Transport: model.ServerTransportHTTP, URL: downURL},
+	}
+	m, _ := newInstallTestManager(t, writeTestTap(t, mf), map[string]adapters.Adapter{
+		model.TargetCodex: newStub("codex", nil),
+	})
+	ctx := context.Background()
+	if _, err := m.InstallFromTap(ctx, InstallRequest{Name: "demo", Force: true}); err != nil {
+		t.Fatalf("InstallFromTap: %v", err)
+	}
+
+	if issues, err := m.Doctor(ctx, DoctorRequest{}); err != nil || len(issues) != 0 {
+		t.Fatalf("expected no probing without --probe, got %+v, %v", issues, err)
+	}
+	issues, err := m.Doctor(ctx, DoctorRequest{Probe: true})
+	if err != nil {
+		t.Fatalf("Doctor: %v", err)
+	}
+	if len(issues) != 1 || issues[0].Kind != "server_unreachable" || !strings.HasPrefix(issues[0].Detail, "down (") {
+		t.Fatalf("expected only the down server reported, got %+v", issues)
+	}
+}
+
+// countingRegistry counts tap syncs made through it.
+type countingRegistry struct {
+	RegistryClient
+	mu       sync.Mutex
+	syncs    int
+	resolves int
+}
+
+func (r *countingRegistry) SyncTap(ctx context.Context, tap model.TapConfig) (registry.TapSnapshot, error) {
+	r.mu.Lock()
+	r.syncs++
+	r.mu.Unlock()
+	return r.RegistryClient.SyncTap(ctx, tap)
+}
+
+func (r *countingRegistry) ResolveFromTap(ctx context.Context, tap model.TapConfig, name, versionExpr string) (registry.ResolvedPackage, error) {
+	r.mu.Lock()
+	r.resolves++
+	r.mu.Unlock()
+	return r.RegistryClient.ResolveFromTap(ctx, tap, name, versionExpr)
+}
+
+func TestDoctor_SyncsEachTapOnce(t *testing.T) {
+	ctx := context.Background()
+	m, _ := newInstallTestManager(t, writeTestTap(t, testManifest("alpha", "1.0.0"), testManifest("beta", "1.0.0"), testManifest("gamma", "1.0.0")), map[string]adapters.Adapter{
+		model.TargetCodex: newStub("codex", nil),
+	})
+	for _, name := range []string{"alpha", "beta", "gamma"} {
+		if _, err := m.InstallFromTap(ctx, InstallRequest{Name: name, Force: true}); err != nil {
+			t.Fatalf("InstallFromTap(%s): %v", name, err)
+		}
+	}
+	reg := &countingRegistry{RegistryClient: m.registry}
+	m.registry = reg
+	m.concurrency = 3
+
+	issues, err := m.Doctor(ctx, DoctorRequest{})
+	if err != nil || len(issues) != 0 {
+		t.Fatalf("expected a clean doctor, got %+v, %v", issues, err)
+	}
+	if reg.syncs != 1 || reg.resolves != 0 {
+		t.Errorf("expected the shared tap synced once before the parallel checks, got %d syncs and %d per-package resolves", reg.syncs, reg.resolves)
+	}
+}
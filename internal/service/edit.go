@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/sarjann/mcper/internal/model"
+	"github.com/sarjann/mcper/internal/shellargs"
+)
+
+// EditRequest opens one client's config file in an editor.
+type EditRequest struct {
+	Target string
+	// Editor is the command to run, split like a shell would, with the
+	// config path appended. Empty falls back to $VISUAL, then $EDITOR, then
+	// the platform's default editor.
+	Editor string
+}
+
+// EditResult reports the file that was edited and whether mcper can still
+// read it.
+type EditResult struct {
+	Target  string `json:"target"`
+	Path    string `json:"path"`
+	Created bool   `json:"created"`
+	// ReadError is why the edited file no longer parses, empty when it does.
+	ReadError string `json:"read_error,omitempty"`
+}
+
+// Edit opens the config of req.Target in an editor and waits for it to
+// exit. A missing config is first created as an empty skeleton in the
+// client's format. Afterwards the file is read back, and a warning is printed
+// when mcper can no longer parse it; that is reported in the result rather
+// than as an error, as the edit itself went through.
+func (m *Manager) Edit(ctx context.Context, req EditRequest) (EditResult, error) {
+	if target := strings.TrimSpace(req.Target); target == "" || target == model.TargetAll {
+		return EditResult{}, errors.New("edit opens one client config at a time; name a client")
+	}
+	st, err := m.store.Load()
+	if err != nil {
+		return EditResult{}, err
+	}
+	targets, err := m.resolveTargets(req.Target, targetScope{aliases: targetAliases(st.Settings)})
+	if err != nil {
+		return EditResult{}, err
+	}
+	if len(targets) != 1 {
+		return EditResult{}, fmt.Errorf("edit opens one client config at a time; %q names %s", req.Target, strings.Join(targets, ","))
+	}
+	adapter := m.adapters[targets[0]]
+	result := EditResult{Target: targets[0], Path: adapter.Path()}
+
+	if _, err := os.Stat(result.Path); errors.Is(err, os.ErrNotExist) {
+		// Upserting nothing writes the client's empty server table.
+		if err := adapter.UpsertServers(ctx, map[string]model.MCPServerSpec{}); err != nil {
+			return result, fmt.Errorf("create %s config: %w", result.Target, err)
+		}
+		result.Created = true
+	} else if err != nil {
+		return result, fmt.Errorf("inspect %s config: %w", result.Target, err)
+	}
+
+	argv, err := editorCommand(req.Editor)
+	if err != nil {
+		return result, err
+	}
+	cmd := exec.CommandContext(ctx, argv[0], append(argv[1:], result.Path)...)
+	// The editor talks to the terminal directly, not through mcper's output.
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return result, fmt.Errorf("run editor %s: %w", argv[0], err)
+	}
+
+	if _, err := adapter.ListServers(ctx); err != nil {
+		result.ReadError = err.Error()
+		fmt.Fprintf(m.stdout, "warning: mcper can no longer read %s: %v\n", result.Path, err)
+	}
+	return result, nil
+}
+
+// editorCommand picks the editor to run: editor if set, then $VISUAL, then
+// $EDITOR, then a platform default that waits until the file is closed.
+func editorCommand(editor string) ([]string, error) {
+	for _, candidate := range []string{editor, os.Getenv("VISUAL"), os.Getenv("EDITOR")} {
+		if strings.TrimSpace(candidate) == "" {
+			continue
+		}
+		argv, err := shellargs.Split(candidate)
+		if err != nil {
+			return nil, fmt.Errorf("parse editor %q: %w", candidate, err)
+		}
+		if len(argv) > 0 {
+			return argv, nil
+		}
+	}
+	switch runtime.GOOS {
+	case "darwin":
+		return []string{"open", "-W", "-t"}, nil
+	case "windows":
+		return []string{"notepad"}, nil
+	default:
+		return []string{"vi"}, nil
+	}
+}
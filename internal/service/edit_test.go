@@ -0,0 +1,68 @@
+package service
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/sarjann/mcper/internal/adapters"
+	"github.com/sarjann/mcper/internal/model"
+)
+
+func TestEditCreatesConfigAndValidatesAfterEditor(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake editor requires a POSIX shell")
+	}
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "client", "mcp.json")
+	adapter := adapters.NewGenericJSONAdapter(model.TargetCursor, configPath, filepath.Join(dir, "backups"), []string{"mcpServers"}, nil, nil)
+	m, buf := newInstallTestManager(t, writeTestTap(t), map[string]adapters.Adapter{model.TargetCursor: adapter})
+
+	logPath := filepath.Join(dir, "editor.log")
+	editor := filepath.Join(dir, "editor")
+	script := "#!/bin/sh\nprintf '%s\\n' \"$@\" >> '" + logPath + "'\n" +
+		"for arg; do file=\"$arg\"; done\n" +
+		"[ -n \"$BREAK_CONFIG\" ] && echo '{\"mcpServers\": ' > \"$file\"\nexit 0\n"
+	if err := os.WriteFile(editor, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("VISUAL", "")
+	t.Setenv("EDITOR", editor+" --wait")
+
+	result, err := m.Edit(context.Background(), EditRequest{Target: model.TargetCursor})
+	if err != nil {
+		t.Fatalf("Edit: %v", err)
+	}
+	if !result.Created || result.Path != configPath || result.ReadError != "" {
+		t.Fatalf("expected a fresh, readable config at %s, got %+v", configPath, result)
+	}
+	if data, err := os.ReadFile(configPath); err != nil || !strings.Contains(string(data), `"mcpServers"`) {
+		t.Fatalf("expected an empty server skeleton, got %q, %v", data, err)
+	}
+	logged, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(logged); got != "--wait\n"+configPath+"\n" {
+		t.Fatalf("expected the editor run with its flag and the config path, got %q", got)
+	}
+
+	t.Setenv("BREAK_CONFIG", "1")
+	result, err = m.Edit(context.Background(), EditRequest{Target: model.TargetCursor, Editor: editor})
+	if err != nil {
+		t.Fatalf("Edit: %v", err)
+	}
+	if result.Created || result.ReadError == "" {
+		t.Fatalf("expected the broken config reported, got %+v", result)
+	}
+	if !strings.Contains(buf.String(), "warning: mcper can no longer read "+configPath) {
+		t.Errorf("expected a warning about the unreadable config, got:\n%s", buf.String())
+	}
+
+	if _, err := m.Edit(context.Background(), EditRequest{Target: model.TargetAll, Editor: editor}); err == nil {
+		t.Error("expected edit to refuse more than one client")
+	}
+}
@@ -0,0 +1,18 @@
+package service
+
+import (
+	"errors"
+
+	"github.com/sarjann/mcper/internal/registry"
+)
+
+// Errors callers can match with errors.Is. Service methods wrap them with the
+// offending name, so the message stays readable while the kind stays stable.
+var (
+	ErrPackageNotFound = registry.ErrPackageNotFound
+	ErrNotInstalled    = errors.New("package is not installed")
+	ErrTapNotFound     = errors.New("tap not found")
+	ErrConflict        = errors.New("conflict detected")
+	ErrTrustRequired   = errors.New("direct source not trusted")
+	ErrTrustNotFound   = errors.New("no trust entry")
+)
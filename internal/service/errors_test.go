@@ -0,0 +1,70 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/sarjann/mcper/internal/adapters"
+	"github.com/sarjann/mcper/internal/model"
+)
+
+func TestTypedErrors(t *testing.T) {
+	mf := testManifest("demo", "1.0.0")
+	stub := newStub("codex", map[string]model.MCPServerSpec{
+		"demo": {Transport: model.ServerTransportSTDIO, Command: "user-owned"},
+	})
+	m, _ := newInstallTestManager(t, writeTestTap(t, mf), map[string]adapters.Adapter{
+		model.TargetCodex: stub,
+	})
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		run  func() error
+		want error
+	}{
+		{"unknown package", func() error {
+			_, err := m.InstallFromTap(ctx, InstallRequest{Name: "missing", Force: true})
+			return err
+		}, ErrPackageNotFound},
+		{"unknown tap", func() error {
+			_, err := m.InstallFromTap(ctx, InstallRequest{Name: "demo", Tap: "nope", Force: true})
+			return err
+		}, ErrTapNotFound},
+		{"tap remove", func() error {
+			return m.TapRemove("nope", false)
+		}, ErrTapNotFound},
+		{"not installed", func() error {
+			_, err := m.Remove(ctx, RemoveRequest{Name: "demo"})
+			return err
+		}, ErrNotInstalled},
+		{"conflict without force", func() error {
+			// A piped stdin is what makes the prompt non-interactive.
+			r, w, err := os.Pipe()
+			if err != nil {
+				return err
+			}
+			defer r.Close()
+			defer w.Close()
+			orig := os.Stdin
+			os.Stdin = r
+			defer func() { os.Stdin = orig }()
+			_, err = m.InstallFromTap(ctx, InstallRequest{Name: "demo"})
+			return err
+		}, ErrConflict},
+		{"untrusted url", func() error {
+			_, err := m.InstallFromURL(ctx, InstallURLRequest{URL: "https://example.com/manifest.json"})
+			return err
+		}, ErrTrustRequired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.run()
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("expected errors.Is(%v, %v)", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/sarjann/mcper/internal/fsutil"
+	"github.com/sarjann/mcper/internal/paths"
+)
+
+// HistoryMaxBytes is the size at which the history log is rotated. One
+// rotated generation is kept, so history uses at most about twice this.
+const HistoryMaxBytes = 1 << 20
+
+type HistoryAction string
+
+const (
+	HistoryInstall   HistoryAction = "install"
+	HistoryUpgrade   HistoryAction = "upgrade"
+	HistoryRemove    HistoryAction = "remove"
+	HistoryReinstall HistoryAction = "reinstall"
+)
+
+// HistoryEntry is one line of the history log.
+type HistoryEntry struct {
+	Time        time.Time     `json:"time"`
+	Action      HistoryAction `json:"action"`
+	Package     string        `json:"package"`
+	FromVersion string        `json:"from_version,omitempty"`
+	ToVersion   string        `json:"to_version,omitempty"`
+	Targets     []string      `json:"targets"`
+	// Unverified is set for installs that skipped the tap's trust checks.
+	Unverified bool `json:"unverified,omitempty"`
+}
+
+// recordHistory appends entry to the history log. The operation it
+// describes has already been saved, so a failure here is only reported.
+func (m *Manager) recordHistory(ctx context.Context, entry HistoryEntry) {
+	if err := m.appendHistory(ctx, entry); err != nil {
+		fmt.Fprintf(m.stdout, "Warning: could not record history: %v\n", err)
+	}
+}
+
+// appendHistory writes entry as a single line under the state store lock,
+// so concurrent mcper runs neither interleave records nor race a rotation.
+func (m *Manager) appendHistory(ctx context.Context, entry HistoryEntry) error {
+	path, err := paths.HistoryPath()
+	if err != nil {
+		return err
+	}
+	if entry.Time.IsZero() {
+		entry.Time = time.Now().UTC()
+	}
+	if entry.Targets == nil {
+		entry.Targets = []string{}
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	unlock, err := m.store.Lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if info, err := os.Stat(path); err == nil && info.Size() >= HistoryMaxBytes {
+		return rotateHistory(path, line)
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("open history: %w", err)
+	}
+	if _, err := f.Write(line); err != nil {
+		f.Close()
+		return fmt.Errorf("write history: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("sync history: %w", err)
+	}
+	return f.Close()
+}
+
+// rotateHistory moves the full log at path to path.1 and starts a new log
+// holding only line. Both files are replaced atomically and the old log is
+// copied before the new one is written, so a crash part way through can
+// repeat entries but never loses them.
+func rotateHistory(path string, line []byte) error {
+	full, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("rotate history: %w", err)
+	}
+	if err := fsutil.AtomicWriteFile(path+".1", full, 0o600); err != nil {
+		return fmt.Errorf("rotate history: %w", err)
+	}
+	if err := fsutil.AtomicWriteFile(path, line, 0o600); err != nil {
+		return fmt.Errorf("rotate history: %w", err)
+	}
+	return nil
+}
+
+// History returns recorded entries oldest first, including the rotated log.
+// Lines that do not decode are skipped.
+func (m *Manager) History() ([]HistoryEntry, error) {
+	path, err := paths.HistoryPath()
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]HistoryEntry, 0)
+	for _, p := range []string{path + ".1", path} {
+		f, err := os.Open(p)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return nil, fmt.Errorf("open history: %w", err)
+		}
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 0, 64*1024), HistoryMaxBytes)
+		for scanner.Scan() {
+			var e HistoryEntry
+			if json.Unmarshal(scanner.Bytes(), &e) == nil {
+				entries = append(entries, e)
+			}
+		}
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("read history: %w", err)
+		}
+	}
+	return entries, nil
+}
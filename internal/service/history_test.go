@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/sarjann/mcper/internal/adapters"
+	"github.com/sarjann/mcper/internal/model"
+	"github.com/sarjann/mcper/internal/paths"
+)
+
+func TestHistory_RecordsInstallUpgradeRemove(t *testing.T) {
+	tapDir := writeTestTap(t, testManifest("demo", "1.0.0"), testManifest("demo", "1.1.0"))
+	m, _ := newInstallTestManager(t, tapDir, map[string]adapters.Adapter{
+		model.TargetCodex: newStub("codex", nil),
+	})
+	ctx := context.Background()
+
+	if _, err := m.InstallFromTap(ctx, InstallRequest{Name: "demo", Version: "1.0.0", Force: true}); err != nil {
+		t.Fatalf("InstallFromTap failed: %v", err)
+	}
+	if _, err := m.Upgrade(ctx, UpgradeRequest{Name: "demo", DryRun: true}); err != nil {
+		t.Fatalf("Upgrade dry run failed: %v", err)
+	}
+	if _, err := m.Upgrade(ctx, UpgradeRequest{Name: "demo"}); err != nil {
+		t.Fatalf("Upgrade failed: %v", err)
+	}
+	if _, err := m.Remove(ctx, RemoveRequest{Name: "demo"}); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+
+	entries, err := m.History()
+	if err != nil {
+		t.Fatalf("History failed: %v", err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("expected install, upgrade and remove (dry run skipped), got %+v", entries)
+	}
+	up := entries[1]
+	if up.Action != HistoryUpgrade || up.Package != "demo" || up.FromVersion != "1.0.0" || up.ToVersion != "1.1.0" {
+		t.Errorf("unexpected upgrade record %+v", up)
+	}
+	if len(up.Targets) != 1 || up.Targets[0] != model.TargetCodex || up.Time.IsZero() {
+		t.Errorf("expected upgrade targets and time, got %+v", up)
+	}
+	if entries[0].Action != HistoryInstall || entries[0].FromVersion != "" || entries[0].ToVersion != "1.0.0" {
+		t.Errorf("unexpected install record %+v", entries[0])
+	}
+	if entries[2].Action != HistoryRemove || entries[2].FromVersion != "1.1.0" || entries[2].ToVersion != "" {
+		t.Errorf("unexpected remove record %+v", entries[2])
+	}
+}
+
+func TestHistory_RotatesWhenFull(t *testing.T) {
+	m, _ := newInstallTestManager(t, t.TempDir(), nil)
+	path, err := paths.HistoryPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := paths.EnsureDirDirOf(path); err != nil {
+		t.Fatal(err)
+	}
+	old := `{"action":"install","package":"old","targets":[]}` + "\n"
+	if err := os.WriteFile(path, []byte(old+strings.Repeat(strings.Repeat(" ", 1023)+"\n", HistoryMaxBytes/1024)), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	m.recordHistory(context.Background(), HistoryEntry{Action: HistoryInstall, Package: "new"})
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() >= HistoryMaxBytes {
+		t.Fatalf("expected a fresh log after rotation, got %d bytes", info.Size())
+	}
+	entries, err := m.History()
+	if err != nil {
+		t.Fatalf("History failed: %v", err)
+	}
+	if len(entries) != 2 || entries[0].Package != "old" || entries[1].Package != "new" {
+		t.Fatalf("expected rotated and current entries in order, got %+v", entries)
+	}
+}
+
+func TestHistory_ConcurrentWritersAcrossRotationKeepEveryEntry(t *testing.T) {
+	m, _ := newInstallTestManager(t, t.TempDir(), nil)
+	path, err := paths.HistoryPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := paths.EnsureDirDirOf(path); err != nil {
+		t.Fatal(err)
+	}
+	// One line short of full, so the writers below race a rotation.
+	filler := strings.Repeat(strings.Repeat(" ", 1023)+"\n", HistoryMaxBytes/1024-1)
+	if err := os.WriteFile(path, []byte(filler), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	const writers = 20
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.recordHistory(context.Background(), HistoryEntry{Action: HistoryInstall, Package: "demo"})
+		}()
+	}
+	wg.Wait()
+
+	entries, err := m.History()
+	if err != nil {
+		t.Fatalf("History failed: %v", err)
+	}
+	if len(entries) != writers {
+		t.Fatalf("expected %d entries, got %d", writers, len(entries))
+	}
+}
@@ -0,0 +1,141 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sarjann/mcper/internal/model"
+)
+
+// LockChange is one package that differs from a baseline lockfile. From is
+// the baseline version and To the installed one; either is empty when the
+// package is only on one side.
+type LockChange struct {
+	Name string `json:"name"`
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+}
+
+// LockDiff lists how the installed packages drifted from a baseline
+// lockfile, each list sorted by name.
+type LockDiff struct {
+	Added   []LockChange `json:"added"`
+	Removed []LockChange `json:"removed"`
+	Changed []LockChange `json:"changed"`
+	// Warnings flag a baseline whose generated_at looks wrong for its age.
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// Empty reports whether the installed set matches the baseline.
+func (d LockDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// DiffLockfile compares the installed packages against the lockfile at
+// baselinePath, as written by export --format lock. Unless ignoreAge is
+// set, a baseline generated in the future or longer ago than the
+// lock-max-age setting is flagged in the diff's warnings.
+func (m *Manager) DiffLockfile(baselinePath string, ignoreAge bool) (LockDiff, error) {
+	data, err := os.ReadFile(baselinePath)
+	if err != nil {
+		return LockDiff{}, fmt.Errorf("read baseline lockfile: %w", err)
+	}
+	var baseline model.Lockfile
+	if err := json.Unmarshal(data, &baseline); err != nil {
+		return LockDiff{}, fmt.Errorf("decode baseline lockfile %s: %w", baselinePath, err)
+	}
+	st, err := m.store.Load()
+	if err != nil {
+		return LockDiff{}, err
+	}
+	diff := diffLock(baseline.Packages, installedPackages(st))
+	if !ignoreAge {
+		maxAge, err := parseAge(st.Settings.LockMaxAge)
+		if err != nil {
+			return LockDiff{}, fmt.Errorf("lock-max-age setting: %w", err)
+		}
+		if warning := lockAgeWarning(baselinePath, baseline.GeneratedAt, time.Now(), maxAge); warning != "" {
+			diff.Warnings = append(diff.Warnings, warning)
+		}
+	}
+	return diff, nil
+}
+
+const (
+	// defaultLockMaxAge is the lock-max-age used until one is set.
+	defaultLockMaxAge = "90d"
+	// lockClockSkew is how far in the future generated_at may be before it
+	// is taken for a clock problem.
+	lockClockSkew = 5 * time.Minute
+)
+
+// lockAgeWarning describes what is wrong with a lockfile generated at
+// generated, or returns "" when it looks current. A missing timestamp is not
+// flagged, and a zero maxAge disables the staleness check.
+func lockAgeWarning(path string, generated, now time.Time, maxAge time.Duration) string {
+	if generated.IsZero() {
+		return ""
+	}
+	stamp := generated.UTC().Format(time.RFC3339)
+	if generated.After(now.Add(lockClockSkew)) {
+		return fmt.Sprintf("%s was generated at %s, in the future; check this machine's clock or the one that wrote it (--ignore-age to silence)", path, stamp)
+	}
+	if maxAge > 0 && now.Sub(generated) > maxAge {
+		return fmt.Sprintf("%s was generated at %s, %d days ago; it may be stale (--ignore-age to silence, or raise lock-max-age)", path, stamp, int(now.Sub(generated).Hours()/24))
+	}
+	return ""
+}
+
+// parseAge reads a lock-max-age value: whole days such as "90d" or a Go
+// duration, with "0" disabling the check. Empty is the default.
+func parseAge(value string) (time.Duration, error) {
+	if value == "" {
+		value = defaultLockMaxAge
+	}
+	if value == "0" {
+		return 0, nil
+	}
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid age %q", value)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid age %q: expected days such as 90d or a duration such as 720h", value)
+	}
+	return d, nil
+}
+
+func diffLock(baseline, current []model.InstalledPackage) LockDiff {
+	diff := LockDiff{Added: []LockChange{}, Removed: []LockChange{}, Changed: []LockChange{}}
+	before := make(map[string]string, len(baseline))
+	for _, pkg := range baseline {
+		before[pkg.Name] = pkg.Version
+	}
+	seen := make(map[string]bool, len(current))
+	for _, pkg := range current {
+		seen[pkg.Name] = true
+		from, ok := before[pkg.Name]
+		switch {
+		case !ok:
+			diff.Added = append(diff.Added, LockChange{Name: pkg.Name, To: pkg.Version})
+		case from != pkg.Version:
+			diff.Changed = append(diff.Changed, LockChange{Name: pkg.Name, From: from, To: pkg.Version})
+		}
+	}
+	for _, pkg := range baseline {
+		if !seen[pkg.Name] {
+			diff.Removed = append(diff.Removed, LockChange{Name: pkg.Name, From: pkg.Version})
+		}
+	}
+	sort.Slice(diff.Removed, func(i, j int) bool { return diff.Removed[i].Name < diff.Removed[j].Name })
+	return diff
+}
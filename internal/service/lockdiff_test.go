@@ -0,0 +1,136 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sarjann/mcper/internal/adapters"
+	"github.com/sarjann/mcper/internal/model"
+)
+
+func TestDiffLockfile(t *testing.T) {
+	ctx := context.Background()
+	m, _ := newInstallTestManager(t, writeTestTap(t, testManifest("kept", "1.0.0"), testManifest("bumped", "1.0.0"), testManifest("dropped", "1.0.0"), testManifest("added", "2.0.0")), map[string]adapters.Adapter{
+		model.TargetCodex: newStub("codex", nil),
+	})
+	for _, name := range []string{"kept", "bumped", "dropped"} {
+		if _, err := m.InstallFromTap(ctx, InstallRequest{Name: name, Force: true}); err != nil {
+			t.Fatalf("InstallFromTap(%s): %v", name, err)
+		}
+	}
+	baseline := filepath.Join(t.TempDir(), "baseline.lock")
+	if _, err := m.ExportToFile(ctx, "lock", baseline); err != nil {
+		t.Fatalf("ExportToFile: %v", err)
+	}
+
+	diff, err := m.DiffLockfile(baseline, false)
+	if err != nil {
+		t.Fatalf("DiffLockfile: %v", err)
+	}
+	if !diff.Empty() {
+		t.Fatalf("expected no differences right after export, got %+v", diff)
+	}
+
+	if _, err := m.Remove(ctx, RemoveRequest{Name: "dropped"}); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if _, err := m.InstallFromTap(ctx, InstallRequest{Name: "added", Force: true}); err != nil {
+		t.Fatalf("InstallFromTap(added): %v", err)
+	}
+	st, err := m.store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bumped := st.Installed["bumped"]
+	bumped.Version = "1.1.0"
+	st.Installed["bumped"] = bumped
+	if err := m.store.Save(st); err != nil {
+		t.Fatal(err)
+	}
+
+	diff, err = m.DiffLockfile(baseline, false)
+	if err != nil {
+		t.Fatalf("DiffLockfile: %v", err)
+	}
+	want := LockDiff{
+		Added:   []LockChange{{Name: "added", To: "2.0.0"}},
+		Removed: []LockChange{{Name: "dropped", From: "1.0.0"}},
+		Changed: []LockChange{{Name: "bumped", From: "1.0.0", To: "1.1.0"}},
+	}
+	if !reflect.DeepEqual(diff, want) {
+		t.Fatalf("expected %+v, got %+v", want, diff)
+	}
+
+	if _, err := m.DiffLockfile(filepath.Join(t.TempDir(), "missing.lock"), false); err == nil {
+		t.Error("expected an error for a missing baseline")
+	}
+}
+
+func TestDiffLockfileWarnsOnAge(t *testing.T) {
+	m, _ := newInstallTestManager(t, writeTestTap(t), nil)
+	writeLock := func(generated time.Time) string {
+		t.Helper()
+		data, err := json.Marshal(model.Lockfile{SchemaVersion: 1, GeneratedAt: generated, Packages: []model.InstalledPackage{}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(t.TempDir(), "baseline.lock")
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	now := time.Now()
+
+	for _, tc := range []struct {
+		name      string
+		generated time.Time
+		want      string
+	}{
+		{"current", now.Add(-time.Hour), ""},
+		{"future", now.Add(48 * time.Hour), "in the future"},
+		{"ancient", now.AddDate(-2, 0, 0), "may be stale"},
+	} {
+		path := writeLock(tc.generated)
+		diff, err := m.DiffLockfile(path, false)
+		if err != nil {
+			t.Fatalf("%s: DiffLockfile: %v", tc.name, err)
+		}
+		if tc.want == "" {
+			if len(diff.Warnings) != 0 {
+				t.Errorf("%s: expected no warning, got %v", tc.name, diff.Warnings)
+			}
+			continue
+		}
+		if len(diff.Warnings) != 1 || !strings.Contains(diff.Warnings[0], tc.want) {
+			t.Errorf("%s: expected a warning containing %q, got %v", tc.name, tc.want, diff.Warnings)
+		}
+		if diff, err := m.DiffLockfile(path, true); err != nil || len(diff.Warnings) != 0 {
+			t.Errorf("%s: expected --ignore-age to silence the warning, got %v, %v", tc.name, diff.Warnings, err)
+		}
+	}
+
+	// The tolerance is configurable, and 0 turns the staleness check off.
+	old := writeLock(now.AddDate(0, 0, -10))
+	if err := m.ConfigSet("lock-max-age", "7d"); err != nil {
+		t.Fatalf("ConfigSet: %v", err)
+	}
+	if diff, _ := m.DiffLockfile(old, false); len(diff.Warnings) != 1 {
+		t.Errorf("expected a 10 day old lockfile flagged with lock-max-age 7d, got %v", diff.Warnings)
+	}
+	if err := m.ConfigSet("lock-max-age", "0"); err != nil {
+		t.Fatalf("ConfigSet: %v", err)
+	}
+	if diff, _ := m.DiffLockfile(writeLock(now.AddDate(-5, 0, 0)), false); len(diff.Warnings) != 0 {
+		t.Errorf("expected no staleness warning with lock-max-age 0, got %v", diff.Warnings)
+	}
+	if err := m.ConfigSet("lock-max-age", "soon"); err == nil {
+		t.Error("expected an invalid lock-max-age to be refused")
+	}
+}
@@ -7,67 +7,272 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"maps"
+	"net/http"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
 	"sort"
 	"strings"
 	"time"
 
+	semver "github.com/Masterminds/semver/v3"
 	"github.com/zalando/go-keyring"
 
 	"github.com/sarjann/mcper/internal/adapters"
+	"github.com/sarjann/mcper/internal/fsutil"
 	"github.com/sarjann/mcper/internal/model"
+	"github.com/sarjann/mcper/internal/parallel"
+	"github.com/sarjann/mcper/internal/paths"
 	"github.com/sarjann/mcper/internal/registry"
 	"github.com/sarjann/mcper/internal/secrets"
 	"github.com/sarjann/mcper/internal/state"
 )
 
+// RegistryClient resolves and searches packages in taps and at URLs.
+// *registry.Client is the implementation NewManager uses.
+type RegistryClient interface {
+	Search(ctx context.Context, taps map[string]model.TapConfig, query string) ([]registry.SearchResult, error)
+	ResolveFromTap(ctx context.Context, tap model.TapConfig, name, versionExpr string) (registry.ResolvedPackage, error)
+	ResolveFromTapUnverified(ctx context.Context, tap model.TapConfig, name, versionExpr string) (registry.ResolvedPackage, error)
+	SyncTap(ctx context.Context, tap model.TapConfig) (registry.TapSnapshot, error)
+	ResolveInSnapshot(ctx context.Context, snap registry.TapSnapshot, name, versionExpr string) (registry.ResolvedPackage, error)
+	ListVersions(ctx context.Context, tap model.TapConfig, name string) ([]registry.VersionInfo, error)
+	ResolveUpgrade(ctx context.Context, tap model.TapConfig, name, currentVersion string, allowMajor bool) (registry.ResolvedPackage, bool, error)
+	ResolveFromURL(ctx context.Context, url string) (registry.ResolvedPackage, error)
+	ResolveFromURLWithHeaders(ctx context.Context, url string, headers http.Header) (registry.ResolvedPackage, error)
+	VerifyDetached(ctx context.Context, data []byte, sig registry.DetachedSignature) (string, error)
+	VerifyTap(ctx context.Context, tap model.TapConfig) ([]registry.TapCheck, error)
+}
+
 type Manager struct {
-	store         *state.Store
-	registry      *registry.Client
-	secret        secrets.Store
-	adapters      map[string]adapters.Adapter
+	store    *state.Store
+	registry RegistryClient
+	secret   secrets.Store
+	adapters map[string]adapters.Adapter
+	// missing holds adapters for known clients that are not detected. One
+	// joins adapters once a target names it explicitly.
+	missing       map[string]adapters.Adapter
 	stdin         io.Reader
 	stdout        io.Writer
 	setupTimeout  time.Duration
 	isInteractive func() bool
+	// concurrency caps parallel work such as doctor checks and per-target
+	// config writes; below 1 means one at a time.
+	concurrency int
+}
+
+// ManagerOptions carries process-wide settings that affect how the manager
+// is wired up, and the dependencies an embedder may swap out.
+type ManagerOptions struct {
+	// NoBackup skips the timestamped backup normally taken before each
+	// client config write.
+	NoBackup bool
+	// Concurrency caps how many taps, packages or targets are worked on at
+	// once.
+	Concurrency int
+	// IncludeUndetected gives the manager an adapter for every known client,
+	// so "all" and explicit targets also cover clients that are not
+	// detected, creating their config files.
+	IncludeUndetected bool
+	// CreateMissingClients lets explicitly named targets cover clients that
+	// are not detected, creating their config files, while "all" still
+	// means the detected clients only.
+	CreateMissingClients bool
+
+	// The fields below replace the manager's defaults for embedders and
+	// tests; a zero value keeps the default.
+
+	// Stdin and Stdout are where prompts are read and progress is written.
+	// They default to os.Stdin and os.Stdout.
+	Stdin  io.Reader
+	Stdout io.Writer
+	// Adapters are the clients the manager writes to, by target name. When
+	// set, detection is skipped and IncludeUndetected and
+	// CreateMissingClients have no effect.
+	Adapters map[string]adapters.Adapter
+	// Registry defaults to a registry.Client honoring Concurrency.
+	Registry RegistryClient
+	// SecretStore defaults to the OS keyring.
+	SecretStore secrets.Store
+	// SetupTimeout bounds each setup command; it defaults to 30 seconds.
+	SetupTimeout time.Duration
+	// IsInteractive reports whether prompts can be answered; it defaults to
+	// checking that stdin and stdout are terminals.
+	IsInteractive func() bool
+}
+
+// NewManager returns a manager reading prompts from stdin and writing to
+// stdout, with every other dependency at its default.
+func NewManager(stdin io.Reader, stdout io.Writer, opts ManagerOptions) (*Manager, error) {
+	opts.Stdin = stdin
+	opts.Stdout = stdout
+	return NewManagerWithOptions(opts)
 }
 
-func NewManager(stdin io.Reader, stdout io.Writer) (*Manager, error) {
+// NewManagerWithOptions returns a manager wired from opts, filling in the
+// defaults for anything left unset.
+func NewManagerWithOptions(opts ManagerOptions) (*Manager, error) {
 	st, err := state.NewStore()
 	if err != nil {
 		return nil, err
 	}
-	detected, err := adapters.DetectedAdapters()
-	if err != nil {
-		return nil, err
+	detected, missing := opts.Adapters, map[string]adapters.Adapter(nil)
+	if detected == nil {
+		if detected, missing, err = detectAdapters(opts); err != nil {
+			return nil, err
+		}
 	}
 
+	reg := opts.Registry
+	if reg == nil {
+		client := registry.NewClient()
+		client.Concurrency = opts.Concurrency
+		reg = client
+	}
+	secret := opts.SecretStore
+	if secret == nil {
+		secret = secrets.NewKeyringStore()
+	}
+	var stdin io.Reader = os.Stdin
+	if opts.Stdin != nil {
+		stdin = opts.Stdin
+	}
+	var stdout io.Writer = os.Stdout
+	if opts.Stdout != nil {
+		stdout = opts.Stdout
+	}
+	setupTimeout := opts.SetupTimeout
+	if setupTimeout <= 0 {
+		setupTimeout = 30 * time.Second
+	}
+	isInteractive := opts.IsInteractive
+	if isInteractive == nil {
+		isInteractive = defaultIsInteractive
+	}
 	return &Manager{
 		store:         st,
-		registry:      registry.NewClient(),
-		secret:        secrets.NewKeyringStore(),
+		registry:      reg,
+		secret:        secret,
 		adapters:      detected,
+		missing:       missing,
 		stdin:         stdin,
 		stdout:        stdout,
-		setupTimeout:  30 * time.Second,
-		isInteractive: defaultIsInteractive,
+		setupTimeout:  setupTimeout,
+		isInteractive: isInteractive,
+		concurrency:   opts.Concurrency,
 	}, nil
 }
 
+// detectAdapters returns the adapters the manager writes to and, with
+// CreateMissingClients, those of known clients held back until named.
+func detectAdapters(opts ManagerOptions) (map[string]adapters.Adapter, map[string]adapters.Adapter, error) {
+	listAdapters := adapters.DetectedAdapters
+	if opts.IncludeUndetected {
+		listAdapters = adapters.AllAdapters
+	}
+	detected, err := listAdapters(opts.NoBackup)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !opts.CreateMissingClients || opts.IncludeUndetected {
+		return detected, nil, nil
+	}
+	all, err := adapters.AllAdapters(opts.NoBackup)
+	if err != nil {
+		return nil, nil, err
+	}
+	missing := make(map[string]adapters.Adapter)
+	for name, adapter := range all {
+		if _, ok := detected[name]; !ok {
+			missing[name] = adapter
+		}
+	}
+	return detected, missing, nil
+}
+
+// Detect reports detection status for every known client, not just the
+// ones the manager writes to.
+func (m *Manager) Detect() []adapters.ClientStatus {
+	return adapters.DetectClients()
+}
+
 type InstallRequest struct {
 	Name    string
 	Version string
 	Tap     string
 	Target  string
 	Force   bool
+	// KeepBackups, when positive, prunes all but that many backup sets after
+	// a successful install.
+	KeepBackups int
+	// ServerTargets sends individual servers to their own target list
+	// instead of Target; unmapped servers still go to Target.
+	ServerTargets map[string]string
+	// InlineSecrets writes the package's stored secrets into the env of
+	// every server that lists the key in EnvRequired.
+	InlineSecrets bool
+	// IncludeTargets and ExcludeTargets narrow an "all" target to, or away
+	// from, the named clients.
+	IncludeTargets []string
+	ExcludeTargets []string
+	// ServerPrefix namespaces the package's servers as "<prefix>-<server>";
+	// ServerPrefixAuto uses the package name. Empty keeps the prefix of an
+	// existing install, if any.
+	ServerPrefix string
+	// Strict refuses the install when a tool in the manifest's
+	// required_tools is not on PATH, instead of warning.
+	Strict bool
+	// NoVerify skips the tap's trust checks on the index and manifest. The
+	// install is recorded as unverified.
+	NoVerify bool
+	// ManifestPath reads the manifest from this local file instead of the
+	// tap, so authors can test edits without publishing a new version. The
+	// tap stays the source, with the file recorded next to it, and the
+	// install is recorded as unverified. Version must be empty.
+	ManifestPath string
+	// EnvOverrides sets env values on individual manifest servers, by
+	// server name, on top of the manifest and any inlined secrets.
+	EnvOverrides map[string]map[string]string
 }
 
+// ServerPrefixAuto as a ServerPrefix prefixes servers with the package name.
+const ServerPrefixAuto = "auto"
+
 type InstallURLRequest struct {
-	URL    string
-	Target string
-	Yes    bool
-	Force  bool
+	URL            string
+	Target         string
+	Yes            bool
+	Force          bool
+	KeepBackups    int
+	InlineSecrets  bool
+	IncludeTargets []string
+	ExcludeTargets []string
+	// Headers are sent with the manifest request only; they are never
+	// stored in state.
+	Headers http.Header
+	// Signature, when SigURL is set, must verify the manifest before it is
+	// installed. It stands in for the trust prompt for this install only;
+	// the verified signer identity is recorded when the URL is already
+	// trusted.
+	Signature registry.DetachedSignature
+}
+
+type InstallFileRequest struct {
+	Path           string
+	SHA256         string
+	Target         string
+	ServerTargets  map[string]string
+	Force          bool
+	KeepBackups    int
+	InlineSecrets  bool
+	IncludeTargets []string
+	ExcludeTargets []string
+	ServerPrefix   string
+	Strict         bool
+	EnvOverrides   map[string]map[string]string
 }
 
 func (m *Manager) InstallFromTap(ctx context.Context, req InstallRequest) (model.InstalledPackage, error) {
@@ -75,45 +280,115 @@ func (m *Manager) InstallFromTap(ctx context.Context, req InstallRequest) (model
 	if err != nil {
 		return model.InstalledPackage{}, err
 	}
+	resolved, source, err := m.resolveTapRequest(ctx, st, req)
+	if err != nil {
+		return model.InstalledPackage{}, err
+	}
+	return m.installResolved(ctx, st, resolved, source, req.options())
+}
+
+func (req InstallRequest) options() installOptions {
+	return installOptions{
+		target:         req.Target,
+		serverTargets:  req.ServerTargets,
+		force:          req.Force,
+		keepBackups:    req.KeepBackups,
+		inlineSecrets:  req.InlineSecrets,
+		includeTargets: req.IncludeTargets,
+		excludeTargets: req.ExcludeTargets,
+		serverPrefix:   req.ServerPrefix,
+		strict:         req.Strict,
+		envOverrides:   req.EnvOverrides,
+	}
+}
+
+func (req InstallURLRequest) options() installOptions {
+	return installOptions{
+		target:         req.Target,
+		force:          req.Force,
+		keepBackups:    req.KeepBackups,
+		inlineSecrets:  req.InlineSecrets,
+		includeTargets: req.IncludeTargets,
+		excludeTargets: req.ExcludeTargets,
+	}
+}
+
+func (req InstallFileRequest) options() installOptions {
+	return installOptions{
+		target:         req.Target,
+		serverTargets:  req.ServerTargets,
+		force:          req.Force,
+		keepBackups:    req.KeepBackups,
+		inlineSecrets:  req.InlineSecrets,
+		includeTargets: req.IncludeTargets,
+		excludeTargets: req.ExcludeTargets,
+		serverPrefix:   req.ServerPrefix,
+		strict:         req.Strict,
+		envOverrides:   req.EnvOverrides,
+	}
+}
 
+// resolveTapRequest resolves the package req names in its tap, defaulting
+// to the official one.
+func (m *Manager) resolveTapRequest(ctx context.Context, st model.State, req InstallRequest) (registry.ResolvedPackage, model.SourceRef, error) {
 	tapName := req.Tap
 	if tapName == "" {
 		tapName = model.DefaultTapName
 	}
 	tap, ok := st.Taps[tapName]
 	if !ok {
-		return model.InstalledPackage{}, fmt.Errorf("tap %q not found", tapName)
+		return registry.ResolvedPackage{}, model.SourceRef{}, fmt.Errorf("%w: %q", ErrTapNotFound, tapName)
 	}
-
-	resolved, err := m.registry.ResolveFromTap(ctx, tap, req.Name, req.Version)
+	if req.ManifestPath != "" {
+		resolved, source, err := m.resolveManifestOverride(ctx, tap, req)
+		if err != nil {
+			return registry.ResolvedPackage{}, model.SourceRef{}, err
+		}
+		return resolved, source, nil
+	}
+	resolve := m.registry.ResolveFromTap
+	if req.NoVerify {
+		resolve = m.registry.ResolveFromTapUnverified
+	}
+	resolved, err := resolve(ctx, tap, req.Name, req.Version)
 	if err != nil {
-		return model.InstalledPackage{}, err
+		return registry.ResolvedPackage{}, model.SourceRef{}, err
 	}
+	return resolved, model.SourceRef{Type: model.SourceTypeTap, Tap: tap.Name}, nil
+}
 
-	installed, err := m.applyInstall(ctx, st, resolved.Manifest, resolved.ManifestDigest, model.SourceRef{
-		Type: model.SourceTypeTap,
-		Tap:  tap.Name,
-	}, req.Target, req.Force)
+// resolveManifestOverride reads req.ManifestPath in place of the tap's
+// manifest for req.Name. The manifest is validated as usual, but no version
+// is resolved in the tap, so none of the tap's trust checks apply.
+func (m *Manager) resolveManifestOverride(ctx context.Context, tap model.TapConfig, req InstallRequest) (registry.ResolvedPackage, model.SourceRef, error) {
+	if req.Version != "" {
+		return registry.ResolvedPackage{}, model.SourceRef{}, fmt.Errorf("--manifest-path replaces version resolution; drop @%s", req.Version)
+	}
+	abs, err := filepath.Abs(req.ManifestPath)
 	if err != nil {
-		return model.InstalledPackage{}, err
+		return registry.ResolvedPackage{}, model.SourceRef{}, fmt.Errorf("resolve manifest path: %w", err)
 	}
-
-	installed.Version = resolved.Version
-	installed.Description = resolved.Manifest.Description
-	installed.Source = model.SourceRef{Type: model.SourceTypeTap, Tap: tap.Name}
-	installed.ManifestDigest = resolved.ManifestDigest
-	installed.UpdatedAt = time.Now().UTC()
-	if installed.InstalledAt.IsZero() {
-		installed.InstalledAt = installed.UpdatedAt
+	resolved, err := m.resolveOverrideFile(ctx, tap, req.Name, abs)
+	if err != nil {
+		return registry.ResolvedPackage{}, model.SourceRef{}, err
 	}
-	st.Installed[installed.Name] = installed
-	if err := m.store.Save(st); err != nil {
-		return model.InstalledPackage{}, err
+	resolved.Warnings = append(resolved.Warnings, fmt.Sprintf("using %s in place of %s from tap %q; reinstalls read this file again until the package is upgraded", abs, req.Name, tap.Name))
+	return resolved, model.SourceRef{Type: model.SourceTypeTap, Tap: tap.Name, ManifestPath: abs}, nil
+}
+
+// resolveOverrideFile reads the local manifest at path as package name from
+// tap. It is never verified against the tap.
+func (m *Manager) resolveOverrideFile(ctx context.Context, tap model.TapConfig, name, path string) (registry.ResolvedPackage, error) {
+	resolved, err := m.registry.ResolveFromURL(ctx, "file://"+path)
+	if err != nil {
+		return registry.ResolvedPackage{}, err
 	}
-	if results := m.runSetupCommands(ctx, installed.Name, resolved.Manifest); len(results) > 0 {
-		formatSetupSummary(m.stdout, installed.Name, results, installed.Targets)
+	if resolved.Manifest.Name != name {
+		return registry.ResolvedPackage{}, fmt.Errorf("manifest %s is for %q, not %q", path, resolved.Manifest.Name, name)
 	}
-	return installed, nil
+	resolved.Tap = tap
+	resolved.Unverified = true
+	return resolved, nil
 }
 
 func (m *Manager) InstallFromURL(ctx context.Context, req InstallURLRequest) (model.InstalledPackage, error) {
@@ -122,68 +397,381 @@ func (m *Manager) InstallFromURL(ctx context.Context, req InstallURLRequest) (mo
 		return model.InstalledPackage{}, err
 	}
 
+	// A verified signature vouches for this manifest only, so it stands in
+	// for the trust prompt without recording a standing approval; an
+	// unsigned install of the URL later still asks.
 	trusted := st.TrustedDirectSources[req.URL]
-	if !trusted.Approved {
+	verify := req.Signature.SigURL != ""
+	record := trusted.Approved
+	if !trusted.Approved && !verify {
 		if !req.Yes {
 			approved, err := m.promptTrust(req.URL)
 			if err != nil {
 				return model.InstalledPackage{}, err
 			}
 			if !approved {
-				return model.InstalledPackage{}, errors.New("direct source not trusted")
+				return model.InstalledPackage{}, ErrTrustRequired
 			}
 		}
-		st.TrustedDirectSources[req.URL] = model.TrustDecision{
+		trusted = model.TrustDecision{
 			URL:       req.URL,
 			Approved:  true,
 			CreatedAt: time.Now().UTC(),
 		}
+		record = true
 	}
 
-	resolved, err := m.registry.ResolveFromURL(ctx, req.URL)
+	resolved, err := m.registry.ResolveFromURLWithHeaders(ctx, req.URL, req.Headers)
 	if err != nil {
 		return model.InstalledPackage{}, err
 	}
+	if verify {
+		identity, err := m.registry.VerifyDetached(ctx, resolved.ManifestRaw, req.Signature)
+		if err != nil {
+			return model.InstalledPackage{}, fmt.Errorf("%w: signature check for %s failed: %v", ErrTrustRequired, req.URL, err)
+		}
+		trusted.Identity = identity
+	}
+	if record {
+		st.TrustedDirectSources[req.URL] = trusted
+	}
+	return m.installResolved(ctx, st, resolved, model.SourceRef{Type: model.SourceTypeDirect, URL: req.URL}, req.options())
+}
 
-	installed, err := m.applyInstall(ctx, st, resolved.Manifest, resolved.ManifestDigest, model.SourceRef{
-		Type: model.SourceTypeDirect,
-		URL:  req.URL,
-	}, req.Target, req.Force)
+// InstallFromFile installs a local manifest without a trust prompt, since the
+// user named the file explicitly. When SHA256 is set the manifest must match
+// it, which keeps local-dev installs reproducible.
+func (m *Manager) InstallFromFile(ctx context.Context, req InstallFileRequest) (model.InstalledPackage, error) {
+	return m.installFile(ctx, req, false)
+}
+
+// installFile is InstallFromFile with the option to install the way watch
+// does on every change: the plan is printed and the package's own servers
+// are overwritten without asking, but a server of the same name it did not
+// write still needs the confirmation a normal install asks for, unless
+// req.Force is set.
+func (m *Manager) installFile(ctx context.Context, req InstallFileRequest, watched bool) (model.InstalledPackage, error) {
+	st, err := m.store.Load()
 	if err != nil {
 		return model.InstalledPackage{}, err
 	}
-	installed.Version = resolved.Manifest.Version
-	installed.Description = resolved.Manifest.Description
-	installed.Source = model.SourceRef{Type: model.SourceTypeDirect, URL: req.URL}
-	installed.ManifestDigest = resolved.ManifestDigest
-	installed.UpdatedAt = time.Now().UTC()
-	if installed.InstalledAt.IsZero() {
-		installed.InstalledAt = installed.UpdatedAt
+	resolved, source, err := m.resolveFileRequest(ctx, req)
+	if err != nil {
+		return model.InstalledPackage{}, err
+	}
+	opts := req.options()
+	if watched {
+		opts.force = true
+		opts.showPlan = true
+		opts.confirmForeign = !req.Force
+	}
+	return m.installResolved(ctx, st, resolved, source, opts)
+}
+
+// resolveFileRequest reads the local manifest req names, checking its hash
+// when one is given.
+func (m *Manager) resolveFileRequest(ctx context.Context, req InstallFileRequest) (registry.ResolvedPackage, model.SourceRef, error) {
+	abs, err := filepath.Abs(req.Path)
+	if err != nil {
+		return registry.ResolvedPackage{}, model.SourceRef{}, fmt.Errorf("resolve manifest path: %w", err)
+	}
+	source := model.SourceRef{Type: model.SourceTypeDirect, URL: "file://" + abs}
+	resolved, err := m.registry.ResolveFromURL(ctx, source.URL)
+	if err != nil {
+		return registry.ResolvedPackage{}, model.SourceRef{}, err
+	}
+	if req.SHA256 != "" && !strings.EqualFold(resolved.ManifestDigest, req.SHA256) {
+		return registry.ResolvedPackage{}, model.SourceRef{}, fmt.Errorf("manifest hash mismatch for %s: expected %s got %s", abs, req.SHA256, resolved.ManifestDigest)
+	}
+	return resolved, source, nil
+}
+
+// InstallPreview is what an install would do, worked out without writing
+// any config or state.
+type InstallPreview struct {
+	Name    string      `json:"name"`
+	Version string      `json:"version"`
+	Plan    InstallPlan `json:"plan"`
+}
+
+// PlanInstall resolves req like InstallFromTap and returns the plan it
+// would apply.
+func (m *Manager) PlanInstall(ctx context.Context, req InstallRequest) (InstallPreview, error) {
+	st, err := m.store.Load()
+	if err != nil {
+		return InstallPreview{}, err
+	}
+	resolved, _, err := m.resolveTapRequest(ctx, st, req)
+	if err != nil {
+		return InstallPreview{}, err
+	}
+	return m.previewInstall(ctx, st, resolved, req.options())
+}
+
+// PlanInstallFile is PlanInstall for a local manifest.
+func (m *Manager) PlanInstallFile(ctx context.Context, req InstallFileRequest) (InstallPreview, error) {
+	st, err := m.store.Load()
+	if err != nil {
+		return InstallPreview{}, err
+	}
+	resolved, _, err := m.resolveFileRequest(ctx, req)
+	if err != nil {
+		return InstallPreview{}, err
+	}
+	return m.previewInstall(ctx, st, resolved, req.options())
+}
+
+// previewInstall builds the plan for resolved. Secrets are never inlined
+// into a preview, so a plan printed or saved by CI cannot leak them.
+func (m *Manager) previewInstall(ctx context.Context, st model.State, resolved registry.ResolvedPackage, opts installOptions) (InstallPreview, error) {
+	opts.inlineSecrets = false
+	resolved.Manifest, opts = prefixInstall(st, resolved.Manifest, opts)
+	placement, _, err := m.placeInstall(ctx, st, resolved.Manifest, opts)
+	if err != nil {
+		return InstallPreview{}, err
+	}
+	plan, err := m.buildPlacementPlan(ctx, placement)
+	if err != nil {
+		return InstallPreview{}, err
+	}
+	if plan.Conflicts == nil {
+		plan.Conflicts = []ServerConflict{}
+	}
+	if plan.Diffs == nil {
+		plan.Diffs = []ServerDiff{}
+	}
+	return InstallPreview{Name: resolved.Manifest.Name, Version: resolved.Version, Plan: plan}, nil
+}
+
+type installOptions struct {
+	target         string
+	serverTargets  map[string]string
+	includeTargets []string
+	excludeTargets []string
+	force          bool
+	keepBackups    int
+	inlineSecrets  bool
+	// showPlan prints the plan of a forced install before applying it.
+	showPlan bool
+	// confirmForeign makes a forced install still prompt before it
+	// overwrites a server the package did not already write to that target.
+	confirmForeign bool
+	// serverPrefix is the requested server name prefix, applied by
+	// prefixInstall.
+	serverPrefix string
+	// strict fails the install when a required tool is missing.
+	strict bool
+	// envOverrides sets env values per server, applied after secrets are
+	// inlined.
+	envOverrides map[string]map[string]string
+}
+
+// installResolved applies a resolved manifest to its targets, records it in
+// state and runs any setup commands.
+func (m *Manager) installResolved(ctx context.Context, st model.State, resolved registry.ResolvedPackage, source model.SourceRef, opts installOptions) (model.InstalledPackage, error) {
+	m.printWarnings(resolved.Warnings)
+	if resolved.Unverified {
+		fmt.Fprintf(m.stdout, "WARNING: installing %s@%s WITHOUT verifying tap %q; its index and manifest were not checked against the tap's trust settings. The install is recorded as unverified.\n", resolved.Manifest.Name, resolved.Version, resolved.Tap.Name)
+	}
+	if missing := missingTools(resolved.Manifest); len(missing) > 0 {
+		if opts.strict {
+			return model.InstalledPackage{}, fmt.Errorf("%s requires %s on PATH; install the missing tools first, or drop --strict to install anyway", resolved.Manifest.Name, strings.Join(missing, ", "))
+		}
+		fmt.Fprintf(m.stdout, "Warning: %s requires %s on PATH, not found; its servers will fail to start until the missing tools are installed\n", resolved.Manifest.Name, strings.Join(missing, ", "))
+	}
+
+	previous := st.Installed[resolved.Manifest.Name].Version
+	resolved.Manifest, opts = prefixInstall(st, resolved.Manifest, opts)
+	installed, err := m.applyInstall(ctx, st, resolved.Manifest, resolved.ManifestDigest, source, opts)
+	if err != nil {
+		return model.InstalledPackage{}, err
 	}
+	installed.Version = resolved.Version
+	installed.ServerPrefix = opts.serverPrefix
+	installed.Unverified = resolved.Unverified
+	installed.SecretKeys = adoptRetainedSecrets(&st, installed.Name, installed.SecretKeys)
 	st.Installed[installed.Name] = installed
 
 	if err := m.store.Save(st); err != nil {
 		return model.InstalledPackage{}, err
 	}
+	m.recordHistory(ctx, HistoryEntry{Action: HistoryInstall, Package: installed.Name, FromVersion: previous, ToVersion: installed.Version, Targets: installed.Targets, Unverified: installed.Unverified})
+	m.pruneBackups(opts.keepBackups)
 	if results := m.runSetupCommands(ctx, installed.Name, resolved.Manifest); len(results) > 0 {
 		formatSetupSummary(m.stdout, installed.Name, results, installed.Targets)
 	}
 	return installed, nil
 }
 
-func (m *Manager) applyInstall(ctx context.Context, st model.State, manifest model.PackageManifest, digest string, source model.SourceRef, target string, force bool) (model.InstalledPackage, error) {
-	targets, err := m.resolveTargets(target)
+// missingTools returns the manifest's required tools that are not on PATH.
+func missingTools(manifest model.PackageManifest) []string {
+	var missing []string
+	for _, tool := range manifest.RequiredTools {
+		if _, err := exec.LookPath(tool); err != nil {
+			missing = append(missing, tool)
+		}
+	}
+	return missing
+}
+
+// prefixInstall applies the requested server name prefix to manifest and to
+// the keys of opts.serverTargets and opts.envOverrides, which name manifest
+// servers. Without a requested prefix, an existing install keeps its own, and
+// without --env overrides it keeps its recorded ones. The returned options
+// carry the effective prefix and overrides.
+func prefixInstall(st model.State, manifest model.PackageManifest, opts installOptions) (model.PackageManifest, installOptions) {
+	prefix := strings.TrimSpace(opts.serverPrefix)
+	switch prefix {
+	case "":
+		prefix = st.Installed[manifest.Name].ServerPrefix
+	case ServerPrefixAuto:
+		prefix = manifest.Name
+	}
+	opts.serverPrefix = prefix
+	if prefix != "" {
+		if len(opts.serverTargets) > 0 {
+			mapped := make(map[string]string, len(opts.serverTargets))
+			for name, target := range opts.serverTargets {
+				mapped[prefixedServerName(prefix, name)] = target
+			}
+			opts.serverTargets = mapped
+		}
+		if len(opts.envOverrides) > 0 {
+			overrides := make(map[string]map[string]string, len(opts.envOverrides))
+			for name, env := range opts.envOverrides {
+				overrides[prefixedServerName(prefix, name)] = env
+			}
+			opts.envOverrides = overrides
+		}
+		manifest = withServerPrefix(manifest, prefix)
+	}
+	if len(opts.envOverrides) == 0 {
+		opts.envOverrides = recordedEnvOverrides(st.Installed[manifest.Name], manifest)
+	}
+	return manifest, opts
+}
+
+// withServerPrefix returns manifest with its servers renamed to the names
+// they are written under in client configs.
+func withServerPrefix(manifest model.PackageManifest, prefix string) model.PackageManifest {
+	if prefix == "" {
+		return manifest
+	}
+	servers := make(map[string]model.MCPServerSpec, len(manifest.MCPServers))
+	for name, spec := range manifest.MCPServers {
+		servers[prefixedServerName(prefix, name)] = spec
+	}
+	manifest.MCPServers = servers
+	return manifest
+}
+
+func prefixedServerName(prefix, name string) string {
+	return prefix + "-" + name
+}
+
+// placeInstall works out which servers an install of manifest writes to
+// which targets, also returning the env keys inlined per server.
+func (m *Manager) placeInstall(ctx context.Context, st model.State, manifest model.PackageManifest, opts installOptions) (serverPlacement, map[string][]string, error) {
+	target := opts.target
+	if strings.TrimSpace(target) == "" {
+		target = st.Settings.DefaultTarget
+	}
+	servers := expandHostEnv(manifest.MCPServers)
+	var inlined map[string][]string
+	if opts.inlineSecrets {
+		servers, inlined = m.inlineSecrets(manifest.Name, servers)
+	}
+	servers, err := withEnvOverrides(servers, opts.envOverrides)
+	if err != nil {
+		return serverPlacement{}, nil, err
+	}
+	for name, spec := range servers {
+		// An empty env block means none; only stripInlinedEnv clears env.
+		if spec.Env != nil && len(spec.Env) == 0 {
+			spec.Env = nil
+			servers[name] = spec
+		}
+	}
+	placement, err := m.placeServers(servers, target, opts.serverTargets, targetScope{
+		aliases: targetAliases(st.Settings),
+		include: opts.includeTargets,
+		exclude: opts.excludeTargets,
+	})
+	if err != nil {
+		return placement, nil, err
+	}
+	if prev := st.Installed[manifest.Name].InlinedEnv; !opts.inlineSecrets && len(prev) > 0 {
+		if err := m.stripInlinedEnv(ctx, placement, prev); err != nil {
+			return placement, nil, err
+		}
+	}
+	return placement, inlined, nil
+}
+
+// stripInlinedEnv keeps secret values inlined by an earlier install out of
+// the configs written without --inline-secrets. Adapters carry a server's
+// existing env over when the new spec has none, so such servers get that env
+// minus the inlined keys instead, empty rather than nil when nothing is left.
+func (m *Manager) stripInlinedEnv(ctx context.Context, placement serverPlacement, inlined map[string][]string) error {
+	for _, target := range placement.targets {
+		existing, err := m.adapters[target].ListServers(ctx)
+		if err != nil {
+			return fmt.Errorf("read %s config: %w", target, err)
+		}
+		for name, spec := range placement.servers[target] {
+			cur, ok := existing[name]
+			if len(inlined[name]) == 0 || !ok || len(spec.Env) > 0 {
+				continue
+			}
+			env := make(map[string]string, len(cur.Env))
+			maps.Copy(env, cur.Env)
+			for _, key := range inlined[name] {
+				delete(env, key)
+			}
+			spec.Env = env
+			placement.servers[target][name] = spec
+		}
+	}
+	return nil
+}
+
+func (m *Manager) applyInstall(ctx context.Context, st model.State, manifest model.PackageManifest, digest string, source model.SourceRef, opts installOptions) (model.InstalledPackage, error) {
+	placement, inlined, err := m.placeInstall(ctx, st, manifest, opts)
 	if err != nil {
 		return model.InstalledPackage{}, err
 	}
 
-	if !force {
-		plan, err := buildInstallPlan(ctx, targets, m.adapters, manifest.MCPServers)
+	if opts.force {
+		// Forced installs skip the prompt but still call out transport
+		// switches; a plan that cannot be built here fails in the apply below.
+		plan, err := m.buildPlacementPlan(ctx, placement)
+		if err == nil {
+			if opts.showPlan {
+				FormatInstallPlan(m.stdout, plan)
+			}
+			for _, c := range plan.TransportChanges() {
+				writeConflictWarning(m.stdout, c)
+			}
+		}
+		if opts.confirmForeign && err == nil && hasForeignConflict(plan, st.Installed[manifest.Name]) {
+			if !opts.showPlan {
+				FormatInstallPlan(m.stdout, plan)
+			}
+			approved, err := m.promptConfirmInstall()
+			if err != nil {
+				return model.InstalledPackage{}, err
+			}
+			if !approved {
+				return model.InstalledPackage{}, errors.New("install canceled")
+			}
+		}
+	} else {
+		plan, err := m.buildPlacementPlan(ctx, placement)
 		if err != nil {
 			return model.InstalledPackage{}, err
 		}
 		if plan.NeedsPrompt() {
-			formatInstallPlan(m.stdout, plan)
+			FormatInstallPlan(m.stdout, plan)
 			approved, err := m.promptConfirmInstall()
 			if err != nil {
 				return model.InstalledPackage{}, err
@@ -194,16 +782,39 @@ func (m *Manager) applyInstall(ctx context.Context, st model.State, manifest mod
 		}
 	}
 
-	applied := make([]adapters.Adapter, 0, len(targets))
-	for _, targetName := range targets {
-		adapter := m.adapters[targetName]
-		if err := adapter.UpsertServers(ctx, manifest.MCPServers); err != nil {
-			for i := len(applied) - 1; i >= 0; i-- {
-				_ = applied[i].RemoveServers(ctx, keys(manifest.MCPServers))
+	for _, targetName := range placement.targets {
+		warnCommentedConfig(m.stdout, m.adapters[targetName])
+	}
+	// Each target is its own config file, so targets are written in
+	// parallel. Targets not yet started when one fails are left alone.
+	errs := parallel.Run(len(placement.targets), m.concurrency, true, func(i int) error {
+		// A canceled install stops before touching further configs.
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		targetName := placement.targets[i]
+		return m.adapters[targetName].UpsertServers(ctx, placement.servers[targetName])
+	})
+	var applied, failed, remaining []string
+	var applyErr error
+	targetPaths := make(map[string]string, len(placement.targets))
+	for i, targetName := range placement.targets {
+		switch err := errs[i]; {
+		case err == nil:
+			applied = append(applied, targetName)
+			targetPaths[targetName] = m.adapters[targetName].Path()
+		case errors.Is(err, parallel.ErrSkipped):
+			remaining = append(remaining, targetName)
+		default:
+			failed = append(failed, targetName)
+			if applyErr == nil {
+				applyErr = fmt.Errorf("apply %s config: %w", targetName, err)
 			}
-			return model.InstalledPackage{}, fmt.Errorf("apply %s config: %w", targetName, err)
 		}
-		applied = append(applied, adapter)
+	}
+	if applyErr != nil {
+		// Rolling back must finish even when the failure was a cancellation.
+		return model.InstalledPackage{}, m.rollbackApplied(context.WithoutCancel(ctx), applyErr, placement, applied, failed, remaining)
 	}
 
 	now := time.Now().UTC()
@@ -217,20 +828,314 @@ func (m *Manager) applyInstall(ctx context.Context, st model.State, manifest mod
 	cur.Source = source
 	cur.ManifestDigest = digest
 	cur.Servers = keys(manifest.MCPServers)
-	cur.Targets = targets
+	cur.Targets = placement.targets
+	cur.TargetPaths = targetPaths
+	cur.ServerTargets = placement.mapped
+	cur.DefaultTargets = placement.defaults
+	cur.InlinedEnv = inlined
+	cur.EnvOverrides = opts.envOverrides
+	cur.TargetVersions = nil
+	cur.SecretKeys = mergeSecretKeys(cur.SecretKeys, manifestSecretKeys(manifest)...)
 	cur.UpdatedAt = now
 
 	return cur, nil
 }
 
-func (m *Manager) Remove(ctx context.Context, name string) error {
+// hasForeignConflict reports whether plan overwrites a server that prev, the
+// package's current install, did not write to that target.
+func hasForeignConflict(plan InstallPlan, prev model.InstalledPackage) bool {
+	for _, c := range plan.Conflicts {
+		if c.Kind == ConflictDuplicateSpec {
+			continue
+		}
+		if !slices.Contains(prev.Servers, c.ServerName) || !slices.Contains(prev.Targets, c.Target) {
+			return true
+		}
+	}
+	return false
+}
+
+// serverPlacement records which servers an install writes to each target.
+type serverPlacement struct {
+	targets []string                                  // every target receiving at least one server
+	servers map[string]map[string]model.MCPServerSpec // target -> servers written there
+	mapped  map[string][]string                       // server -> targets, set only when a mapping was used
+	// defaults are the targets of unmapped servers when a mapping was used.
+	defaults []string
+}
+
+// placeServers assigns servers to targets. Servers named in serverTargets go
+// to their mapped targets and the rest to the target list.
+func (m *Manager) placeServers(servers map[string]model.MCPServerSpec, target string, serverTargets map[string]string, scope targetScope) (serverPlacement, error) {
+	p := serverPlacement{servers: make(map[string]map[string]model.MCPServerSpec)}
+	for name, mapped := range serverTargets {
+		if _, ok := servers[name]; !ok {
+			return serverPlacement{}, fmt.Errorf("mapped server %q is not in the manifest", name)
+		}
+		if strings.TrimSpace(mapped) == "" {
+			return serverPlacement{}, fmt.Errorf("server %q is mapped to no target", name)
+		}
+	}
+
+	var defaults []string
+	if len(serverTargets) < len(servers) {
+		var err error
+		if defaults, err = m.resolveTargets(target, scope); err != nil {
+			return serverPlacement{}, err
+		}
+	}
+	seen := make(map[string]bool)
+	addTarget := func(t string) {
+		if !seen[t] {
+			seen[t] = true
+			p.targets = append(p.targets, t)
+		}
+	}
+	for _, t := range defaults {
+		addTarget(t)
+	}
+	if len(serverTargets) > 0 {
+		p.mapped = make(map[string][]string, len(servers))
+		p.defaults = defaults
+	}
+	for _, name := range keys(servers) {
+		targets := defaults
+		if mapped, ok := serverTargets[name]; ok {
+			resolved, err := m.resolveTargets(mapped, scope)
+			if err != nil {
+				return serverPlacement{}, fmt.Errorf("map server %q: %w", name, err)
+			}
+			targets = resolved
+		}
+		for _, t := range targets {
+			addTarget(t)
+			if p.servers[t] == nil {
+				p.servers[t] = make(map[string]model.MCPServerSpec)
+			}
+			p.servers[t][name] = servers[name]
+		}
+		if p.mapped != nil {
+			p.mapped[name] = targets
+		}
+	}
+	return p, nil
+}
+
+// buildPlacementPlan builds one install plan covering every target in p,
+// each checked against only the servers placed on it.
+func (m *Manager) buildPlacementPlan(ctx context.Context, p serverPlacement) (InstallPlan, error) {
+	var plan InstallPlan
+	for _, target := range p.targets {
+		tp, err := buildInstallPlan(ctx, []string{target}, m.adapters, p.servers[target])
+		if err != nil {
+			return plan, err
+		}
+		plan.Conflicts = append(plan.Conflicts, tp.Conflicts...)
+		plan.Diffs = append(plan.Diffs, tp.Diffs...)
+	}
+	return plan, nil
+}
+
+// serversForTarget lists the installed servers pkg wrote to target.
+func serversForTarget(pkg model.InstalledPackage, target string) []string {
+	if len(pkg.ServerTargets) == 0 {
+		return pkg.Servers
+	}
+	out := make([]string, 0, len(pkg.Servers))
+	for _, name := range pkg.Servers {
+		if targets, ok := pkg.ServerTargets[name]; !ok || slices.Contains(targets, target) {
+			out = append(out, name)
+		}
+	}
+	return out
+}
+
+// recordedServerTargets turns pkg's recorded mapping back into install
+// mappings for the servers that manifest still defines.
+func recordedServerTargets(pkg model.InstalledPackage, manifest model.PackageManifest) map[string]string {
+	if len(pkg.ServerTargets) == 0 {
+		return nil
+	}
+	out := make(map[string]string, len(pkg.ServerTargets))
+	for name, targets := range pkg.ServerTargets {
+		if _, ok := manifest.MCPServers[name]; ok {
+			out[name] = strings.Join(targets, ",")
+		}
+	}
+	return out
+}
+
+// upgradeTarget is the target list an upgrade of pkg to manifest applies to
+// selected. Servers new in manifest would go to all of them; for a package
+// installed with --map they go to its recorded DefaultTargets instead. A
+// package whose servers were all mapped has none, so its new servers still
+// go everywhere, with a warning.
+func (m *Manager) upgradeTarget(pkg model.InstalledPackage, manifest model.PackageManifest, selected []string) string {
+	if len(pkg.ServerTargets) == 0 {
+		return strings.Join(selected, ",")
+	}
+	var added []string
+	for _, name := range keys(manifest.MCPServers) {
+		if _, ok := pkg.ServerTargets[name]; !ok {
+			added = append(added, name)
+		}
+	}
+	if len(added) == 0 {
+		return strings.Join(selected, ",")
+	}
+	if len(pkg.DefaultTargets) > 0 {
+		return strings.Join(pkg.DefaultTargets, ",")
+	}
+	fmt.Fprintf(m.stdout, "Warning: %s@%s adds %s, which no --map placed; writing to all of the package's targets (%s). Reinstall with --map to place them.\n", manifest.Name, manifest.Version, strings.Join(added, ", "), strings.Join(selected, ","))
+	return strings.Join(selected, ",")
+}
+
+// recordedEnvOverrides returns pkg's recorded env overrides for the servers
+// that manifest still defines.
+func recordedEnvOverrides(pkg model.InstalledPackage, manifest model.PackageManifest) map[string]map[string]string {
+	if len(pkg.EnvOverrides) == 0 {
+		return nil
+	}
+	out := make(map[string]map[string]string, len(pkg.EnvOverrides))
+	for name, env := range pkg.EnvOverrides {
+		if _, ok := manifest.MCPServers[name]; ok {
+			out[name] = env
+		}
+	}
+	return out
+}
+
+// withEnvOverrides sets the given env values on each named server, on top
+// of the env the manifest and inlined secrets gave it.
+func withEnvOverrides(servers map[string]model.MCPServerSpec, overrides map[string]map[string]string) (map[string]model.MCPServerSpec, error) {
+	if len(overrides) == 0 {
+		return servers, nil
+	}
+	out := maps.Clone(servers)
+	for name, env := range overrides {
+		spec, ok := out[name]
+		if !ok {
+			return nil, fmt.Errorf("env override for server %q: server is not in the manifest", name)
+		}
+		merged := make(map[string]string, len(spec.Env)+len(env))
+		maps.Copy(merged, spec.Env)
+		maps.Copy(merged, env)
+		spec.Env = merged
+		out[name] = spec
+	}
+	return out, nil
+}
+
+// TargetOutcome records where a single target was left after a failed
+// multi-target install.
+type TargetOutcome struct {
+	Target string
+	State  string
+	Err    error
+	Backup string
+}
+
+const (
+	TargetRolledBack     = "rolled back"
+	TargetRollbackFailed = "rollback failed"
+	TargetApplyFailed    = "apply failed"
+	TargetNotAttempted   = "not attempted"
+)
+
+// PartialApplyError is returned when an install failed part-way and at
+// least one already-written target could not be rolled back.
+type PartialApplyError struct {
+	Err      error
+	Outcomes []TargetOutcome
+}
+
+func (e *PartialApplyError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%v; rollback incomplete, targets may be inconsistent:", e.Err)
+	for _, o := range e.Outcomes {
+		fmt.Fprintf(&b, "\n  %s: %s", o.Target, o.State)
+		if o.Err != nil {
+			fmt.Fprintf(&b, " (%v)", o.Err)
+		}
+		if o.Backup != "" {
+			fmt.Fprintf(&b, " (restore from %s)", o.Backup)
+		}
+	}
+	return b.String()
+}
+
+func (e *PartialApplyError) Unwrap() error { return e.Err }
+
+// rollbackApplied removes servers from targets written before applyErr. If
+// every rollback succeeds applyErr is returned unchanged; otherwise the result
+// is a *PartialApplyError describing each target.
+func (m *Manager) rollbackApplied(ctx context.Context, applyErr error, placement serverPlacement, applied, failed, remaining []string) error {
+	backupDir, _ := paths.BackupDir()
+	outcomes := make([]TargetOutcome, 0, len(applied)+len(failed)+len(remaining))
+	incomplete := false
+	for _, target := range applied {
+		adapter := m.adapters[target]
+		// Look the backup up before rolling back: the newest backup is the
+		// pre-install copy written by UpsertServers.
+		var backup string
+		if backupDir != "" {
+			backup, _ = fsutil.LatestBackup(adapter.Path(), backupDir)
+		}
+		if err := adapter.RemoveServers(ctx, keys(placement.servers[target])); err != nil {
+			incomplete = true
+			outcomes = append(outcomes, TargetOutcome{
+				Target: target,
+				State:  TargetRollbackFailed,
+				Err:    err,
+				Backup: backup,
+			})
+			continue
+		}
+		outcomes = append(outcomes, TargetOutcome{Target: target, State: TargetRolledBack})
+	}
+	if !incomplete {
+		return applyErr
+	}
+	for _, target := range failed {
+		outcomes = append(outcomes, TargetOutcome{Target: target, State: TargetApplyFailed})
+	}
+	for _, target := range remaining {
+		outcomes = append(outcomes, TargetOutcome{Target: target, State: TargetNotAttempted})
+	}
+	return &PartialApplyError{Err: applyErr, Outcomes: outcomes}
+}
+
+type RemoveRequest struct {
+	Name        string
+	KeepSecrets bool
+	// Idempotent treats a package that is not installed as already removed
+	// instead of failing with ErrNotInstalled.
+	Idempotent bool
+	// PruneEmpty drops a client's servers key when this removal empties it,
+	// instead of leaving an empty object, for adapters that support it.
+	PruneEmpty bool
+}
+
+// RemoveResult reports what remove did. Removed is false only for an
+// idempotent remove of a package that was not installed.
+type RemoveResult struct {
+	Name    string   `json:"name"`
+	Removed bool     `json:"removed"`
+	Targets []string `json:"targets"`
+}
+
+func (m *Manager) Remove(ctx context.Context, req RemoveRequest) (RemoveResult, error) {
 	st, err := m.store.Load()
 	if err != nil {
-		return err
+		return RemoveResult{}, err
 	}
+	name := req.Name
 	pkg, ok := st.Installed[name]
 	if !ok {
-		return fmt.Errorf("package %q is not installed", name)
+		if req.Idempotent {
+			return RemoveResult{Name: name, Targets: []string{}}, nil
+		}
+		return RemoveResult{}, fmt.Errorf("%w: %q", ErrNotInstalled, name)
 	}
 
 	for _, target := range pkg.Targets {
@@ -238,13 +1143,54 @@ func (m *Manager) Remove(ctx context.Context, name string) error {
 		if !ok {
 			continue
 		}
-		if err := adapter.RemoveServers(ctx, pkg.Servers); err != nil {
-			return fmt.Errorf("remove servers from %s: %w", target, err)
+		warnCommentedConfig(m.stdout, adapter)
+		remove := adapter.RemoveServers
+		if pruner, ok := adapter.(adapters.EmptyPruner); ok && req.PruneEmpty {
+			remove = pruner.RemoveServersPruneEmpty
+		}
+		if err := remove(ctx, serversForTarget(pkg, target)); err != nil {
+			return RemoveResult{}, fmt.Errorf("remove servers from %s: %w", target, err)
 		}
 	}
 
 	delete(st.Installed, name)
-	return m.store.Save(st)
+	if req.KeepSecrets {
+		retainSecrets(&st, name, pkg.SecretKeys...)
+	}
+	if err := m.store.Save(st); err != nil {
+		return RemoveResult{}, err
+	}
+	m.recordHistory(ctx, HistoryEntry{Action: HistoryRemove, Package: name, FromVersion: pkg.Version, Targets: pkg.Targets})
+	if !req.KeepSecrets {
+		m.purgeSecrets(name, pkg.SecretKeys)
+	}
+	return RemoveResult{Name: name, Removed: true, Targets: pkg.Targets}, nil
+}
+
+// warnCommentedConfig tells the user that rewriting a client config holding
+// comments will drop them.
+func warnCommentedConfig(w io.Writer, adapter adapters.Adapter) {
+	if commented, ok := adapter.(adapters.CommentedConfig); ok && commented.HasComments() {
+		fmt.Fprintf(w, "warning: %s has comments, which this write will not keep\n", adapter.Path())
+	}
+}
+
+// purgeSecrets deletes a removed package's keychain entries. The package is
+// already gone from state, so failures are reported rather than returned.
+func (m *Manager) purgeSecrets(pkg string, secretKeys []string) {
+	deleted := 0
+	for _, key := range secretKeys {
+		if err := m.secret.Delete(pkg, key); err != nil {
+			if !errors.Is(err, keyring.ErrNotFound) {
+				fmt.Fprintf(m.stdout, "Warning: %v\n", err)
+			}
+			continue
+		}
+		deleted++
+	}
+	if deleted > 0 {
+		fmt.Fprintf(m.stdout, "Deleted %d secret(s) for %s\n", deleted, pkg)
+	}
 }
 
 func (m *Manager) ListInstalled() ([]model.InstalledPackage, error) {
@@ -252,6 +1198,11 @@ func (m *Manager) ListInstalled() ([]model.InstalledPackage, error) {
 	if err != nil {
 		return nil, err
 	}
+	return installedPackages(st), nil
+}
+
+// installedPackages returns the installed packages sorted by name.
+func installedPackages(st model.State) []model.InstalledPackage {
 	items := make([]model.InstalledPackage, 0, len(st.Installed))
 	for _, pkg := range st.Installed {
 		items = append(items, pkg)
@@ -259,15 +1210,62 @@ func (m *Manager) ListInstalled() ([]model.InstalledPackage, error) {
 	sort.Slice(items, func(i, j int) bool {
 		return items[i].Name < items[j].Name
 	})
-	return items, nil
+	return items
 }
 
-func (m *Manager) Search(ctx context.Context, query string) ([]registry.SearchResult, error) {
+// InstalledServer is one tracked server as it is currently configured in a
+// client.
+type InstalledServer struct {
+	Target  string `json:"target"`
+	Name    string `json:"name"`
+	Summary string `json:"summary,omitempty"`
+	Missing bool   `json:"missing,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// InstalledServers reads pkg's servers back from each target's config. A
+// client that cannot be read is reported per server rather than failing.
+func (m *Manager) InstalledServers(ctx context.Context, pkg model.InstalledPackage) []InstalledServer {
+	var out []InstalledServer
+	for _, target := range pkg.Targets {
+		names := serversForTarget(pkg, target)
+		var configured map[string]model.MCPServerSpec
+		var readErr string
+		if adapter, ok := m.adapters[target]; !ok {
+			readErr = "client not detected"
+		} else if servers, err := adapter.ListServers(ctx); err != nil {
+			readErr = err.Error()
+		} else {
+			configured = servers
+		}
+		for _, name := range names {
+			entry := InstalledServer{Target: target, Name: name, Error: readErr}
+			if readErr == "" {
+				if spec, ok := configured[name]; ok {
+					entry.Summary = specSummary(spec)
+				} else {
+					entry.Missing = true
+				}
+			}
+			out = append(out, entry)
+		}
+	}
+	return out
+}
+
+func (m *Manager) Search(ctx context.Context, query string, dedup bool) ([]registry.SearchResult, error) {
 	st, err := m.store.Load()
 	if err != nil {
 		return nil, err
 	}
-	return m.registry.Search(ctx, st.Taps, query)
+	results, err := m.registry.Search(ctx, st.Taps, query)
+	if err != nil {
+		return nil, err
+	}
+	if dedup {
+		results = registry.DedupResults(results)
+	}
+	return results, nil
 }
 
 func (m *Manager) Info(ctx context.Context, name, tapName string) (model.PackageManifest, error) {
@@ -275,6 +1273,33 @@ func (m *Manager) Info(ctx context.Context, name, tapName string) (model.Package
 	if err != nil {
 		return model.PackageManifest{}, err
 	}
+	tap, err := packageTap(st, name, tapName)
+	if err != nil {
+		return model.PackageManifest{}, err
+	}
+	resolved, err := m.registry.ResolveFromTap(ctx, tap, name, "")
+	if err != nil {
+		return model.PackageManifest{}, err
+	}
+	return resolved.Manifest, nil
+}
+
+// ListVersions returns every version of a package available in its tap.
+func (m *Manager) ListVersions(ctx context.Context, name, tapName string) ([]registry.VersionInfo, error) {
+	st, err := m.store.Load()
+	if err != nil {
+		return nil, err
+	}
+	tap, err := packageTap(st, name, tapName)
+	if err != nil {
+		return nil, err
+	}
+	return m.registry.ListVersions(ctx, tap, name)
+}
+
+// packageTap picks the tap an installed package came from, falling back to
+// tapName and then the default tap.
+func packageTap(st model.State, name, tapName string) (model.TapConfig, error) {
 	if pkg, ok := st.Installed[name]; ok {
 		if pkg.Source.Type == model.SourceTypeTap && pkg.Source.Tap != "" {
 			tapName = pkg.Source.Tap
@@ -285,33 +1310,77 @@ func (m *Manager) Info(ctx context.Context, name, tapName string) (model.Package
 	}
 	tap, ok := st.Taps[tapName]
 	if !ok {
-		return model.PackageManifest{}, fmt.Errorf("tap %q not found", tapName)
-	}
-	resolved, err := m.registry.ResolveFromTap(ctx, tap, name, "")
-	if err != nil {
-		return model.PackageManifest{}, err
+		return model.TapConfig{}, fmt.Errorf("%w: %q", ErrTapNotFound, tapName)
 	}
-	return resolved.Manifest, nil
+	return tap, nil
 }
 
 type UpgradeResult struct {
+	Name         string `json:"name"`
+	OldVersion   string `json:"old_version"`
+	NewVersion   string `json:"new_version"`
+	WasUpgraded  bool   `json:"upgraded"`
+	Changelog    string `json:"changelog,omitempty"`
+	ReleaseNotes string `json:"release_notes,omitempty"`
+	// EarlierNotes holds the release notes of versions skipped over, those
+	// after OldVersion (or the requested SinceVersion) and before
+	// NewVersion, oldest first. Versions without notes are left out.
+	EarlierNotes []VersionNotes `json:"earlier_release_notes,omitempty"`
+	DryRun       bool           `json:"dry_run,omitempty"`
+	// HeldTargets are the package's targets this upgrade left on an older
+	// version, with that version.
+	HeldTargets map[string]string `json:"held_targets,omitempty"`
+	// ServersOnly marks a result of upgrade --servers-only, which re-applied
+	// the installed version's servers without looking for a newer one.
+	ServersOnly bool `json:"servers_only,omitempty"`
+}
+
+// VersionNotes are the release notes published for one version.
+type VersionNotes struct {
+	Version string `json:"version"`
+	Notes   string `json:"notes"`
+}
+
+type UpgradeRequest struct {
 	Name        string
-	OldVersion  string
-	NewVersion  string
-	WasUpgraded bool
+	AllowMajor  bool
+	KeepBackups int
+	// DryRun prints the install plan for each upgrade without touching
+	// client configs or state.
+	DryRun bool
+	// SinceVersion collects release notes from after this version instead
+	// of after the installed one.
+	SinceVersion string
+	// Target limits the upgrade to these of each package's targets,
+	// comma-separated. The rest keep their current config and are recorded
+	// in TargetVersions until a later upgrade reaches them.
+	Target string
+	// ServersOnly re-applies the installed version's servers to the
+	// package's targets instead of upgrading, for when a client lost or
+	// mangled them. The tap is not asked for newer releases.
+	ServersOnly bool
 }
 
-func (m *Manager) Upgrade(ctx context.Context, name string, allowMajor bool) ([]UpgradeResult, error) {
+func (m *Manager) Upgrade(ctx context.Context, req UpgradeRequest) ([]UpgradeResult, error) {
+	if req.ServersOnly && (req.AllowMajor || req.SinceVersion != "") {
+		return nil, errors.New("--servers-only keeps the installed version; it cannot be combined with --major or --since-version")
+	}
+	if req.SinceVersion != "" {
+		if _, err := semver.NewVersion(req.SinceVersion); err != nil {
+			return nil, fmt.Errorf("invalid --since-version %q: %w", req.SinceVersion, err)
+		}
+	}
 	st, err := m.store.Load()
 	if err != nil {
 		return nil, err
 	}
+	name := req.Name
 
 	candidates := make([]model.InstalledPackage, 0, len(st.Installed))
 	if name != "" {
 		pkg, ok := st.Installed[name]
 		if !ok {
-			return nil, fmt.Errorf("package %q is not installed", name)
+			return nil, fmt.Errorf("%w: %q", ErrNotInstalled, name)
 		}
 		candidates = append(candidates, pkg)
 	} else {
@@ -320,30 +1389,152 @@ func (m *Manager) Upgrade(ctx context.Context, name string, allowMajor bool) ([]
 		}
 	}
 
+	var only map[string]bool
+	if strings.TrimSpace(req.Target) != "" {
+		only, err = upgradeTargetFilter(st, req.Target)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	results := make([]UpgradeResult, 0, len(candidates))
+	appliedTargets := make(map[string][]string)
 	for _, pkg := range candidates {
 		if pkg.Source.Type != model.SourceTypeTap || pkg.Source.Tap == "" {
 			results = append(results, UpgradeResult{Name: pkg.Name, OldVersion: pkg.Version, NewVersion: pkg.Version, WasUpgraded: false})
 			continue
 		}
+		selected := pkg.Targets
+		if only != nil {
+			selected = nil
+			for _, target := range pkg.Targets {
+				if only[target] {
+					selected = append(selected, target)
+				}
+			}
+			if len(selected) == 0 {
+				if name != "" {
+					return nil, fmt.Errorf("%s is not installed in %s (its targets: %s)", name, req.Target, strings.Join(pkg.Targets, ","))
+				}
+				continue
+			}
+			if len(selected) < len(pkg.Targets) && len(pkg.ServerTargets) > 0 {
+				return nil, fmt.Errorf("cannot upgrade %s in only some targets: its servers were mapped to targets with --map; upgrade it without --target", pkg.Name)
+			}
+		}
 		tap, ok := st.Taps[pkg.Source.Tap]
 		if !ok {
 			return nil, fmt.Errorf("tap %q used by package %q is no longer configured", pkg.Source.Tap, pkg.Name)
 		}
-		resolved, hasUpgrade, err := m.registry.ResolveUpgrade(ctx, tap, pkg.Name, pkg.Version, allowMajor)
+		if req.ServersOnly {
+			// Targets held back by an earlier upgrade --target stay on
+			// their version.
+			selected = slices.DeleteFunc(slices.Clone(selected), func(target string) bool {
+				_, held := pkg.TargetVersions[target]
+				return held
+			})
+			if len(selected) == 0 {
+				results = append(results, UpgradeResult{Name: pkg.Name, OldVersion: pkg.Version, NewVersion: pkg.Version, WasUpgraded: false})
+				continue
+			}
+			updated, plan, err := m.reinstallPackage(ctx, st, pkg, selected, req.DryRun)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", pkg.Name, err)
+			}
+			result := UpgradeResult{Name: pkg.Name, OldVersion: pkg.Version, NewVersion: pkg.Version, HeldTargets: pkg.TargetVersions, ServersOnly: true}
+			if req.DryRun {
+				fmt.Fprintf(m.stdout, "%s %s -> %s (dry run)\n", pkg.Name, pkg.Version, pkg.Version)
+				FormatInstallPlan(m.stdout, plan)
+				result.DryRun = true
+			} else {
+				st.Installed[pkg.Name] = updated
+				appliedTargets[pkg.Name] = selected
+				result.WasUpgraded = true
+			}
+			results = append(results, result)
+			continue
+		}
+		oldVersion := pkg.Version
+		resolved, hasUpgrade, err := m.registry.ResolveUpgrade(ctx, tap, pkg.Name, pkg.Version, req.AllowMajor)
 		if err != nil {
 			return nil, err
 		}
 		if !hasUpgrade {
-			results = append(results, UpgradeResult{Name: pkg.Name, OldVersion: pkg.Version, NewVersion: pkg.Version, WasUpgraded: false})
+			// Targets held back by an earlier upgrade --target catch up to
+			// the recorded version.
+			var held []string
+			for _, target := range selected {
+				if _, ok := pkg.TargetVersions[target]; ok {
+					held = append(held, target)
+				}
+			}
+			if len(held) == 0 {
+				results = append(results, UpgradeResult{Name: pkg.Name, OldVersion: pkg.Version, NewVersion: pkg.Version, WasUpgraded: false})
+				continue
+			}
+			if resolved, err = m.resolveInstalled(ctx, st, pkg); err != nil {
+				return nil, err
+			}
+			selected = held
+			oldVersion = pkg.TargetVersions[held[0]]
+		}
+		heldBack := make(map[string]string)
+		for _, target := range pkg.Targets {
+			if slices.Contains(selected, target) {
+				continue
+			}
+			current := pkg.Version
+			if v, ok := pkg.TargetVersions[target]; ok {
+				current = v
+			}
+			if current != resolved.Version {
+				heldBack[target] = current
+			}
+		}
+		if len(heldBack) == 0 {
+			heldBack = nil
+		}
+
+		resolved.Manifest = withServerPrefix(resolved.Manifest, pkg.ServerPrefix)
+		since := oldVersion
+		if req.SinceVersion != "" {
+			since = req.SinceVersion
+		}
+		earlier := notesBetween(resolved.Manifest.ReleaseNotes, since, resolved.Version)
+		if req.DryRun {
+			preview := pkg
+			preview.Version = oldVersion
+			preview.Targets = selected
+			if err := m.previewUpgrade(ctx, preview, resolved.Manifest); err != nil {
+				return nil, err
+			}
+			results = append(results, UpgradeResult{
+				Name:         pkg.Name,
+				OldVersion:   oldVersion,
+				NewVersion:   resolved.Version,
+				Changelog:    resolved.Manifest.Changelog,
+				ReleaseNotes: resolved.Manifest.ReleaseNotes[resolved.Version],
+				EarlierNotes: earlier,
+				DryRun:       true,
+				HeldTargets:  heldBack,
+			})
 			continue
 		}
 
-		oldVersion := pkg.Version
-		if _, err := m.applyInstall(ctx, st, resolved.Manifest, resolved.ManifestDigest, model.SourceRef{
-			Type: model.SourceTypeTap,
-			Tap:  tap.Name,
-		}, strings.Join(pkg.Targets, ","), true); err != nil {
+		// A new version comes from the tap, replacing any local manifest
+		// install --manifest-path recorded.
+		source := pkg.Source
+		if hasUpgrade {
+			source = model.SourceRef{Type: model.SourceTypeTap, Tap: tap.Name}
+		}
+		applied, err := m.applyInstall(ctx, st, resolved.Manifest, resolved.ManifestDigest, source, installOptions{
+			target:        m.upgradeTarget(pkg, resolved.Manifest, selected),
+			serverTargets: recordedServerTargets(pkg, resolved.Manifest),
+			force:         true,
+			inlineSecrets: pkg.InlinedEnv != nil,
+			envOverrides:  recordedEnvOverrides(pkg, resolved.Manifest),
+		})
+		if err != nil {
 			return nil, err
 		}
 
@@ -351,120 +1542,499 @@ func (m *Manager) Upgrade(ctx context.Context, name string, allowMajor bool) ([]
 		pkg.Version = resolved.Version
 		pkg.Description = resolved.Manifest.Description
 		pkg.ManifestDigest = resolved.ManifestDigest
-		pkg.Servers = keys(resolved.Manifest.MCPServers)
+		pkg.Source = source
+		servers := keys(resolved.Manifest.MCPServers)
+		if heldBack != nil {
+			// Held targets still have the old servers, so remove must know
+			// about both versions' names.
+			for _, server := range pkg.Servers {
+				if !slices.Contains(servers, server) {
+					servers = append(servers, server)
+				}
+			}
+			sort.Strings(servers)
+		}
+		pkg.Servers = servers
+		if len(selected) == len(pkg.Targets) {
+			pkg.Targets = applied.Targets
+			pkg.TargetPaths = applied.TargetPaths
+		} else {
+			pkg.TargetPaths = maps.Clone(pkg.TargetPaths)
+			if pkg.TargetPaths == nil {
+				pkg.TargetPaths = make(map[string]string)
+			}
+			maps.Copy(pkg.TargetPaths, applied.TargetPaths)
+		}
+		pkg.TargetVersions = heldBack
+		pkg.ServerTargets = applied.ServerTargets
+		pkg.InlinedEnv = applied.InlinedEnv
+		pkg.EnvOverrides = applied.EnvOverrides
+		pkg.SecretKeys = applied.SecretKeys
+		pkg.Unverified = resolved.Unverified
 		pkg.UpdatedAt = now
 		st.Installed[pkg.Name] = pkg
-		results = append(results, UpgradeResult{Name: pkg.Name, OldVersion: oldVersion, NewVersion: resolved.Version, WasUpgraded: true})
+		appliedTargets[pkg.Name] = applied.Targets
+		results = append(results, UpgradeResult{
+			Name:         pkg.Name,
+			OldVersion:   oldVersion,
+			NewVersion:   resolved.Version,
+			WasUpgraded:  true,
+			Changelog:    resolved.Manifest.Changelog,
+			ReleaseNotes: resolved.Manifest.ReleaseNotes[resolved.Version],
+			EarlierNotes: earlier,
+			HeldTargets:  heldBack,
+		})
+	}
+	if req.DryRun {
+		return results, nil
+	}
+
+	if err := m.store.Save(st); err != nil {
+		return nil, err
+	}
+	for _, r := range results {
+		if r.WasUpgraded {
+			action := HistoryUpgrade
+			if r.ServersOnly {
+				action = HistoryReinstall
+			}
+			m.recordHistory(ctx, HistoryEntry{Action: action, Package: r.Name, FromVersion: r.OldVersion, ToVersion: r.NewVersion, Targets: appliedTargets[r.Name]})
+		}
+	}
+	for _, r := range results {
+		if r.WasUpgraded {
+			m.pruneBackups(req.KeepBackups)
+			break
+		}
+	}
+	return results, nil
+}
+
+// upgradeTargetFilter turns upgrade --target into a set of client names,
+// expanding aliases. Clients need not be detected: a package may be
+// recorded in a client whose config was since moved.
+func upgradeTargetFilter(st model.State, target string) (map[string]bool, error) {
+	aliases := targetAliases(st.Settings)
+	known := adapters.ClientLabels()
+	only := make(map[string]bool)
+	for _, name := range expandTargetAliases(target, aliases) {
+		if name == model.TargetAll {
+			return nil, nil
+		}
+		if _, ok := known[name]; !ok {
+			return nil, unknownTargetError(name, aliases)
+		}
+		only[name] = true
+	}
+	if len(only) == 0 {
+		return nil, errors.New("no valid targets specified")
+	}
+	return only, nil
+}
+
+// notesBetween returns the notes for versions strictly between from and to,
+// oldest first. Keys that are not versions, and a from or to that is not one,
+// yield nothing rather than an error, since notes are informational.
+func notesBetween(notes map[string]string, from, to string) []VersionNotes {
+	lower, err := semver.NewVersion(from)
+	if err != nil {
+		return nil
+	}
+	upper, err := semver.NewVersion(to)
+	if err != nil {
+		return nil
+	}
+	type entry struct {
+		v     *semver.Version
+		notes VersionNotes
+	}
+	var found []entry
+	for raw, text := range notes {
+		v, err := semver.NewVersion(raw)
+		if err != nil || strings.TrimSpace(text) == "" {
+			continue
+		}
+		if v.GreaterThan(lower) && v.LessThan(upper) {
+			found = append(found, entry{v: v, notes: VersionNotes{Version: raw, Notes: text}})
+		}
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].v.LessThan(found[j].v) })
+	out := make([]VersionNotes, 0, len(found))
+	for _, e := range found {
+		out = append(out, e.notes)
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
+// previewUpgrade prints the install plan an upgrade of pkg to manifest would
+// apply to its current targets.
+func (m *Manager) previewUpgrade(ctx context.Context, pkg model.InstalledPackage, manifest model.PackageManifest) error {
+	placement, err := m.placeServers(expandHostEnv(manifest.MCPServers), strings.Join(pkg.Targets, ","), recordedServerTargets(pkg, manifest), targetScope{})
+	if err != nil {
+		return err
+	}
+	plan, err := m.buildPlacementPlan(ctx, placement)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(m.stdout, "%s %s -> %s (dry run)\n", pkg.Name, pkg.Version, manifest.Version)
+	FormatInstallPlan(m.stdout, plan)
+	return nil
+}
+
+type DoctorIssue struct {
+	Package string `json:"package"`
+	Target  string `json:"target"`
+	Kind    string `json:"kind"`
+	Detail  string `json:"detail"`
+}
+
+// FixAction is one change doctor --fix made to a client config.
+type FixAction struct {
+	Package string `json:"package"`
+	Target  string `json:"target"`
+	Action  string `json:"action"`
+	Detail  string `json:"detail"`
+}
+
+// DoctorResult is everything a doctor run found and, with Fix, changed.
+type DoctorResult struct {
+	Issues []DoctorIssue
+	Fixed  []FixAction
+}
+
+// DoctorReport wraps doctor issues for JSON output so metadata can be added
+// without breaking consumers.
+type DoctorReport struct {
+	OK         bool          `json:"ok"`
+	IssueCount int           `json:"issue_count"`
+	Issues     []DoctorIssue `json:"issues"`
+	Fixed      []FixAction   `json:"fixed,omitempty"`
+}
+
+func NewDoctorReport(issues []DoctorIssue) DoctorReport {
+	if issues == nil {
+		issues = []DoctorIssue{}
+	}
+	return DoctorReport{OK: len(issues) == 0, IssueCount: len(issues), Issues: issues}
+}
+
+type DoctorRequest struct {
+	Fix                  bool
+	CheckCommandVersions bool
+	// KeyringOnly reports required env vars that are only satisfied by the
+	// host environment rather than the keychain.
+	KeyringOnly bool
+	// Package limits the checks to one installed package.
+	Package string
+	// ManifestPath, which requires Package, checks against a local manifest
+	// instead of the one resolved from the package's source.
+	ManifestPath string
+	// Probe sends a HEAD request to each http server's URL and reports
+	// those that cannot be reached. It is off by default so doctor makes no
+	// network calls unless asked.
+	Probe bool
+}
+
+func (m *Manager) Doctor(ctx context.Context, req DoctorRequest) ([]DoctorIssue, error) {
+	result, err := m.RunDoctor(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return result.Issues, nil
+}
+
+// RunDoctor is Doctor that also reports the fixes applied with req.Fix.
+func (m *Manager) RunDoctor(ctx context.Context, req DoctorRequest) (DoctorResult, error) {
+	if req.ManifestPath != "" && req.Package == "" {
+		return DoctorResult{}, errors.New("manifest override requires a package")
+	}
+	st, err := m.store.Load()
+	if err != nil {
+		return DoctorResult{}, err
+	}
+	if req.Package != "" {
+		if _, ok := st.Installed[req.Package]; !ok {
+			return DoctorResult{}, fmt.Errorf("%w: %q", ErrNotInstalled, req.Package)
+		}
+	}
+
+	pkgs := make([]model.InstalledPackage, 0, len(st.Installed))
+	for _, pkg := range st.Installed {
+		if req.Package == "" || pkg.Name == req.Package {
+			pkgs = append(pkgs, pkg)
+		}
+	}
+	sort.Slice(pkgs, func(i, j int) bool { return pkgs[i].Name < pkgs[j].Name })
+
+	// Packages are checked in parallel, except with --fix: packages sharing
+	// a client would otherwise race on writing its config.
+	limit := m.concurrency
+	if req.Fix {
+		limit = 1
+	}
+	var taps map[string]syncedTap
+	if req.ManifestPath == "" {
+		taps = m.syncPackageTaps(ctx, st, pkgs)
+	}
+	perPackage := make([]DoctorResult, len(pkgs))
+	parallel.Run(len(pkgs), limit, false, func(i int) error {
+		perPackage[i] = m.doctorPackage(ctx, st, pkgs[i], req, taps)
+		return nil
+	})
+	result := DoctorResult{Issues: make([]DoctorIssue, 0)}
+	for _, r := range append(perPackage, m.doctorConfigPermissions(ctx, pkgs, req)) {
+		result.Issues = append(result.Issues, r.Issues...)
+		result.Fixed = append(result.Fixed, r.Fixed...)
 	}
+	return result, nil
+}
 
-	if err := m.store.Save(st); err != nil {
-		return nil, err
+// syncedTap is a tap synced once for a doctor run, or why it could not be.
+type syncedTap struct {
+	snap registry.TapSnapshot
+	err  error
+}
+
+func (t syncedTap) resolve(ctx context.Context, reg RegistryClient, pkg model.InstalledPackage) (model.PackageManifest, error) {
+	if t.err != nil {
+		return model.PackageManifest{}, t.err
 	}
-	return results, nil
+	resolved, err := reg.ResolveInSnapshot(ctx, t.snap, pkg.Name, pkg.Version)
+	if err != nil {
+		return model.PackageManifest{}, err
+	}
+	return resolved.Manifest, nil
 }
 
-type DoctorIssue struct {
-	Package string `json:"package"`
-	Target  string `json:"target"`
-	Kind    string `json:"kind"`
-	Detail  string `json:"detail"`
+// syncPackageTaps syncs every tap that pkgs were installed from, one at a
+// time, before doctor checks packages in parallel. Each tap is pulled once,
+// so no check reads a cache that another is pulling or re-cloning.
+func (m *Manager) syncPackageTaps(ctx context.Context, st model.State, pkgs []model.InstalledPackage) map[string]syncedTap {
+	taps := make(map[string]syncedTap)
+	for _, pkg := range pkgs {
+		if pkg.Source.Type != model.SourceTypeTap {
+			continue
+		}
+		if _, done := taps[pkg.Source.Tap]; done {
+			continue
+		}
+		tap, ok := st.Taps[pkg.Source.Tap]
+		if !ok {
+			// resolveInstalled reports the missing tap.
+			continue
+		}
+		snap, err := m.registry.SyncTap(ctx, tap)
+		taps[pkg.Source.Tap] = syncedTap{snap: snap, err: err}
+	}
+	return taps
 }
 
-func (m *Manager) Doctor(ctx context.Context, fix bool) ([]DoctorIssue, error) {
-	st, err := m.store.Load()
+// doctorPackage checks one installed package against every target it was
+// installed to.
+func (m *Manager) doctorPackage(ctx context.Context, st model.State, pkg model.InstalledPackage, req DoctorRequest, taps map[string]syncedTap) DoctorResult {
+	var issues []DoctorIssue
+	var fixed []FixAction
+	var manifest model.PackageManifest
+	var err error
+	if req.ManifestPath != "" {
+		manifest, err = m.loadDoctorManifest(ctx, req.ManifestPath, pkg.Name)
+	} else if pkg.Source.Type == model.SourceTypeUnknown {
+		return m.doctorRecovered(ctx, pkg)
+	} else if synced, ok := taps[pkg.Source.Tap]; ok && pkg.Source.Type == model.SourceTypeTap && pkg.Source.ManifestPath == "" {
+		manifest, err = synced.resolve(ctx, m.registry, pkg)
+	} else {
+		manifest, err = m.resolveManifestForInstalled(ctx, st, pkg)
+	}
 	if err != nil {
-		return nil, err
+		return DoctorResult{Issues: []DoctorIssue{{Package: pkg.Name, Kind: "manifest", Detail: err.Error()}}}
+	}
+	manifest = withServerPrefix(manifest, pkg.ServerPrefix)
+	for _, tool := range missingTools(manifest) {
+		issues = append(issues, DoctorIssue{Package: pkg.Name, Kind: "missing_tool", Detail: fmt.Sprintf("%s (required by the manifest; install it and make sure it is on PATH)", tool)})
 	}
 
-	issues := make([]DoctorIssue, 0)
-	for _, pkg := range st.Installed {
-		manifest, err := m.resolveManifestForInstalled(ctx, st, pkg)
+	// What install would write, to compare against and re-apply.
+	wanted, _ := withEnvOverrides(expandHostEnv(manifest.MCPServers), recordedEnvOverrides(pkg, manifest))
+	for _, target := range pkg.Targets {
+		if _, held := pkg.TargetVersions[target]; held {
+			// Kept on an older version by upgrade --target; this manifest
+			// does not describe it.
+			continue
+		}
+		adapter, ok := m.adapters[target]
+		if !ok {
+			issues = append(issues, DoctorIssue{Package: pkg.Name, Target: target, Kind: "adapter", Detail: "client not detected"})
+			continue
+		}
+		servers, err := adapter.ListServers(ctx)
 		if err != nil {
-			issues = append(issues, DoctorIssue{Package: pkg.Name, Kind: "manifest", Detail: err.Error()})
+			issues = append(issues, DoctorIssue{Package: pkg.Name, Target: target, Kind: "adapter", Detail: err.Error()})
 			continue
 		}
-
-		for _, target := range pkg.Targets {
-			adapter := m.adapters[target]
-			servers, err := adapter.ListServers(ctx)
-			if err != nil {
-				issues = append(issues, DoctorIssue{Package: pkg.Name, Target: target, Kind: "adapter", Detail: err.Error()})
+		missing := make(map[string]model.MCPServerSpec)
+		drifted := make(map[string]model.MCPServerSpec)
+		for serverName, expected := range manifest.MCPServers {
+			if mapped, ok := pkg.ServerTargets[serverName]; ok && !slices.Contains(mapped, target) {
 				continue
 			}
-			missing := make(map[string]model.MCPServerSpec)
-			for serverName, expected := range manifest.MCPServers {
-				actual, ok := servers[serverName]
-				if !ok {
-					issues = append(issues, DoctorIssue{Package: pkg.Name, Target: target, Kind: "missing_server", Detail: serverName})
-					missing[serverName] = expected
-					continue
+			label := serverLabel(serverName, expected)
+			actual, ok := servers[serverName]
+			if !ok {
+				issues = append(issues, DoctorIssue{Package: pkg.Name, Target: target, Kind: "missing_server", Detail: label})
+				missing[serverName] = wanted[serverName]
+				continue
+			}
+			// Env is left out: it holds inlined secrets and user additions.
+			if canonicalKey(actual) != canonicalKey(wanted[serverName]) {
+				issues = append(issues, DoctorIssue{Package: pkg.Name, Target: target, Kind: "drifted_server", Detail: fmt.Sprintf("%s (%s, expected %s)", label, specSummary(actual), specSummary(wanted[serverName]))})
+				fix := wanted[serverName]
+				fix.Env = actual.Env
+				drifted[serverName] = fix
+			} else if expected.Transport == model.ServerTransportHTTP {
+				if req.Probe {
+					if err := probeServer(ctx, actual.URL); err != nil {
+						issues = append(issues, DoctorIssue{Package: pkg.Name, Target: target, Kind: "server_unreachable", Detail: fmt.Sprintf("%s (%v)", label, err)})
+					}
 				}
-				if expected.Transport == model.ServerTransportSTDIO {
-					if _, err := exec.LookPath(actual.Command); err != nil {
-						issues = append(issues, DoctorIssue{Package: pkg.Name, Target: target, Kind: "missing_command", Detail: fmt.Sprintf("%s (%s)", serverName, actual.Command)})
+			} else if expected.Transport == model.ServerTransportSTDIO {
+				if _, err := exec.LookPath(actual.Command); err != nil {
+					issues = append(issues, DoctorIssue{Package: pkg.Name, Target: target, Kind: "missing_command", Detail: fmt.Sprintf("%s (%s)", label, actual.Command)})
+				} else if req.CheckCommandVersions && expected.MinCommandVersion != "" {
+					if detail, outdated := checkCommandVersion(ctx, actual.Command, expected.MinCommandVersion); outdated {
+						issues = append(issues, DoctorIssue{Package: pkg.Name, Target: target, Kind: "outdated_command", Detail: fmt.Sprintf("%s (%s)", label, detail)})
 					}
 				}
-				for _, env := range expected.EnvRequired {
-					if _, err := m.secret.Get(pkg.Name, env); err != nil {
-						if errors.Is(err, keyring.ErrNotFound) {
-							issues = append(issues, DoctorIssue{Package: pkg.Name, Target: target, Kind: "missing_secret", Detail: fmt.Sprintf("%s:%s", serverName, env)})
+			}
+			for _, env := range expected.EnvRequired {
+				if _, err := m.secret.Get(pkg.Name, env); err != nil {
+					if errors.Is(err, keyring.ErrNotFound) {
+						detail := fmt.Sprintf("%s:%s", label, env)
+						switch {
+						case os.Getenv(env) == "":
+							issues = append(issues, DoctorIssue{Package: pkg.Name, Target: target, Kind: "missing_secret", Detail: detail})
+						case req.KeyringOnly:
+							issues = append(issues, DoctorIssue{Package: pkg.Name, Target: target, Kind: "secret_in_env_only", Detail: detail})
 						}
 					}
 				}
 			}
-			if fix && len(missing) > 0 {
-				if err := adapter.UpsertServers(ctx, missing); err != nil {
-					issues = append(issues, DoctorIssue{Package: pkg.Name, Target: target, Kind: "fix_failed", Detail: err.Error()})
+		}
+		if req.Fix && len(missing)+len(drifted) > 0 {
+			upsert := make(map[string]model.MCPServerSpec, len(missing)+len(drifted))
+			maps.Copy(upsert, missing)
+			maps.Copy(upsert, drifted)
+			if err := adapter.UpsertServers(ctx, upsert); err != nil {
+				issues = append(issues, DoctorIssue{Package: pkg.Name, Target: target, Kind: "fix_failed", Detail: err.Error()})
+				continue
+			}
+			for _, serverName := range keys(upsert) {
+				action := "added_server"
+				if _, ok := drifted[serverName]; ok {
+					action = "reapplied_server"
 				}
+				fixed = append(fixed, FixAction{Package: pkg.Name, Target: target, Action: action, Detail: serverLabel(serverName, upsert[serverName])})
+			}
+		}
+	}
+	return DoctorResult{Issues: issues, Fixed: fixed}
+}
+
+// doctorRecovered checks a package rebuilt by repair. With no manifest to
+// compare against, it can only confirm each recorded server is still there.
+func (m *Manager) doctorRecovered(ctx context.Context, pkg model.InstalledPackage) DoctorResult {
+	var issues []DoctorIssue
+	for _, target := range pkg.Targets {
+		adapter, ok := m.adapters[target]
+		if !ok {
+			issues = append(issues, DoctorIssue{Package: pkg.Name, Target: target, Kind: "adapter", Detail: "client not detected"})
+			continue
+		}
+		servers, err := adapter.ListServers(ctx)
+		if err != nil {
+			issues = append(issues, DoctorIssue{Package: pkg.Name, Target: target, Kind: "adapter", Detail: err.Error()})
+			continue
+		}
+		for _, name := range serversForTarget(pkg, target) {
+			if _, ok := servers[name]; !ok {
+				issues = append(issues, DoctorIssue{Package: pkg.Name, Target: target, Kind: "missing_server", Detail: name})
 			}
 		}
 	}
+	return DoctorResult{Issues: issues}
+}
+
+// serverLabel names a server in doctor details, adding its description when
+// the manifest provides one.
+func serverLabel(name string, spec model.MCPServerSpec) string {
+	if spec.Description == "" {
+		return name
+	}
+	return fmt.Sprintf("%s [%s]", name, spec.Description)
+}
 
-	return issues, nil
+// loadDoctorManifest reads and validates a local manifest override, which
+// must describe the package being checked.
+func (m *Manager) loadDoctorManifest(ctx context.Context, path, name string) (model.PackageManifest, error) {
+	resolved, err := m.registry.ResolveFromURL(ctx, path)
+	if err != nil {
+		return model.PackageManifest{}, err
+	}
+	if resolved.Manifest.Name != name {
+		return model.PackageManifest{}, fmt.Errorf("manifest %s is for %q, not %q", path, resolved.Manifest.Name, name)
+	}
+	return resolved.Manifest, nil
 }
 
 func (m *Manager) resolveManifestForInstalled(ctx context.Context, st model.State, pkg model.InstalledPackage) (model.PackageManifest, error) {
+	resolved, err := m.resolveInstalled(ctx, st, pkg)
+	if err != nil {
+		return model.PackageManifest{}, err
+	}
+	return resolved.Manifest, nil
+}
+
+// resolveInstalled fetches the installed version of pkg from its recorded
+// source.
+func (m *Manager) resolveInstalled(ctx context.Context, st model.State, pkg model.InstalledPackage) (registry.ResolvedPackage, error) {
 	switch pkg.Source.Type {
 	case model.SourceTypeTap:
 		tap, ok := st.Taps[pkg.Source.Tap]
 		if !ok {
-			return model.PackageManifest{}, fmt.Errorf("tap %q not configured", pkg.Source.Tap)
+			return registry.ResolvedPackage{}, fmt.Errorf("tap %q not configured", pkg.Source.Tap)
 		}
-		resolved, err := m.registry.ResolveFromTap(ctx, tap, pkg.Name, pkg.Version)
-		if err != nil {
-			return model.PackageManifest{}, err
+		if pkg.Source.ManifestPath != "" {
+			return m.resolveOverrideFile(ctx, tap, pkg.Name, pkg.Source.ManifestPath)
 		}
-		return resolved.Manifest, nil
+		return m.registry.ResolveFromTap(ctx, tap, pkg.Name, pkg.Version)
 	case model.SourceTypeDirect:
-		resolved, err := m.registry.ResolveFromURL(ctx, pkg.Source.URL)
-		if err != nil {
-			return model.PackageManifest{}, err
+		if path, key, ok := splitBundleSource(pkg.Source.URL); ok {
+			return resolveFromBundle(path, key)
 		}
-		return resolved.Manifest, nil
+		return m.registry.ResolveFromURL(ctx, pkg.Source.URL)
+	case model.SourceTypeUnknown:
+		return registry.ResolvedPackage{}, fmt.Errorf("%s was rebuilt by repair and has no known source; reinstall it to restore one", pkg.Name)
 	default:
-		return model.PackageManifest{}, fmt.Errorf("unknown source type %q", pkg.Source.Type)
+		return registry.ResolvedPackage{}, fmt.Errorf("unknown source type %q", pkg.Source.Type)
 	}
 }
 
-func (m *Manager) Export(format string) ([]byte, error) {
+func (m *Manager) Export(ctx context.Context, format string) ([]byte, error) {
 	st, err := m.store.Load()
 	if err != nil {
 		return nil, err
 	}
-	pkgs := make([]model.InstalledPackage, 0, len(st.Installed))
-	for _, pkg := range st.Installed {
-		pkgs = append(pkgs, pkg)
-	}
-	sort.Slice(pkgs, func(i, j int) bool {
-		return pkgs[i].Name < pkgs[j].Name
-	})
+	pkgs := installedPackages(st)
 
 	switch format {
 	case "lock":
 		lock := model.Lockfile{
 			SchemaVersion: 1,
 			GeneratedAt:   time.Now().UTC(),
-			Packages:      pkgs,
+			Packages:      withRedactedEnvOverrides(pkgs),
 		}
 		return json.MarshalIndent(lock, "", "  ")
 	case "sbom":
@@ -474,15 +2044,115 @@ func (m *Manager) Export(format string) ([]byte, error) {
 		}
 		sbom := model.SBOM{SchemaVersion: 1, GeneratedAt: time.Now().UTC(), Components: items}
 		return json.MarshalIndent(sbom, "", "  ")
+	case "bundle":
+		bundle, err := m.exportBundle(ctx, st, pkgs)
+		if err != nil {
+			return nil, err
+		}
+		return json.MarshalIndent(bundle, "", "  ")
+	case "env":
+		return m.exportEnv(ctx, st, pkgs)
 	default:
 		return nil, fmt.Errorf("unsupported export format %q", format)
 	}
 }
 
+// withRedactedEnvOverrides returns pkgs with every install --env value
+// replaced by Redacted. A lockfile is meant to be shared, and override
+// values are often credentials; the keys still show what was overridden.
+func withRedactedEnvOverrides(pkgs []model.InstalledPackage) []model.InstalledPackage {
+	out := make([]model.InstalledPackage, len(pkgs))
+	for i, pkg := range pkgs {
+		if len(pkg.EnvOverrides) > 0 {
+			redacted := make(map[string]map[string]string, len(pkg.EnvOverrides))
+			for server, env := range pkg.EnvOverrides {
+				redacted[server] = make(map[string]string, len(env))
+				for key := range env {
+					redacted[server][key] = Redacted
+				}
+			}
+			pkg.EnvOverrides = redacted
+		}
+		out[i] = pkg
+	}
+	return out
+}
+
+// ExportToFile writes the export payload to path and returns the path that
+// was written. When path is an existing directory the payload is written to
+// the default file name for the format inside it.
+func (m *Manager) ExportToFile(ctx context.Context, format, path string) (string, error) {
+	payload, err := m.Export(ctx, format)
+	if err != nil {
+		return "", err
+	}
+	if fi, err := os.Stat(path); err == nil && fi.IsDir() {
+		path = filepath.Join(path, exportFileName(format))
+	}
+	if err := fsutil.AtomicWriteFile(path, append(payload, '\n'), 0o644); err != nil {
+		return "", fmt.Errorf("write export: %w", err)
+	}
+	return path, nil
+}
+
+func exportFileName(format string) string {
+	switch format {
+	case "sbom":
+		return "mcper-sbom.json"
+	case "env":
+		return "mcper.env"
+	default:
+		return "mcper-" + format + ".json"
+	}
+}
+
+// exportEnv writes an empty assignment for every env var the installed
+// packages' manifests require, grouped under a comment per package. Values
+// are never written, stored secrets included.
+func (m *Manager) exportEnv(ctx context.Context, st model.State, pkgs []model.InstalledPackage) ([]byte, error) {
+	var b strings.Builder
+	b.WriteString("# Env vars required by installed mcper packages. Fill in values locally;\n")
+	b.WriteString("# do not commit this file once it holds secrets.\n")
+	for _, pkg := range pkgs {
+		manifest, err := m.resolveManifestForInstalled(ctx, st, pkg)
+		if err != nil {
+			return nil, fmt.Errorf("resolve %s: %w", pkg.Name, err)
+		}
+		seen := make(map[string]bool)
+		var required []string
+		for _, spec := range manifest.MCPServers {
+			for _, key := range spec.EnvRequired {
+				if !seen[key] {
+					seen[key] = true
+					required = append(required, key)
+				}
+			}
+		}
+		if len(required) == 0 {
+			continue
+		}
+		sort.Strings(required)
+		fmt.Fprintf(&b, "\n# %s@%s\n", pkg.Name, pkg.Version)
+		for _, key := range required {
+			fmt.Fprintf(&b, "%s=\n", key)
+		}
+	}
+	return []byte(strings.TrimSuffix(b.String(), "\n")), nil
+}
+
 type TapAddRequest struct {
 	Name        string
 	URL         string
 	Description string
+	// CloneDepth overrides the default shallow clone; 0 clones full history.
+	CloneDepth *int
+	GitArgs    []string
+	// Subdir locates the index and manifest paths below the repository root.
+	Subdir string
+	// IndexFile names the index within Subdir; empty means index.json.
+	IndexFile string
+	// Submodules checks out git submodules after each clone and pull.
+	Submodules bool
 }
 
 func (m *Manager) TapAdd(req TapAddRequest) error {
@@ -496,6 +2166,23 @@ func (m *Manager) TapAdd(req TapAddRequest) error {
 	if req.URL == "" {
 		return errors.New("tap url is required")
 	}
+	if req.CloneDepth != nil && *req.CloneDepth < 0 {
+		return errors.New("clone depth must be 0 (full history) or positive")
+	}
+	subdir := filepath.Clean(strings.TrimSpace(req.Subdir))
+	if subdir == "." {
+		subdir = ""
+	}
+	if subdir != "" && !filepath.IsLocal(subdir) {
+		return fmt.Errorf("tap subdir %q must be a relative path inside the repository", req.Subdir)
+	}
+	indexFile := filepath.Clean(strings.TrimSpace(req.IndexFile))
+	if indexFile == "." || indexFile == model.DefaultIndexFile {
+		indexFile = ""
+	}
+	if indexFile != "" && !filepath.IsLocal(indexFile) {
+		return fmt.Errorf("tap index file %q must be a relative path inside the tap", req.IndexFile)
+	}
 	trust := model.TapTrustConfig{Mode: model.TrustModeHash}
 
 	now := time.Now().UTC()
@@ -504,13 +2191,20 @@ func (m *Manager) TapAdd(req TapAddRequest) error {
 		URL:         req.URL,
 		Description: req.Description,
 		Trust:       trust,
+		CloneDepth:  req.CloneDepth,
+		GitArgs:     req.GitArgs,
+		Subdir:      subdir,
+		IndexFile:   indexFile,
+		Submodules:  req.Submodules,
 		CreatedAt:   now,
 		UpdatedAt:   now,
 	}
 	return m.store.Save(st)
 }
 
-func (m *Manager) TapRemove(name string) error {
+// TapRemove deletes a configured tap. Unless force is set, removal is refused
+// while installed packages are still sourced from the tap.
+func (m *Manager) TapRemove(name string, force bool) error {
 	if name == model.DefaultTapName {
 		return errors.New("cannot remove default tap")
 	}
@@ -519,12 +2213,38 @@ func (m *Manager) TapRemove(name string) error {
 		return err
 	}
 	if _, ok := st.Taps[name]; !ok {
-		return fmt.Errorf("tap %q not found", name)
+		return fmt.Errorf("%w: %q", ErrTapNotFound, name)
+	}
+	if dependents := tapDependents(st, name); len(dependents) > 0 && !force {
+		return fmt.Errorf("tap %q is used by installed package(s) %s; remove them first or use --force", name, strings.Join(dependents, ", "))
 	}
 	delete(st.Taps, name)
 	return m.store.Save(st)
 }
 
+// TapDependents returns the names of installed packages sourced from the tap.
+func (m *Manager) TapDependents(name string) ([]string, error) {
+	st, err := m.store.Load()
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := st.Taps[name]; !ok {
+		return nil, fmt.Errorf("%w: %q", ErrTapNotFound, name)
+	}
+	return tapDependents(st, name), nil
+}
+
+func tapDependents(st model.State, tap string) []string {
+	out := make([]string, 0)
+	for _, pkg := range st.Installed {
+		if pkg.Source.Type == model.SourceTypeTap && pkg.Source.Tap == tap {
+			out = append(out, pkg.Name)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
 func (m *Manager) TapList() ([]model.TapConfig, error) {
 	st, err := m.store.Load()
 	if err != nil {
@@ -538,6 +2258,72 @@ func (m *Manager) TapList() ([]model.TapConfig, error) {
 	return items, nil
 }
 
+// TapVerify checks a configured tap's index and the latest version of every
+// package it lists, without installing anything.
+func (m *Manager) TapVerify(ctx context.Context, name string) ([]registry.TapCheck, error) {
+	st, err := m.store.Load()
+	if err != nil {
+		return nil, err
+	}
+	tap, ok := st.Taps[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrTapNotFound, name)
+	}
+	return m.registry.VerifyTap(ctx, tap)
+}
+
+// TrustList returns the approved direct sources sorted by URL.
+func (m *Manager) TrustList() ([]model.TrustDecision, error) {
+	st, err := m.store.Load()
+	if err != nil {
+		return nil, err
+	}
+	items := make([]model.TrustDecision, 0, len(st.TrustedDirectSources))
+	for _, decision := range st.TrustedDirectSources {
+		if decision.Approved {
+			items = append(items, decision)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].URL < items[j].URL })
+	return items, nil
+}
+
+// TrustAdd pre-approves a direct source so later install-url runs, including
+// non-interactive ones, proceed without --yes.
+func (m *Manager) TrustAdd(url string) error {
+	url = strings.TrimSpace(url)
+	if url == "" {
+		return errors.New("url is required")
+	}
+	st, err := m.store.Load()
+	if err != nil {
+		return err
+	}
+	if st.TrustedDirectSources[url].Approved {
+		return nil
+	}
+	st.TrustedDirectSources[url] = model.TrustDecision{
+		URL:       url,
+		Approved:  true,
+		CreatedAt: time.Now().UTC(),
+	}
+	return m.store.Save(st)
+}
+
+// TrustRevoke forgets the trust decision for a direct source so the next
+// install-url from it prompts again.
+func (m *Manager) TrustRevoke(url string) error {
+	st, err := m.store.Load()
+	if err != nil {
+		return err
+	}
+	if _, ok := st.TrustedDirectSources[url]; !ok {
+		return fmt.Errorf("%w for %q", ErrTrustNotFound, url)
+	}
+	delete(st.TrustedDirectSources, url)
+	return m.store.Save(st)
+}
+
 func (m *Manager) SecretSet(pkg, key, value string) error {
 	if pkg == "" || key == "" {
 		return errors.New("package and key are required")
@@ -545,40 +2331,91 @@ func (m *Manager) SecretSet(pkg, key, value string) error {
 	if value == "" {
 		return errors.New("secret value is empty")
 	}
-	return m.secret.Set(pkg, key, value)
+	if err := m.secret.Set(pkg, key, value); err != nil {
+		return err
+	}
+	// Remember manually set keys so remove can purge them later. A secret
+	// set ahead of install is not recorded: secret prune only deletes keys
+	// left behind by remove --keep-secrets.
+	st, err := m.store.Load()
+	if err != nil {
+		return err
+	}
+	installed, ok := st.Installed[pkg]
+	if !ok {
+		return nil
+	}
+	if slices.Contains(installed.SecretKeys, key) {
+		return nil
+	}
+	installed.SecretKeys = mergeSecretKeys(installed.SecretKeys, key)
+	st.Installed[pkg] = installed
+	return m.store.Save(st)
 }
 
 func (m *Manager) SecretUnset(pkg, key string) error {
 	if pkg == "" || key == "" {
 		return errors.New("package and key are required")
 	}
-	return m.secret.Delete(pkg, key)
+	if err := m.secret.Delete(pkg, key); err != nil {
+		return err
+	}
+	st, err := m.store.Load()
+	if err != nil {
+		return err
+	}
+	if !forgetRetainedSecret(&st, pkg, key) {
+		return nil
+	}
+	return m.store.Save(st)
 }
 
-func (m *Manager) resolveTargets(target string) ([]string, error) {
+// resolveTargets turns a comma-separated target list, which may use aliases,
+// into detected target names. "all" or an empty list means every detected
+// client, narrowed by the scope's include and exclude lists.
+func (m *Manager) resolveTargets(target string, scope targetScope) ([]string, error) {
 	target = strings.TrimSpace(target)
 	if target == "" || target == model.TargetAll {
+		include, err := scope.clientSet(scope.include)
+		if err != nil {
+			return nil, err
+		}
+		exclude, err := scope.clientSet(scope.exclude)
+		if err != nil {
+			return nil, err
+		}
 		targets := make([]string, 0, len(m.adapters))
 		for name := range m.adapters {
-			targets = append(targets, name)
+			if (include == nil || include[name]) && !exclude[name] {
+				targets = append(targets, name)
+			}
 		}
 		sort.Strings(targets)
+		if len(m.adapters) == 0 {
+			return nil, errors.New(`no AI clients detected; run "mcper clients --verbose" to see where mcper looked, or name clients with --target and pass --only-detected=false to create their configs`)
+		}
 		if len(targets) == 0 {
-			return nil, errors.New("no AI clients detected; install a supported client first")
+			return nil, errors.New("--include and --exclude leave no detected clients")
 		}
 		return targets, nil
 	}
+	if len(scope.include) > 0 || len(scope.exclude) > 0 {
+		return nil, fmt.Errorf("--include and --exclude only refine --target all, not %q", target)
+	}
 
-	parts := strings.Split(target, ",")
+	parts := expandTargetAliases(target, scope.aliases)
 	seen := map[string]bool{}
 	out := make([]string, 0, len(parts))
-	for _, part := range parts {
-		p := strings.ToLower(strings.TrimSpace(part))
-		if p == "" {
-			continue
-		}
+	for _, p := range parts {
 		if _, ok := m.adapters[p]; !ok {
-			return nil, fmt.Errorf("unknown or undetected target %q", p)
+			if adapter, ok := m.missing[p]; ok {
+				m.adapters[p] = adapter
+				delete(m.missing, p)
+			} else if _, known := adapters.ClientLabels()[p]; !known {
+				return nil, unknownTargetError(p, scope.aliases)
+			} else {
+				return nil, fmt.Errorf("target %q is not detected; pass --create-missing-clients or --only-detected=false to create its config anyway", p)
+			}
 		}
 		if !seen[p] {
 			seen[p] = true
@@ -602,12 +2439,8 @@ func (m *Manager) DetectedTargets() []string {
 }
 
 func (m *Manager) promptConfirmInstall() (bool, error) {
-	fi, err := os.Stdin.Stat()
-	if err != nil {
-		return false, fmt.Errorf("inspect stdin: %w", err)
-	}
-	if fi.Mode()&os.ModeCharDevice == 0 {
-		return false, errors.New("conflict detected; use --force to overwrite in non-interactive mode")
+	if !m.isInteractive() {
+		return false, fmt.Errorf("%w; use --force to overwrite in non-interactive mode", ErrConflict)
 	}
 
 	fmt.Fprint(m.stdout, "Proceed? Type 'yes' to continue: ")
@@ -620,12 +2453,8 @@ func (m *Manager) promptConfirmInstall() (bool, error) {
 }
 
 func (m *Manager) promptTrust(url string) (bool, error) {
-	fi, err := os.Stdin.Stat()
-	if err != nil {
-		return false, fmt.Errorf("inspect stdin: %w", err)
-	}
-	if fi.Mode()&os.ModeCharDevice == 0 {
-		return false, errors.New("direct URL trust requires --yes in non-interactive mode")
+	if !m.isInteractive() {
+		return false, fmt.Errorf("%w; direct URL trust requires --yes in non-interactive mode", ErrTrustRequired)
 	}
 
 	fmt.Fprintf(m.stdout, "Direct source trust required for %s\n", url)
@@ -638,6 +2467,32 @@ func (m *Manager) promptTrust(url string) (bool, error) {
 	return strings.EqualFold(strings.TrimSpace(resp), "yes"), nil
 }
 
+// pruneBackups trims the backup tree after a successful write. Failures are
+// reported but never fail the operation that already succeeded.
+func (m *Manager) pruneBackups(keep int) {
+	if keep <= 0 {
+		return
+	}
+	backupDir, err := paths.BackupDir()
+	if err != nil {
+		fmt.Fprintf(m.stdout, "Warning: prune backups: %v\n", err)
+		return
+	}
+	removed, err := fsutil.PruneBackups(backupDir, keep)
+	if err != nil {
+		fmt.Fprintf(m.stdout, "Warning: prune backups: %v\n", err)
+	}
+	if len(removed) > 0 {
+		fmt.Fprintf(m.stdout, "Pruned %d old backup set(s)\n", len(removed))
+	}
+}
+
+func (m *Manager) printWarnings(warnings []string) {
+	for _, w := range warnings {
+		fmt.Fprintf(m.stdout, "Warning: %s\n", w)
+	}
+}
+
 func defaultIsInteractive() bool {
 	fi, err := os.Stdin.Stat()
 	if err != nil {
@@ -646,6 +2501,107 @@ func defaultIsInteractive() bool {
 	return fi.Mode()&os.ModeCharDevice != 0
 }
 
+var hostEnvRef = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandHostEnv resolves ${VAR} references in the args of servers that opt in
+// via ExpandHostEnv. Keys listed in the server's EnvRequired are secret
+// placeholders and, like unset variables, are left untouched.
+func expandHostEnv(servers map[string]model.MCPServerSpec) map[string]model.MCPServerSpec {
+	out := make(map[string]model.MCPServerSpec, len(servers))
+	for name, spec := range servers {
+		if !spec.ExpandHostEnv || len(spec.Args) == 0 {
+			out[name] = spec
+			continue
+		}
+		secretKeys := make(map[string]bool, len(spec.EnvRequired))
+		for _, key := range spec.EnvRequired {
+			secretKeys[key] = true
+		}
+		args := make([]string, len(spec.Args))
+		for i, arg := range spec.Args {
+			args[i] = hostEnvRef.ReplaceAllStringFunc(arg, func(ref string) string {
+				key := hostEnvRef.FindStringSubmatch(ref)[1]
+				if secretKeys[key] {
+					return ref
+				}
+				if val, ok := os.LookupEnv(key); ok {
+					return val
+				}
+				return ref
+			})
+		}
+		spec.Args = args
+		out[name] = spec
+	}
+	return out
+}
+
+// inlineSecrets copies the package's stored secrets into the env of each
+// server that requires them, so a secret set once for the package reaches
+// every server. Keys without a stored secret are left for doctor to report.
+// The second result records which keys each server received.
+func (m *Manager) inlineSecrets(pkg string, servers map[string]model.MCPServerSpec) (map[string]model.MCPServerSpec, map[string][]string) {
+	out := make(map[string]model.MCPServerSpec, len(servers))
+	inlined := make(map[string][]string)
+	values := make(map[string]string)
+	for name, spec := range servers {
+		out[name] = spec
+		for _, key := range spec.EnvRequired {
+			value, ok := values[key]
+			if !ok {
+				v, err := m.secret.Get(pkg, key)
+				if err != nil || v == "" {
+					continue
+				}
+				value = v
+				values[key] = v
+			}
+			env := make(map[string]string, len(spec.Env)+1)
+			for k, v := range spec.Env {
+				env[k] = v
+			}
+			env[key] = value
+			spec.Env = env
+			out[name] = spec
+			inlined[name] = append(inlined[name], key)
+		}
+	}
+	if len(inlined) == 0 {
+		return out, nil
+	}
+	for name := range inlined {
+		sort.Strings(inlined[name])
+	}
+	return out, inlined
+}
+
+// manifestSecretKeys returns the env vars a manifest may store in the
+// keychain: required server env plus setup command outputs.
+func manifestSecretKeys(manifest model.PackageManifest) []string {
+	var out []string
+	for _, spec := range manifest.MCPServers {
+		out = append(out, spec.EnvRequired...)
+	}
+	for envVar := range manifest.SetupCommands {
+		out = append(out, envVar)
+	}
+	return out
+}
+
+func mergeSecretKeys(existing []string, add ...string) []string {
+	seen := make(map[string]bool, len(existing)+len(add))
+	var out []string
+	for _, k := range append(append([]string{}, existing...), add...) {
+		if k == "" || seen[k] {
+			continue
+		}
+		seen[k] = true
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
+
 func keys(m map[string]model.MCPServerSpec) []string {
 	out := make([]string, 0, len(m))
 	for k := range m {
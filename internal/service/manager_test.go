@@ -1,12 +1,111 @@
 package service
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/sarjann/mcper/internal/adapters"
+	"github.com/sarjann/mcper/internal/fsutil"
 	"github.com/sarjann/mcper/internal/model"
+	"github.com/sarjann/mcper/internal/paths"
+	"github.com/sarjann/mcper/internal/registry"
+	"github.com/sarjann/mcper/internal/state"
+	"github.com/sarjann/mcper/internal/testutil"
 )
 
+// testManifest returns a minimal valid manifest with a single stdio server
+// named after the package.
+func testManifest(name, version string) model.PackageManifest {
+	return model.PackageManifest{
+		SchemaVersion: 1,
+		Name:          name,
+		Version:       version,
+		MCPServers: map[string]model.MCPServerSpec{
+			name: {Transport: model.ServerTransportSTDIO, Command: "npx", Args: []string{"-y", name}},
+		},
+	}
+}
+
+// writeTestTap lays out a local tap directory containing the given manifests
+// and returns its path.
+func writeTestTap(t *testing.T, manifests ...model.PackageManifest) string {
+	t.Helper()
+	dir := t.TempDir()
+	idx := model.RegistryIndex{SchemaVersion: 1, Packages: map[string]model.IndexPackage{}}
+	for _, mf := range manifests {
+		data, err := json.MarshalIndent(mf, "", "  ")
+		if err != nil {
+			t.Fatalf("encode manifest: %v", err)
+		}
+		rel := filepath.Join("packages", mf.Name, mf.Version, "manifest.json")
+		if err := os.MkdirAll(filepath.Join(dir, filepath.Dir(rel)), 0o755); err != nil {
+			t.Fatalf("create manifest dir: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, rel), data, 0o644); err != nil {
+			t.Fatalf("write manifest: %v", err)
+		}
+		pkg := idx.Packages[mf.Name]
+		if pkg.Versions == nil {
+			pkg.Versions = map[string]model.IndexVersion{}
+		}
+		pkg.Description = mf.Description
+		pkg.Homepage = mf.Homepage
+		pkg.Versions[mf.Version] = model.IndexVersion{ManifestPath: rel, SHA256: fsutil.SHA256Hex(data)}
+		idx.Packages[mf.Name] = pkg
+	}
+	data, err := json.MarshalIndent(idx, "", "  ")
+	if err != nil {
+		t.Fatalf("encode index: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "index.json"), data, 0o644); err != nil {
+		t.Fatalf("write index: %v", err)
+	}
+	return dir
+}
+
+// newInstallTestManager returns a Manager backed by a temporary state file
+// whose default tap points at tapDir.
+func newInstallTestManager(t *testing.T, tapDir string, adapterMap map[string]adapters.Adapter) (*Manager, *bytes.Buffer) {
+	t.Helper()
+	tmp := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(tmp, "config"))
+	t.Setenv("XDG_CACHE_HOME", filepath.Join(tmp, "cache"))
+
+	store, err := state.NewStore()
+	if err != nil {
+		t.Fatalf("NewStore failed: %v", err)
+	}
+	st := model.NewDefaultState()
+	tap := st.Taps[model.DefaultTapName]
+	tap.URL = tapDir
+	st.Taps[model.DefaultTapName] = tap
+	if err := store.Save(st); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	var buf bytes.Buffer
+	m := &Manager{
+		store:         store,
+		registry:      registry.NewClient(),
+		secret:        newStubSecretStore(),
+		adapters:      adapterMap,
+		stdin:         strings.NewReader(""),
+		stdout:        &buf,
+		setupTimeout:  10 * time.Second,
+		isInteractive: func() bool { return false },
+	}
+	return m, &buf
+}
+
 func TestResolveTargets(t *testing.T) {
 	m := &Manager{
 		adapters: map[string]adapters.Adapter{
@@ -14,7 +113,7 @@ func TestResolveTargets(t *testing.T) {
 			model.TargetClaude: newStub("claude", nil),
 		},
 	}
-	targets, err := m.resolveTargets("codex,claude")
+	targets, err := m.resolveTargets("codex,claude", targetScope{})
 	if err != nil {
 		t.Fatalf("resolveTargets returned error: %v", err)
 	}
@@ -22,11 +121,44 @@ func TestResolveTargets(t *testing.T) {
 		t.Fatalf("expected 2 targets, got %d", len(targets))
 	}
 
-	if _, err := m.resolveTargets("unknown"); err == nil {
+	if _, err := m.resolveTargets("unknown", targetScope{}); err == nil {
 		t.Fatalf("expected error for unknown target")
 	}
 }
 
+func TestResolveTargets_Aliases(t *testing.T) {
+	m := &Manager{
+		adapters: map[string]adapters.Adapter{
+			model.TargetClaudeDesktop: newStub("claude-desktop", nil),
+			model.TargetCursor:        newStub("cursor", nil),
+			model.TargetVSCode:        newStub("vscode", nil),
+			model.TargetZed:           newStub("zed", nil),
+		},
+	}
+	aliases := targetAliases(model.Settings{TargetAliases: map[string]string{"mine": "zed,cursor"}})
+
+	targets, err := m.resolveTargets("Desktop", targetScope{aliases: aliases})
+	if err != nil {
+		t.Fatalf("resolveTargets returned error: %v", err)
+	}
+	if !reflect.DeepEqual(targets, []string{"claude-desktop"}) {
+		t.Fatalf("expected desktop to expand to claude-desktop, got %v", targets)
+	}
+
+	targets, err = m.resolveTargets("editors,mine,vscode", targetScope{aliases: aliases})
+	if err != nil {
+		t.Fatalf("resolveTargets returned error: %v", err)
+	}
+	if want := []string{"cursor", "vscode", "zed"}; !reflect.DeepEqual(targets, want) {
+		t.Fatalf("expected %v, got %v", want, targets)
+	}
+
+	_, err = m.resolveTargets("deskop", targetScope{aliases: aliases})
+	if err == nil || !strings.Contains(err.Error(), `unknown target or alias "deskop"`) || !strings.Contains(err.Error(), "desktop") {
+		t.Fatalf("expected unknown alias error listing the aliases, got %v", err)
+	}
+}
+
 func TestResolveTargets_All(t *testing.T) {
 	m := &Manager{
 		adapters: map[string]adapters.Adapter{
@@ -35,7 +167,7 @@ func TestResolveTargets_All(t *testing.T) {
 			model.TargetCursor:  newStub("cursor", nil),
 		},
 	}
-	targets, err := m.resolveTargets("all")
+	targets, err := m.resolveTargets("all", targetScope{})
 	if err != nil {
 		t.Fatalf("resolveTargets returned error: %v", err)
 	}
@@ -48,12 +180,1694 @@ func TestResolveTargets_All(t *testing.T) {
 	}
 }
 
+func TestResolveTargets_IncludeExclude(t *testing.T) {
+	m := &Manager{
+		adapters: map[string]adapters.Adapter{
+			model.TargetClaude: newStub("claude", nil),
+			model.TargetCodex:  newStub("codex", nil),
+			model.TargetCursor: newStub("cursor", nil),
+			model.TargetVSCode: newStub("vscode", nil),
+		},
+	}
+	aliases := targetAliases(model.Settings{})
+
+	targets, err := m.resolveTargets("all", targetScope{aliases: aliases, exclude: []string{"VSCode", "cursor"}})
+	if err != nil {
+		t.Fatalf("resolveTargets returned error: %v", err)
+	}
+	if want := []string{"claude", "codex"}; !reflect.DeepEqual(targets, want) {
+		t.Errorf("expected exclude to leave %v, got %v", want, targets)
+	}
+
+	// zed is known but not detected, so include skips it instead of failing.
+	targets, err = m.resolveTargets("", targetScope{aliases: aliases, include: []string{"editors", "codex"}})
+	if err != nil {
+		t.Fatalf("resolveTargets returned error: %v", err)
+	}
+	if want := []string{"codex", "cursor", "vscode"}; !reflect.DeepEqual(targets, want) {
+		t.Errorf("expected include to keep %v, got %v", want, targets)
+	}
+
+	targets, err = m.resolveTargets("all", targetScope{aliases: aliases, include: []string{"codex", "cursor"}, exclude: []string{"cursor"}})
+	if err != nil {
+		t.Fatalf("resolveTargets returned error: %v", err)
+	}
+	if want := []string{"codex"}; !reflect.DeepEqual(targets, want) {
+		t.Errorf("expected exclude to win over include, got %v", targets)
+	}
+
+	if _, err := m.resolveTargets("all", targetScope{aliases: aliases, exclude: []string{"notaclient"}}); err == nil || !strings.Contains(err.Error(), "notaclient") {
+		t.Errorf("expected unknown client error, got %v", err)
+	}
+	if _, err := m.resolveTargets("all", targetScope{include: []string{"zed"}}); err == nil {
+		t.Error("expected error when include leaves no detected clients")
+	}
+	if _, err := m.resolveTargets("codex", targetScope{exclude: []string{"cursor"}}); err == nil {
+		t.Error("expected error when filtering an explicit target list")
+	}
+}
+
 func TestResolveTargets_Empty(t *testing.T) {
 	m := &Manager{
 		adapters: map[string]adapters.Adapter{},
 	}
-	_, err := m.resolveTargets("all")
+	_, err := m.resolveTargets("all", targetScope{})
 	if err == nil {
 		t.Fatal("expected error for empty adapters")
 	}
+	for _, hint := range []string{"mcper clients", "--target", "--only-detected=false"} {
+		if !strings.Contains(err.Error(), hint) {
+			t.Errorf("expected zero-detected error to mention %s, got %v", hint, err)
+		}
+	}
+
+	_, err = m.resolveTargets("cursor", targetScope{})
+	if err == nil || !strings.Contains(err.Error(), "--only-detected=false") {
+		t.Fatalf("expected undetected target error to suggest --only-detected=false, got %v", err)
+	}
+}
+
+func TestInstallFromTap_CreateMissingClients(t *testing.T) {
+	codex := newStub("codex", nil)
+	m, _ := newInstallTestManager(t, writeTestTap(t, testManifest("demo", "1.0.0")), map[string]adapters.Adapter{
+		model.TargetCodex: codex,
+	})
+	cursorPath := filepath.Join(t.TempDir(), ".cursor", "mcp.json")
+	m.missing = map[string]adapters.Adapter{
+		model.TargetCursor: adapters.NewGenericJSONAdapter(model.TargetCursor, cursorPath, "", []string{"mcpServers"}, nil, nil),
+	}
+	ctx := context.Background()
+
+	installed, err := m.InstallFromTap(ctx, InstallRequest{Name: "demo", Force: true})
+	if err != nil {
+		t.Fatalf("InstallFromTap(all): %v", err)
+	}
+	if len(installed.Targets) != 1 || installed.Targets[0] != model.TargetCodex {
+		t.Fatalf("expected all to cover detected clients only, got %v", installed.Targets)
+	}
+	if _, err := os.Stat(cursorPath); !os.IsNotExist(err) {
+		t.Fatalf("expected no cursor config for all, stat err: %v", err)
+	}
+
+	installed, err = m.InstallFromTap(ctx, InstallRequest{Name: "demo", Target: "codex,cursor", Force: true})
+	if err != nil {
+		t.Fatalf("InstallFromTap(cursor): %v", err)
+	}
+	if len(installed.Targets) != 2 || installed.TargetPaths[model.TargetCursor] != cursorPath {
+		t.Fatalf("expected the undetected cursor installed to, got %+v", installed)
+	}
+	servers, err := m.adapters[model.TargetCursor].ListServers(ctx)
+	if err != nil {
+		t.Fatalf("ListServers: %v", err)
+	}
+	if _, ok := servers["demo"]; !ok {
+		t.Errorf("expected demo written to the created cursor config, got %v", servers)
+	}
+}
+
+// stubRegistry serves one manifest from ResolveFromTap; other registry
+// calls are not expected.
+type stubRegistry struct {
+	RegistryClient
+	manifest model.PackageManifest
+	resolved []string
+}
+
+func (r *stubRegistry) ResolveFromTap(ctx context.Context, tap model.TapConfig, name, versionExpr string) (registry.ResolvedPackage, error) {
+	r.resolved = append(r.resolved, tap.Name+"/"+name)
+	if name != r.manifest.Name {
+		return registry.ResolvedPackage{}, registry.ErrPackageNotFound
+	}
+	return registry.ResolvedPackage{Manifest: r.manifest, ManifestDigest: "sha256:stub", Tap: tap, Version: r.manifest.Version}, nil
+}
+
+func TestNewManagerWithOptions_InjectedDependencies(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(tmp, "config"))
+	t.Setenv("XDG_CACHE_HOME", filepath.Join(tmp, "cache"))
+
+	mf := testManifest("demo", "1.0.0")
+	spec := mf.MCPServers["demo"]
+	spec.EnvRequired = []string{"API_TOKEN"}
+	mf.MCPServers["demo"] = spec
+	reg := &stubRegistry{manifest: mf}
+	secret := newStubSecretStore()
+	if err := secret.Set("demo", "API_TOKEN", "tok"); err != nil {
+		t.Fatal(err)
+	}
+	codex := newStub("codex", nil)
+	m, err := NewManagerWithOptions(ManagerOptions{
+		Stdin:         strings.NewReader(""),
+		Stdout:        &bytes.Buffer{},
+		Adapters:      map[string]adapters.Adapter{model.TargetCodex: codex},
+		Registry:      reg,
+		SecretStore:   secret,
+		SetupTimeout:  time.Second,
+		IsInteractive: func() bool { return false },
+	})
+	if err != nil {
+		t.Fatalf("NewManagerWithOptions: %v", err)
+	}
+
+	installed, err := m.InstallFromTap(context.Background(), InstallRequest{Name: "demo", Force: true, InlineSecrets: true})
+	if err != nil {
+		t.Fatalf("InstallFromTap: %v", err)
+	}
+	if len(reg.resolved) != 1 || reg.resolved[0] != model.DefaultTapName+"/demo" {
+		t.Errorf("expected the stub registry to resolve demo from the default tap, got %v", reg.resolved)
+	}
+	if len(installed.Targets) != 1 || installed.Targets[0] != model.TargetCodex {
+		t.Errorf("expected only the injected codex adapter targeted, got %v", installed.Targets)
+	}
+	if got := codex.servers["demo"].Env["API_TOKEN"]; got != "tok" {
+		t.Errorf("expected the secret from the injected store inlined, got %q", got)
+	}
+}
+
+func TestInstallFromTap_UsesDefaultTargetWhenOmitted(t *testing.T) {
+	tapDir := writeTestTap(t, testManifest("demo", "1.0.0"))
+	codex := newStub("codex", nil)
+	claude := newStub("claude", nil)
+	m, _ := newInstallTestManager(t, tapDir, map[string]adapters.Adapter{
+		model.TargetCodex:  codex,
+		model.TargetClaude: claude,
+	})
+	if err := m.ConfigSet("default-target", "Codex"); err != nil {
+		t.Fatalf("ConfigSet: %v", err)
+	}
+
+	installed, err := m.InstallFromTap(context.Background(), InstallRequest{Name: "demo", Force: true})
+	if err != nil {
+		t.Fatalf("InstallFromTap: %v", err)
+	}
+	if len(installed.Targets) != 1 || installed.Targets[0] != model.TargetCodex {
+		t.Fatalf("expected default target codex, got %v", installed.Targets)
+	}
+	if len(claude.servers) != 0 {
+		t.Fatalf("expected claude to be untouched, got %v", claude.servers)
+	}
+
+	// An explicit --target still wins over the default.
+	if err := m.ConfigSet("default-target", "claude"); err != nil {
+		t.Fatalf("ConfigSet: %v", err)
+	}
+	installed, err = m.InstallFromTap(context.Background(), InstallRequest{Name: "demo", Target: "codex", Force: true})
+	if err != nil {
+		t.Fatalf("InstallFromTap: %v", err)
+	}
+	if len(installed.Targets) != 1 || installed.Targets[0] != model.TargetCodex {
+		t.Fatalf("expected explicit target codex, got %v", installed.Targets)
+	}
+}
+
+func TestDefaultTarget_RejectsUnknownTargetAndAllClears(t *testing.T) {
+	tapDir := writeTestTap(t, testManifest("demo", "1.0.0"))
+	m, _ := newInstallTestManager(t, tapDir, map[string]adapters.Adapter{
+		model.TargetCodex:  newStub("codex", nil),
+		model.TargetClaude: newStub("claude", nil),
+	})
+	if err := m.ConfigSet("default-target", "codex,notaclient"); err == nil {
+		t.Fatal("expected error for unknown target")
+	}
+	if err := m.ConfigSet("default-target", "codex"); err != nil {
+		t.Fatalf("ConfigSet: %v", err)
+	}
+	if err := m.ConfigSet("default-target", "all"); err != nil {
+		t.Fatalf("ConfigSet(all): %v", err)
+	}
+	st, err := m.store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Settings.DefaultTarget != "" {
+		t.Fatalf("expected all to clear the default, got %q", st.Settings.DefaultTarget)
+	}
+
+	installed, err := m.InstallFromTap(context.Background(), InstallRequest{Name: "demo", Force: true})
+	if err != nil {
+		t.Fatalf("InstallFromTap: %v", err)
+	}
+	if len(installed.Targets) != 2 {
+		t.Errorf("expected a cleared default to install to every target, got %v", installed.Targets)
+	}
+}
+
+func TestInstallFromTap_RecordsTargetPaths(t *testing.T) {
+	tapDir := writeTestTap(t, testManifest("demo", "1.0.0"))
+	m, _ := newInstallTestManager(t, tapDir, map[string]adapters.Adapter{
+		model.TargetCodex:  newStub("codex", nil),
+		model.TargetClaude: newStub("claude", nil),
+	})
+
+	installed, err := m.InstallFromTap(context.Background(), InstallRequest{Name: "demo", Force: true})
+	if err != nil {
+		t.Fatalf("InstallFromTap failed: %v", err)
+	}
+	want := map[string]string{"claude": "/tmp/claude", "codex": "/tmp/codex"}
+	if len(installed.TargetPaths) != len(want) {
+		t.Fatalf("expected %d target paths, got %v", len(want), installed.TargetPaths)
+	}
+	for target, path := range want {
+		if installed.TargetPaths[target] != path {
+			t.Errorf("expected %s path %q, got %q", target, path, installed.TargetPaths[target])
+		}
+	}
+
+	pkgs, err := m.ListInstalled()
+	if err != nil {
+		t.Fatalf("ListInstalled failed: %v", err)
+	}
+	if len(pkgs) != 1 || pkgs[0].TargetPaths["codex"] != "/tmp/codex" {
+		t.Fatalf("expected target paths persisted in state, got %+v", pkgs)
+	}
+}
+
+func TestInstallFromTap_ServerTargetsSplitServers(t *testing.T) {
+	mf := testManifest("demo", "1.0.0")
+	mf.MCPServers = map[string]model.MCPServerSpec{
+		"alpha": {Transport: model.ServerTransportSTDIO, Command: "go", Args: []string{"alpha"}},
+		"beta":  {Transport: model.ServerTransportSTDIO, Command: "go", Args: []string{"beta"}},
+	}
+	claude := newStub("claude", map[string]model.MCPServerSpec{
+		"beta": {Transport: model.ServerTransportSTDIO, Command: "user-owned"},
+	})
+	codex := newStub("codex", nil)
+	m, _ := newInstallTestManager(t, writeTestTap(t, mf), map[string]adapters.Adapter{
+		model.TargetClaude: claude,
+		model.TargetCodex:  codex,
+	})
+	ctx := context.Background()
+
+	if _, err := m.InstallFromTap(ctx, InstallRequest{Name: "demo", Force: true, ServerTargets: map[string]string{"nope": "codex"}}); err == nil {
+		t.Fatal("expected mapping for an unknown server to fail")
+	}
+
+	installed, err := m.InstallFromTap(ctx, InstallRequest{
+		Name:          "demo",
+		Force:         true,
+		ServerTargets: map[string]string{"alpha": "claude", "beta": "codex"},
+	})
+	if err != nil {
+		t.Fatalf("InstallFromTap failed: %v", err)
+	}
+	if _, ok := claude.servers["alpha"]; !ok {
+		t.Error("expected alpha in claude")
+	}
+	if claude.servers["beta"].Command != "user-owned" {
+		t.Errorf("expected claude's own beta untouched, got %+v", claude.servers["beta"])
+	}
+	if _, ok := codex.servers["beta"]; !ok {
+		t.Error("expected beta in codex")
+	}
+	if _, ok := codex.servers["alpha"]; ok {
+		t.Error("expected alpha to stay out of codex")
+	}
+	if got := installed.ServerTargets; len(got) != 2 || got["alpha"][0] != "claude" || got["beta"][0] != "codex" {
+		t.Errorf("expected recorded server targets, got %v", got)
+	}
+
+	issues, err := m.Doctor(ctx, DoctorRequest{})
+	if err != nil {
+		t.Fatalf("Doctor failed: %v", err)
+	}
+	if len(issues) != 0 {
+		t.Errorf("expected doctor to respect the mapping, got %+v", issues)
+	}
+
+	if _, err := m.Remove(ctx, RemoveRequest{Name: "demo"}); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+	if _, ok := claude.servers["alpha"]; ok {
+		t.Error("expected alpha removed from claude")
+	}
+	if _, ok := claude.servers["beta"]; !ok {
+		t.Error("expected remove to leave claude's own beta alone")
+	}
+	if _, ok := codex.servers["beta"]; ok {
+		t.Error("expected beta removed from codex")
+	}
+}
+
+func TestUpgrade_MappedInstallPlacesNewServersOnDefaults(t *testing.T) {
+	servers := func(names ...string) map[string]model.MCPServerSpec {
+		out := make(map[string]model.MCPServerSpec, len(names))
+		for _, name := range names {
+			out[name] = model.MCPServerSpec{Transport: model.ServerTransportSTDIO, Command: "go", Args: []string{name}}
+		}
+		return out
+	}
+	v1 := testManifest("demo", "1.0.0")
+	v1.MCPServers = servers("alpha", "beta")
+	v2 := testManifest("demo", "1.1.0")
+	v2.MCPServers = servers("alpha", "beta", "gamma")
+	claude := newStub("claude", nil)
+	codex := newStub("codex", nil)
+	m, out := newInstallTestManager(t, writeTestTap(t, v1, v2), map[string]adapters.Adapter{
+		model.TargetClaude: claude,
+		model.TargetCodex:  codex,
+	})
+	ctx := context.Background()
+
+	installed, err := m.InstallFromTap(ctx, InstallRequest{Name: "demo", Version: "1.0.0", Target: model.TargetCodex, Force: true, ServerTargets: map[string]string{"alpha": "claude"}})
+	if err != nil {
+		t.Fatalf("InstallFromTap: %v", err)
+	}
+	if len(installed.DefaultTargets) != 1 || installed.DefaultTargets[0] != model.TargetCodex {
+		t.Fatalf("expected codex recorded as the default target, got %v", installed.DefaultTargets)
+	}
+	if _, err := m.Upgrade(ctx, UpgradeRequest{Name: "demo"}); err != nil {
+		t.Fatalf("Upgrade: %v", err)
+	}
+	if _, ok := codex.servers["gamma"]; !ok {
+		t.Error("expected the new server written to the default target")
+	}
+	if _, ok := claude.servers["gamma"]; ok {
+		t.Error("expected the new server kept out of the mapped-only target")
+	}
+
+	// With every server mapped there is no default to fall back on.
+	for _, stub := range []*stubAdapter{claude, codex} {
+		clear(stub.servers)
+	}
+	if _, err := m.InstallFromTap(ctx, InstallRequest{Name: "demo", Version: "1.0.0", Force: true, ServerTargets: map[string]string{"alpha": "claude", "beta": "codex"}}); err != nil {
+		t.Fatalf("InstallFromTap: %v", err)
+	}
+	out.Reset()
+	if _, err := m.Upgrade(ctx, UpgradeRequest{Name: "demo"}); err != nil {
+		t.Fatalf("Upgrade: %v", err)
+	}
+	if !strings.Contains(out.String(), "adds gamma, which no --map placed") {
+		t.Errorf("expected a warning about the unplaced server, got:\n%s", out.String())
+	}
+}
+
+func TestRemove_ReportsTargetsAndIdempotentAbsence(t *testing.T) {
+	codex := newStub("codex", nil)
+	m, _ := newInstallTestManager(t, writeTestTap(t, testManifest("demo", "1.0.0")), map[string]adapters.Adapter{
+		model.TargetCodex: codex,
+	})
+	ctx := context.Background()
+	if _, err := m.InstallFromTap(ctx, InstallRequest{Name: "demo", Force: true}); err != nil {
+		t.Fatalf("InstallFromTap: %v", err)
+	}
+
+	result, err := m.Remove(ctx, RemoveRequest{Name: "demo"})
+	if err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if !result.Removed || result.Name != "demo" || len(result.Targets) != 1 || result.Targets[0] != model.TargetCodex {
+		t.Fatalf("expected demo removed from codex, got %+v", result)
+	}
+
+	if _, err := m.Remove(ctx, RemoveRequest{Name: "demo"}); !errors.Is(err, ErrNotInstalled) {
+		t.Fatalf("expected ErrNotInstalled for an absent package, got %v", err)
+	}
+	result, err = m.Remove(ctx, RemoveRequest{Name: "demo", Idempotent: true})
+	if err != nil {
+		t.Fatalf("expected an idempotent remove of an absent package to succeed, got %v", err)
+	}
+	if result.Removed || result.Targets == nil {
+		t.Errorf("expected removed false with empty targets, got %+v", result)
+	}
+}
+
+func TestInstallWarnsBeforeDroppingConfigComments(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "mcp.json")
+	if err := os.WriteFile(configPath, []byte("{\n  // keep me\n  \"servers\": {}\n}\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	m, out := newInstallTestManager(t, writeTestTap(t, testManifest("demo", "1.0.0")), map[string]adapters.Adapter{
+		model.TargetVSCode: adapters.NewGenericJSONAdapter(model.TargetVSCode, configPath, "", []string{"servers"}, nil, nil),
+	})
+	if _, err := m.InstallFromTap(context.Background(), InstallRequest{Name: "demo", Force: true}); err != nil {
+		t.Fatalf("InstallFromTap: %v", err)
+	}
+	if want := "warning: " + configPath + " has comments, which this write will not keep\n"; !strings.Contains(out.String(), want) {
+		t.Errorf("expected a comment warning, got:\n%s", out.String())
+	}
+}
+
+func TestUpgrade_IncludesReleaseNotes(t *testing.T) {
+	next := testManifest("demo", "1.1.0")
+	next.Changelog = "https://example.com/demo/CHANGELOG.md"
+	next.ReleaseNotes = map[string]string{"1.1.0": "Added search tool"}
+	tapDir := writeTestTap(t, testManifest("demo", "1.0.0"), next)
+	m, _ := newInstallTestManager(t, tapDir, map[string]adapters.Adapter{
+		model.TargetCodex: newStub("codex", nil),
+	})
+
+	ctx := context.Background()
+	if _, err := m.InstallFromTap(ctx, InstallRequest{Name: "demo", Version: "1.0.0", Force: true}); err != nil {
+		t.Fatalf("InstallFromTap failed: %v", err)
+	}
+	results, err := m.Upgrade(ctx, UpgradeRequest{Name: "demo"})
+	if err != nil {
+		t.Fatalf("Upgrade failed: %v", err)
+	}
+	if len(results) != 1 || !results[0].WasUpgraded {
+		t.Fatalf("expected one upgrade, got %+v", results)
+	}
+	if results[0].ReleaseNotes != "Added search tool" {
+		t.Errorf("expected release notes for 1.1.0, got %q", results[0].ReleaseNotes)
+	}
+	if results[0].Changelog != next.Changelog {
+		t.Errorf("expected changelog %q, got %q", next.Changelog, results[0].Changelog)
+	}
+}
+
+func TestUpgrade_CollectsSkippedReleaseNotes(t *testing.T) {
+	next := testManifest("demo", "1.3.0")
+	next.ReleaseNotes = map[string]string{
+		"1.0.0": "Initial release",
+		"1.1.0": "Added search tool",
+		"1.2.0": "Faster startup",
+		"1.2.1": "",
+		"1.3.0": "Added deploy tool",
+		"next":  "not a version",
+	}
+	tapDir := writeTestTap(t, testManifest("demo", "1.0.0"), next)
+	m, _ := newInstallTestManager(t, tapDir, map[string]adapters.Adapter{
+		model.TargetCodex: newStub("codex", nil),
+	})
+
+	ctx := context.Background()
+	if _, err := m.InstallFromTap(ctx, InstallRequest{Name: "demo", Version: "1.0.0", Force: true}); err != nil {
+		t.Fatalf("InstallFromTap failed: %v", err)
+	}
+	results, err := m.Upgrade(ctx, UpgradeRequest{Name: "demo", DryRun: true})
+	if err != nil {
+		t.Fatalf("Upgrade failed: %v", err)
+	}
+	want := []VersionNotes{{Version: "1.1.0", Notes: "Added search tool"}, {Version: "1.2.0", Notes: "Faster startup"}}
+	if len(results) != 1 || !reflect.DeepEqual(results[0].EarlierNotes, want) {
+		t.Fatalf("expected notes for 1.1.0 and 1.2.0, got %+v", results)
+	}
+	if results[0].ReleaseNotes != "Added deploy tool" {
+		t.Errorf("expected target notes kept separately, got %q", results[0].ReleaseNotes)
+	}
+
+	results, err = m.Upgrade(ctx, UpgradeRequest{Name: "demo", DryRun: true, SinceVersion: "1.1.0"})
+	if err != nil {
+		t.Fatalf("Upgrade failed: %v", err)
+	}
+	if got := results[0].EarlierNotes; len(got) != 1 || got[0].Version != "1.2.0" {
+		t.Errorf("expected only 1.2.0 after --since-version 1.1.0, got %+v", got)
+	}
+	if _, err := m.Upgrade(ctx, UpgradeRequest{Name: "demo", SinceVersion: "latest"}); err == nil {
+		t.Error("expected an invalid --since-version to be rejected")
+	}
+}
+
+func TestUpgrade_TargetFilterHoldsOtherTargets(t *testing.T) {
+	next := testManifest("demo", "1.1.0")
+	next.MCPServers["demo"] = model.MCPServerSpec{Transport: model.ServerTransportSTDIO, Command: "npx", Args: []string{"-y", "demo@1.1.0"}}
+	m, _ := newInstallTestManager(t, writeTestTap(t, testManifest("demo", "1.0.0"), next), map[string]adapters.Adapter{})
+	codex, claude := newStub("codex", nil), newStub("claude", nil)
+	m.adapters = map[string]adapters.Adapter{model.TargetCodex: codex, model.TargetClaude: claude}
+	ctx := context.Background()
+	if _, err := m.InstallFromTap(ctx, InstallRequest{Name: "demo", Version: "1.0.0", Force: true}); err != nil {
+		t.Fatalf("InstallFromTap: %v", err)
+	}
+
+	if _, err := m.Upgrade(ctx, UpgradeRequest{Name: "demo", Target: "cursor"}); err == nil {
+		t.Fatal("expected an error for a target the package is not installed in")
+	}
+	results, err := m.Upgrade(ctx, UpgradeRequest{Name: "demo", Target: model.TargetClaude})
+	if err != nil {
+		t.Fatalf("Upgrade: %v", err)
+	}
+	if len(results) != 1 || !results[0].WasUpgraded || results[0].HeldTargets[model.TargetCodex] != "1.0.0" {
+		t.Fatalf("expected claude upgraded with codex held at 1.0.0, got %+v", results)
+	}
+	if args := claude.servers["demo"].Args; args[1] != "demo@1.1.0" {
+		t.Errorf("expected claude on 1.1.0, got %v", args)
+	}
+	if args := codex.servers["demo"].Args; args[1] != "demo" {
+		t.Errorf("expected codex left on 1.0.0, got %v", args)
+	}
+	st, err := m.store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg := st.Installed["demo"]
+	if pkg.Version != "1.1.0" || len(pkg.Targets) != 2 || pkg.TargetVersions[model.TargetCodex] != "1.0.0" {
+		t.Fatalf("expected version 1.1.0 with codex held, got %+v", pkg)
+	}
+	if issues, err := m.Doctor(ctx, DoctorRequest{Package: "demo"}); err != nil || len(issues) != 0 {
+		t.Errorf("expected the held target not reported as drift, got %+v, %v", issues, err)
+	}
+
+	// A later upgrade brings the held target up to the recorded version.
+	results, err = m.Upgrade(ctx, UpgradeRequest{Name: "demo"})
+	if err != nil {
+		t.Fatalf("Upgrade: %v", err)
+	}
+	if len(results) != 1 || !results[0].WasUpgraded || results[0].OldVersion != "1.0.0" || results[0].NewVersion != "1.1.0" {
+		t.Fatalf("expected codex caught up 1.0.0 -> 1.1.0, got %+v", results)
+	}
+	if args := codex.servers["demo"].Args; args[1] != "demo@1.1.0" {
+		t.Errorf("expected codex on 1.1.0, got %v", args)
+	}
+	if st, err = m.store.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if pkg := st.Installed["demo"]; pkg.TargetVersions != nil || len(pkg.Targets) != 2 {
+		t.Errorf("expected no held targets left, got %+v", pkg)
+	}
+	if results, err := m.Upgrade(ctx, UpgradeRequest{Name: "demo"}); err != nil || results[0].WasUpgraded {
+		t.Errorf("expected nothing left to upgrade, got %+v, %v", results, err)
+	}
+}
+
+func TestUpgrade_ServersOnlyKeepsVersion(t *testing.T) {
+	next := testManifest("demo", "1.1.0")
+	next.MCPServers["demo"] = model.MCPServerSpec{Transport: model.ServerTransportSTDIO, Command: "npx", Args: []string{"-y", "demo@1.1.0"}}
+	codex := newStub("codex", nil)
+	m, _ := newInstallTestManager(t, writeTestTap(t, testManifest("demo", "1.0.0"), next), map[string]adapters.Adapter{
+		model.TargetCodex: codex,
+	})
+	ctx := context.Background()
+	if _, err := m.InstallFromTap(ctx, InstallRequest{Name: "demo", Version: "1.0.0", Force: true}); err != nil {
+		t.Fatalf("InstallFromTap: %v", err)
+	}
+	// A client reset wiped the server.
+	delete(codex.servers, "demo")
+
+	if _, err := m.Upgrade(ctx, UpgradeRequest{Name: "demo", ServersOnly: true, AllowMajor: true}); err == nil || !strings.Contains(err.Error(), "--major ") {
+		t.Fatalf("expected --servers-only with --major to be refused, got %v", err)
+	}
+	results, err := m.Upgrade(ctx, UpgradeRequest{Name: "demo", ServersOnly: true})
+	if err != nil {
+		t.Fatalf("Upgrade: %v", err)
+	}
+	if len(results) != 1 || !results[0].WasUpgraded || !results[0].ServersOnly || results[0].NewVersion != "1.0.0" {
+		t.Fatalf("expected servers re-applied at 1.0.0, got %+v", results)
+	}
+	spec, ok := codex.servers["demo"]
+	if !ok || spec.Args[1] != "demo" {
+		t.Fatalf("expected the 1.0.0 server restored, got %+v", codex.servers)
+	}
+	st, err := m.store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pkg := st.Installed["demo"]; pkg.Version != "1.0.0" {
+		t.Errorf("expected the version left at 1.0.0, got %s", pkg.Version)
+	}
+	entries, err := m.History()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last := entries[len(entries)-1]; last.Action != HistoryReinstall || last.ToVersion != "1.0.0" {
+		t.Errorf("expected the re-apply logged as a reinstall of 1.0.0, got %+v", last)
+	}
+}
+
+func TestUpgrade_DryRunPrintsPlanWithoutApplying(t *testing.T) {
+	next := testManifest("demo", "1.1.0")
+	next.MCPServers["demo"] = model.MCPServerSpec{Transport: model.ServerTransportSTDIO, Command: "npx", Args: []string{"-y", "demo@1.1.0"}}
+	tapDir := writeTestTap(t, testManifest("demo", "1.0.0"), next)
+	stub := newStub("codex", nil)
+	m, out := newInstallTestManager(t, tapDir, map[string]adapters.Adapter{
+		model.TargetCodex: stub,
+	})
+
+	ctx := context.Background()
+	if _, err := m.InstallFromTap(ctx, InstallRequest{Name: "demo", Version: "1.0.0", Force: true}); err != nil {
+		t.Fatalf("InstallFromTap failed: %v", err)
+	}
+	before, err := m.store.Load()
+	if err != nil {
+		t.Fatalf("load state: %v", err)
+	}
+	out.Reset()
+
+	results, err := m.Upgrade(ctx, UpgradeRequest{Name: "demo", DryRun: true})
+	if err != nil {
+		t.Fatalf("Upgrade failed: %v", err)
+	}
+	if len(results) != 1 || !results[0].DryRun || results[0].WasUpgraded || results[0].NewVersion != "1.1.0" {
+		t.Fatalf("expected one dry-run result for 1.1.0, got %+v", results)
+	}
+
+	got := out.String()
+	for _, want := range []string{
+		"demo 1.0.0 -> 1.1.0 (dry run)",
+		"[codex] demo",
+		"- command: npx -y demo\n",
+		"+ command: npx -y demo@1.1.0\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected plan output to contain %q, got:\n%s", want, got)
+		}
+	}
+
+	if args := stub.servers["demo"].Args; len(args) != 2 || args[1] != "demo" {
+		t.Errorf("expected client config untouched, got args %v", args)
+	}
+	after, err := m.store.Load()
+	if err != nil {
+		t.Fatalf("load state: %v", err)
+	}
+	if got := after.Installed["demo"]; got.Version != "1.0.0" || !got.UpdatedAt.Equal(before.Installed["demo"].UpdatedAt) {
+		t.Errorf("expected state untouched, got %+v", got)
+	}
+}
+
+func TestTapRemove_BlockedByDependentPackage(t *testing.T) {
+	tapDir := writeTestTap(t, testManifest("demo", "1.0.0"))
+	m, _ := newInstallTestManager(t, tapDir, map[string]adapters.Adapter{
+		model.TargetCodex: newStub("codex", nil),
+	})
+	if err := m.TapAdd(TapAddRequest{Name: "team", URL: tapDir}); err != nil {
+		t.Fatalf("TapAdd failed: %v", err)
+	}
+	if _, err := m.InstallFromTap(context.Background(), InstallRequest{Name: "demo", Tap: "team", Force: true}); err != nil {
+		t.Fatalf("InstallFromTap failed: %v", err)
+	}
+
+	dependents, err := m.TapDependents("team")
+	if err != nil {
+		t.Fatalf("TapDependents failed: %v", err)
+	}
+	if len(dependents) != 1 || dependents[0] != "demo" {
+		t.Fatalf("expected [demo], got %v", dependents)
+	}
+
+	err = m.TapRemove("team", false)
+	if err == nil {
+		t.Fatal("expected removal to be blocked")
+	}
+	if !strings.Contains(err.Error(), "demo") {
+		t.Errorf("expected error to name dependent package, got %v", err)
+	}
+
+	if err := m.TapRemove("team", true); err != nil {
+		t.Fatalf("TapRemove with force failed: %v", err)
+	}
+	taps, err := m.TapList()
+	if err != nil {
+		t.Fatalf("TapList failed: %v", err)
+	}
+	for _, tap := range taps {
+		if tap.Name == "team" {
+			t.Fatal("expected team tap to be removed")
+		}
+	}
+}
+
+func TestTapRemove_NoDependents(t *testing.T) {
+	tapDir := writeTestTap(t)
+	m, _ := newInstallTestManager(t, tapDir, nil)
+	if err := m.TapAdd(TapAddRequest{Name: "team", URL: tapDir}); err != nil {
+		t.Fatalf("TapAdd failed: %v", err)
+	}
+	if err := m.TapRemove("team", false); err != nil {
+		t.Fatalf("expected removal without dependents to succeed, got %v", err)
+	}
+}
+
+func TestTrustListAndRevoke(t *testing.T) {
+	manifestPath := filepath.Join(t.TempDir(), "manifest.json")
+	data, err := json.Marshal(testManifest("demo", "1.0.0"))
+	if err != nil {
+		t.Fatalf("encode manifest: %v", err)
+	}
+	if err := os.WriteFile(manifestPath, data, 0o644); err != nil {
+		t.Fatalf("write manifest: %v", err)
+	}
+	m, _ := newInstallTestManager(t, writeTestTap(t), map[string]adapters.Adapter{
+		model.TargetCodex: newStub("codex", nil),
+	})
+
+	ctx := context.Background()
+	if _, err := m.InstallFromURL(ctx, InstallURLRequest{URL: manifestPath, Yes: true, Force: true}); err != nil {
+		t.Fatalf("InstallFromURL failed: %v", err)
+	}
+
+	items, err := m.TrustList()
+	if err != nil {
+		t.Fatalf("TrustList failed: %v", err)
+	}
+	if len(items) != 1 || items[0].URL != manifestPath || items[0].CreatedAt.IsZero() {
+		t.Fatalf("expected one trusted source for %s, got %+v", manifestPath, items)
+	}
+
+	if err := m.TrustRevoke(manifestPath); err != nil {
+		t.Fatalf("TrustRevoke failed: %v", err)
+	}
+	items, err = m.TrustList()
+	if err != nil {
+		t.Fatalf("TrustList failed: %v", err)
+	}
+	if len(items) != 0 {
+		t.Fatalf("expected no trusted sources after revoke, got %+v", items)
+	}
+
+	// Without --yes the revoked source must be re-approved; stdin is not a
+	// terminal in tests so the prompt refuses.
+	if _, err := m.InstallFromURL(ctx, InstallURLRequest{URL: manifestPath, Force: true}); err == nil {
+		t.Fatal("expected install-url to require trust after revoke")
+	}
+
+	if err := m.TrustRevoke(manifestPath); !errors.Is(err, ErrTrustNotFound) || !strings.Contains(err.Error(), "no trust entry for") {
+		t.Fatalf("expected a not-found error revoking an untrusted source, got %v", err)
+	}
+}
+
+func TestTrustAdd_PreApprovedURLInstallsWithoutPrompt(t *testing.T) {
+	manifestPath, _ := writeTestManifest(t, testManifest("demo", "1.0.0"))
+	m, _ := newInstallTestManager(t, writeTestTap(t), map[string]adapters.Adapter{
+		model.TargetCodex: newStub("codex", nil),
+	})
+	ctx := context.Background()
+
+	// stdin is not a terminal in tests, so an unapproved source is refused.
+	if _, err := m.InstallFromURL(ctx, InstallURLRequest{URL: manifestPath, Force: true}); err == nil {
+		t.Fatal("expected install-url to require trust")
+	}
+
+	if err := m.TrustAdd(manifestPath); err != nil {
+		t.Fatalf("TrustAdd failed: %v", err)
+	}
+	if err := m.TrustAdd(manifestPath); err != nil {
+		t.Fatalf("TrustAdd should be idempotent: %v", err)
+	}
+	installed, err := m.InstallFromURL(ctx, InstallURLRequest{URL: manifestPath, Force: true})
+	if err != nil {
+		t.Fatalf("expected pre-approved install to proceed, got %v", err)
+	}
+	if installed.Name != "demo" {
+		t.Fatalf("unexpected install %+v", installed)
+	}
+	if err := m.TrustAdd("  "); err == nil {
+		t.Fatal("expected error for empty url")
+	}
+}
+
+func TestInstallFromURL_VerifiesSignature(t *testing.T) {
+	testutil.FakeCosign(t, "good@example.com")
+	manifestPath, _ := writeTestManifest(t, testManifest("demo", "1.0.0"))
+	sigPath, certPath := testutil.SignatureFiles(t)
+	sig := registry.DetachedSignature{
+		SigURL:     sigPath,
+		CertURL:    certPath,
+		OIDCIssuer: "https://token.actions.githubusercontent.com",
+	}
+	codex := newStub("codex", nil)
+	m, _ := newInstallTestManager(t, writeTestTap(t), map[string]adapters.Adapter{
+		model.TargetCodex: codex,
+	})
+	ctx := context.Background()
+
+	sig.Identities = []string{"mallory@example.com"}
+	_, err := m.InstallFromURL(ctx, InstallURLRequest{URL: manifestPath, Force: true, Signature: sig})
+	if !errors.Is(err, ErrTrustRequired) || !strings.Contains(err.Error(), "none of the expected identities matched") {
+		t.Fatalf("expected a trust error carrying cosign's output, got %v", err)
+	}
+	if items, _ := m.TrustList(); len(items) != 0 || len(codex.servers) != 0 {
+		t.Fatalf("expected nothing trusted or written after a failed check, got %+v, %v", items, codex.servers)
+	}
+
+	// A verified signature replaces the trust prompt, which would refuse here.
+	sig.Identities = []string{"mallory@example.com", "good@example.com"}
+	if _, err := m.InstallFromURL(ctx, InstallURLRequest{URL: manifestPath, Force: true, Signature: sig}); err != nil {
+		t.Fatalf("InstallFromURL failed: %v", err)
+	}
+	// The signature vouched for that one manifest only; it is not a
+	// standing approval for unsigned installs of the URL.
+	if items, _ := m.TrustList(); len(items) != 0 {
+		t.Fatalf("expected no trust entry from a signature, got %+v", items)
+	}
+	if _, err := m.InstallFromURL(ctx, InstallURLRequest{URL: manifestPath, Force: true}); !errors.Is(err, ErrTrustRequired) {
+		t.Fatalf("expected an unsigned install to need trust again, got %v", err)
+	}
+
+	// A source approved by hand records who signed it.
+	if err := m.TrustAdd(manifestPath); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.InstallFromURL(ctx, InstallURLRequest{URL: manifestPath, Force: true, Signature: sig}); err != nil {
+		t.Fatalf("InstallFromURL failed: %v", err)
+	}
+	items, err := m.TrustList()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || items[0].Identity != "good@example.com" {
+		t.Fatalf("expected the signer identity recorded with the trust decision, got %+v", items)
+	}
+}
+
+func TestListVersions(t *testing.T) {
+	tapDir := writeTestTap(t,
+		testManifest("demo", "1.0.0"),
+		testManifest("demo", "2.0.0"),
+		testManifest("demo", "1.1.0"),
+	)
+	m, _ := newInstallTestManager(t, tapDir, nil)
+
+	versions, err := m.ListVersions(context.Background(), "demo", "")
+	if err != nil {
+		t.Fatalf("ListVersions failed: %v", err)
+	}
+	want := []string{"2.0.0", "1.1.0", "1.0.0"}
+	if len(versions) != len(want) {
+		t.Fatalf("expected %d versions, got %+v", len(want), versions)
+	}
+	for i, v := range want {
+		if versions[i].Version != v {
+			t.Errorf("position %d: expected %s, got %s", i, v, versions[i].Version)
+		}
+	}
+
+	if _, err := m.ListVersions(context.Background(), "missing", ""); err == nil {
+		t.Fatal("expected error for unknown package")
+	}
+}
+
+func TestInfo_IncludesServerDescription(t *testing.T) {
+	mf := testManifest("demo", "1.0.0")
+	spec := mf.MCPServers["demo"]
+	spec.Description = "Deployment tools"
+	mf.MCPServers["demo"] = spec
+	m, _ := newInstallTestManager(t, writeTestTap(t, mf), nil)
+
+	info, err := m.Info(context.Background(), "demo", "")
+	if err != nil {
+		t.Fatalf("Info failed: %v", err)
+	}
+	if got := info.MCPServers["demo"].Description; got != "Deployment tools" {
+		t.Fatalf("expected server description, got %q", got)
+	}
+	data, err := json.Marshal(info)
+	if err != nil {
+		t.Fatalf("marshal info: %v", err)
+	}
+	if !strings.Contains(string(data), `"description":"Deployment tools"`) {
+		t.Fatalf("expected description in info output, got %s", data)
+	}
+}
+
+func TestInfoAndSearch_IncludeHomepage(t *testing.T) {
+	mf := testManifest("demo", "1.0.0")
+	mf.Homepage = "https://demo.example.com"
+	mf.Repository = "https://github.com/example/demo"
+	m, _ := newInstallTestManager(t, writeTestTap(t, mf), nil)
+	ctx := context.Background()
+
+	info, err := m.Info(ctx, "demo", "")
+	if err != nil {
+		t.Fatalf("Info failed: %v", err)
+	}
+	data, err := json.Marshal(info)
+	if err != nil {
+		t.Fatalf("marshal info: %v", err)
+	}
+	for _, want := range []string{`"homepage":"https://demo.example.com"`, `"repository":"https://github.com/example/demo"`} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("expected %s in info output, got %s", want, data)
+		}
+	}
+
+	results, err := m.Search(ctx, "demo", false)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(results) != 1 || results[0].Homepage != "https://demo.example.com" {
+		t.Errorf("expected homepage in search results, got %+v", results)
+	}
+}
+
+func TestExportToFile(t *testing.T) {
+	tapDir := writeTestTap(t, testManifest("demo", "1.0.0"))
+	m, _ := newInstallTestManager(t, tapDir, map[string]adapters.Adapter{
+		model.TargetCodex: newStub("codex", nil),
+	})
+	if _, err := m.InstallFromTap(context.Background(), InstallRequest{Name: "demo", Force: true}); err != nil {
+		t.Fatalf("InstallFromTap failed: %v", err)
+	}
+
+	outPath := filepath.Join(t.TempDir(), "mcper.lock")
+	written, err := m.ExportToFile(context.Background(), "lock", outPath)
+	if err != nil {
+		t.Fatalf("ExportToFile failed: %v", err)
+	}
+	if written != outPath {
+		t.Fatalf("expected written path %s, got %s", outPath, written)
+	}
+	data, err := os.ReadFile(outPath)
+	if err != nil {
+		t.Fatalf("read export: %v", err)
+	}
+	var lock model.Lockfile
+	if err := json.Unmarshal(data, &lock); err != nil {
+		t.Fatalf("decode lockfile: %v", err)
+	}
+	if len(lock.Packages) != 1 || lock.Packages[0].Name != "demo" {
+		t.Fatalf("expected lockfile with demo, got %+v", lock.Packages)
+	}
+
+	dir := t.TempDir()
+	written, err = m.ExportToFile(context.Background(), "sbom", dir)
+	if err != nil {
+		t.Fatalf("ExportToFile to dir failed: %v", err)
+	}
+	if written != filepath.Join(dir, "mcper-sbom.json") {
+		t.Fatalf("expected default sbom file name, got %s", written)
+	}
+	if _, err := os.Stat(written); err != nil {
+		t.Fatalf("expected sbom file to exist: %v", err)
+	}
+}
+
+func TestExportEnv(t *testing.T) {
+	demo := testManifest("demo", "1.0.0")
+	spec := demo.MCPServers["demo"]
+	spec.EnvRequired = []string{"DEMO_TOKEN", "DEMO_URL"}
+	demo.MCPServers["demo"] = spec
+	demo.MCPServers["demo-admin"] = model.MCPServerSpec{Transport: model.ServerTransportSTDIO, Command: "npx", EnvRequired: []string{"DEMO_TOKEN", "ADMIN_KEY"}}
+	plain := testManifest("plain", "2.0.0")
+
+	m, _ := newInstallTestManager(t, writeTestTap(t, demo, plain), map[string]adapters.Adapter{
+		model.TargetCodex: newStub("codex", nil),
+	})
+	ctx := context.Background()
+	for _, name := range []string{"demo", "plain"} {
+		if _, err := m.InstallFromTap(ctx, InstallRequest{Name: name, Force: true}); err != nil {
+			t.Fatalf("InstallFromTap(%s) failed: %v", name, err)
+		}
+	}
+	if err := m.SecretSet("demo", "DEMO_TOKEN", "s3cret"); err != nil {
+		t.Fatal(err)
+	}
+
+	payload, err := m.Export(ctx, "env")
+	if err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	out := string(payload)
+	if !strings.Contains(out, "\n# demo@1.0.0\nADMIN_KEY=\nDEMO_TOKEN=\nDEMO_URL=") {
+		t.Errorf("expected sorted empty assignments under a demo heading, got:\n%s", out)
+	}
+	if strings.Count(out, "DEMO_TOKEN=") != 1 {
+		t.Errorf("expected a key shared by two servers once, got:\n%s", out)
+	}
+	if strings.Contains(out, "s3cret") {
+		t.Errorf("expected stored secret values never to be exported, got:\n%s", out)
+	}
+	if strings.Contains(out, "plain") {
+		t.Errorf("expected packages without required env to be skipped, got:\n%s", out)
+	}
+
+	written, err := m.ExportToFile(ctx, "env", t.TempDir())
+	if err != nil {
+		t.Fatalf("ExportToFile failed: %v", err)
+	}
+	if filepath.Base(written) != "mcper.env" {
+		t.Errorf("expected default env file name, got %s", written)
+	}
+}
+
+func TestExpandHostEnv(t *testing.T) {
+	t.Setenv("MCPER_TEST_HOME", "/home/demo")
+	t.Setenv("DEMO_TOKEN", "host-value")
+
+	servers := map[string]model.MCPServerSpec{
+		"expanded": {
+			Transport:     model.ServerTransportSTDIO,
+			Command:       "demo",
+			Args:          []string{"--root=${MCPER_TEST_HOME}/data", "--token=${DEMO_TOKEN}", "${MCPER_TEST_UNSET}"},
+			EnvRequired:   []string{"DEMO_TOKEN"},
+			ExpandHostEnv: true,
+		},
+		"literal": {
+			Transport: model.ServerTransportSTDIO,
+			Command:   "demo",
+			Args:      []string{"--root=${MCPER_TEST_HOME}"},
+		},
+	}
+
+	got := expandHostEnv(servers)
+
+	wantExpanded := []string{"--root=/home/demo/data", "--token=${DEMO_TOKEN}", "${MCPER_TEST_UNSET}"}
+	for i, want := range wantExpanded {
+		if got["expanded"].Args[i] != want {
+			t.Errorf("expanded arg %d: expected %q, got %q", i, want, got["expanded"].Args[i])
+		}
+	}
+	if got["literal"].Args[0] != "--root=${MCPER_TEST_HOME}" {
+		t.Errorf("expected literal args untouched, got %q", got["literal"].Args[0])
+	}
+	if servers["expanded"].Args[0] != "--root=${MCPER_TEST_HOME}/data" {
+		t.Errorf("expected input specs to be left unmodified")
+	}
+}
+
+func TestInstallFromTap_ExpandsHostEnv(t *testing.T) {
+	t.Setenv("MCPER_TEST_HOME", "/home/demo")
+	mf := testManifest("demo", "1.0.0")
+	spec := mf.MCPServers["demo"]
+	spec.Args = []string{"--root", "${MCPER_TEST_HOME}"}
+	spec.ExpandHostEnv = true
+	mf.MCPServers["demo"] = spec
+
+	codex := newStub("codex", nil)
+	m, _ := newInstallTestManager(t, writeTestTap(t, mf), map[string]adapters.Adapter{
+		model.TargetCodex: codex,
+	})
+	if _, err := m.InstallFromTap(context.Background(), InstallRequest{Name: "demo", Force: true}); err != nil {
+		t.Fatalf("InstallFromTap failed: %v", err)
+	}
+	if got := codex.servers["demo"].Args; len(got) != 2 || got[1] != "/home/demo" {
+		t.Fatalf("expected expanded args written to adapter, got %v", got)
+	}
+}
+
+func writeTestManifest(t *testing.T, mf model.PackageManifest) (string, string) {
+	t.Helper()
+	data, err := json.Marshal(mf)
+	if err != nil {
+		t.Fatalf("encode manifest: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "manifest.json")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatalf("write manifest: %v", err)
+	}
+	return path, fsutil.SHA256Hex(data)
+}
+
+func TestInstallFromTap_InlineSecretsSharedAcrossServers(t *testing.T) {
+	mf := testManifest("demo", "1.0.0")
+	mf.MCPServers = map[string]model.MCPServerSpec{
+		"alpha": {Transport: model.ServerTransportSTDIO, Command: "go", Args: []string{"alpha"}, EnvRequired: []string{"API_TOKEN"}},
+		"beta":  {Transport: model.ServerTransportSTDIO, Command: "go", Args: []string{"beta"}, Env: map[string]string{"MODE": "ro"}, EnvRequired: []string{"API_TOKEN", "UNSET_KEY"}},
+		"gamma": {Transport: model.ServerTransportSTDIO, Command: "go", Args: []string{"gamma"}},
+	}
+	stub := newStub("codex", nil)
+	m, _ := newInstallTestManager(t, writeTestTap(t, mf), map[string]adapters.Adapter{
+		model.TargetCodex: stub,
+	})
+	if err := m.secret.Set("demo", "API_TOKEN", "s3cret"); err != nil {
+		t.Fatal(err)
+	}
+
+	installed, err := m.InstallFromTap(context.Background(), InstallRequest{Name: "demo", Force: true, InlineSecrets: true})
+	if err != nil {
+		t.Fatalf("InstallFromTap failed: %v", err)
+	}
+	for _, name := range []string{"alpha", "beta"} {
+		if got := stub.servers[name].Env["API_TOKEN"]; got != "s3cret" {
+			t.Errorf("expected %s to receive API_TOKEN, got %q", name, got)
+		}
+	}
+	if got := stub.servers["beta"].Env["MODE"]; got != "ro" {
+		t.Errorf("expected beta to keep its manifest env, got %v", stub.servers["beta"].Env)
+	}
+	if _, ok := stub.servers["beta"].Env["UNSET_KEY"]; ok {
+		t.Error("expected keys without a stored secret to be skipped")
+	}
+	if len(stub.servers["gamma"].Env) != 0 {
+		t.Errorf("expected gamma to get no env, got %v", stub.servers["gamma"].Env)
+	}
+	if mf.MCPServers["alpha"].Env != nil {
+		t.Error("expected manifest specs to be left unmodified")
+	}
+	want := map[string][]string{"alpha": {"API_TOKEN"}, "beta": {"API_TOKEN"}}
+	if !reflect.DeepEqual(installed.InlinedEnv, want) {
+		t.Errorf("expected inlined env %v, got %v", want, installed.InlinedEnv)
+	}
+}
+
+func TestInstallFromTap_NoInlineSecretsByDefault(t *testing.T) {
+	mf := testManifest("demo", "1.0.0")
+	spec := mf.MCPServers["demo"]
+	spec.EnvRequired = []string{"API_TOKEN"}
+	mf.MCPServers["demo"] = spec
+	stub := newStub("codex", nil)
+	m, _ := newInstallTestManager(t, writeTestTap(t, mf), map[string]adapters.Adapter{
+		model.TargetCodex: stub,
+	})
+	if err := m.secret.Set("demo", "API_TOKEN", "s3cret"); err != nil {
+		t.Fatal(err)
+	}
+
+	installed, err := m.InstallFromTap(context.Background(), InstallRequest{Name: "demo", Force: true})
+	if err != nil {
+		t.Fatalf("InstallFromTap failed: %v", err)
+	}
+	if len(stub.servers["demo"].Env) != 0 || installed.InlinedEnv != nil {
+		t.Errorf("expected secrets to stay out of the client config, got %v / %v", stub.servers["demo"].Env, installed.InlinedEnv)
+	}
+}
+
+func TestInstallFromTap_WithoutInlineSecretsStripsInlinedValues(t *testing.T) {
+	mf := testManifest("demo", "1.0.0")
+	spec := mf.MCPServers["demo"]
+	spec.EnvRequired = []string{"API_TOKEN"}
+	mf.MCPServers["demo"] = spec
+	dir := t.TempDir()
+	adapter := adapters.NewGenericJSONAdapter(model.TargetCursor, filepath.Join(dir, "mcp.json"), filepath.Join(dir, "backups"), []string{"mcpServers"}, nil, nil)
+	m, _ := newInstallTestManager(t, writeTestTap(t, mf), map[string]adapters.Adapter{
+		model.TargetCursor: adapter,
+	})
+	if err := m.secret.Set("demo", "API_TOKEN", "s3cret"); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if _, err := m.InstallFromTap(ctx, InstallRequest{Name: "demo", Force: true, InlineSecrets: true}); err != nil {
+		t.Fatalf("InstallFromTap failed: %v", err)
+	}
+	servers, err := adapter.ListServers(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := servers["demo"].Env["API_TOKEN"]; got != "s3cret" {
+		t.Fatalf("expected the secret inlined first, got %q", got)
+	}
+	// An env value the user added by hand must survive the reinstall.
+	edited := servers["demo"]
+	edited.Env["LOG_LEVEL"] = "debug"
+	if err := adapter.UpsertServers(ctx, map[string]model.MCPServerSpec{"demo": edited}); err != nil {
+		t.Fatal(err)
+	}
+
+	installed, err := m.InstallFromTap(ctx, InstallRequest{Name: "demo", Force: true})
+	if err != nil {
+		t.Fatalf("InstallFromTap failed: %v", err)
+	}
+	servers, err = adapter.ListServers(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := servers["demo"].Env["API_TOKEN"]; ok {
+		t.Errorf("expected the inlined secret removed from the config, got %v", servers["demo"].Env)
+	}
+	if got := servers["demo"].Env["LOG_LEVEL"]; got != "debug" {
+		t.Errorf("expected user env kept, got %v", servers["demo"].Env)
+	}
+	if installed.InlinedEnv != nil {
+		t.Errorf("expected no inlined env recorded, got %v", installed.InlinedEnv)
+	}
+}
+
+func TestInstalledServers_ReadsCurrentConfig(t *testing.T) {
+	mf := testManifest("demo", "1.0.0")
+	mf.MCPServers["docs"] = model.MCPServerSpec{Transport: model.ServerTransportHTTP, URL: "https://example.com/mcp"}
+	stub := newStub("codex", nil)
+	m, _ := newInstallTestManager(t, writeTestTap(t, mf), map[string]adapters.Adapter{
+		model.TargetCodex: stub,
+	})
+	installed, err := m.InstallFromTap(context.Background(), InstallRequest{Name: "demo", Force: true})
+	if err != nil {
+		t.Fatalf("InstallFromTap failed: %v", err)
+	}
+	// The user edited the command by hand; list should show what is configured.
+	stub.servers["demo"] = model.MCPServerSpec{Transport: model.ServerTransportSTDIO, Command: "uvx", Args: []string{"demo-server"}}
+	delete(stub.servers, "docs")
+
+	got := m.InstalledServers(context.Background(), installed)
+	want := []InstalledServer{
+		{Target: model.TargetCodex, Name: "demo", Summary: "command: uvx demo-server"},
+		{Target: model.TargetCodex, Name: "docs", Missing: true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+}
+
+// probeAdapter reports overlapping UpsertServers calls to a probe shared by
+// every adapter in a test.
+type probeAdapter struct {
+	*stubAdapter
+	probe *concurrencyProbe
+}
+
+type concurrencyProbe struct {
+	mu        sync.Mutex
+	cur, peak int
+}
+
+func (p *probeAdapter) UpsertServers(ctx context.Context, specs map[string]model.MCPServerSpec) error {
+	p.probe.mu.Lock()
+	p.probe.cur++
+	p.probe.peak = max(p.probe.peak, p.probe.cur)
+	p.probe.mu.Unlock()
+	time.Sleep(20 * time.Millisecond)
+	p.probe.mu.Lock()
+	p.probe.cur--
+	p.probe.mu.Unlock()
+	return p.stubAdapter.UpsertServers(ctx, specs)
+}
+
+func TestApplyInstall_ConcurrencyCapsParallelTargets(t *testing.T) {
+	for _, concurrency := range []int{1, 2} {
+		probe := &concurrencyProbe{}
+		adapterMap := map[string]adapters.Adapter{}
+		for _, name := range []string{model.TargetClaude, model.TargetCodex, model.TargetCursor} {
+			adapterMap[name] = &probeAdapter{stubAdapter: newStub(name, nil), probe: probe}
+		}
+		m, _ := newInstallTestManager(t, writeTestTap(t, testManifest("demo", "1.0.0")), adapterMap)
+		m.concurrency = concurrency
+
+		if _, err := m.InstallFromTap(context.Background(), InstallRequest{Name: "demo", Target: "claude,codex,cursor", Force: true}); err != nil {
+			t.Fatalf("InstallFromTap failed: %v", err)
+		}
+		if probe.peak > concurrency {
+			t.Errorf("concurrency %d: saw %d concurrent config writes", concurrency, probe.peak)
+		}
+		for name, a := range adapterMap {
+			if _, ok := a.(*probeAdapter).servers["demo"]; !ok {
+				t.Errorf("concurrency %d: expected demo in %s", concurrency, name)
+			}
+		}
+	}
+}
+
+func TestInstallNoVerifyRecordsUnverified(t *testing.T) {
+	tapDir := writeTestTap(t, testManifest("demo", "1.0.0"), testManifest("demo", "1.1.0"))
+	m, buf := newInstallTestManager(t, tapDir, map[string]adapters.Adapter{
+		model.TargetCodex: newStub("codex", nil),
+	})
+	ctx := context.Background()
+
+	installed, err := m.InstallFromTap(ctx, InstallRequest{Name: "demo", Version: "1.0.0", Force: true, NoVerify: true})
+	if err != nil {
+		t.Fatalf("InstallFromTap: %v", err)
+	}
+	if !installed.Unverified {
+		t.Error("expected the install marked unverified")
+	}
+	if !strings.Contains(buf.String(), "WARNING: installing demo@1.0.0 WITHOUT verifying") {
+		t.Errorf("expected a loud warning, got:\n%s", buf.String())
+	}
+	st, err := m.store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !st.Installed["demo"].Unverified {
+		t.Error("expected state to record the unverified install")
+	}
+
+	// A verified install of a newer version clears the marker.
+	buf.Reset()
+	installed, err = m.InstallFromTap(ctx, InstallRequest{Name: "demo", Force: true})
+	if err != nil {
+		t.Fatalf("InstallFromTap: %v", err)
+	}
+	if installed.Unverified || strings.Contains(buf.String(), "WITHOUT verifying") {
+		t.Errorf("expected a verified install without warning, got %+v:\n%s", installed, buf.String())
+	}
+
+	entries, err := m.History()
+	if err != nil {
+		t.Fatalf("History: %v", err)
+	}
+	if len(entries) != 2 || !entries[0].Unverified || entries[1].Unverified {
+		t.Errorf("expected only the first install recorded as unverified, got %+v", entries)
+	}
+
+	// Upgrades and reinstalls record whether their own resolve was verified.
+	if _, err := m.InstallFromTap(ctx, InstallRequest{Name: "demo", Version: "1.0.0", Force: true, NoVerify: true}); err != nil {
+		t.Fatalf("InstallFromTap: %v", err)
+	}
+	if _, err := m.Reinstall(ctx, ReinstallRequest{Names: []string{"demo"}}); err != nil {
+		t.Fatalf("Reinstall: %v", err)
+	}
+	if st, err := m.store.Load(); err != nil || st.Installed["demo"].Unverified {
+		t.Errorf("expected a verified reinstall to clear the marker, got %+v, %v", st.Installed["demo"], err)
+	}
+	if _, err := m.InstallFromTap(ctx, InstallRequest{Name: "demo", Version: "1.0.0", Force: true, NoVerify: true}); err != nil {
+		t.Fatalf("InstallFromTap: %v", err)
+	}
+	if _, err := m.Upgrade(ctx, UpgradeRequest{Name: "demo"}); err != nil {
+		t.Fatalf("Upgrade: %v", err)
+	}
+	if st, err := m.store.Load(); err != nil || st.Installed["demo"].Unverified {
+		t.Errorf("expected a verified upgrade to clear the marker, got %+v, %v", st.Installed["demo"], err)
+	}
+}
+
+func TestInstallFromTap_ManifestPathOverride(t *testing.T) {
+	local := testManifest("demo", "1.0.0")
+	local.MCPServers["demo"] = model.MCPServerSpec{Transport: model.ServerTransportSTDIO, Command: "npx", Args: []string{"-y", "demo@dev"}}
+	path, digest := writeTestManifest(t, local)
+	stub := newStub("codex", nil)
+	m, out := newInstallTestManager(t, writeTestTap(t, testManifest("demo", "1.0.0")), map[string]adapters.Adapter{
+		model.TargetCodex: stub,
+	})
+	ctx := context.Background()
+
+	if _, err := m.InstallFromTap(ctx, InstallRequest{Name: "other", ManifestPath: path, Force: true}); err == nil || !strings.Contains(err.Error(), `is for "demo"`) {
+		t.Fatalf("expected a name mismatch error, got %v", err)
+	}
+	if _, err := m.InstallFromTap(ctx, InstallRequest{Name: "demo", Version: "1.0.0", ManifestPath: path, Force: true}); err == nil {
+		t.Fatal("expected an explicit version to be refused with --manifest-path")
+	}
+
+	installed, err := m.InstallFromTap(ctx, InstallRequest{Name: "demo", ManifestPath: path, Force: true})
+	if err != nil {
+		t.Fatalf("InstallFromTap: %v", err)
+	}
+	if args := stub.servers["demo"].Args; len(args) != 2 || args[1] != "demo@dev" {
+		t.Errorf("expected the local manifest applied, got args %v", args)
+	}
+	abs, _ := filepath.Abs(path)
+	if installed.Source != (model.SourceRef{Type: model.SourceTypeTap, Tap: model.DefaultTapName, ManifestPath: abs}) || installed.ManifestDigest != digest {
+		t.Errorf("expected the tap recorded as source with the local file and digest, got %+v", installed)
+	}
+	if !installed.Unverified {
+		t.Error("expected the override to be recorded as unverified")
+	}
+	if !strings.Contains(out.String(), "in place of demo from tap") || !strings.Contains(out.String(), "WITHOUT verifying") {
+		t.Errorf("expected warnings about the override, got:\n%s", out.String())
+	}
+
+	// Every path that re-reads the installed manifest reads the local file.
+	if _, err := m.Reinstall(ctx, ReinstallRequest{Names: []string{"demo"}}); err != nil {
+		t.Fatalf("Reinstall: %v", err)
+	}
+	if st, err := m.store.Load(); err != nil || !st.Installed["demo"].Unverified {
+		t.Errorf("expected the reinstall to stay unverified, got %+v, %v", st.Installed["demo"], err)
+	}
+	if _, err := m.Upgrade(ctx, UpgradeRequest{Name: "demo", ServersOnly: true}); err != nil {
+		t.Fatalf("upgrade --servers-only: %v", err)
+	}
+	if issues, err := m.Doctor(ctx, DoctorRequest{Package: "demo"}); err != nil || len(issues) != 0 {
+		t.Fatalf("expected a clean doctor run, got %v, %v", issues, err)
+	}
+	if _, err := m.Export(ctx, "bundle"); err != nil {
+		t.Fatalf("bundle export: %v", err)
+	}
+	if args := stub.servers["demo"].Args; len(args) != 2 || args[1] != "demo@dev" {
+		t.Errorf("expected the local manifest kept, got args %v", args)
+	}
+
+	bad := local
+	bad.MCPServers = nil
+	badPath, _ := writeTestManifest(t, bad)
+	if _, err := m.InstallFromTap(ctx, InstallRequest{Name: "demo", ManifestPath: badPath, Force: true}); err == nil {
+		t.Error("expected an invalid local manifest to be rejected")
+	}
+}
+
+func TestInstallFromFile_EnforcesHash(t *testing.T) {
+	path, digest := writeTestManifest(t, testManifest("demo", "1.0.0"))
+	m, _ := newInstallTestManager(t, writeTestTap(t), map[string]adapters.Adapter{
+		model.TargetCodex: newStub("codex", nil),
+	})
+	ctx := context.Background()
+
+	_, err := m.InstallFromFile(ctx, InstallFileRequest{Path: path, SHA256: strings.Repeat("0", 64), Force: true})
+	if err == nil || !strings.Contains(err.Error(), "hash mismatch") {
+		t.Fatalf("expected hash mismatch error, got %v", err)
+	}
+	if pkgs, _ := m.ListInstalled(); len(pkgs) != 0 {
+		t.Fatalf("expected nothing installed after mismatch, got %+v", pkgs)
+	}
+
+	installed, err := m.InstallFromFile(ctx, InstallFileRequest{Path: path, SHA256: strings.ToUpper(digest), Force: true})
+	if err != nil {
+		t.Fatalf("InstallFromFile failed: %v", err)
+	}
+	if installed.Source.Type != model.SourceTypeDirect || installed.Source.URL != "file://"+path {
+		t.Fatalf("expected direct file source for %s, got %+v", path, installed.Source)
+	}
+	if installed.ManifestDigest != digest {
+		t.Fatalf("expected digest %s, got %s", digest, installed.ManifestDigest)
+	}
+	if trusted, _ := m.TrustList(); len(trusted) != 0 {
+		t.Fatalf("expected no trust decision for file installs, got %+v", trusted)
+	}
+}
+
+func seedBackupSets(t *testing.T, names ...string) string {
+	t.Helper()
+	backupDir, err := paths.BackupDir()
+	if err != nil {
+		t.Fatalf("BackupDir failed: %v", err)
+	}
+	for _, name := range names {
+		if err := os.MkdirAll(filepath.Join(backupDir, name), 0o755); err != nil {
+			t.Fatalf("seed backup: %v", err)
+		}
+	}
+	return backupDir
+}
+
+func countDirs(t *testing.T, dir string) int {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("read %s: %v", dir, err)
+	}
+	return len(entries)
+}
+
+func TestInstallFromTap_PrunesBackupsOnlyWhenRequested(t *testing.T) {
+	tapDir := writeTestTap(t, testManifest("demo", "1.0.0"))
+	m, _ := newInstallTestManager(t, tapDir, map[string]adapters.Adapter{
+		model.TargetCodex: newStub("codex", nil),
+	})
+	backupDir := seedBackupSets(t, "20240101T000000Z", "20240102T000000Z", "20240103T000000Z")
+	ctx := context.Background()
+
+	if _, err := m.InstallFromTap(ctx, InstallRequest{Name: "demo", Force: true}); err != nil {
+		t.Fatalf("InstallFromTap failed: %v", err)
+	}
+	if n := countDirs(t, backupDir); n != 3 {
+		t.Fatalf("expected backups untouched without retention, got %d", n)
+	}
+
+	if _, err := m.InstallFromTap(ctx, InstallRequest{Name: "missing", Force: true, KeepBackups: 1}); err == nil {
+		t.Fatal("expected install of unknown package to fail")
+	}
+	if n := countDirs(t, backupDir); n != 3 {
+		t.Fatalf("expected backups untouched after failed install, got %d", n)
+	}
+
+	if _, err := m.InstallFromTap(ctx, InstallRequest{Name: "demo", Force: true, KeepBackups: 1}); err != nil {
+		t.Fatalf("InstallFromTap failed: %v", err)
+	}
+	if n := countDirs(t, backupDir); n != 1 {
+		t.Fatalf("expected one backup set kept, got %d", n)
+	}
+	if _, err := os.Stat(filepath.Join(backupDir, "20240103T000000Z")); err != nil {
+		t.Fatalf("expected newest backup kept: %v", err)
+	}
+}
+
+func TestRemove_PurgesSecretsUnlessKept(t *testing.T) {
+	mf := testManifest("demo", "1.0.0")
+	spec := mf.MCPServers["demo"]
+	spec.EnvRequired = []string{"API_TOKEN"}
+	mf.MCPServers["demo"] = spec
+	tapDir := writeTestTap(t, mf)
+
+	for _, keep := range []bool{false, true} {
+		m, _ := newInstallTestManager(t, tapDir, map[string]adapters.Adapter{
+			model.TargetCodex: newStub("codex", nil),
+		})
+		if _, err := m.InstallFromTap(context.Background(), InstallRequest{Name: "demo", Force: true}); err != nil {
+			t.Fatalf("InstallFromTap: %v", err)
+		}
+		if err := m.SecretSet("demo", "API_TOKEN", "tok"); err != nil {
+			t.Fatalf("SecretSet: %v", err)
+		}
+		if err := m.SecretSet("demo", "EXTRA", "x"); err != nil {
+			t.Fatalf("SecretSet: %v", err)
+		}
+		st, err := m.store.Load()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := st.Installed["demo"].SecretKeys; len(got) != 2 || got[0] != "API_TOKEN" || got[1] != "EXTRA" {
+			t.Fatalf("expected tracked secret keys [API_TOKEN EXTRA], got %v", got)
+		}
+
+		if _, err := m.Remove(context.Background(), RemoveRequest{Name: "demo", KeepSecrets: keep}); err != nil {
+			t.Fatalf("Remove: %v", err)
+		}
+		for _, key := range []string{"API_TOKEN", "EXTRA"} {
+			_, err := m.secret.Get("demo", key)
+			if keep && err != nil {
+				t.Fatalf("expected %s to be kept, got %v", key, err)
+			}
+			if !keep && err == nil {
+				t.Fatalf("expected %s to be purged", key)
+			}
+		}
+	}
+}
+
+// failingAdapter wraps a stub and fails upserts or removals on demand.
+type failingAdapter struct {
+	*stubAdapter
+	upsertErr error
+	removeErr error
+}
+
+func (f *failingAdapter) UpsertServers(ctx context.Context, specs map[string]model.MCPServerSpec) error {
+	if f.upsertErr != nil {
+		return f.upsertErr
+	}
+	return f.stubAdapter.UpsertServers(ctx, specs)
+}
+
+func (f *failingAdapter) RemoveServers(ctx context.Context, names []string) error {
+	if f.removeErr != nil {
+		return f.removeErr
+	}
+	return f.stubAdapter.RemoveServers(ctx, names)
+}
+
+func TestInstallFromTap_ReportsFailedRollback(t *testing.T) {
+	tapDir := writeTestTap(t, testManifest("demo", "1.0.0"))
+	claude := &failingAdapter{stubAdapter: newStub("claude", nil), removeErr: errors.New("disk full")}
+	codex := newStub("codex", nil)
+	cursor := &failingAdapter{stubAdapter: newStub("cursor", nil), upsertErr: errors.New("permission denied")}
+	zed := newStub("zed", nil)
+	m, _ := newInstallTestManager(t, tapDir, map[string]adapters.Adapter{
+		model.TargetClaude: claude,
+		model.TargetCodex:  codex,
+		model.TargetCursor: cursor,
+		model.TargetZed:    zed,
+	})
+
+	_, err := m.InstallFromTap(context.Background(), InstallRequest{Name: "demo", Target: "claude,codex,cursor,zed", Force: true})
+	var partial *PartialApplyError
+	if !errors.As(err, &partial) {
+		t.Fatalf("expected PartialApplyError, got %v", err)
+	}
+	want := map[string]string{
+		"claude": TargetRollbackFailed,
+		"codex":  TargetRolledBack,
+		"cursor": TargetApplyFailed,
+		"zed":    TargetNotAttempted,
+	}
+	if len(partial.Outcomes) != len(want) {
+		t.Fatalf("expected %d outcomes, got %+v", len(want), partial.Outcomes)
+	}
+	for _, o := range partial.Outcomes {
+		if want[o.Target] != o.State {
+			t.Errorf("target %s: expected %q, got %q", o.Target, want[o.Target], o.State)
+		}
+	}
+	for _, target := range []string{"claude", "codex", "cursor", "zed", "disk full", "permission denied"} {
+		if !strings.Contains(err.Error(), target) {
+			t.Errorf("expected error to mention %q: %v", target, err)
+		}
+	}
+	if _, ok := codex.servers["demo"]; ok {
+		t.Error("expected codex to be rolled back")
+	}
+	if len(zed.servers) != 0 {
+		t.Error("expected zed to be untouched")
+	}
+}
+
+func TestInstallFromTap_CleanRollbackKeepsPlainError(t *testing.T) {
+	tapDir := writeTestTap(t, testManifest("demo", "1.0.0"))
+	codex := newStub("codex", nil)
+	cursor := &failingAdapter{stubAdapter: newStub("cursor", nil), upsertErr: errors.New("permission denied")}
+	m, _ := newInstallTestManager(t, tapDir, map[string]adapters.Adapter{
+		model.TargetCodex:  codex,
+		model.TargetCursor: cursor,
+	})
+
+	_, err := m.InstallFromTap(context.Background(), InstallRequest{Name: "demo", Target: "codex,cursor", Force: true})
+	if err == nil {
+		t.Fatal("expected install error")
+	}
+	var partial *PartialApplyError
+	if errors.As(err, &partial) {
+		t.Fatalf("expected plain error after clean rollback, got %v", err)
+	}
+	if len(codex.servers) != 0 {
+		t.Error("expected codex to be rolled back")
+	}
+}
+
+func TestInstallFromTap_CanceledWritesNothing(t *testing.T) {
+	codex := newStub("codex", nil)
+	m, _ := newInstallTestManager(t, writeTestTap(t, testManifest("demo", "1.0.0")), map[string]adapters.Adapter{
+		model.TargetCodex: codex,
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := m.InstallFromTap(ctx, InstallRequest{Name: "demo", Force: true}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected a canceled install, got %v", err)
+	}
+	if len(codex.servers) != 0 {
+		t.Errorf("expected no config writes, got %v", codex.servers)
+	}
+	if pkgs, err := m.ListInstalled(); err != nil || len(pkgs) != 0 {
+		t.Errorf("expected nothing recorded in state, got %+v, %v", pkgs, err)
+	}
+}
+
+func TestInstallChecksRequiredTools(t *testing.T) {
+	ctx := context.Background()
+	mf := testManifest("demo", "1.0.0")
+	mf.RequiredTools = []string{"sh", "mcper-test-missing-tool"}
+	codex := newStub("codex", nil)
+	m, buf := newInstallTestManager(t, writeTestTap(t, mf), map[string]adapters.Adapter{
+		model.TargetCodex: codex,
+	})
+
+	_, err := m.InstallFromTap(ctx, InstallRequest{Name: "demo", Force: true, Strict: true})
+	if err == nil || !strings.Contains(err.Error(), "mcper-test-missing-tool") || strings.Contains(err.Error(), "sh,") {
+		t.Fatalf("expected strict install to fail naming only the missing tool, got %v", err)
+	}
+	if len(codex.servers) != 0 {
+		t.Fatal("expected nothing written by a refused install")
+	}
+
+	if _, err := m.InstallFromTap(ctx, InstallRequest{Name: "demo", Force: true}); err != nil {
+		t.Fatalf("InstallFromTap: %v", err)
+	}
+	if !strings.Contains(buf.String(), "Warning: demo requires mcper-test-missing-tool on PATH") {
+		t.Errorf("expected a missing tool warning, got:\n%s", buf.String())
+	}
+
+	issues, err := m.Doctor(ctx, DoctorRequest{Package: "demo"})
+	if err != nil {
+		t.Fatalf("Doctor: %v", err)
+	}
+	found := false
+	for _, issue := range issues {
+		if issue.Kind == "missing_tool" {
+			found = strings.HasPrefix(issue.Detail, "mcper-test-missing-tool ")
+		}
+	}
+	if !found {
+		t.Errorf("expected doctor to report the missing tool, got %+v", issues)
+	}
+}
+
+func TestInstallToRegisteredClient(t *testing.T) {
+	niche := newStub("niche", nil)
+	if err := adapters.RegisterClient(adapters.ClientDef{
+		Target: "niche",
+		Label:  "Niche Editor",
+		New:    func(string) (adapters.Adapter, error) { return niche, nil },
+	}); err != nil {
+		t.Fatalf("RegisterClient: %v", err)
+	}
+	t.Cleanup(func() { adapters.UnregisterClient("niche") })
+
+	m, _ := newInstallTestManager(t, writeTestTap(t, testManifest("demo", "1.0.0")), map[string]adapters.Adapter{
+		model.TargetCodex: newStub("codex", nil),
+		"niche":           niche,
+	})
+	installed, err := m.InstallFromTap(context.Background(), InstallRequest{Name: "demo", Target: "niche", Force: true})
+	if err != nil {
+		t.Fatalf("InstallFromTap: %v", err)
+	}
+	if len(installed.Targets) != 1 || installed.Targets[0] != "niche" {
+		t.Fatalf("expected demo installed to niche, got %v", installed.Targets)
+	}
+	if _, ok := niche.servers["demo"]; !ok {
+		t.Error("expected demo written through the registered client")
+	}
 }
@@ -0,0 +1,111 @@
+package service
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/sarjann/mcper/internal/model"
+	"github.com/sarjann/mcper/internal/state"
+)
+
+// DefaultRedactPatterns match the token formats of common API providers.
+// They apply until the redact-patterns setting replaces them.
+var DefaultRedactPatterns = []string{
+	`sk-[A-Za-z0-9_-]{16,}`,                 // OpenAI, Anthropic and similar secret keys
+	`gh[pousr]_[A-Za-z0-9]{20,}`,            // GitHub tokens
+	`github_pat_[A-Za-z0-9_]{20,}`,          // GitHub fine-grained tokens
+	`glpat-[A-Za-z0-9_-]{20,}`,              // GitLab personal access tokens
+	`xox[abprs]-[A-Za-z0-9-]{10,}`,          // Slack tokens
+	`AKIA[0-9A-Z]{16}`,                      // AWS access key IDs
+	`AIza[0-9A-Za-z_-]{35}`,                 // Google API keys
+	`(?i)bearer\s+[A-Za-z0-9._~+/-]{16,}=*`, // Authorization header values
+}
+
+// redactNone as the redact-patterns setting turns redaction off.
+const redactNone = "none"
+
+// Redacted replaces every match of a redaction pattern.
+const Redacted = "[REDACTED]"
+
+// Redactor masks text matching any of its patterns.
+type Redactor struct {
+	patterns []*regexp.Regexp
+}
+
+// NewRedactor compiles patterns, naming the first that is not a valid
+// regular expression.
+func NewRedactor(patterns []string) (*Redactor, error) {
+	r := &Redactor{}
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redact pattern %q: %w", p, err)
+		}
+		r.patterns = append(r.patterns, re)
+	}
+	return r, nil
+}
+
+// redactPatterns returns the patterns the settings select.
+func redactPatterns(s model.Settings) []string {
+	switch value := strings.TrimSpace(s.RedactPatterns); value {
+	case "":
+		return DefaultRedactPatterns
+	case redactNone:
+		return nil
+	default:
+		return strings.Fields(value)
+	}
+}
+
+// LoadRedactor builds the redactor for the redact-patterns setting. Output
+// must never go unredacted because state is unreadable, so any failure
+// falls back to the default patterns.
+func LoadRedactor() *Redactor {
+	fallback, _ := NewRedactor(DefaultRedactPatterns)
+	store, err := state.NewStore()
+	if err != nil {
+		return fallback
+	}
+	st, err := store.Load()
+	if err != nil {
+		return fallback
+	}
+	r, err := NewRedactor(redactPatterns(st.Settings))
+	if err != nil {
+		return fallback
+	}
+	return r
+}
+
+// Redact returns s with every match replaced by Redacted.
+func (r *Redactor) Redact(s string) string {
+	for _, re := range r.patterns {
+		s = re.ReplaceAllString(s, Redacted)
+	}
+	return s
+}
+
+// Writer wraps w so everything written through it is redacted. Each Write
+// is redacted on its own, so a token split across two writes is missed;
+// the fmt.Fprint family writes each call in one piece.
+func (r *Redactor) Writer(w io.Writer) io.Writer {
+	if len(r.patterns) == 0 {
+		return w
+	}
+	return redactingWriter{r: r, w: w}
+}
+
+type redactingWriter struct {
+	r *Redactor
+	w io.Writer
+}
+
+func (rw redactingWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(rw.w, rw.r.Redact(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
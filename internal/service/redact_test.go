@@ -0,0 +1,49 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/sarjann/mcper/internal/adapters"
+)
+
+func TestRedactorPatternsFromConfig(t *testing.T) {
+	m, _ := newInstallTestManager(t, writeTestTap(t), map[string]adapters.Adapter{})
+	const token = "sk-abcdefghijklmnopqrstuvwx"
+
+	var buf bytes.Buffer
+	fmt.Fprintf(LoadRedactor().Writer(&buf), "env API_TOKEN=%s internal=corp_12345\n", token)
+	if got := buf.String(); got != "env API_TOKEN=[REDACTED] internal=corp_12345\n" {
+		t.Fatalf("expected the default patterns to mask only the sk- token, got %q", got)
+	}
+
+	if err := m.ConfigSet("redact-patterns", "(unclosed"); err == nil {
+		t.Fatal("expected an invalid pattern to be rejected")
+	}
+	if err := m.ConfigSet("redact-patterns", `corp_[0-9]+`); err != nil {
+		t.Fatalf("ConfigSet: %v", err)
+	}
+	if got := LoadRedactor().Redact(token + " corp_12345"); got != token+" [REDACTED]" {
+		t.Fatalf("expected custom patterns to replace the defaults, got %q", got)
+	}
+
+	if err := m.ConfigSet("redact-patterns", "none"); err != nil {
+		t.Fatalf("ConfigSet(none): %v", err)
+	}
+	if got := LoadRedactor().Redact(token); got != token {
+		t.Fatalf("expected none to disable redaction, got %q", got)
+	}
+
+	if err := m.ConfigSet("redact-patterns", "default"); err != nil {
+		t.Fatalf("ConfigSet(default): %v", err)
+	}
+	got, err := m.ConfigGet("redact-patterns")
+	if err != nil {
+		t.Fatalf("ConfigGet: %v", err)
+	}
+	if got != strings.Join(DefaultRedactPatterns, " ") {
+		t.Fatalf("expected default to restore the built-in patterns, got %q", got)
+	}
+}
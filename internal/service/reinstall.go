@@ -0,0 +1,161 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"strings"
+	"time"
+
+	"github.com/sarjann/mcper/internal/model"
+)
+
+// ReinstallRequest rewrites installed packages' servers into their client
+// configs at the recorded version, such as after a client upgrade changed its
+// config schema.
+type ReinstallRequest struct {
+	// Names lists the packages to reinstall; All selects every installed one.
+	Names []string
+	All   bool
+	// DryRun reports each package's plan without writing anything.
+	DryRun      bool
+	KeepBackups int
+}
+
+// ReinstallResult is the outcome for one package. Plan is set for a dry run;
+// Error is set when the package could not be reinstalled.
+type ReinstallResult struct {
+	Name    string       `json:"name"`
+	Version string       `json:"version"`
+	Targets []string     `json:"targets"`
+	Plan    *InstallPlan `json:"plan,omitempty"`
+	Error   string       `json:"error,omitempty"`
+}
+
+// Reinstall re-resolves each selected package at its installed version and
+// re-applies it to its recorded targets, keeping its server mapping, prefix
+// and inlined secrets. A package that fails is reported and the rest still
+// run; the returned error only covers problems before any package started.
+func (m *Manager) Reinstall(ctx context.Context, req ReinstallRequest) ([]ReinstallResult, error) {
+	if req.All == (len(req.Names) > 0) {
+		return nil, errors.New("name packages to reinstall or use --all, not both")
+	}
+	st, err := m.store.Load()
+	if err != nil {
+		return nil, err
+	}
+	pkgs := installedPackages(st)
+	if !req.All {
+		pkgs = pkgs[:0:0]
+		for _, name := range req.Names {
+			pkg, ok := st.Installed[name]
+			if !ok {
+				return nil, fmt.Errorf("%w: %q", ErrNotInstalled, name)
+			}
+			pkgs = append(pkgs, pkg)
+		}
+	}
+
+	results := make([]ReinstallResult, 0, len(pkgs))
+	reinstalled := false
+	for _, pkg := range pkgs {
+		if err := ctx.Err(); err != nil {
+			return results, err
+		}
+		result := ReinstallResult{Name: pkg.Name, Version: pkg.Version, Targets: pkg.Targets}
+		updated, plan, err := m.reinstallPackage(ctx, st, pkg, nil, req.DryRun)
+		switch {
+		case err != nil:
+			result.Error = err.Error()
+		case req.DryRun:
+			result.Plan = &plan
+		default:
+			st.Installed[pkg.Name] = updated
+			result.Targets = updated.Targets
+			reinstalled = true
+		}
+		results = append(results, result)
+	}
+	if !reinstalled {
+		return results, nil
+	}
+
+	if err := m.store.Save(st); err != nil {
+		return results, err
+	}
+	for _, r := range results {
+		if r.Error == "" {
+			m.recordHistory(ctx, HistoryEntry{Action: HistoryReinstall, Package: r.Name, FromVersion: r.Version, ToVersion: r.Version, Targets: r.Targets})
+		}
+	}
+	m.pruneBackups(req.KeepBackups)
+	return results, nil
+}
+
+// reinstallPackage re-applies pkg, or only plans it when dryRun is set. The
+// manifest must still match the digest recorded at install, so a reinstall
+// never silently changes what a version installs. targets limits it to
+// some of pkg's targets, as upgrade --servers-only --target does; nil means
+// all of them.
+func (m *Manager) reinstallPackage(ctx context.Context, st model.State, pkg model.InstalledPackage, targets []string, dryRun bool) (model.InstalledPackage, InstallPlan, error) {
+	resolved, err := m.resolveInstalled(ctx, st, pkg)
+	if err != nil {
+		return model.InstalledPackage{}, InstallPlan{}, err
+	}
+	if pkg.ManifestDigest != "" && !strings.EqualFold(resolved.ManifestDigest, pkg.ManifestDigest) {
+		return model.InstalledPackage{}, InstallPlan{}, fmt.Errorf("manifest changed since install: expected %s got %s", pkg.ManifestDigest, resolved.ManifestDigest)
+	}
+	manifest := withServerPrefix(resolved.Manifest, pkg.ServerPrefix)
+	if targets == nil {
+		targets = pkg.Targets
+	}
+	opts := installOptions{
+		target:        strings.Join(targets, ","),
+		serverTargets: recordedServerTargets(pkg, manifest),
+		force:         true,
+		inlineSecrets: pkg.InlinedEnv != nil,
+		envOverrides:  recordedEnvOverrides(pkg, manifest),
+	}
+
+	if dryRun {
+		opts.inlineSecrets = false
+		placement, _, err := m.placeInstall(ctx, st, manifest, opts)
+		if err != nil {
+			return model.InstalledPackage{}, InstallPlan{}, err
+		}
+		plan, err := m.buildPlacementPlan(ctx, placement)
+		if plan.Conflicts == nil {
+			plan.Conflicts = []ServerConflict{}
+		}
+		if plan.Diffs == nil {
+			plan.Diffs = []ServerDiff{}
+		}
+		return model.InstalledPackage{}, plan, err
+	}
+
+	applied, err := m.applyInstall(ctx, st, manifest, resolved.ManifestDigest, pkg.Source, opts)
+	if err != nil {
+		return model.InstalledPackage{}, InstallPlan{}, err
+	}
+	if len(targets) == len(pkg.Targets) {
+		pkg.Servers = applied.Servers
+		pkg.Targets = applied.Targets
+		pkg.TargetPaths = applied.TargetPaths
+	} else {
+		// The other targets keep what they have, which may be another
+		// version's servers.
+		pkg.TargetPaths = maps.Clone(pkg.TargetPaths)
+		if pkg.TargetPaths == nil {
+			pkg.TargetPaths = make(map[string]string)
+		}
+		maps.Copy(pkg.TargetPaths, applied.TargetPaths)
+	}
+	pkg.ServerTargets = applied.ServerTargets
+	pkg.InlinedEnv = applied.InlinedEnv
+	pkg.EnvOverrides = applied.EnvOverrides
+	pkg.SecretKeys = applied.SecretKeys
+	pkg.Unverified = resolved.Unverified
+	pkg.UpdatedAt = time.Now().UTC()
+	return pkg, InstallPlan{}, nil
+}
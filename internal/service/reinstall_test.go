@@ -0,0 +1,132 @@
+package service
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sarjann/mcper/internal/adapters"
+	"github.com/sarjann/mcper/internal/model"
+)
+
+func TestReinstallAllContinuesPastFailures(t *testing.T) {
+	ctx := context.Background()
+	codex := newStub("codex", nil)
+	claude := newStub("claude", nil)
+	tapDir := writeTestTap(t, testManifest("alpha", "1.0.0"), testManifest("broken", "1.0.0"), testManifest("gamma", "1.0.0"))
+	m, _ := newInstallTestManager(t, tapDir, map[string]adapters.Adapter{
+		model.TargetCodex:  codex,
+		model.TargetClaude: claude,
+	})
+	for _, req := range []InstallRequest{
+		{Name: "alpha", Target: model.TargetCodex},
+		{Name: "broken", Target: model.TargetCodex},
+		{Name: "gamma", Target: model.TargetClaude},
+	} {
+		req.Force = true
+		if _, err := m.InstallFromTap(ctx, req); err != nil {
+			t.Fatalf("InstallFromTap(%s): %v", req.Name, err)
+		}
+	}
+	// The tap now serves different bytes for the installed version.
+	if err := os.WriteFile(filepath.Join(tapDir, "packages", "broken", "1.0.0", "manifest.json"), []byte(`{"schema_version":1}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// Simulate a client rewriting its config and dropping the servers.
+	delete(codex.servers, "alpha")
+	delete(claude.servers, "gamma")
+
+	preview, err := m.Reinstall(ctx, ReinstallRequest{All: true, DryRun: true})
+	if err != nil {
+		t.Fatalf("Reinstall dry run: %v", err)
+	}
+	if len(preview) != 3 || preview[0].Plan == nil || len(preview[0].Plan.Diffs) != 1 {
+		t.Fatalf("expected a plan re-adding alpha, got %+v", preview)
+	}
+	if _, ok := codex.servers["alpha"]; ok {
+		t.Fatal("dry run wrote to the client config")
+	}
+
+	results, err := m.Reinstall(ctx, ReinstallRequest{All: true})
+	if err != nil {
+		t.Fatalf("Reinstall: %v", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("expected a result per package, got %+v", results)
+	}
+	if results[0].Name != "alpha" || results[0].Error != "" || results[2].Name != "gamma" || results[2].Error != "" {
+		t.Errorf("expected alpha and gamma reinstalled, got %+v", results)
+	}
+	if results[1].Name != "broken" || results[1].Error == "" {
+		t.Errorf("expected broken to fail, got %+v", results[1])
+	}
+	if _, ok := codex.servers["alpha"]; !ok {
+		t.Error("expected alpha rewritten to codex")
+	}
+	if _, ok := claude.servers["gamma"]; !ok {
+		t.Error("expected gamma rewritten to claude")
+	}
+	if _, ok := claude.servers["alpha"]; ok {
+		t.Error("expected alpha kept to its recorded target")
+	}
+
+	if _, err := m.Reinstall(ctx, ReinstallRequest{}); err == nil {
+		t.Error("expected an error without names or --all")
+	}
+}
+
+func TestEnvOverridesSurviveReinstall(t *testing.T) {
+	ctx := context.Background()
+	codex := newStub("codex", nil)
+	m, _ := newInstallTestManager(t, writeTestTap(t, testManifest("demo", "1.0.0")), map[string]adapters.Adapter{
+		model.TargetCodex: codex,
+	})
+	if _, err := m.InstallFromTap(ctx, InstallRequest{Name: "demo", Force: true, EnvOverrides: map[string]map[string]string{"nope": {"LOG_LEVEL": "debug"}}}); err == nil {
+		t.Fatal("expected an override for a server not in the manifest to be rejected")
+	}
+	req := InstallRequest{Name: "demo", Force: true, ServerPrefix: "team", EnvOverrides: map[string]map[string]string{"demo": {"LOG_LEVEL": "debug"}}}
+	if _, err := m.InstallFromTap(ctx, req); err != nil {
+		t.Fatalf("InstallFromTap: %v", err)
+	}
+	if got := codex.servers["team-demo"].Env["LOG_LEVEL"]; got != "debug" {
+		t.Fatalf("expected the override written to the config, got %q", got)
+	}
+
+	// A client reset drops the server.
+	delete(codex.servers, "team-demo")
+	if _, err := m.Reinstall(ctx, ReinstallRequest{Names: []string{"demo"}}); err != nil {
+		t.Fatalf("Reinstall: %v", err)
+	}
+	if got := codex.servers["team-demo"].Env["LOG_LEVEL"]; got != "debug" {
+		t.Fatalf("expected reinstall to write the override again, got %q", got)
+	}
+	st, err := m.store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := st.Installed["demo"].EnvOverrides["team-demo"]["LOG_LEVEL"]; got != "debug" {
+		t.Errorf("expected the override kept in state, got %v", st.Installed["demo"].EnvOverrides)
+	}
+
+	// Installing again without --env keeps the recorded overrides, as it
+	// keeps the recorded prefix.
+	if _, err := m.InstallFromTap(ctx, InstallRequest{Name: "demo", Force: true}); err != nil {
+		t.Fatalf("InstallFromTap: %v", err)
+	}
+	if got := codex.servers["team-demo"].Env["LOG_LEVEL"]; got != "debug" {
+		t.Errorf("expected a plain install to keep the override, got %q", got)
+	}
+
+	lock, err := m.Export(ctx, "lock")
+	if err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+	if strings.Contains(string(lock), "debug") || !strings.Contains(string(lock), `"LOG_LEVEL": "`+Redacted+`"`) {
+		t.Errorf("expected the lockfile to list override keys only, got:\n%s", lock)
+	}
+	if st, _ := m.store.Load(); st.Installed["demo"].EnvOverrides["team-demo"]["LOG_LEVEL"] != "debug" {
+		t.Error("expected export to leave state untouched")
+	}
+}
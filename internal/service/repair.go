@@ -0,0 +1,143 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sarjann/mcper/internal/model"
+)
+
+// RepairVersion is the version recorded for packages rebuilt by repair.
+const RepairVersion = "unknown"
+
+type RepairRequest struct {
+	// Yes writes the rebuilt state without asking.
+	Yes bool
+	// DryRun reports what would be recovered without writing state.
+	DryRun bool
+}
+
+// RepairResult lists the packages repair rebuilt and whether they were
+// written to state.
+type RepairResult struct {
+	Recovered []model.InstalledPackage `json:"recovered"`
+	Applied   bool                     `json:"applied"`
+}
+
+// Repair rebuilds install records for servers found in client configs that
+// no recorded package owns, such as after state.json was lost. Each server
+// becomes a package of the same name, covering every detected client that
+// has it, with an unknown source and version; packages already in state are
+// kept as they are. Unless req.Yes is set, the user confirms before state is
+// rewritten.
+func (m *Manager) Repair(ctx context.Context, req RepairRequest) (RepairResult, error) {
+	st, err := m.store.Load()
+	if err != nil {
+		return RepairResult{}, err
+	}
+	recovered, err := m.recoverPackages(ctx, st)
+	if err != nil {
+		return RepairResult{}, err
+	}
+	result := RepairResult{Recovered: recovered}
+	if len(recovered) == 0 || req.DryRun {
+		return result, nil
+	}
+
+	if !req.Yes {
+		if !m.isInteractive() {
+			return result, errors.New("repair rewrites state; use --yes to confirm in non-interactive mode")
+		}
+		formatRepairPlan(m.stdout, recovered)
+		fmt.Fprint(m.stdout, "Proceed? Type 'yes' to continue: ")
+		resp, err := bufio.NewReader(m.stdin).ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return result, fmt.Errorf("read confirmation: %w", err)
+		}
+		if !strings.EqualFold(strings.TrimSpace(resp), "yes") {
+			return result, errors.New("repair canceled")
+		}
+	}
+
+	for _, pkg := range recovered {
+		st.Installed[pkg.Name] = pkg
+	}
+	if err := m.store.Save(st); err != nil {
+		return result, err
+	}
+	result.Applied = true
+	return result, nil
+}
+
+// recoverPackages groups the servers in every detected client by name,
+// skipping servers a recorded package already owns.
+func (m *Manager) recoverPackages(ctx context.Context, st model.State) ([]model.InstalledPackage, error) {
+	owned := make(map[string]bool)
+	for _, pkg := range st.Installed {
+		for _, name := range pkg.Servers {
+			owned[name] = true
+		}
+	}
+
+	targetNames := make([]string, 0, len(m.adapters))
+	for name := range m.adapters {
+		targetNames = append(targetNames, name)
+	}
+	sort.Strings(targetNames)
+
+	now := time.Now().UTC()
+	byName := make(map[string]*model.InstalledPackage)
+	for _, target := range targetNames {
+		adapter := m.adapters[target]
+		servers, err := adapter.ListServers(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("read %s config: %w", target, err)
+		}
+		for _, server := range keys(servers) {
+			if owned[server] {
+				continue
+			}
+			if _, ok := st.Installed[server]; ok {
+				// The name is taken by a package that does not own this server.
+				continue
+			}
+			pkg, ok := byName[server]
+			if !ok {
+				pkg = &model.InstalledPackage{
+					Name:        server,
+					Version:     RepairVersion,
+					Description: servers[server].Description,
+					Source:      model.SourceRef{Type: model.SourceTypeUnknown},
+					Servers:     []string{server},
+					TargetPaths: make(map[string]string),
+					InstalledAt: now,
+					UpdatedAt:   now,
+				}
+				byName[server] = pkg
+			}
+			pkg.Targets = append(pkg.Targets, target)
+			pkg.TargetPaths[target] = adapter.Path()
+		}
+	}
+
+	out := make([]model.InstalledPackage, 0, len(byName))
+	for _, pkg := range byName {
+		out = append(out, *pkg)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
+
+func formatRepairPlan(w io.Writer, recovered []model.InstalledPackage) {
+	fmt.Fprintln(w, "The following packages will be recorded from client configs:")
+	for _, pkg := range recovered {
+		fmt.Fprintf(w, "  %s targets=%s\n", pkg.Name, strings.Join(pkg.Targets, ","))
+	}
+	fmt.Fprintln(w)
+}
@@ -0,0 +1,71 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sarjann/mcper/internal/adapters"
+	"github.com/sarjann/mcper/internal/model"
+)
+
+func TestRepairRebuildsStateFromConfigs(t *testing.T) {
+	ctx := context.Background()
+	spec := model.MCPServerSpec{Transport: model.ServerTransportSTDIO, Command: "sh"}
+	codex := newStub("codex", map[string]model.MCPServerSpec{"alpha": spec, "kept": spec})
+	claude := newStub("claude", map[string]model.MCPServerSpec{"alpha": spec, "beta": spec})
+	m, _ := newInstallTestManager(t, writeTestTap(t, testManifest("kept", "1.0.0")), map[string]adapters.Adapter{
+		model.TargetCodex:  codex,
+		model.TargetClaude: claude,
+	})
+	if _, err := m.InstallFromTap(ctx, InstallRequest{Name: "kept", Target: model.TargetCodex, Force: true}); err != nil {
+		t.Fatalf("InstallFromTap: %v", err)
+	}
+
+	if _, err := m.Repair(ctx, RepairRequest{}); err == nil {
+		t.Fatal("expected repair without --yes to refuse in non-interactive mode")
+	}
+	if pkgs, _ := m.ListInstalled(); len(pkgs) != 1 {
+		t.Fatalf("expected state untouched without confirmation, got %+v", pkgs)
+	}
+
+	result, err := m.Repair(ctx, RepairRequest{Yes: true})
+	if err != nil {
+		t.Fatalf("Repair: %v", err)
+	}
+	if !result.Applied || len(result.Recovered) != 2 {
+		t.Fatalf("expected alpha and beta recovered, got %+v", result)
+	}
+	st, err := m.store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	alpha := st.Installed["alpha"]
+	if alpha.Source.Type != model.SourceTypeUnknown || alpha.Version != RepairVersion {
+		t.Errorf("expected alpha marked as unknown source, got %+v", alpha)
+	}
+	if len(alpha.Targets) != 2 || alpha.Targets[0] != model.TargetClaude || alpha.Targets[1] != model.TargetCodex {
+		t.Errorf("expected alpha targets [claude codex], got %v", alpha.Targets)
+	}
+	if beta := st.Installed["beta"]; len(beta.Targets) != 1 || beta.Targets[0] != model.TargetClaude {
+		t.Errorf("expected beta only in claude, got %+v", beta)
+	}
+	if st.Installed["kept"].Source.Type != model.SourceTypeTap {
+		t.Errorf("expected the recorded package kept as is, got %+v", st.Installed["kept"])
+	}
+
+	for _, name := range []string{"alpha", "beta"} {
+		issues, err := m.Doctor(ctx, DoctorRequest{Package: name})
+		if err != nil || len(issues) != 0 {
+			t.Fatalf("expected a clean doctor for %s after repair, got %+v, %v", name, issues, err)
+		}
+	}
+	if _, err := m.Remove(ctx, RemoveRequest{Name: "alpha"}); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if _, ok := codex.servers["alpha"]; ok {
+		t.Error("expected alpha removed from codex")
+	}
+	if _, ok := claude.servers["alpha"]; ok {
+		t.Error("expected alpha removed from claude")
+	}
+}
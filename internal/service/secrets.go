@@ -0,0 +1,102 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+
+	"github.com/zalando/go-keyring"
+
+	"github.com/sarjann/mcper/internal/model"
+)
+
+// OrphanedSecret is a keychain entry mcper stored for a package that is no
+// longer installed.
+type OrphanedSecret struct {
+	Package string `json:"package"`
+	Key     string `json:"key"`
+}
+
+// SecretPrune lists the secrets mcper recorded for packages that are not
+// installed and, unless dryRun is set, deletes them. Only keys in state are
+// considered; other entries in the keychain are never touched. A key already
+// missing from the keychain counts as pruned. Failed deletions stay recorded
+// and are returned as an error after the rest are pruned.
+func (m *Manager) SecretPrune(dryRun bool) ([]OrphanedSecret, error) {
+	st, err := m.store.Load()
+	if err != nil {
+		return nil, err
+	}
+	pkgs := make([]string, 0, len(st.RetainedSecrets))
+	for pkg := range st.RetainedSecrets {
+		if _, ok := st.Installed[pkg]; !ok {
+			pkgs = append(pkgs, pkg)
+		}
+	}
+	sort.Strings(pkgs)
+
+	var out []OrphanedSecret
+	var errs []error
+	for _, pkg := range pkgs {
+		for _, key := range slices.Clone(st.RetainedSecrets[pkg]) {
+			if !dryRun {
+				if err := m.secret.Delete(pkg, key); err != nil && !errors.Is(err, keyring.ErrNotFound) {
+					errs = append(errs, err)
+					continue
+				}
+				forgetRetainedSecret(&st, pkg, key)
+			}
+			out = append(out, OrphanedSecret{Package: pkg, Key: key})
+		}
+	}
+	if !dryRun && len(out) > 0 {
+		if err := m.store.Save(st); err != nil {
+			return out, err
+		}
+	}
+	if len(errs) > 0 {
+		return out, fmt.Errorf("prune secrets: %w", errors.Join(errs...))
+	}
+	return out, nil
+}
+
+// retainSecrets records keys stored for a package that is not installed, so
+// secret prune can find them later.
+func retainSecrets(st *model.State, pkg string, keys ...string) {
+	if len(keys) == 0 {
+		return
+	}
+	if st.RetainedSecrets == nil {
+		st.RetainedSecrets = make(map[string][]string)
+	}
+	st.RetainedSecrets[pkg] = mergeSecretKeys(st.RetainedSecrets[pkg], keys...)
+}
+
+// adoptRetainedSecrets moves a package's retained keys onto its install
+// record when it is installed again, returning the merged key list.
+func adoptRetainedSecrets(st *model.State, pkg string, keys []string) []string {
+	retained, ok := st.RetainedSecrets[pkg]
+	if !ok {
+		return keys
+	}
+	delete(st.RetainedSecrets, pkg)
+	return mergeSecretKeys(keys, retained...)
+}
+
+// forgetRetainedSecret drops one retained key, reporting whether it was
+// recorded.
+func forgetRetainedSecret(st *model.State, pkg, key string) bool {
+	keys := st.RetainedSecrets[pkg]
+	i := slices.Index(keys, key)
+	if i < 0 {
+		return false
+	}
+	keys = slices.Delete(keys, i, i+1)
+	if len(keys) == 0 {
+		delete(st.RetainedSecrets, pkg)
+	} else {
+		st.RetainedSecrets[pkg] = keys
+	}
+	return true
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sarjann/mcper/internal/adapters"
+	"github.com/sarjann/mcper/internal/model"
+)
+
+func TestSecretPruneRemovedPackage(t *testing.T) {
+	ctx := context.Background()
+	m, _ := newInstallTestManager(t, writeTestTap(t, testManifest("gone", "1.0.0"), testManifest("kept", "1.0.0")), map[string]adapters.Adapter{
+		model.TargetCodex: newStub("codex", nil),
+	})
+	for _, name := range []string{"gone", "kept"} {
+		if _, err := m.InstallFromTap(ctx, InstallRequest{Name: name, Force: true}); err != nil {
+			t.Fatalf("InstallFromTap(%s): %v", name, err)
+		}
+		if err := m.SecretSet(name, "API_TOKEN", "tok"); err != nil {
+			t.Fatalf("SecretSet(%s): %v", name, err)
+		}
+	}
+	if _, err := m.Remove(ctx, RemoveRequest{Name: "gone", KeepSecrets: true}); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	// Never recorded by mcper, so prune must leave it alone.
+	if err := m.secret.Set("stray", "API_TOKEN", "tok"); err != nil {
+		t.Fatal(err)
+	}
+
+	orphans, err := m.SecretPrune(true)
+	if err != nil {
+		t.Fatalf("SecretPrune(dry run): %v", err)
+	}
+	if len(orphans) != 1 || orphans[0] != (OrphanedSecret{Package: "gone", Key: "API_TOKEN"}) {
+		t.Fatalf("expected only gone/API_TOKEN reported, got %+v", orphans)
+	}
+	if _, err := m.secret.Get("gone", "API_TOKEN"); err != nil {
+		t.Fatalf("dry run deleted the secret: %v", err)
+	}
+
+	if _, err := m.SecretPrune(false); err != nil {
+		t.Fatalf("SecretPrune: %v", err)
+	}
+	if _, err := m.secret.Get("gone", "API_TOKEN"); err == nil {
+		t.Error("expected gone/API_TOKEN deleted")
+	}
+	for _, pkg := range []string{"kept", "stray"} {
+		if _, err := m.secret.Get(pkg, "API_TOKEN"); err != nil {
+			t.Errorf("expected %s/API_TOKEN untouched, got %v", pkg, err)
+		}
+	}
+	st, err := m.store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(st.RetainedSecrets) != 0 {
+		t.Errorf("expected pruned keys forgotten, got %v", st.RetainedSecrets)
+	}
+}
+
+func TestSecretSetBeforeInstallSurvivesPrune(t *testing.T) {
+	m, _ := newInstallTestManager(t, writeTestTap(t, testManifest("demo", "1.0.0")), map[string]adapters.Adapter{
+		model.TargetCodex: newStub("codex", nil),
+	})
+	if err := m.SecretSet("demo", "API_TOKEN", "tok"); err != nil {
+		t.Fatalf("SecretSet: %v", err)
+	}
+	if orphans, err := m.SecretPrune(false); err != nil || len(orphans) != 0 {
+		t.Fatalf("expected a secret set ahead of install left alone, got %+v, %v", orphans, err)
+	}
+	if _, err := m.secret.Get("demo", "API_TOKEN"); err != nil {
+		t.Fatalf("expected the pre-install secret kept: %v", err)
+	}
+	if _, err := m.InstallFromTap(context.Background(), InstallRequest{Name: "demo", Force: true}); err != nil {
+		t.Fatalf("InstallFromTap: %v", err)
+	}
+	if got, err := m.secret.Get("demo", "API_TOKEN"); err != nil || got != "tok" {
+		t.Errorf("expected the secret available after install, got %q, %v", got, err)
+	}
+}
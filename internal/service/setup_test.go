@@ -3,12 +3,13 @@ package service
 import (
 	"bytes"
 	"context"
-	"fmt"
 	"runtime"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/zalando/go-keyring"
+
 	"github.com/sarjann/mcper/internal/model"
 )
 
@@ -29,7 +30,7 @@ func (s *stubSecretStore) Set(pkg, key, value string) error {
 func (s *stubSecretStore) Get(pkg, key string) (string, error) {
 	v, ok := s.data[pkg+"/"+key]
 	if !ok {
-		return "", fmt.Errorf("secret not found")
+		return "", keyring.ErrNotFound
 	}
 	return v, nil
 }
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/sarjann/mcper/internal/registry"
+)
+
+// TapStaleAfter is how old a git tap's cache may get before status flags it.
+const TapStaleAfter = 7 * 24 * time.Hour
+
+// TapStatus summarizes one configured tap.
+type TapStatus struct {
+	Name       string     `json:"name"`
+	URL        string     `json:"url"`
+	LastSynced *time.Time `json:"last_synced,omitempty"`
+	Stale      bool       `json:"stale"`
+}
+
+// Status is the one-shot overview printed by `mcper status`.
+type Status struct {
+	Installed       int         `json:"installed"`
+	DetectedClients []string    `json:"detected_clients"`
+	Taps            []TapStatus `json:"taps"`
+	DoctorIssues    int         `json:"doctor_issues"`
+	DoctorError     string      `json:"doctor_error,omitempty"`
+}
+
+// Status aggregates installed packages, detected clients, taps and the
+// doctor issue count. A failing doctor run is reported in the result rather
+// than failing the whole summary.
+func (m *Manager) Status(ctx context.Context) (Status, error) {
+	pkgs, err := m.ListInstalled()
+	if err != nil {
+		return Status{}, err
+	}
+	taps, err := m.TapList()
+	if err != nil {
+		return Status{}, err
+	}
+
+	status := Status{
+		Installed:       len(pkgs),
+		DetectedClients: make([]string, 0),
+		Taps:            make([]TapStatus, 0, len(taps)),
+	}
+	for _, c := range m.Detect() {
+		if c.Detected && c.AdapterOK {
+			status.DetectedClients = append(status.DetectedClients, c.Target)
+		}
+	}
+	now := time.Now()
+	for _, tap := range taps {
+		ts := TapStatus{Name: tap.Name, URL: tap.URL}
+		if synced, ok := registry.LastSynced(tap); ok {
+			ts.LastSynced = &synced
+			ts.Stale = now.Sub(synced) > TapStaleAfter
+		}
+		status.Taps = append(status.Taps, ts)
+	}
+
+	issues, err := m.Doctor(ctx, DoctorRequest{})
+	if err != nil {
+		status.DoctorError = err.Error()
+	} else {
+		status.DoctorIssues = len(issues)
+	}
+	return status, nil
+}
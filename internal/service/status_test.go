@@ -0,0 +1,88 @@
+package service
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sarjann/mcper/internal/adapters"
+	"github.com/sarjann/mcper/internal/model"
+	"github.com/sarjann/mcper/internal/paths"
+)
+
+func TestStatus_SummarizesSeededState(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	if err := os.MkdirAll(filepath.Join(home, ".codex"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	mf := testManifest("demo", "1.0.0")
+	mf.MCPServers["demo"] = model.MCPServerSpec{Transport: model.ServerTransportSTDIO, Command: "go", Args: []string{"version"}}
+	stub := newStub("codex", nil)
+	m, _ := newInstallTestManager(t, writeTestTap(t, mf), map[string]adapters.Adapter{
+		model.TargetCodex: stub,
+	})
+	ctx := context.Background()
+	if _, err := m.InstallFromTap(ctx, InstallRequest{Name: "demo", Force: true}); err != nil {
+		t.Fatalf("InstallFromTap failed: %v", err)
+	}
+	// Drop the server from the client so doctor has one thing to report.
+	delete(stub.servers, "demo")
+
+	// A git tap whose cache was last refreshed a month ago.
+	st, err := m.store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.Taps["team"] = model.TapConfig{Name: "team", URL: "https://example.com/team.git"}
+	if err := m.store.Save(st); err != nil {
+		t.Fatal(err)
+	}
+	cacheDir, err := paths.TapCacheDir("team")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(cacheDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	index := filepath.Join(cacheDir, "index.json")
+	if err := os.WriteFile(index, []byte(`{"schema_version":1,"packages":{}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-30 * 24 * time.Hour)
+	if err := os.Chtimes(index, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	status, err := m.Status(ctx)
+	if err != nil {
+		t.Fatalf("Status failed: %v", err)
+	}
+	if status.Installed != 1 {
+		t.Errorf("expected 1 installed package, got %d", status.Installed)
+	}
+	if len(status.DetectedClients) != 1 || status.DetectedClients[0] != model.TargetCodex {
+		t.Errorf("expected codex detected, got %v", status.DetectedClients)
+	}
+	if status.DoctorIssues != 1 || status.DoctorError != "" {
+		t.Errorf("expected one doctor issue, got %d (%s)", status.DoctorIssues, status.DoctorError)
+	}
+	if len(status.Taps) != 2 {
+		t.Fatalf("expected 2 taps, got %+v", status.Taps)
+	}
+	for _, tap := range status.Taps {
+		switch tap.Name {
+		case model.DefaultTapName:
+			if tap.LastSynced != nil || tap.Stale {
+				t.Errorf("expected local tap to have no sync time, got %+v", tap)
+			}
+		case "team":
+			if tap.LastSynced == nil || !tap.Stale {
+				t.Errorf("expected team tap to be stale, got %+v", tap)
+			}
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package service
+
+import "github.com/sarjann/mcper/internal/registry"
+
+// ManifestValidation is the outcome of checking a manifest without
+// installing it. Errors and Warnings are never nil, so JSON output always
+// carries both lists.
+type ManifestValidation struct {
+	Valid    bool     `json:"valid"`
+	Name     string   `json:"name,omitempty"`
+	Version  string   `json:"version,omitempty"`
+	Errors   []string `json:"errors"`
+	Warnings []string `json:"warnings"`
+}
+
+// ValidateManifest decodes and validates manifest bytes the way install
+// does, touching neither the network nor state. origin names the input in
+// messages.
+func ValidateManifest(data []byte, origin string) ManifestValidation {
+	result := ManifestValidation{Errors: []string{}, Warnings: []string{}}
+	resolved, err := registry.ResolveManifest(data, origin)
+	if err != nil {
+		result.Errors = append(result.Errors, err.Error())
+		return result
+	}
+	result.Valid = true
+	result.Name = resolved.Manifest.Name
+	result.Version = resolved.Version
+	result.Warnings = append(result.Warnings, resolved.Warnings...)
+	return result
+}
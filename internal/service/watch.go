@@ -0,0 +1,131 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	defaultWatchInterval = 500 * time.Millisecond
+	defaultWatchDebounce = 300 * time.Millisecond
+)
+
+// WatchRequest re-installs a local manifest every time it changes.
+type WatchRequest struct {
+	Path           string
+	Target         string
+	ServerTargets  map[string]string
+	KeepBackups    int
+	InlineSecrets  bool
+	IncludeTargets []string
+	ExcludeTargets []string
+	// Force overwrites servers of the same name that the package did not
+	// write without asking.
+	Force bool
+	// Interval is how often the file is checked for changes.
+	Interval time.Duration
+	// Debounce is how long the file must stay unchanged before a change is
+	// applied, so an editor's save-in-several-writes installs once.
+	Debounce time.Duration
+}
+
+// Watch installs the manifest at req.Path, then installs it again after each
+// change until ctx is canceled, printing the plan every time. Changes to the
+// package's own servers are applied without asking; overwriting a server it
+// did not write asks first, as install does, unless req.Force is set. A
+// failed install is reported and the watch goes on, as a half-edited
+// manifest is expected.
+func (m *Manager) Watch(ctx context.Context, req WatchRequest) error {
+	if _, err := os.Stat(req.Path); err != nil {
+		return fmt.Errorf("watch manifest: %w", err)
+	}
+	interval := req.Interval
+	if interval <= 0 {
+		interval = defaultWatchInterval
+	}
+	return m.watch(ctx, req, pollFile(ctx, req.Path, interval))
+}
+
+// watch applies the manifest once and then after each debounced event. It
+// returns nil when ctx is canceled or events is closed.
+func (m *Manager) watch(ctx context.Context, req WatchRequest, events <-chan struct{}) error {
+	debounce := req.Debounce
+	if debounce <= 0 {
+		debounce = defaultWatchDebounce
+	}
+	m.applyWatched(ctx, req)
+	fmt.Fprintf(m.stdout, "Watching %s for changes (Ctrl+C to stop)\n", req.Path)
+
+	timer := time.NewTimer(debounce)
+	timer.Stop()
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case _, ok := <-events:
+			if !ok {
+				return nil
+			}
+			timer.Reset(debounce)
+		case <-timer.C:
+			m.applyWatched(ctx, req)
+		}
+	}
+}
+
+func (m *Manager) applyWatched(ctx context.Context, req WatchRequest) {
+	installed, err := m.installFile(ctx, InstallFileRequest{
+		Path:           req.Path,
+		Target:         req.Target,
+		ServerTargets:  req.ServerTargets,
+		Force:          req.Force,
+		KeepBackups:    req.KeepBackups,
+		InlineSecrets:  req.InlineSecrets,
+		IncludeTargets: req.IncludeTargets,
+		ExcludeTargets: req.ExcludeTargets,
+	}, true)
+	if err != nil {
+		fmt.Fprintf(m.stdout, "install %s failed: %v\n", req.Path, err)
+		return
+	}
+	fmt.Fprintf(m.stdout, "Installed %s@%s targets=%s\n", installed.Name, installed.Version, strings.Join(installed.Targets, ","))
+}
+
+// pollFile sends on the returned channel whenever the file's size or
+// modification time changes, checking every interval. A file that goes
+// missing counts as a change once it reappears. The channel is closed when
+// ctx is done.
+func pollFile(ctx context.Context, path string, interval time.Duration) <-chan struct{} {
+	events := make(chan struct{}, 1)
+	go func() {
+		defer close(events)
+		last, _ := os.Stat(path)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			info, err := os.Stat(path)
+			if err != nil {
+				last = nil
+				continue
+			}
+			if last != nil && info.Size() == last.Size() && info.ModTime().Equal(last.ModTime()) {
+				continue
+			}
+			last = info
+			select {
+			case events <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	return events
+}
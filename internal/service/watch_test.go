@@ -0,0 +1,98 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sarjann/mcper/internal/adapters"
+	"github.com/sarjann/mcper/internal/model"
+)
+
+// notifyingStub signals every completed UpsertServers call.
+type notifyingStub struct {
+	*stubAdapter
+	applied chan struct{}
+}
+
+func (s notifyingStub) UpsertServers(ctx context.Context, servers map[string]model.MCPServerSpec) error {
+	err := s.stubAdapter.UpsertServers(ctx, servers)
+	s.applied <- struct{}{}
+	return err
+}
+
+func TestWatchReappliesOnChange(t *testing.T) {
+	mf := testManifest("demo", "1.0.0")
+	path, _ := writeTestManifest(t, mf)
+	codex := newStub("codex", nil)
+	stub := notifyingStub{stubAdapter: codex, applied: make(chan struct{}, 1)}
+	m, buf := newInstallTestManager(t, writeTestTap(t), map[string]adapters.Adapter{
+		model.TargetCodex: stub,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- m.watch(ctx, WatchRequest{Path: path, Debounce: time.Millisecond}, events)
+	}()
+	<-stub.applied
+	if got := codex.servers["demo"].Args; len(got) != 2 || got[1] != "demo" {
+		t.Fatalf("expected initial install, got args %v", got)
+	}
+
+	mf.MCPServers["demo"] = model.MCPServerSpec{Transport: model.ServerTransportSTDIO, Command: "npx", Args: []string{"-y", "demo@next"}}
+	data, err := json.Marshal(mf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	events <- struct{}{}
+	<-stub.applied
+	if got := codex.servers["demo"].Args; len(got) != 2 || got[1] != "demo@next" {
+		t.Fatalf("expected change re-applied, got args %v", got)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("watch returned %v after cancel", err)
+	}
+	out := buf.String()
+	if strings.Count(out, "The following changes will be applied:") != 2 || !strings.Contains(out, "- command: npx -y demo\n") {
+		t.Errorf("expected the plan printed for each apply, got:\n%s", out)
+	}
+}
+
+func TestWatchAsksBeforeOverwritingForeignServer(t *testing.T) {
+	path, _ := writeTestManifest(t, testManifest("demo", "1.0.0"))
+	foreign := model.MCPServerSpec{Transport: model.ServerTransportSTDIO, Command: "uvx", Args: []string{"someone-else"}}
+	codex := newStub("codex", map[string]model.MCPServerSpec{"demo": foreign})
+	m, buf := newInstallTestManager(t, writeTestTap(t), map[string]adapters.Adapter{
+		model.TargetCodex: codex,
+	})
+	ctx := context.Background()
+
+	m.applyWatched(ctx, WatchRequest{Path: path})
+	if got := codex.servers["demo"]; got.Command != "uvx" {
+		t.Fatalf("expected the foreign server left alone without confirmation, got %+v", got)
+	}
+	out := buf.String()
+	if !strings.Contains(out, `server "demo" already exists in codex config`) || !strings.Contains(out, "failed") {
+		t.Errorf("expected the conflict reported and the install refused, got:\n%s", out)
+	}
+
+	m.applyWatched(ctx, WatchRequest{Path: path, Force: true})
+	if got := codex.servers["demo"]; got.Command != "npx" {
+		t.Fatalf("expected --force to overwrite the server, got %+v", got)
+	}
+	// Once the package wrote the server, later changes apply without asking.
+	m.applyWatched(ctx, WatchRequest{Path: path})
+	if strings.Count(buf.String(), "Installed demo@1.0.0") != 2 {
+		t.Errorf("expected the package's own server re-applied, got:\n%s", buf.String())
+	}
+}
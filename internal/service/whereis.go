@@ -0,0 +1,49 @@
+package service
+
+import (
+	"sort"
+
+	"github.com/sarjann/mcper/internal/paths"
+)
+
+// ClientLocation is the config file mcper writes for one detected client.
+type ClientLocation struct {
+	Target string `json:"target"`
+	Path   string `json:"path"`
+}
+
+// Locations lists where mcper keeps its files, as resolved for this process.
+type Locations struct {
+	StateFile string           `json:"state_file"`
+	ConfigDir string           `json:"config_dir"`
+	CacheDir  string           `json:"cache_dir"`
+	BackupDir string           `json:"backup_dir"`
+	Clients   []ClientLocation `json:"clients"`
+}
+
+func (m *Manager) Locations() (Locations, error) {
+	configDir, err := paths.ConfigDir()
+	if err != nil {
+		return Locations{}, err
+	}
+	cacheDir, err := paths.CacheDir()
+	if err != nil {
+		return Locations{}, err
+	}
+	backupDir, err := paths.BackupDir()
+	if err != nil {
+		return Locations{}, err
+	}
+	loc := Locations{
+		StateFile: m.store.Path(),
+		ConfigDir: configDir,
+		CacheDir:  cacheDir,
+		BackupDir: backupDir,
+		Clients:   make([]ClientLocation, 0, len(m.adapters)),
+	}
+	for target, adapter := range m.adapters {
+		loc.Clients = append(loc.Clients, ClientLocation{Target: target, Path: adapter.Path()})
+	}
+	sort.Slice(loc.Clients, func(i, j int) bool { return loc.Clients[i].Target < loc.Clients[j].Target })
+	return loc, nil
+}
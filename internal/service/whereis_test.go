@@ -0,0 +1,29 @@
+package service
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/sarjann/mcper/internal/adapters"
+	"github.com/sarjann/mcper/internal/model"
+)
+
+func TestLocations(t *testing.T) {
+	m, _ := newInstallTestManager(t, t.TempDir(), map[string]adapters.Adapter{
+		model.TargetCodex:  newStub("codex", nil),
+		model.TargetClaude: newStub("claude", nil),
+	})
+	loc, err := m.Locations()
+	if err != nil {
+		t.Fatalf("Locations failed: %v", err)
+	}
+	if loc.StateFile != m.store.Path() {
+		t.Errorf("expected state file %s, got %s", m.store.Path(), loc.StateFile)
+	}
+	if filepath.Dir(loc.StateFile) != loc.ConfigDir || filepath.Dir(loc.BackupDir) != loc.ConfigDir {
+		t.Errorf("expected state and backups under %s, got %+v", loc.ConfigDir, loc)
+	}
+	if len(loc.Clients) != 2 || loc.Clients[0].Target != model.TargetClaude || loc.Clients[1].Path != "/tmp/codex" {
+		t.Errorf("unexpected clients %+v", loc.Clients)
+	}
+}
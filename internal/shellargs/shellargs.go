@@ -0,0 +1,69 @@
+// Package shellargs splits a command-line string into arguments the way a
+// POSIX shell would, without expanding variables or globs.
+package shellargs
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrUnterminated is returned for a string that ends inside quotes or after
+// a trailing backslash.
+var ErrUnterminated = errors.New("unterminated quote or escape")
+
+// Split breaks s on unquoted whitespace. Single quotes keep everything up to
+// the closing quote literally; double quotes allow backslash to escape ",
+// \, $ and `; outside quotes a backslash escapes any character.
+func Split(s string) ([]string, error) {
+	var (
+		args    []string
+		cur     strings.Builder
+		inArg   bool
+		quote   rune
+		escaped bool
+	)
+	for _, r := range s {
+		switch {
+		case escaped:
+			if quote == '"' && !strings.ContainsRune("\"\\$`", r) {
+				cur.WriteRune('\\')
+			}
+			cur.WriteRune(r)
+			escaped = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				cur.WriteRune(r)
+			}
+		case r == '\\':
+			escaped = true
+			inArg = true
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else {
+				cur.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inArg = true
+		case r == ' ' || r == '\t' || r == '\n' || r == '\r':
+			if inArg {
+				args = append(args, cur.String())
+				cur.Reset()
+				inArg = false
+			}
+		default:
+			cur.WriteRune(r)
+			inArg = true
+		}
+	}
+	if escaped || quote != 0 {
+		return nil, ErrUnterminated
+	}
+	if inArg {
+		args = append(args, cur.String())
+	}
+	return args, nil
+}
@@ -0,0 +1,39 @@
+package shellargs
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"", nil},
+		{"  -y  demo-mcp ", []string{"-y", "demo-mcp"}},
+		{`--root "/tmp/my dir" --name 'a "b"'`, []string{"--root", "/tmp/my dir", "--name", `a "b"`}},
+		{`a\ b "c\"d" "e\f"`, []string{"a b", `c"d`, `e\f`}},
+		{`--empty ""`, []string{"--empty", ""}},
+		{`pre"mid"post`, []string{"premidpost"}},
+	}
+	for _, tt := range tests {
+		got, err := Split(tt.in)
+		if err != nil {
+			t.Errorf("Split(%q) failed: %v", tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Split(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSplitUnterminated(t *testing.T) {
+	for _, in := range []string{`"open`, `'open`, `trailing\`} {
+		if _, err := Split(in); !errors.Is(err, ErrUnterminated) {
+			t.Errorf("Split(%q) error = %v, want ErrUnterminated", in, err)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package state
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -103,6 +104,16 @@ func (s *Store) Save(st model.State) error {
 	return nil
 }
 
+// Lock takes the store's exclusive lock, which is shared across mcper
+// processes, and waits until it is free or ctx is done. The returned func
+// releases it.
+func (s *Store) Lock(ctx context.Context) (func(), error) {
+	if err := paths.EnsureDirDirOf(s.path); err != nil {
+		return nil, err
+	}
+	return fsutil.Lock(ctx, s.path+".lock")
+}
+
 func (s *Store) MustLoad() model.State {
 	st, err := s.Load()
 	if err != nil {
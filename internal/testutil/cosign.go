@@ -0,0 +1,46 @@
+// Package testutil holds test helpers shared by several packages.
+package testutil
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// FakeCosign puts a cosign stub first on PATH whose verify-blob accepts only
+// certificates for identity. Any other identity fails with "none of the
+// expected identities matched" on stderr, as cosign does.
+func FakeCosign(t testing.TB, identity string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake cosign requires a POSIX shell")
+	}
+	binDir := t.TempDir()
+	script := `#!/bin/sh
+case "$*" in
+*"--certificate-identity ` + identity + ` "*) exit 0 ;;
+esac
+echo "error: none of the expected identities matched" >&2
+exit 1
+`
+	if err := os.WriteFile(filepath.Join(binDir, "cosign"), []byte(script), 0o755); err != nil {
+		t.Fatalf("write fake cosign: %v", err)
+	}
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+// SignatureFiles writes placeholder signature and certificate files for
+// FakeCosign to be pointed at and returns their paths.
+func SignatureFiles(t testing.TB) (sigPath, certPath string) {
+	t.Helper()
+	dir := t.TempDir()
+	sigPath = filepath.Join(dir, "manifest.sig")
+	certPath = filepath.Join(dir, "manifest.pem")
+	for _, path := range []string{sigPath, certPath} {
+		if err := os.WriteFile(path, []byte("stub"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return sigPath, certPath
+}
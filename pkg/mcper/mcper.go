@@ -0,0 +1,82 @@
+// Package mcper lets other Go programs install and manage MCP server
+// packages the way the mcper command does. It re-exports the manager and
+// the types its install, upgrade, remove, reinstall, doctor, search, tap
+// and trust methods take and return; the other Manager methods back CLI
+// commands and take types that are not exported here.
+package mcper
+
+import (
+	"github.com/sarjann/mcper/internal/adapters"
+	"github.com/sarjann/mcper/internal/model"
+	"github.com/sarjann/mcper/internal/registry"
+	"github.com/sarjann/mcper/internal/secrets"
+	"github.com/sarjann/mcper/internal/service"
+)
+
+// Manager and the options it is built from.
+type (
+	Manager = service.Manager
+	Options = service.ManagerOptions
+)
+
+// Dependencies Options can swap out.
+type (
+	// Adapter reads and writes the MCP servers in one client's config.
+	Adapter = adapters.Adapter
+	// RegistryClient resolves packages in taps and at URLs.
+	RegistryClient = service.RegistryClient
+	// SecretStore holds package secrets; the default is the OS keyring.
+	SecretStore = secrets.Store
+)
+
+// Requests and results of the Manager methods.
+type (
+	InstallRequest     = service.InstallRequest
+	InstallURLRequest  = service.InstallURLRequest
+	InstallFileRequest = service.InstallFileRequest
+	InstallPreview     = service.InstallPreview
+	RemoveRequest      = service.RemoveRequest
+	RemoveResult       = service.RemoveResult
+	UpgradeRequest     = service.UpgradeRequest
+	UpgradeResult      = service.UpgradeResult
+	ReinstallRequest   = service.ReinstallRequest
+	ReinstallResult    = service.ReinstallResult
+	DoctorRequest      = service.DoctorRequest
+	DoctorResult       = service.DoctorResult
+	DoctorIssue        = service.DoctorIssue
+	TapAddRequest      = service.TapAddRequest
+)
+
+// Packages, taps and what the registry resolves.
+type (
+	MCPServerSpec     = model.MCPServerSpec
+	PackageManifest   = model.PackageManifest
+	InstalledPackage  = model.InstalledPackage
+	SourceRef         = model.SourceRef
+	TapConfig         = model.TapConfig
+	TrustDecision     = model.TrustDecision
+	ResolvedPackage   = registry.ResolvedPackage
+	SearchResult      = registry.SearchResult
+	VersionInfo       = registry.VersionInfo
+	TapSnapshot       = registry.TapSnapshot
+	TapCheck          = registry.TapCheck
+	DetachedSignature = registry.DetachedSignature
+)
+
+// Errors the Manager methods wrap, for matching with errors.Is.
+var (
+	ErrPackageNotFound = service.ErrPackageNotFound
+	ErrNotInstalled    = service.ErrNotInstalled
+	ErrTapNotFound     = service.ErrTapNotFound
+	ErrConflict        = service.ErrConflict
+	ErrTrustRequired   = service.ErrTrustRequired
+	ErrTrustNotFound   = service.ErrTrustNotFound
+)
+
+// NewManager returns a manager built from opts. Zero-valued fields keep
+// the defaults the mcper command uses: os.Stdin and os.Stdout, the detected
+// clients, the registry client and the OS keyring. State and caches live in
+// the same places as for the command.
+func NewManager(opts Options) (*Manager, error) {
+	return service.NewManagerWithOptions(opts)
+}
@@ -0,0 +1,107 @@
+package mcper_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sarjann/mcper/pkg/mcper"
+)
+
+// memoryAdapter keeps a client's servers in memory, as an embedder's own
+// Adapter might.
+type memoryAdapter struct {
+	servers map[string]mcper.MCPServerSpec
+}
+
+func (a *memoryAdapter) Name() string { return "memory" }
+func (a *memoryAdapter) Path() string { return "memory" }
+func (a *memoryAdapter) UpsertServers(_ context.Context, specs map[string]mcper.MCPServerSpec) error {
+	for name, spec := range specs {
+		a.servers[name] = spec
+	}
+	return nil
+}
+func (a *memoryAdapter) RemoveServers(_ context.Context, names []string) error {
+	for _, name := range names {
+		delete(a.servers, name)
+	}
+	return nil
+}
+func (a *memoryAdapter) ListServers(context.Context) (map[string]mcper.MCPServerSpec, error) {
+	return a.servers, nil
+}
+
+func TestEmbedderInstallsAndRemoves(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(tmp, "config"))
+	t.Setenv("XDG_CACHE_HOME", filepath.Join(tmp, "cache"))
+	path := filepath.Join(tmp, "manifest.json")
+	manifest := `{"schema_version":1,"name":"demo","version":"1.0.0","mcp_servers":{"demo":{"transport":"http","url":"https://example.com/mcp"}}}`
+	if err := os.WriteFile(path, []byte(manifest), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	client := &memoryAdapter{servers: map[string]mcper.MCPServerSpec{}}
+	m, err := mcper.NewManager(mcper.Options{
+		Stdout:   &bytes.Buffer{},
+		Adapters: map[string]mcper.Adapter{"codex": client},
+		NoBackup: true,
+	})
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+	ctx := context.Background()
+	installed, err := m.InstallFromFile(ctx, mcper.InstallFileRequest{Path: path, Force: true})
+	if err != nil {
+		t.Fatalf("InstallFromFile: %v", err)
+	}
+	if installed.Name != "demo" || client.servers["demo"].URL != "https://example.com/mcp" {
+		t.Fatalf("expected demo written through the embedder's adapter, got %+v, %v", installed, client.servers)
+	}
+	if _, err := m.Remove(ctx, mcper.RemoveRequest{Name: "demo"}); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if len(client.servers) != 0 {
+		t.Errorf("expected demo removed, got %v", client.servers)
+	}
+}
+
+func TestEmbedderAnswersConflictPromptThroughStdin(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(tmp, "config"))
+	t.Setenv("XDG_CACHE_HOME", filepath.Join(tmp, "cache"))
+	path := filepath.Join(tmp, "manifest.json")
+	manifest := `{"schema_version":1,"name":"demo","version":"1.0.0","mcp_servers":{"demo":{"transport":"http","url":"https://example.com/mcp"}}}`
+	if err := os.WriteFile(path, []byte(manifest), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// A server of the same name the embedder's user added by hand.
+	client := &memoryAdapter{servers: map[string]mcper.MCPServerSpec{
+		"demo": {Transport: "http", URL: "https://example.com/other"},
+	}}
+	var out bytes.Buffer
+	m, err := mcper.NewManager(mcper.Options{
+		Stdin:         strings.NewReader("yes\n"),
+		Stdout:        &out,
+		Adapters:      map[string]mcper.Adapter{"codex": client},
+		NoBackup:      true,
+		IsInteractive: func() bool { return true },
+	})
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+	if _, err := m.InstallFromFile(context.Background(), mcper.InstallFileRequest{Path: path}); err != nil {
+		t.Fatalf("InstallFromFile: %v", err)
+	}
+	if !strings.Contains(out.String(), "Proceed?") {
+		t.Errorf("expected the conflict prompt, got %q", out.String())
+	}
+	if client.servers["demo"].URL != "https://example.com/mcp" {
+		t.Errorf("expected the answered prompt to overwrite demo, got %+v", client.servers["demo"])
+	}
+}